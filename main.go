@@ -1,15 +1,139 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	_ "github.com/bonyuta0204/mcp-mysql-client/pkg/datastore" // Import for side effects (init)
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/auth"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/cache"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/config"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/dataprofile"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/dump"
 	"github.com/bonyuta0204/mcp-mysql-client/pkg/handlers"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/history"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/optionfile"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/ratelimit"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sampling"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/savedqueries"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/session"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/snapshot"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
 func main() {
+	historyFile := flag.String("history-file", "", "JSON file used to persist the query history across restarts")
+	historyLimit := flag.Int("history-limit", history.DefaultLimit, "Maximum number of statements kept in the query history")
+	savedQueriesDir := flag.String("saved-queries", "", "Directory of .sql files exposed as saved query tools")
+	cacheTTL := flag.Duration("cache-ttl", 0, "Time to live of cached results of deterministic read queries, caching is disabled when 0")
+	cacheSize := flag.Int("cache-size", 256, "Maximum number of cached query results")
+	cacheMaxBytes := flag.Int("cache-max-bytes", 16<<20, "Maximum total size in bytes of cached query results")
+	dumpDir := flag.String("dump-dir", "", "Directory dump files are written to, dumps are returned inline when not set")
+	snapshotDir := flag.String("snapshot-dir", "", "Directory schema snapshots are saved to and loaded from at startup, to answer schema questions while disconnected")
+	schemaCheckInterval := flag.Duration("schema-check-interval", 0, "Minimum time between checks of information_schema for schema changes, checked on every call when 0")
+	healthCheckInterval := flag.Duration("health-check-interval", datastore.DefaultHealthCheck.Interval, "Interval between health checks of MySQL connections, monitoring and automatic reconnection are disabled when 0")
+	reconnectAttempts := flag.Int("reconnect-attempts", datastore.DefaultHealthCheck.MaxAttempts, "Number of reconnection attempts before a lost connection is reported as failed")
+	transport := flag.String("transport", "stdio", "Transport used to serve MCP clients: stdio or sse")
+	addr := flag.String("addr", ":8080", "Address the HTTP server listens on when using the sse transport")
+	baseURL := flag.String("base-url", "", "Public base URL of the server announced to sse clients, such as https://mcp.example.com")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file, serves HTTPS when set together with -tls-key")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "Time allowed for open requests to finish on shutdown")
+	configFile := flag.String("config", "", "YAML or JSON file with connection profiles, users and roles")
+	defaultsFile := flag.String("defaults-file", "", "MySQL option file read for connection defaults instead of the standard ones such as ~/.my.cnf")
+	noDefaults := flag.Bool("no-defaults", false, "Do not read connection defaults from MySQL option files")
+	flag.Parse()
+
+	if *transport != "stdio" && *transport != "sse" {
+		fmt.Fprintf(os.Stderr, "Unknown transport %q, expected stdio or sse\n", *transport)
+		os.Exit(2)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintln(os.Stderr, "Both -tls-cert and -tls-key are required to serve HTTPS")
+		os.Exit(2)
+	}
+
+	// Load the configuration
+	if *configFile != "" {
+		c, err := config.Load(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+			os.Exit(1)
+		}
+		config.Default = c
+	}
+
+	// Enable rate limiting
+	if config.Default.Limits.Enabled() {
+		ratelimit.Default = ratelimit.New(config.Default.Limits)
+		session.Default.OnClose(func(s *session.Session) {
+			ratelimit.Default.Forget(s.ID)
+		})
+	}
+
+	// Load the query history
+	h, err := history.New(*historyFile, *historyLimit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load query history: %v\n", err)
+		os.Exit(1)
+	}
+	history.Default = h
+
+	// Configure the connection health monitor
+	datastore.DefaultHealthCheck.Interval = *healthCheckInterval
+	datastore.DefaultHealthCheck.MaxAttempts = *reconnectAttempts
+
+	// Read the connection defaults of the [client] and [mysql-mcp] groups of the option files
+	if !*noDefaults {
+		var files []string
+		if *defaultsFile != "" {
+			files = []string{*defaultsFile}
+			if _, err := os.Stat(*defaultsFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read option file: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			files = optionfile.DefaultFiles()
+		}
+		f, err := optionfile.LoadAll(files...)
+		if err == nil {
+			datastore.Defaults, err = datastore.DefaultsFromOptionFile(f, datastore.DefaultGroups...)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load option files: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Configure the schema catalog
+	catalog.Default = catalog.NewRegistry(*schemaCheckInterval)
+
+	// Load the schema snapshots
+	if *snapshotDir != "" {
+		snapshot.Default = snapshot.NewStore(*snapshotDir)
+		if err := snapshot.Default.LoadDir(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load schema snapshots: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Configure the dump directory
+	dump.Dir = *dumpDir
+
+	// Enable the result cache
+	if *cacheTTL > 0 {
+		cache.Default = cache.New(*cacheTTL, *cacheSize, *cacheMaxBytes)
+	}
+
 	// Create MCP server
 	s := server.NewMCPServer(
 		"MySQL Client",
@@ -20,26 +144,84 @@ func main() {
 	// Add connection tool
 	connectTool := mcp.NewTool("connect",
 		mcp.WithDescription("Establish a connection to a MySQL database, storing the connection details for subsequent queries"),
+		mcp.WithString("profile",
+			mcp.Description("Name of a connection profile of the server configuration, replaces the other parameters"),
+		),
 		mcp.WithString("host",
-			mcp.Required(),
-			mcp.Description("MySQL host address"),
+			mcp.Description("MySQL host address, or unix:///path/to/mysql.sock, required unless a profile, a socket or an option file host is given"),
+		),
+		mcp.WithString("socket",
+			mcp.Description("Path of the MySQL Unix socket, used instead of host and port"),
 		),
 		mcp.WithString("port",
 			mcp.Description("MySQL port"),
 			mcp.DefaultString("3306"),
 		),
 		mcp.WithString("username",
-			mcp.Required(),
-			mcp.Description("MySQL username"),
+			mcp.Description("MySQL username, required unless a profile is given or the option files set a user"),
 		),
 		mcp.WithString("password",
-			mcp.Required(),
-			mcp.Description("MySQL password"),
+			mcp.Description("MySQL password, required unless a profile is given or the option files set a password"),
 		),
 		mcp.WithString("database",
 			mcp.Description("MySQL database name"),
 			mcp.DefaultString(""),
 		),
+		mcp.WithString("dsn",
+			mcp.Description("Raw Go MySQL driver DSN such as user:password@tcp(host:3306)/db?parseTime=true, replaces host, port, username, password and database"),
+		),
+		mcp.WithNumber("max_open_conns",
+			mcp.Description("Maximum number of open connections in the pool (default 10)"),
+		),
+		mcp.WithNumber("max_idle_conns",
+			mcp.Description("Maximum number of idle connections in the pool (default 5)"),
+		),
+		mcp.WithString("conn_max_lifetime",
+			mcp.Description("Maximum lifetime of a pooled connection such as 5m (default 5m)"),
+		),
+		mcp.WithString("conn_max_idle_time",
+			mcp.Description("Maximum idle time of a pooled connection such as 1m"),
+		),
+		mcp.WithString("charset",
+			mcp.Description("Connection character set such as utf8mb4"),
+		),
+		mcp.WithString("collation",
+			mcp.Description("Connection collation such as utf8mb4_unicode_ci"),
+		),
+		mcp.WithString("time_zone",
+			mcp.Description("IANA time zone used to parse DATETIME and TIMESTAMP values such as Asia/Tokyo"),
+		),
+		mcp.WithBoolean("parse_time",
+			mcp.Description("Parse DATE and DATETIME values into time values"),
+		),
+		mcp.WithString("timeout",
+			mcp.Description("Dial timeout such as 5s"),
+		),
+		mcp.WithString("read_timeout",
+			mcp.Description("I/O read timeout such as 30s"),
+		),
+		mcp.WithString("write_timeout",
+			mcp.Description("I/O write timeout such as 30s"),
+		),
+		mcp.WithBoolean("interpolate_params",
+			mcp.Description("Interpolate placeholders into the query instead of using server-side prepared statements"),
+		),
+		mcp.WithString("ssl_mode",
+			mcp.Description("TLS mode of the connection"),
+			mcp.Enum(datastore.SSLModes...),
+		),
+		mcp.WithString("ssl_ca",
+			mcp.Description("Path of the CA bundle verifying the server certificate"),
+		),
+		mcp.WithString("ssl_cert",
+			mcp.Description("Path of the client certificate"),
+		),
+		mcp.WithString("ssl_key",
+			mcp.Description("Path of the client private key"),
+		),
+		mcp.WithString("ssl_server_name",
+			mcp.Description("Server name checked by verify-identity instead of the host"),
+		),
 	)
 
 	// Add query tool
@@ -51,6 +233,32 @@ func main() {
 		),
 	)
 
+	// Add run script tool
+	runScriptTool := mcp.NewTool("run_script",
+		mcp.WithDescription("Run a multi-statement SQL script in order on a single connection, so that variables and temporary tables are shared between its statements. Returns the result set, affected rows or error of every statement"),
+		mcp.WithString("script",
+			mcp.Required(),
+			mcp.Description("SQL statements separated by ; (or the delimiter set with a DELIMITER line)"),
+		),
+		mcp.WithString("on_error",
+			mcp.Description("Stop at the first failing statement, skipping the rest, or continue with the next statements"),
+			mcp.Enum("stop", "continue"),
+			mcp.DefaultString("stop"),
+		),
+	)
+
+	// Add call procedure tool
+	callProcedureTool := mcp.NewTool("call_procedure",
+		mcp.WithDescription("Call a stored procedure or function. Arguments are bound according to the routine signature; every result set, the OUT and INOUT parameters or the return value come back in one response"),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the procedure or function, optionally qualified as database.name"),
+		),
+		mcp.WithObject("args",
+			mcp.Description("Values of the IN and INOUT parameters by name"),
+		),
+	)
+
 	// Add list databases tool
 	listDatabasesTool := mcp.NewTool("list_databases",
 		mcp.WithDescription("Retrieve a list of all databases available on the currently connected MySQL server"),
@@ -73,15 +281,433 @@ func main() {
 		),
 	)
 
+	// Add schema object tools
+	includeDefinitions := mcp.WithBoolean("include_definitions",
+		mcp.Description("Include the SQL bodies, which may be large"),
+		mcp.DefaultBool(false),
+	)
+	objectsDatabase := mcp.WithString("database",
+		mcp.Description("Database name (optional, all user databases are listed if not specified)"),
+	)
+	listRoutinesTool := mcp.NewTool("list_routines",
+		mcp.WithDescription("List the stored procedures and functions with their parameters, return type, definer, security type and data access"),
+		objectsDatabase,
+		includeDefinitions,
+	)
+	listTriggersTool := mcp.NewTool("list_triggers",
+		mcp.WithDescription("List the triggers with their table, event, timing, order and definer"),
+		objectsDatabase,
+		mcp.WithString("table",
+			mcp.Description("Only list the triggers of this table"),
+		),
+		includeDefinitions,
+	)
+	listViewsTool := mcp.NewTool("list_views",
+		mcp.WithDescription("List the views with their definer, security type, check option and whether they are updatable"),
+		objectsDatabase,
+		includeDefinitions,
+	)
+	listEventsTool := mcp.NewTool("list_events",
+		mcp.WithDescription("List the scheduled events with their schedule, status, last execution and definer"),
+		objectsDatabase,
+		includeDefinitions,
+	)
+	showDefinitionTool := mcp.NewTool("show_definition",
+		mcp.WithDescription("Show the CREATE statement of a table, view, stored procedure, function, trigger or event"),
+		mcp.WithString("type",
+			mcp.Required(),
+			mcp.Description("Type of the object"),
+			mcp.Enum(catalog.DefinitionTypes...),
+		),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the object, optionally qualified as database.name"),
+		),
+	)
+
+	// Add profile table tool
+	profileTableTool := mcp.NewTool("profile_table",
+		mcp.WithDescription("Profile the data distribution of the columns of a table from a bounded sample: null ratio, distinct count, min/max, most frequent values, average length of strings and histograms of numbers and dates. Server histograms of information_schema.COLUMN_STATISTICS are used when they exist"),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Table name, optionally qualified as database.table"),
+		),
+		mcp.WithArray("columns",
+			mcp.Description("Names of the columns to profile (optional, all columns if not specified)"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithNumber("sample_size",
+			mcp.Description(fmt.Sprintf("Number of rows read from the table (at most %d)", dataprofile.MaxSampleSize)),
+			mcp.DefaultNumber(dataprofile.DefaultSampleSize),
+		),
+		mcp.WithNumber("top",
+			mcp.Description("Number of most frequent values reported per column"),
+			mcp.DefaultNumber(dataprofile.DefaultTop),
+		),
+		mcp.WithNumber("buckets",
+			mcp.Description("Number of buckets of the histograms computed from the sample"),
+			mcp.DefaultNumber(dataprofile.DefaultBuckets),
+		),
+		mcp.WithBoolean("exact",
+			mcp.Description("Read the whole table instead of a sample, which may be slow on big tables"),
+			mcp.DefaultBool(false),
+		),
+	)
+
+	// Add sample rows tool
+	sampleRowsTool := mcp.NewTool("sample_rows",
+		mcp.WithDescription("Peek at a few rows of a table without scanning it. Rows are picked at random points of an integer primary key by default, or are the first or last rows by primary key. Long values are truncated and binary values summarized by their length and a hex prefix"),
+		mcp.WithString("table",
+			mcp.Required(),
+			mcp.Description("Table name, optionally qualified as database.table"),
+		),
+		mcp.WithString("strategy",
+			mcp.Description("How rows are picked (optional, random when the table has a single-column integer primary key and first otherwise)"),
+			mcp.Enum(sampling.Strategies...),
+		),
+		mcp.WithArray("columns",
+			mcp.Description("Names of the columns to read (optional, all columns if not specified)"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Number of rows (at most %d)", sampling.MaxLimit)),
+			mcp.DefaultNumber(sampling.DefaultLimit),
+		),
+		mcp.WithNumber("max_length",
+			mcp.Description("Number of characters longer values are truncated to, 0 keeps values whole"),
+			mcp.DefaultNumber(200),
+		),
+	)
+
+	// Add schema diff tool
+	schemaDiffTool := mcp.NewTool("schema_diff",
+		mcp.WithDescription("Compare the tables of two schemas, on the current connection or on connection profiles, and report the added, removed and changed tables, columns, indexes, foreign keys and table options of the target. Optionally generate the statements making the target match the source"),
+		mcp.WithString("source",
+			mcp.Description("Source schema (optional, defaults to the current database of the source connection)"),
+		),
+		mcp.WithString("target",
+			mcp.Description("Target schema (optional, defaults to the current database of the target connection)"),
+		),
+		mcp.WithString("source_profile",
+			mcp.Description("Connection profile of the source (optional, the current connection if not specified)"),
+		),
+		mcp.WithString("target_profile",
+			mcp.Description("Connection profile of the target (optional, the current connection if not specified)"),
+		),
+		mcp.WithBoolean("alter",
+			mcp.Description("Also return the CREATE, ALTER and DROP statements making the target match the source"),
+			mcp.DefaultBool(false),
+		),
+	)
+
+	// Add snapshot tools
+	snapshotSchemaTool := mcp.NewTool("snapshot_schema",
+		mcp.WithDescription("Save the catalog of a database (tables with their columns, indexes and foreign keys, views, routines, triggers and events) to a versionable JSON or YAML snapshot in the snapshot directory, or return it when the server has none. Loaded snapshots answer list_tables, describe_table and the list tools while disconnected"),
+		mcp.WithString("database",
+			mcp.Description("Database name (optional, uses the current database if not specified)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Snapshot format, ignored when file is given"),
+			mcp.Enum(snapshot.Formats...),
+			mcp.DefaultString(string(snapshot.JSON)),
+		),
+		mcp.WithString("file",
+			mcp.Description("Name of the snapshot file in the snapshot directory, with a .json, .yaml or .yml extension (optional, named after the database if not specified)"),
+		),
+	)
+
+	compareToSnapshotTool := mcp.NewTool("compare_to_snapshot",
+		mcp.WithDescription("Report the drift of a database from a snapshot: the tables, columns, indexes, foreign keys, table options, views, routines, triggers and events created, dropped or changed since"),
+		mcp.WithString("database",
+			mcp.Description("Database name (optional, the database of the snapshot file or the current database if not specified)"),
+		),
+		mcp.WithString("file",
+			mcp.Description("Name of the snapshot file in the snapshot directory (optional, the latest snapshot of the database if not specified)"),
+		),
+	)
+
+	// Add dump tool
+	dumpTool := mcp.NewTool("dump",
+		mcp.WithDescription("Write a mysqldump-compatible SQL dump (CREATE statements and batched extended INSERTs) of databases or tables, read in one consistent snapshot, to the dump directory, or return it when the server has none"),
+		mcp.WithArray("databases",
+			mcp.Description("Names of the databases to dump (optional, uses the current database if not specified)"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithArray("tables",
+			mcp.Description("Tables and views of a single database to dump, optionally qualified as database.table (optional, all tables and views if not specified)"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithObject("where",
+			mcp.Description("Object mapping table names to the condition filtering their rows, such as {\"orders\": \"created_at >= '2024-05-01'\"}"),
+		),
+		mcp.WithString("profile",
+			mcp.Description("Connection profile of the server to dump (optional, the current connection if not specified)"),
+		),
+		mcp.WithBoolean("create_databases",
+			mcp.Description("Add CREATE DATABASE and USE statements to a dump of a single database, always added when dumping several"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithBoolean("no_data",
+			mcp.Description("Only dump the CREATE statements"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithNumber("batch_size",
+			mcp.Description("Number of rows per INSERT statement"),
+			mcp.DefaultNumber(dump.DefaultBatchRows),
+		),
+		mcp.WithBoolean("gzip",
+			mcp.Description("Compress the dump file with gzip, adding .gz to its name"),
+			mcp.DefaultBool(false),
+		),
+		mcp.WithString("file",
+			mcp.Description("Name of the dump file in the dump directory (optional, named after the databases if not specified)"),
+		),
+	)
+
+	// Add query history tool
+	queryHistoryTool := mcp.NewTool("query_history",
+		mcp.WithDescription("List previously executed statements with their timing, row counts and status, most recent first"),
+		mcp.WithString("search",
+			mcp.Description("Only return statements containing this text (case-insensitive)"),
+		),
+		mcp.WithString("status",
+			mcp.Description("Only return statements with this status"),
+			mcp.Enum("all", "ok", "error"),
+			mcp.DefaultString("all"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of statements to return"),
+			mcp.DefaultNumber(20),
+		),
+	)
+
+	// Add rerun query tool
+	rerunQueryTool := mcp.NewTool("rerun_query",
+		mcp.WithDescription("Execute a statement from the query history again on the currently connected MySQL database"),
+		mcp.WithNumber("id",
+			mcp.Required(),
+			mcp.Description("ID of the statement as reported by query_history"),
+		),
+	)
+
+	// Add clear cache tool
+	clearCacheTool := mcp.NewTool("clear_cache",
+		mcp.WithDescription("Remove the cached query results of the current connection so that subsequent queries hit the database"),
+	)
+
+	// Add connection status tool
+	connectionStatusTool := mcp.NewTool("connection_status",
+		mcp.WithDescription("Report the health of the MySQL connection: connected, degraded, reconnecting or failed"),
+	)
+
+	// Add disconnect tool
+	disconnectTool := mcp.NewTool("disconnect",
+		mcp.WithDescription("Close the connection to the MySQL database and release its pooled connections"),
+	)
+
+	// Add connection info tool
+	connectionInfoTool := mcp.NewTool("connection_info",
+		mcp.WithDescription("Show the host, user, current database, server version, sql_mode, time zone, character set, TLS status and pool statistics of the connection"),
+	)
+
+	// Add use database tool
+	useDatabaseTool := mcp.NewTool("use_database",
+		mcp.WithDescription("Change the default database of the connection. Prefer this over running USE through the query tool, which only affects one pooled connection"),
+		mcp.WithString("database",
+			mcp.Required(),
+			mcp.Description("Name of the database to use"),
+		),
+	)
+
 	// Add tool handlers
-	s.AddTool(connectTool, handlers.ConnectHandler)
-	s.AddTool(queryTool, handlers.QueryHandler)
-	s.AddTool(listDatabasesTool, handlers.ListDatabasesHandler)
-	s.AddTool(listTablesTool, handlers.ListTablesHandler)
-	s.AddTool(describeTableTool, handlers.DescribeTableHandler)
+	addTool(s, connectTool, handlers.ConnectHandler)
+	addTool(s, disconnectTool, handlers.DisconnectHandler)
+	addTool(s, connectionInfoTool, handlers.ConnectionInfoHandler)
+	addTool(s, useDatabaseTool, handlers.UseDatabaseHandler)
+	addTool(s, queryTool, handlers.QueryHandler)
+	addTool(s, runScriptTool, handlers.RunScriptHandler)
+	addTool(s, callProcedureTool, handlers.CallProcedureHandler)
+	addTool(s, listDatabasesTool, handlers.ListDatabasesHandler)
+	addTool(s, listTablesTool, handlers.ListTablesHandler)
+	addTool(s, describeTableTool, handlers.DescribeTableHandler)
+	addTool(s, listRoutinesTool, handlers.ListRoutinesHandler)
+	addTool(s, listTriggersTool, handlers.ListTriggersHandler)
+	addTool(s, listViewsTool, handlers.ListViewsHandler)
+	addTool(s, listEventsTool, handlers.ListEventsHandler)
+	addTool(s, showDefinitionTool, handlers.ShowDefinitionHandler)
+	addTool(s, profileTableTool, handlers.ProfileTableHandler)
+	addTool(s, sampleRowsTool, handlers.SampleRowsHandler)
+	addTool(s, schemaDiffTool, handlers.SchemaDiffHandler)
+	addTool(s, snapshotSchemaTool, handlers.SnapshotSchemaHandler)
+	addTool(s, compareToSnapshotTool, handlers.CompareToSnapshotHandler)
+	addTool(s, dumpTool, handlers.DumpHandler)
+	addTool(s, queryHistoryTool, handlers.QueryHistoryHandler)
+	addTool(s, rerunQueryTool, handlers.RerunQueryHandler)
+	addTool(s, clearCacheTool, handlers.ClearCacheHandler)
+	addTool(s, connectionStatusTool, handlers.ConnectionStatusHandler)
+
+	// Add saved query tools
+	if *savedQueriesDir != "" {
+		lib, err := savedqueries.Load(*savedQueriesDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load saved queries: %v\n", err)
+			os.Exit(1)
+		}
+		addSavedQueryTools(s, lib)
+	}
+
+	if *transport == "sse" {
+		// Start the HTTP server
+		err := serveSSE(s, *addr, *baseURL, *tlsCert, *tlsKey, *shutdownTimeout)
+		closeHistory()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Start the stdio server
 	if err := server.ServeStdio(s); err != nil {
 		fmt.Printf("Server error: %v\n", err)
 	}
+	session.Default.CloseAll()
+	closeHistory()
+}
+
+// closeHistory writes the statements recorded since the last background save
+func closeHistory() {
+	if err := history.Default.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save query history: %v\n", err)
+	}
+}
+
+// serveSSE serves MCP clients over HTTP with server-sent events until SIGINT or
+// SIGTERM is received, then shuts down gracefully
+func serveSSE(s *server.MCPServer, addr, baseURL, tlsCert, tlsKey string, shutdownTimeout time.Duration) error {
+	httpServer := &http.Server{Addr: addr}
+	sseServer := server.NewSSEServer(s,
+		server.WithBaseURL(baseURL),
+		server.WithHTTPServer(httpServer),
+	)
+	// Close the database connections of a client as soon as its SSE stream ends
+	httpServer.Handler = session.Default.TrackSSE(sseServer, "/sse")
+
+	// Authenticate every request when users are configured
+	if len(config.Default.Users) > 0 {
+		httpServer.Handler = auth.NewAuthenticator(config.Default).Middleware(httpServer.Handler)
+	} else {
+		fmt.Fprintln(os.Stderr, "Warning: no users configured, authentication is disabled")
+	}
+	defer session.Default.CloseAll()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		var err error
+		if tlsCert != "" {
+			err = httpServer.ListenAndServeTLS(tlsCert, tlsKey)
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		errCh <- err
+	}()
+	fmt.Fprintf(os.Stderr, "Serving MCP over SSE on %s\n", addr)
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Fprintln(os.Stderr, "Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return sseServer.Shutdown(shutdownCtx)
+}
+
+// addTool registers a tool whose handler is only called for callers allowed to use it
+// and within the configured rate limits
+func addTool(s *server.MCPServer, tool mcp.Tool, handler server.ToolHandlerFunc) {
+	if ratelimit.Default != nil {
+		handler = ratelimit.Default.Wrap(sessionLimitKey, handler)
+	}
+	s.AddTool(tool, auth.RequireTool(tool.Name, session.Default.RequireOwner(handler)))
+}
+
+// sessionLimitKey returns the session ID and connection of a tool call, the
+// connection being empty when the session is not connected
+func sessionLimitKey(ctx context.Context) (string, string) {
+	s := session.Default.FromContext(ctx)
+	return s.ID, s.ConnectionKey()
+}
+
+// addSavedQueryTools registers one tool per saved query plus the generic run_saved_query tool
+func addSavedQueryTools(s *server.MCPServer, lib *savedqueries.Library) {
+	names := lib.Names()
+	if len(names) == 0 {
+		return
+	}
+
+	for _, name := range names {
+		q, _ := lib.Get(name)
+		addTool(s, savedQueryTool(q), handlers.SavedQueryHandler(q))
+	}
+
+	runSavedQueryTool := mcp.NewTool("run_saved_query",
+		mcp.WithDescription("Execute one of the saved queries of the team library by name"),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Name of the saved query"),
+			mcp.Enum(names...),
+		),
+		mcp.WithObject("params",
+			mcp.Description("Parameters of the saved query by name"),
+		),
+	)
+	addTool(s, runSavedQueryTool, handlers.RunSavedQueryHandler(lib))
+}
+
+// savedQueryTool builds a tool whose arguments are the parameters of the saved query
+func savedQueryTool(q *savedqueries.Query) mcp.Tool {
+	description := q.Description
+	if description == "" {
+		description = fmt.Sprintf("Execute the saved query %s", q.Name)
+	}
+
+	opts := []mcp.ToolOption{mcp.WithDescription(description)}
+	for _, p := range q.Params {
+		propOpts := []mcp.PropertyOption{mcp.Description(p.Description)}
+		if p.Required {
+			propOpts = append(propOpts, mcp.Required())
+		}
+
+		switch p.Type {
+		case savedqueries.TypeInteger, savedqueries.TypeNumber:
+			if v, ok := p.Default.(int); ok {
+				propOpts = append(propOpts, mcp.DefaultNumber(float64(v)))
+			} else if v, ok := p.Default.(float64); ok {
+				propOpts = append(propOpts, mcp.DefaultNumber(v))
+			}
+			opts = append(opts, mcp.WithNumber(p.Name, propOpts...))
+		case savedqueries.TypeBoolean:
+			if v, ok := p.Default.(bool); ok {
+				propOpts = append(propOpts, mcp.DefaultBool(v))
+			}
+			opts = append(opts, mcp.WithBoolean(p.Name, propOpts...))
+		default:
+			if p.Default != nil {
+				propOpts = append(propOpts, mcp.DefaultString(fmt.Sprintf("%v", p.Default)))
+			}
+			opts = append(opts, mcp.WithString(p.Name, propOpts...))
+		}
+	}
+
+	return mcp.NewTool("saved_"+q.Name, opts...)
 }
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/config"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sqlutil"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Wildcard allows every profile, tool or statement class of a role
+const Wildcard = "*"
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	User     string
+	RoleName string
+	Role     config.Role
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying the identity of the caller
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity of the caller, or nil for unauthenticated
+// transports such as stdio
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// UserName returns the name of the caller, or an empty string if unauthenticated
+func UserName(ctx context.Context) string {
+	if id := FromContext(ctx); id != nil {
+		return id.User
+	}
+	return ""
+}
+
+// Authenticator resolves bearer tokens and API keys to identities
+type Authenticator struct {
+	credentials []credential
+}
+
+type credential struct {
+	secret   string
+	identity *Identity
+}
+
+// NewAuthenticator creates an authenticator for the users of the configuration
+func NewAuthenticator(c *config.Config) *Authenticator {
+	a := &Authenticator{}
+	for name, u := range c.Users {
+		id := &Identity{User: name, RoleName: u.Role, Role: c.Roles[u.Role]}
+		for _, token := range u.Tokens {
+			a.credentials = append(a.credentials, credential{secret: "bearer:" + token, identity: id})
+		}
+		for _, key := range u.APIKeys {
+			a.credentials = append(a.credentials, credential{secret: "apikey:" + key, identity: id})
+		}
+	}
+	return a
+}
+
+// Authenticate returns the identity matching the credentials of the request
+func (a *Authenticator) Authenticate(r *http.Request) (*Identity, bool) {
+	var presented string
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		presented = "bearer:" + strings.TrimSpace(token)
+	} else if key := r.Header.Get("X-API-Key"); key != "" {
+		presented = "apikey:" + key
+	} else {
+		return nil, false
+	}
+
+	for _, c := range a.credentials {
+		if subtle.ConstantTimeCompare([]byte(c.secret), []byte(presented)) == 1 {
+			return c.identity, true
+		}
+	}
+	return nil, false
+}
+
+// Middleware rejects requests without valid credentials and stores the identity
+// of the caller in the request context
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := a.Authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-mysql-client"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	})
+}
+
+func allows(entries []string, value string) bool {
+	return slices.Contains(entries, Wildcard) || slices.Contains(entries, value)
+}
+
+// CheckTool returns an error if the caller may not use the tool
+func CheckTool(ctx context.Context, tool string) error {
+	id := FromContext(ctx)
+	if id == nil || allows(id.Role.Tools, tool) {
+		return nil
+	}
+	return fmt.Errorf("permission denied: user %s may not use tool %s", id.User, tool)
+}
+
+// CheckProfile returns an error if the caller may not connect with the profile.
+// An empty profile stands for connection parameters given directly, which
+// requires access to all profiles.
+func CheckProfile(ctx context.Context, profile string) error {
+	id := FromContext(ctx)
+	if id == nil {
+		return nil
+	}
+	if profile == "" {
+		if slices.Contains(id.Role.Profiles, Wildcard) {
+			return nil
+		}
+		return fmt.Errorf("permission denied: user %s must connect through a connection profile", id.User)
+	}
+	if allows(id.Role.Profiles, profile) {
+		return nil
+	}
+	return fmt.Errorf("permission denied: user %s may not use connection profile %s", id.User, profile)
+}
+
+// CheckStatement returns an error if the caller may not execute statements of the class
+func CheckStatement(ctx context.Context, class sqlutil.StatementClass) error {
+	id := FromContext(ctx)
+	if id == nil || allows(id.Role.Statements, string(class)) {
+		return nil
+	}
+	return fmt.Errorf("permission denied: user %s may not execute %s statements", id.User, class)
+}
+
+// RequireTool wraps a tool handler so that it is only called for callers allowed to use the tool
+func RequireTool(tool string, handler func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if err := CheckTool(ctx, tool); err != nil {
+			return nil, err
+		}
+		return handler(ctx, request)
+	}
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/config"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sqlutil"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+var testConfig = &config.Config{
+	Profiles: map[string]config.Profile{
+		"replica": {Host: "replica.internal"},
+		"primary": {Host: "primary.internal"},
+	},
+	Users: map[string]config.User{
+		"alice": {Tokens: []string{"alice-token"}, Role: "analyst"},
+		"bot":   {APIKeys: []string{"bot-key"}, Role: "admin"},
+	},
+	Roles: map[string]config.Role{
+		"analyst": {Profiles: []string{"replica"}, Tools: []string{"connect", "query"}, Statements: []string{"read"}},
+		"admin":   {Profiles: []string{"*"}, Tools: []string{"*"}, Statements: []string{"*"}},
+	},
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := NewAuthenticator(testConfig)
+
+	tests := []struct {
+		name         string
+		header       string
+		value        string
+		expectedUser string
+	}{
+		{name: "bearer token", header: "Authorization", value: "Bearer alice-token", expectedUser: "alice"},
+		{name: "api key", header: "X-API-Key", value: "bot-key", expectedUser: "bot"},
+		{name: "api key as bearer token", header: "Authorization", value: "Bearer bot-key"},
+		{name: "wrong token", header: "Authorization", value: "Bearer nope"},
+		{name: "no credentials"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/sse", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+
+			id, ok := a.Authenticate(r)
+			if tt.expectedUser == "" {
+				assert.False(t, ok)
+			} else {
+				assert.True(t, ok)
+				assert.Equal(t, tt.expectedUser, id.User)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var user string
+	handler := NewAuthenticator(testConfig).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = UserName(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sse", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	r := httptest.NewRequest(http.MethodGet, "/sse", nil)
+	r.Header.Set("Authorization", "Bearer alice-token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "alice", user)
+}
+
+func TestChecks(t *testing.T) {
+	analyst := WithIdentity(context.Background(), &Identity{User: "alice", Role: testConfig.Roles["analyst"]})
+	admin := WithIdentity(context.Background(), &Identity{User: "bot", Role: testConfig.Roles["admin"]})
+	anonymous := context.Background()
+
+	assert.NoError(t, CheckTool(analyst, "query"))
+	assert.Error(t, CheckTool(analyst, "clear_cache"))
+	assert.NoError(t, CheckTool(admin, "clear_cache"))
+	assert.NoError(t, CheckTool(anonymous, "clear_cache"))
+
+	assert.NoError(t, CheckProfile(analyst, "replica"))
+	assert.Error(t, CheckProfile(analyst, "primary"))
+	assert.Error(t, CheckProfile(analyst, ""))
+	assert.NoError(t, CheckProfile(admin, ""))
+	assert.NoError(t, CheckProfile(anonymous, ""))
+
+	assert.NoError(t, CheckStatement(analyst, sqlutil.ClassRead))
+	assert.Error(t, CheckStatement(analyst, sqlutil.ClassWrite))
+	assert.NoError(t, CheckStatement(admin, sqlutil.ClassDDL))
+}
+
+func TestRequireTool(t *testing.T) {
+	called := false
+	handler := RequireTool("clear_cache", func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		called = true
+		return mcp.NewToolResultText("ok"), nil
+	})
+
+	analyst := WithIdentity(context.Background(), &Identity{User: "alice", Role: testConfig.Roles["analyst"]})
+	_, err := handler(analyst, mcp.CallToolRequest{})
+	assert.Error(t, err)
+	assert.False(t, called)
+}
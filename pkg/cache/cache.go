@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sqlutil"
+)
+
+// Entry is a cached query result
+type Entry struct {
+	Result   string
+	RowCount int
+	StoredAt time.Time
+}
+
+// Cache is an LRU cache of formatted query results with a TTL and size limits
+type Cache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	order      *list.List
+	items      map[string]*list.Element
+	now        func() time.Time
+}
+
+type item struct {
+	key      string
+	identity string
+	entry    Entry
+}
+
+// New creates a cache holding at most maxEntries results totalling at most
+// maxBytes bytes, each valid for ttl. A zero limit disables that limit.
+func New(ttl time.Duration, maxEntries, maxBytes int) *Cache {
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		items:      map[string]*list.Element{},
+		now:        time.Now,
+	}
+}
+
+// Key builds the cache key of a statement executed with the given arguments on
+// the connection identified by scope
+func Key(scope, query string, args ...interface{}) string {
+	var b strings.Builder
+	b.WriteString(scope)
+	b.WriteByte(0)
+	b.WriteString(sqlutil.Normalize(query))
+	for _, arg := range args {
+		b.WriteByte(0)
+		fmt.Fprintf(&b, "%T:%v", arg, arg)
+	}
+	return b.String()
+}
+
+// Get returns the entry stored under key if it has not expired
+func (c *Cache) Get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return Entry{}, false
+	}
+
+	it := el.Value.(*item)
+	if c.ttl > 0 && c.now().Sub(it.entry.StoredAt) > c.ttl {
+		c.remove(el)
+		return Entry{}, false
+	}
+
+	c.order.MoveToFront(el)
+	return it.entry, true
+}
+
+// Put stores a result under key for the connection identified by identity
+func (c *Cache) Put(key, identity string, entry Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A single result larger than the whole cache is never stored
+	if c.maxBytes > 0 && len(entry.Result) > c.maxBytes {
+		return
+	}
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+
+	entry.StoredAt = c.now()
+	el := c.order.PushFront(&item{key: key, identity: identity, entry: entry})
+	c.items[key] = el
+	c.bytes += len(entry.Result)
+
+	for (c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.remove(c.order.Back())
+	}
+}
+
+// Invalidate removes every entry of the connection identified by identity
+func (c *Cache) Invalidate(identity string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*item).identity == identity {
+			c.remove(el)
+			removed++
+		}
+		el = next
+	}
+	return removed
+}
+
+// Clear removes every entry and returns how many were removed
+func (c *Cache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := c.order.Len()
+	c.order.Init()
+	c.items = map[string]*list.Element{}
+	c.bytes = 0
+	return removed
+}
+
+// Len returns the number of cached entries
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *Cache) remove(el *list.Element) {
+	it := c.order.Remove(el).(*item)
+	delete(c.items, it.key)
+	c.bytes -= len(it.entry.Result)
+}
+
+// Global result cache, nil unless caching is enabled
+var Default *Cache
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyNormalizesQuery(t *testing.T) {
+	assert.Equal(t, Key("root@db:3306/app", "SELECT  1"), Key("root@db:3306/app", "SELECT 1;"))
+	assert.NotEqual(t, Key("root@db:3306/app", "SELECT 1"), Key("root@db:3306/other", "SELECT 1"))
+	assert.NotEqual(t, Key("root@db:3306/app", "SELECT ?", 1), Key("root@db:3306/app", "SELECT ?", "1"))
+}
+
+func TestTTL(t *testing.T) {
+	c := New(time.Minute, 0, 0)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.Put("k", "id", Entry{Result: "r"})
+	_, ok := c.Get("k")
+	assert.True(t, ok)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = c.Get("k")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New(time.Minute, 2, 0)
+
+	c.Put("a", "id", Entry{Result: "a"})
+	c.Put("b", "id", Entry{Result: "b"})
+	c.Get("a")
+	c.Put("c", "id", Entry{Result: "c"})
+
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	_, ok = c.Get("c")
+	assert.True(t, ok)
+}
+
+func TestMaxBytes(t *testing.T) {
+	c := New(time.Minute, 0, 10)
+
+	c.Put("a", "id", Entry{Result: "123456"})
+	c.Put("b", "id", Entry{Result: "123456"})
+	assert.Equal(t, 1, c.Len())
+
+	// Results larger than the cache are not stored
+	c.Put("c", "id", Entry{Result: "12345678901"})
+	_, ok := c.Get("c")
+	assert.False(t, ok)
+}
+
+func TestInvalidateAndClear(t *testing.T) {
+	c := New(time.Minute, 0, 0)
+
+	c.Put("a", "one", Entry{Result: "a"})
+	c.Put("b", "two", Entry{Result: "b"})
+	c.Put("c", "one", Entry{Result: "c"})
+
+	assert.Equal(t, 2, c.Invalidate("one"))
+	assert.Equal(t, 1, c.Len())
+	assert.Equal(t, 1, c.Clear())
+	assert.Equal(t, 0, c.Len())
+}
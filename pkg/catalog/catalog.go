@@ -0,0 +1,263 @@
+package catalog
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Table describes a table or view of the catalog
+type Table struct {
+	Schema     string   `json:"schema"`
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Rows       *int64   `json:"rows,omitempty"`
+	Comment    string   `json:"comment,omitempty"`
+	CreateTime string   `json:"create_time,omitempty"`
+	UpdateTime string   `json:"update_time,omitempty"`
+	Columns    []Column `json:"columns,omitempty"`
+
+	// Table options, empty for views
+	Engine        string `json:"engine,omitempty"`
+	Collation     string `json:"collation,omitempty"`
+	RowFormat     string `json:"row_format,omitempty"`
+	CreateOptions string `json:"create_options,omitempty"`
+
+	// Indexes and ForeignKeys are only loaded with InformationSchema.Schema
+	Indexes     []Index      `json:"indexes,omitempty"`
+	ForeignKeys []ForeignKey `json:"foreign_keys,omitempty"`
+}
+
+// Column describes a column of a table
+type Column struct {
+	Name     string  `json:"name"`
+	Position int     `json:"position"`
+	Type     string  `json:"type"`
+	Nullable bool    `json:"nullable"`
+	Key      string  `json:"key,omitempty"`
+	Default  *string `json:"default,omitempty"`
+	Extra    string  `json:"extra,omitempty"`
+	Comment  string  `json:"comment,omitempty"`
+}
+
+// Source loads catalog metadata from a database server
+type Source interface {
+	// Fingerprints returns a value per schema that changes whenever a table of the
+	// schema is created, dropped or updated. An empty schema selects all user schemas.
+	Fingerprints(ctx context.Context, schema string) (map[string]string, error)
+	// Tables returns the tables of the given schemas
+	Tables(ctx context.Context, schemas []string) ([]Table, error)
+	// Columns returns the columns of every table of a schema by table name
+	Columns(ctx context.Context, schema string) (map[string][]Column, error)
+}
+
+// Catalog is an in-memory cache of the schema metadata of one connection.
+// Schemas are loaded lazily and reloaded when their fingerprint changes.
+type Catalog struct {
+	mu            sync.Mutex
+	checkInterval time.Duration
+	schemas       map[string]*schemaEntry
+	checkedAt     map[string]time.Time
+	now           func() time.Time
+}
+
+type schemaEntry struct {
+	fingerprint string
+	tables      map[string]*Table
+	hasColumns  bool
+}
+
+// New creates an empty catalog. Fingerprints are checked at most once per
+// checkInterval, a zero interval checks them on every lookup.
+func New(checkInterval time.Duration) *Catalog {
+	return &Catalog{
+		checkInterval: checkInterval,
+		schemas:       map[string]*schemaEntry{},
+		checkedAt:     map[string]time.Time{},
+		now:           time.Now,
+	}
+}
+
+// Tables returns the tables of a schema, or of all user schemas if schema is empty,
+// sorted by schema and name
+func (c *Catalog) Tables(ctx context.Context, src Source, schema string) ([]Table, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names, err := c.refresh(ctx, src, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []Table{}
+	for _, name := range names {
+		for _, t := range c.schemas[name].tables {
+			table := *t
+			table.Columns = nil
+			tables = append(tables, table)
+		}
+	}
+
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Schema != tables[j].Schema {
+			return tables[i].Schema < tables[j].Schema
+		}
+		return tables[i].Name < tables[j].Name
+	})
+	return tables, nil
+}
+
+// Table returns a table of a schema including its columns
+func (c *Catalog) Table(ctx context.Context, src Source, schema, name string) (*Table, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.refresh(ctx, src, schema); err != nil {
+		return nil, false, err
+	}
+
+	entry, ok := c.schemas[schema]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if !entry.hasColumns {
+		columns, err := src.Columns(ctx, schema)
+		if err != nil {
+			return nil, false, err
+		}
+		for tableName, t := range entry.tables {
+			t.Columns = columns[tableName]
+		}
+		entry.hasColumns = true
+	}
+
+	t, ok := entry.tables[name]
+	if !ok {
+		return nil, false, nil
+	}
+	table := *t
+	return &table, true, nil
+}
+
+// Invalidate drops all cached metadata, for example after DDL ran through the server
+func (c *Catalog) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.schemas = map[string]*schemaEntry{}
+	c.checkedAt = map[string]time.Time{}
+}
+
+// refresh reloads the schemas whose fingerprint changed and returns the names of
+// the schemas matching the request
+func (c *Catalog) refresh(ctx context.Context, src Source, schema string) ([]string, error) {
+	if checked, ok := c.checkedAt[schema]; ok && c.now().Sub(checked) < c.checkInterval {
+		return c.cachedNames(schema), nil
+	}
+
+	fingerprints, err := src.Fingerprints(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	for name, fp := range fingerprints {
+		if entry, ok := c.schemas[name]; !ok || entry.fingerprint != fp {
+			stale = append(stale, name)
+		}
+	}
+
+	// Schemas that no longer have any table are dropped
+	for name := range c.schemas {
+		if _, ok := fingerprints[name]; !ok && (schema == "" || schema == name) {
+			delete(c.schemas, name)
+		}
+	}
+
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		tables, err := src.Tables(ctx, stale)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range stale {
+			c.schemas[name] = &schemaEntry{fingerprint: fingerprints[name], tables: map[string]*Table{}}
+		}
+		for i := range tables {
+			t := tables[i]
+			if entry, ok := c.schemas[t.Schema]; ok {
+				entry.tables[t.Name] = &t
+			}
+		}
+	}
+
+	c.checkedAt[schema] = c.now()
+
+	names := make([]string, 0, len(fingerprints))
+	for name := range fingerprints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (c *Catalog) cachedNames(schema string) []string {
+	if schema != "" {
+		if _, ok := c.schemas[schema]; ok {
+			return []string{schema}
+		}
+		return nil
+	}
+
+	names := make([]string, 0, len(c.schemas))
+	for name := range c.schemas {
+		if !IsSystemSchema(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsSystemSchema reports whether a schema belongs to the MySQL server itself
+func IsSystemSchema(name string) bool {
+	switch name {
+	case "information_schema", "performance_schema", "sys", "mysql":
+		return true
+	}
+	return false
+}
+
+// Registry holds one catalog per connection identity
+type Registry struct {
+	mu            sync.Mutex
+	checkInterval time.Duration
+	catalogs      map[string]*Catalog
+}
+
+// NewRegistry creates a registry whose catalogs use the given check interval
+func NewRegistry(checkInterval time.Duration) *Registry {
+	return &Registry{
+		checkInterval: checkInterval,
+		catalogs:      map[string]*Catalog{},
+	}
+}
+
+// For returns the catalog of the connection identified by identity
+func (r *Registry) For(identity string) *Catalog {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.catalogs[identity]
+	if !ok {
+		c = New(r.checkInterval)
+		r.catalogs[identity] = c
+	}
+	return c
+}
+
+// Global registry of schema catalogs
+var Default = NewRegistry(0)
@@ -0,0 +1,151 @@
+package catalog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource serves catalog metadata from memory and counts the loads
+type fakeSource struct {
+	fingerprints map[string]string
+	tables       []Table
+	columns      map[string]map[string][]Column
+	tableLoads   int
+	columnLoads  int
+}
+
+func (s *fakeSource) Fingerprints(ctx context.Context, schema string) (map[string]string, error) {
+	result := map[string]string{}
+	for name, fp := range s.fingerprints {
+		if schema == "" || schema == name {
+			result[name] = fp
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeSource) Tables(ctx context.Context, schemas []string) ([]Table, error) {
+	s.tableLoads++
+	var result []Table
+	for _, t := range s.tables {
+		for _, schema := range schemas {
+			if t.Schema == schema {
+				result = append(result, t)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeSource) Columns(ctx context.Context, schema string) (map[string][]Column, error) {
+	s.columnLoads++
+	return s.columns[schema], nil
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		fingerprints: map[string]string{"app": "2|t1|t1", "logs": "1|t1|t1"},
+		tables: []Table{
+			{Schema: "app", Name: "users"},
+			{Schema: "app", Name: "orders"},
+			{Schema: "logs", Name: "events"},
+		},
+		columns: map[string]map[string][]Column{
+			"app": {"users": {{Name: "id", Position: 1, Type: "int"}}},
+		},
+	}
+}
+
+func TestTablesAreLoadedLazilyAndCached(t *testing.T) {
+	src := newFakeSource()
+	c := New(0)
+	ctx := context.Background()
+
+	tables, err := c.Tables(ctx, src, "")
+	require.NoError(t, err)
+	assert.Len(t, tables, 3)
+	assert.Equal(t, "orders", tables[0].Name)
+	assert.Equal(t, 1, src.tableLoads)
+
+	tables, err = c.Tables(ctx, src, "app")
+	require.NoError(t, err)
+	assert.Len(t, tables, 2)
+	assert.Equal(t, 1, src.tableLoads)
+}
+
+func TestChangedFingerprintReloadsSchema(t *testing.T) {
+	src := newFakeSource()
+	c := New(0)
+	ctx := context.Background()
+
+	_, err := c.Tables(ctx, src, "")
+	require.NoError(t, err)
+
+	src.fingerprints["app"] = "3|t2|t2"
+	src.tables = append(src.tables, Table{Schema: "app", Name: "payments"})
+
+	tables, err := c.Tables(ctx, src, "app")
+	require.NoError(t, err)
+	assert.Len(t, tables, 3)
+	assert.Equal(t, 2, src.tableLoads)
+
+	// Dropped schemas disappear
+	delete(src.fingerprints, "logs")
+	tables, err = c.Tables(ctx, src, "")
+	require.NoError(t, err)
+	assert.Len(t, tables, 3)
+}
+
+func TestCheckInterval(t *testing.T) {
+	src := newFakeSource()
+	c := New(time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := c.Tables(ctx, src, "")
+	require.NoError(t, err)
+
+	src.fingerprints["app"] = "3|t2|t2"
+	_, err = c.Tables(ctx, src, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, src.tableLoads)
+
+	now = now.Add(2 * time.Minute)
+	_, err = c.Tables(ctx, src, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, src.tableLoads)
+}
+
+func TestTableLoadsColumnsOnce(t *testing.T) {
+	src := newFakeSource()
+	c := New(0)
+	ctx := context.Background()
+
+	table, ok, err := c.Table(ctx, src, "app", "users")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "id", table.Columns[0].Name)
+
+	_, ok, err = c.Table(ctx, src, "app", "missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 1, src.columnLoads)
+
+	// Invalidation forces a reload
+	c.Invalidate()
+	_, _, err = c.Table(ctx, src, "app", "users")
+	require.NoError(t, err)
+	assert.Equal(t, 2, src.columnLoads)
+	assert.Equal(t, 2, src.tableLoads)
+}
+
+func TestRegistryKeepsOneCatalogPerIdentity(t *testing.T) {
+	r := NewRegistry(0)
+	assert.Same(t, r.For("a"), r.For("a"))
+	assert.NotSame(t, r.For("a"), r.For("b"))
+}
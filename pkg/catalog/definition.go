@@ -0,0 +1,80 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sqlutil"
+)
+
+// DefinitionTypes are the object types SHOW CREATE describes
+var DefinitionTypes = []string{"table", "view", "procedure", "function", "trigger", "event"}
+
+// Definition is the CREATE statement of a schema object
+type Definition struct {
+	Type   string `json:"type"`
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	SQL    string `json:"sql"`
+	// Attributes are the other columns of SHOW CREATE, such as sql_mode or
+	// character_set_client
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Definition loads the CREATE statement of an object with SHOW CREATE
+func (s InformationSchema) Definition(ctx context.Context, objectType, schema, name string) (*Definition, error) {
+	objectType = strings.ToLower(objectType)
+	valid := false
+	for _, t := range DefinitionTypes {
+		valid = valid || t == objectType
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid type %q, expected one of %s", objectType, strings.Join(DefinitionTypes, ", "))
+	}
+
+	rows, err := s.DS.QueryContext(ctx, "SHOW CREATE "+strings.ToUpper(objectType)+" "+sqlutil.QuoteQualified(schema, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load definition: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load definition: %w", err)
+	}
+	values := make([]sql.NullString, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating over rows: %w", err)
+		}
+		return nil, fmt.Errorf("%s %s.%s does not exist", objectType, schema, name)
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	d := &Definition{Type: objectType, Schema: schema, Name: name, Attributes: map[string]string{}}
+	visible := false
+	for i, column := range columns {
+		switch {
+		// Triggers name their statement differently from the other objects
+		case strings.HasPrefix(column, "Create ") || column == "SQL Original Statement":
+			d.SQL, visible = values[i].String, values[i].Valid
+		case strings.EqualFold(column, objectType):
+			// The name of the object
+		case values[i].Valid:
+			d.Attributes[column] = values[i].String
+		}
+	}
+	// The statement of a routine is NULL when the current user may not see it
+	if !visible {
+		return nil, fmt.Errorf("the definition of %s %s.%s is not visible to the current user", objectType, schema, name)
+	}
+	return d, nil
+}
@@ -0,0 +1,161 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// PrimaryKey is the name of the primary key index
+const PrimaryKey = "PRIMARY"
+
+// Index describes an index of a table
+type Index struct {
+	Name    string        `json:"name"`
+	Unique  bool          `json:"unique"`
+	Columns []IndexColumn `json:"columns"`
+	// Type is BTREE, HASH, FULLTEXT or SPATIAL
+	Type    string `json:"type"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// IndexColumn is a column of an index. Functional key parts have no column name.
+type IndexColumn struct {
+	Name string `json:"name,omitempty"`
+	// SubPart is the length of a column prefix index
+	SubPart int `json:"sub_part,omitempty"`
+	// Descending is set for key parts sorted in descending order
+	Descending bool `json:"descending,omitempty"`
+}
+
+// ForeignKey describes a foreign key constraint of a table
+type ForeignKey struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	// ReferencedSchema is empty when the referenced table is in the same schema
+	ReferencedSchema  string   `json:"referenced_schema,omitempty"`
+	ReferencedTable   string   `json:"referenced_table"`
+	ReferencedColumns []string `json:"referenced_columns"`
+	OnUpdate          string   `json:"on_update"`
+	OnDelete          string   `json:"on_delete"`
+}
+
+// Indexes loads the indexes of every table of a schema by table name, the
+// primary key first and the others by name
+func (s InformationSchema) Indexes(ctx context.Context, schema string) (map[string][]Index, error) {
+	rows, err := s.DS.QueryContext(ctx, "SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COALESCE(COLUMN_NAME, ''), SUB_PART, COALESCE(COLLATION, ''), INDEX_TYPE, INDEX_COMMENT FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, INDEX_NAME = 'PRIMARY' DESC, INDEX_NAME, SEQ_IN_INDEX", schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load indexes: %w", err)
+	}
+	defer rows.Close()
+
+	indexes := map[string][]Index{}
+	for rows.Next() {
+		var table, name, collation, indexType, comment string
+		var nonUnique int
+		var subPart sql.NullInt64
+		var c IndexColumn
+		if err := rows.Scan(&table, &name, &nonUnique, &c.Name, &subPart, &collation, &indexType, &comment); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		c.SubPart = int(subPart.Int64)
+		c.Descending = collation == "D"
+
+		// Rows of the same index follow each other
+		tableIndexes := indexes[table]
+		if n := len(tableIndexes); n == 0 || tableIndexes[n-1].Name != name {
+			tableIndexes = append(tableIndexes, Index{Name: name, Unique: nonUnique == 0, Type: indexType, Comment: comment})
+		}
+		last := &tableIndexes[len(tableIndexes)-1]
+		last.Columns = append(last.Columns, c)
+		indexes[table] = tableIndexes
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return indexes, nil
+}
+
+// ForeignKeys loads the foreign keys of every table of a schema by table name
+func (s InformationSchema) ForeignKeys(ctx context.Context, schema string) (map[string][]ForeignKey, error) {
+	rows, err := s.DS.QueryContext(ctx, "SELECT k.TABLE_NAME, k.CONSTRAINT_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_SCHEMA, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME, r.UPDATE_RULE, r.DELETE_RULE FROM information_schema.KEY_COLUMN_USAGE k JOIN information_schema.REFERENTIAL_CONSTRAINTS r ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.TABLE_NAME = k.TABLE_NAME AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME WHERE k.TABLE_SCHEMA = ? AND k.REFERENCED_TABLE_NAME IS NOT NULL ORDER BY k.TABLE_NAME, k.CONSTRAINT_NAME, k.ORDINAL_POSITION", schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	foreignKeys := map[string][]ForeignKey{}
+	for rows.Next() {
+		var table, name, column, referencedSchema, referencedTable, referencedColumn, onUpdate, onDelete string
+		if err := rows.Scan(&table, &name, &column, &referencedSchema, &referencedTable, &referencedColumn, &onUpdate, &onDelete); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if referencedSchema == schema {
+			referencedSchema = ""
+		}
+
+		// Rows of the same constraint follow each other
+		keys := foreignKeys[table]
+		if n := len(keys); n == 0 || keys[n-1].Name != name {
+			keys = append(keys, ForeignKey{Name: name, ReferencedSchema: referencedSchema, ReferencedTable: referencedTable, OnUpdate: onUpdate, OnDelete: onDelete})
+		}
+		last := &keys[len(keys)-1]
+		last.Columns = append(last.Columns, column)
+		last.ReferencedColumns = append(last.ReferencedColumns, referencedColumn)
+		foreignKeys[table] = keys
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return foreignKeys, nil
+}
+
+// Schema loads the complete definition of the base tables of a schema, with their
+// columns, indexes, foreign keys and options, sorted by name. Unlike the catalog
+// it reads the server every time.
+func (s InformationSchema) Schema(ctx context.Context, schema string) ([]Table, error) {
+	rows, err := s.DS.QueryContext(ctx, "SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema: %w", err)
+	}
+	exists := rows.Next()
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("schema %s does not exist", schema)
+	}
+
+	all, err := s.Tables(ctx, []string{schema})
+	if err != nil {
+		return nil, err
+	}
+	columns, err := s.Columns(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := s.Indexes(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	foreignKeys, err := s.ForeignKeys(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []Table{}
+	for _, t := range all {
+		if t.Type != "BASE TABLE" {
+			continue
+		}
+		t.Columns = columns[t.Name]
+		t.Indexes = indexes[t.Name]
+		t.ForeignKeys = foreignKeys[t.Name]
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	return tables, nil
+}
@@ -0,0 +1,109 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Querier runs the queries of InformationSchema: a datastore, or a connection
+// reading in a transaction
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// InformationSchema loads catalog metadata from information_schema
+type InformationSchema struct {
+	DS Querier
+}
+
+const systemSchemas = "('information_schema', 'performance_schema', 'sys', 'mysql')"
+
+// schemaFilter restricts column to a schema, or to the user schemas if schema is empty
+func schemaFilter(column, schema string) (string, []interface{}) {
+	if schema != "" {
+		return column + " = ?", []interface{}{schema}
+	}
+	return column + " NOT IN " + systemSchemas, nil
+}
+
+func (s InformationSchema) Fingerprints(ctx context.Context, schema string) (map[string]string, error) {
+	filter, args := schemaFilter("TABLE_SCHEMA", schema)
+	rows, err := s.DS.QueryContext(ctx, "SELECT TABLE_SCHEMA, COUNT(*), COALESCE(MAX(CREATE_TIME), ''), COALESCE(MAX(UPDATE_TIME), '') FROM information_schema.TABLES WHERE "+filter+" GROUP BY TABLE_SCHEMA", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check schema metadata: %w", err)
+	}
+	defer rows.Close()
+
+	fingerprints := map[string]string{}
+	for rows.Next() {
+		var name, count, created, updated string
+		if err := rows.Scan(&name, &count, &created, &updated); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		fingerprints[name] = count + "|" + created + "|" + updated
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return fingerprints, nil
+}
+
+func (s InformationSchema) Tables(ctx context.Context, schemas []string) ([]Table, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(schemas)), ", ")
+	args := make([]interface{}, len(schemas))
+	for i, schema := range schemas {
+		args[i] = schema
+	}
+
+	rows, err := s.DS.QueryContext(ctx, "SELECT TABLE_SCHEMA, TABLE_NAME, TABLE_TYPE, TABLE_ROWS, TABLE_COMMENT, COALESCE(CREATE_TIME, ''), COALESCE(UPDATE_TIME, ''), COALESCE(ENGINE, ''), COALESCE(TABLE_COLLATION, ''), COALESCE(ROW_FORMAT, ''), COALESCE(CREATE_OPTIONS, '') FROM information_schema.TABLES WHERE TABLE_SCHEMA IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []Table
+	for rows.Next() {
+		var t Table
+		var tableRows sql.NullInt64
+		if err := rows.Scan(&t.Schema, &t.Name, &t.Type, &tableRows, &t.Comment, &t.CreateTime, &t.UpdateTime, &t.Engine, &t.Collation, &t.RowFormat, &t.CreateOptions); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if tableRows.Valid {
+			t.Rows = &tableRows.Int64
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return tables, nil
+}
+
+func (s InformationSchema) Columns(ctx context.Context, schema string) (map[string][]Column, error) {
+	rows, err := s.DS.QueryContext(ctx, "SELECT TABLE_NAME, COLUMN_NAME, ORDINAL_POSITION, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COLUMN_DEFAULT, EXTRA, COLUMN_COMMENT FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, ORDINAL_POSITION", schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load columns: %w", err)
+	}
+	defer rows.Close()
+
+	columns := map[string][]Column{}
+	for rows.Next() {
+		var table, nullable string
+		var c Column
+		var def sql.NullString
+		if err := rows.Scan(&table, &c.Name, &c.Position, &c.Type, &nullable, &c.Key, &def, &c.Extra, &c.Comment); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		c.Nullable = nullable == "YES"
+		if def.Valid {
+			c.Default = &def.String
+		}
+		columns[table] = append(columns[table], c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return columns, nil
+}
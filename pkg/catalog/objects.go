@@ -0,0 +1,148 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+)
+
+// ObjectFilter selects the schema objects to list
+type ObjectFilter struct {
+	// Schema restricts the objects to a schema, all user schemas are listed if empty
+	Schema string
+	// Table restricts triggers to those of a table
+	Table string
+	// WithBodies loads the SQL bodies of the objects, which may be large
+	WithBodies bool
+}
+
+// body selects the column holding the body of an object, or an empty string
+func (f ObjectFilter) body(column string) string {
+	if !f.WithBodies {
+		return "''"
+	}
+	// Bodies are NULL for objects the current user may not see the definition of
+	return "COALESCE(" + column + ", '')"
+}
+
+// Trigger describes a trigger of a table
+type Trigger struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	Table  string `json:"table"`
+	// Event is INSERT, UPDATE or DELETE
+	Event string `json:"event"`
+	// Timing is BEFORE or AFTER
+	Timing string `json:"timing"`
+	// Order is the position among the triggers with the same event and timing
+	Order   int    `json:"order"`
+	Definer string `json:"definer"`
+	Created string `json:"created,omitempty"`
+	Body    string `json:"body,omitempty"`
+}
+
+// View describes a view
+type View struct {
+	Schema       string `json:"schema"`
+	Name         string `json:"name"`
+	Definer      string `json:"definer"`
+	SecurityType string `json:"security_type"`
+	CheckOption  string `json:"check_option"`
+	Updatable    bool   `json:"updatable"`
+	Body         string `json:"body,omitempty"`
+}
+
+// Event describes a scheduled event
+type Event struct {
+	Schema  string `json:"schema"`
+	Name    string `json:"name"`
+	Definer string `json:"definer"`
+	// Type is ONE TIME or RECURRING
+	Type string `json:"type"`
+	// ExecuteAt is the time a one-time event runs
+	ExecuteAt string `json:"execute_at,omitempty"`
+	// IntervalValue and IntervalField are the period of a recurring event
+	IntervalValue string `json:"interval_value,omitempty"`
+	IntervalField string `json:"interval_field,omitempty"`
+	Starts        string `json:"starts,omitempty"`
+	Ends          string `json:"ends,omitempty"`
+	// Status is ENABLED, DISABLED or SLAVESIDE_DISABLED
+	Status       string `json:"status"`
+	OnCompletion string `json:"on_completion"`
+	LastExecuted string `json:"last_executed,omitempty"`
+	Body         string `json:"body,omitempty"`
+}
+
+// Triggers lists the triggers of a schema, by table and order of execution
+func (s InformationSchema) Triggers(ctx context.Context, f ObjectFilter) ([]Trigger, error) {
+	filter, args := schemaFilter("TRIGGER_SCHEMA", f.Schema)
+	if f.Table != "" {
+		filter += " AND EVENT_OBJECT_TABLE = ?"
+		args = append(args, f.Table)
+	}
+	rows, err := s.DS.QueryContext(ctx, "SELECT TRIGGER_SCHEMA, TRIGGER_NAME, EVENT_OBJECT_TABLE, EVENT_MANIPULATION, ACTION_TIMING, ACTION_ORDER, DEFINER, COALESCE(CREATED, ''), "+f.body("ACTION_STATEMENT")+" FROM information_schema.TRIGGERS WHERE "+filter+" ORDER BY TRIGGER_SCHEMA, EVENT_OBJECT_TABLE, EVENT_MANIPULATION, ACTION_TIMING, ACTION_ORDER", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load triggers: %w", err)
+	}
+	defer rows.Close()
+
+	triggers := []Trigger{}
+	for rows.Next() {
+		var t Trigger
+		if err := rows.Scan(&t.Schema, &t.Name, &t.Table, &t.Event, &t.Timing, &t.Order, &t.Definer, &t.Created, &t.Body); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		triggers = append(triggers, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return triggers, nil
+}
+
+// Views lists the views of a schema
+func (s InformationSchema) Views(ctx context.Context, f ObjectFilter) ([]View, error) {
+	filter, args := schemaFilter("TABLE_SCHEMA", f.Schema)
+	rows, err := s.DS.QueryContext(ctx, "SELECT TABLE_SCHEMA, TABLE_NAME, DEFINER, SECURITY_TYPE, CHECK_OPTION, IS_UPDATABLE, "+f.body("VIEW_DEFINITION")+" FROM information_schema.VIEWS WHERE "+filter+" ORDER BY TABLE_SCHEMA, TABLE_NAME", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load views: %w", err)
+	}
+	defer rows.Close()
+
+	views := []View{}
+	for rows.Next() {
+		var v View
+		var updatable string
+		if err := rows.Scan(&v.Schema, &v.Name, &v.Definer, &v.SecurityType, &v.CheckOption, &updatable, &v.Body); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		v.Updatable = updatable == "YES"
+		views = append(views, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return views, nil
+}
+
+// Events lists the scheduled events of a schema
+func (s InformationSchema) Events(ctx context.Context, f ObjectFilter) ([]Event, error) {
+	filter, args := schemaFilter("EVENT_SCHEMA", f.Schema)
+	rows, err := s.DS.QueryContext(ctx, "SELECT EVENT_SCHEMA, EVENT_NAME, DEFINER, EVENT_TYPE, COALESCE(EXECUTE_AT, ''), COALESCE(INTERVAL_VALUE, ''), COALESCE(INTERVAL_FIELD, ''), COALESCE(STARTS, ''), COALESCE(ENDS, ''), STATUS, ON_COMPLETION, COALESCE(LAST_EXECUTED, ''), "+f.body("EVENT_DEFINITION")+" FROM information_schema.EVENTS WHERE "+filter+" ORDER BY EVENT_SCHEMA, EVENT_NAME", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.Schema, &e.Name, &e.Definer, &e.Type, &e.ExecuteAt, &e.IntervalValue, &e.IntervalField, &e.Starts, &e.Ends, &e.Status, &e.OnCompletion, &e.LastExecuted, &e.Body); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return events, nil
+}
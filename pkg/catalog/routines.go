@@ -0,0 +1,146 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+)
+
+// Routine types of information_schema.ROUTINES
+const (
+	RoutineProcedure = "PROCEDURE"
+	RoutineFunction  = "FUNCTION"
+)
+
+// Routine describes a stored procedure or function
+type Routine struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	// Returns is the return type of a function
+	Returns    string      `json:"returns,omitempty"`
+	Parameters []Parameter `json:"parameters"`
+
+	// The following are only set when listing routines
+	Definer       string `json:"definer,omitempty"`
+	SecurityType  string `json:"security_type,omitempty"`
+	DataAccess    string `json:"data_access,omitempty"`
+	Deterministic bool   `json:"deterministic,omitempty"`
+	Comment       string `json:"comment,omitempty"`
+	Created       string `json:"created,omitempty"`
+	LastAltered   string `json:"last_altered,omitempty"`
+	Body          string `json:"body,omitempty"`
+}
+
+// Parameter describes a parameter of a routine
+type Parameter struct {
+	Position int    `json:"position"`
+	Name     string `json:"name"`
+	// Mode is IN, OUT or INOUT, always IN for functions
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+}
+
+// Routine loads the signature of a stored procedure or function. Signatures are
+// not cached, routines are usually few and cheap to load.
+func (s InformationSchema) Routine(ctx context.Context, schema, name string) (*Routine, bool, error) {
+	rows, err := s.DS.QueryContext(ctx, "SELECT ROUTINE_TYPE, COALESCE(DTD_IDENTIFIER, '') FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = ? AND ROUTINE_NAME = ?", schema, name)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load routine: %w", err)
+	}
+	r := &Routine{Schema: schema, Name: name}
+	found := rows.Next()
+	if found {
+		err = rows.Scan(&r.Type, &r.Returns)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load routine: %w", err)
+	}
+	if !found {
+		return nil, false, nil
+	}
+
+	// The return value of a function is the parameter at position 0
+	rows, err = s.DS.QueryContext(ctx, "SELECT ORDINAL_POSITION, COALESCE(PARAMETER_NAME, ''), COALESCE(PARAMETER_MODE, ''), DTD_IDENTIFIER FROM information_schema.PARAMETERS WHERE SPECIFIC_SCHEMA = ? AND SPECIFIC_NAME = ? AND ROUTINE_TYPE = ? AND ORDINAL_POSITION > 0 ORDER BY ORDINAL_POSITION", schema, name, r.Type)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load routine parameters: %w", err)
+	}
+	defer rows.Close()
+
+	r.Parameters = []Parameter{}
+	for rows.Next() {
+		var p Parameter
+		if err := rows.Scan(&p.Position, &p.Name, &p.Mode, &p.Type); err != nil {
+			return nil, false, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if p.Mode == "" {
+			p.Mode = "IN"
+		}
+		r.Parameters = append(r.Parameters, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return r, true, nil
+}
+
+// Routines lists the stored procedures and functions of a schema with their parameters
+func (s InformationSchema) Routines(ctx context.Context, f ObjectFilter) ([]Routine, error) {
+	filter, args := schemaFilter("ROUTINE_SCHEMA", f.Schema)
+	rows, err := s.DS.QueryContext(ctx, "SELECT ROUTINE_SCHEMA, ROUTINE_NAME, ROUTINE_TYPE, COALESCE(DTD_IDENTIFIER, ''), DEFINER, SECURITY_TYPE, SQL_DATA_ACCESS, IS_DETERMINISTIC, ROUTINE_COMMENT, CREATED, LAST_ALTERED, "+f.body("ROUTINE_DEFINITION")+" FROM information_schema.ROUTINES WHERE "+filter+" ORDER BY ROUTINE_SCHEMA, ROUTINE_NAME, ROUTINE_TYPE", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load routines: %w", err)
+	}
+	defer rows.Close()
+
+	routines := []Routine{}
+	for rows.Next() {
+		var r Routine
+		var deterministic string
+		if err := rows.Scan(&r.Schema, &r.Name, &r.Type, &r.Returns, &r.Definer, &r.SecurityType, &r.DataAccess, &deterministic, &r.Comment, &r.Created, &r.LastAltered, &r.Body); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		r.Deterministic = deterministic == "YES"
+		r.Parameters = []Parameter{}
+		routines = append(routines, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	if len(routines) == 0 {
+		return routines, nil
+	}
+
+	filter, args = schemaFilter("SPECIFIC_SCHEMA", f.Schema)
+	rows, err = s.DS.QueryContext(ctx, "SELECT SPECIFIC_SCHEMA, SPECIFIC_NAME, ROUTINE_TYPE, ORDINAL_POSITION, COALESCE(PARAMETER_NAME, ''), COALESCE(PARAMETER_MODE, ''), DTD_IDENTIFIER FROM information_schema.PARAMETERS WHERE "+filter+" AND ORDINAL_POSITION > 0 ORDER BY SPECIFIC_SCHEMA, SPECIFIC_NAME, ORDINAL_POSITION", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load routine parameters: %w", err)
+	}
+	defer rows.Close()
+
+	byName := map[string]*Routine{}
+	for i := range routines {
+		r := &routines[i]
+		byName[r.Schema+"."+r.Name+"."+r.Type] = r
+	}
+	for rows.Next() {
+		var schema, name, routineType string
+		var p Parameter
+		if err := rows.Scan(&schema, &name, &routineType, &p.Position, &p.Name, &p.Mode, &p.Type); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if p.Mode == "" {
+			p.Mode = "IN"
+		}
+		if r, ok := byName[schema+"."+name+"."+routineType]; ok {
+			r.Parameters = append(r.Parameters, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return routines, nil
+}
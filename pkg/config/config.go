@@ -0,0 +1,365 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"gopkg.in/yaml.v3"
+)
+
+// ConnectionOptions configures the connection pool and the driver. Durations are
+// strings such as "30s" or "5m".
+type ConnectionOptions struct {
+	MaxOpenConns      int    `yaml:"max_open_conns" json:"max_open_conns"`
+	MaxIdleConns      int    `yaml:"max_idle_conns" json:"max_idle_conns"`
+	ConnMaxLifetime   string `yaml:"conn_max_lifetime" json:"conn_max_lifetime"`
+	ConnMaxIdleTime   string `yaml:"conn_max_idle_time" json:"conn_max_idle_time"`
+	Charset           string `yaml:"charset" json:"charset"`
+	Collation         string `yaml:"collation" json:"collation"`
+	TimeZone          string `yaml:"time_zone" json:"time_zone"`
+	ParseTime         *bool  `yaml:"parse_time" json:"parse_time"`
+	Timeout           string `yaml:"timeout" json:"timeout"`
+	ReadTimeout       string `yaml:"read_timeout" json:"read_timeout"`
+	WriteTimeout      string `yaml:"write_timeout" json:"write_timeout"`
+	InterpolateParams *bool  `yaml:"interpolate_params" json:"interpolate_params"`
+	SSLMode           string `yaml:"ssl_mode" json:"ssl_mode"`
+	SSLCA             string `yaml:"ssl_ca" json:"ssl_ca"`
+	SSLCert           string `yaml:"ssl_cert" json:"ssl_cert"`
+	SSLKey            string `yaml:"ssl_key" json:"ssl_key"`
+	SSLServerName     string `yaml:"ssl_server_name" json:"ssl_server_name"`
+}
+
+// DatastoreOptions converts the options for the datastore
+func (o ConnectionOptions) DatastoreOptions() (datastore.Options, error) {
+	opts := datastore.Options{
+		MaxOpenConns:      o.MaxOpenConns,
+		MaxIdleConns:      o.MaxIdleConns,
+		Charset:           o.Charset,
+		Collation:         o.Collation,
+		TimeZone:          o.TimeZone,
+		ParseTime:         o.ParseTime,
+		InterpolateParams: o.InterpolateParams,
+		SSLMode:           o.SSLMode,
+		SSLCA:             o.SSLCA,
+		SSLCert:           o.SSLCert,
+		SSLKey:            o.SSLKey,
+		SSLServerName:     o.SSLServerName,
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"conn_max_lifetime", o.ConnMaxLifetime, &opts.ConnMaxLifetime},
+		{"conn_max_idle_time", o.ConnMaxIdleTime, &opts.ConnMaxIdleTime},
+		{"timeout", o.Timeout, &opts.Timeout},
+		{"read_timeout", o.ReadTimeout, &opts.ReadTimeout},
+		{"write_timeout", o.WriteTimeout, &opts.WriteTimeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return datastore.Options{}, fmt.Errorf("invalid %s: %w", d.name, err)
+		}
+		*d.dest = parsed
+	}
+
+	if o.TimeZone != "" {
+		if _, err := time.LoadLocation(o.TimeZone); err != nil {
+			return datastore.Options{}, fmt.Errorf("invalid time_zone: %w", err)
+		}
+	}
+
+	if err := datastore.ValidateSSLMode(o.SSLMode); err != nil {
+		return datastore.Options{}, err
+	}
+
+	return opts, nil
+}
+
+// Profile is a named set of connection parameters
+type Profile struct {
+	Host string `yaml:"host" json:"host"`
+	Port string `yaml:"port" json:"port"`
+	// Socket is a Unix socket path used instead of Host and Port
+	Socket   string `yaml:"socket" json:"socket"`
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+	// PasswordFrom reads the password from a secret instead of Password
+	PasswordFrom *PasswordFrom `yaml:"password_from" json:"password_from"`
+	Database     string        `yaml:"database" json:"database"`
+	// DSN replaces the parameters above when set
+	DSN string `yaml:"dsn" json:"dsn"`
+	// SSH reaches the database through a bastion host
+	SSH *SSH `yaml:"ssh" json:"ssh"`
+
+	ConnectionOptions `yaml:",inline"`
+}
+
+// PasswordFrom references the secret holding the password of a profile. Exactly
+// one source is set.
+type PasswordFrom struct {
+	Env         string   `yaml:"env" json:"env"`
+	File        string   `yaml:"file" json:"file"`
+	Command     []string `yaml:"command" json:"command"`
+	OptionFile  string   `yaml:"option_file" json:"option_file"`
+	OptionGroup string   `yaml:"option_group" json:"option_group"`
+	LoginPath   string   `yaml:"login_path" json:"login_path"`
+}
+
+// DatastoreSource converts the reference for the datastore
+func (p PasswordFrom) DatastoreSource() (datastore.PasswordSource, error) {
+	source := datastore.PasswordSource{
+		Env:         p.Env,
+		File:        p.File,
+		Command:     p.Command,
+		OptionFile:  p.OptionFile,
+		OptionGroup: p.OptionGroup,
+		LoginPath:   p.LoginPath,
+	}
+	if !source.Enabled() {
+		return datastore.PasswordSource{}, fmt.Errorf("password_from requires env, file, command, option_file or login_path")
+	}
+	if err := source.Validate(); err != nil {
+		return datastore.PasswordSource{}, fmt.Errorf("password_from: %w", err)
+	}
+	return source, nil
+}
+
+// SSH configures the tunnel of a profile. KeepAlive is a duration string such as "30s".
+type SSH struct {
+	Host       string `yaml:"host" json:"host"`
+	Port       string `yaml:"port" json:"port"`
+	User       string `yaml:"user" json:"user"`
+	KeyFile    string `yaml:"key_file" json:"key_file"`
+	Passphrase string `yaml:"passphrase" json:"passphrase"`
+	KnownHosts string `yaml:"known_hosts" json:"known_hosts"`
+	Agent      bool   `yaml:"agent" json:"agent"`
+	KeepAlive  string `yaml:"keep_alive" json:"keep_alive"`
+}
+
+// DatastoreOptions converts the tunnel settings for the datastore
+func (s SSH) DatastoreOptions() (datastore.SSHOptions, error) {
+	if s.Host == "" {
+		return datastore.SSHOptions{}, fmt.Errorf("ssh host is required")
+	}
+	if s.User == "" {
+		return datastore.SSHOptions{}, fmt.Errorf("ssh user is required")
+	}
+	if s.KeyFile == "" && !s.Agent {
+		return datastore.SSHOptions{}, fmt.Errorf("ssh key_file or agent is required")
+	}
+
+	opts := datastore.SSHOptions{
+		Host:       s.Host,
+		Port:       s.Port,
+		User:       s.User,
+		KeyFile:    s.KeyFile,
+		Passphrase: s.Passphrase,
+		KnownHosts: s.KnownHosts,
+		Agent:      s.Agent,
+	}
+	if s.KeepAlive != "" {
+		d, err := time.ParseDuration(s.KeepAlive)
+		if err != nil {
+			return datastore.SSHOptions{}, fmt.Errorf("invalid ssh keep_alive: %w", err)
+		}
+		opts.KeepAlive = d
+	}
+	return opts, nil
+}
+
+// ConnectParams returns the parameters of a connection with the profile. The
+// options of the profile override the given defaults.
+func (p Profile) ConnectParams(defaults datastore.Options) (datastore.ConnectParams, error) {
+	var params datastore.ConnectParams
+	if p.DSN != "" {
+		var err error
+		params, err = datastore.ParseDSN(p.DSN)
+		if err != nil {
+			return datastore.ConnectParams{}, err
+		}
+	} else {
+		params = datastore.ConnectParams{
+			Host:     p.Host,
+			Port:     p.Port,
+			Socket:   p.Socket,
+			Username: p.Username,
+			Password: p.Password,
+			Database: p.Database,
+		}
+		if params.Port == "" {
+			params.Port = "3306"
+		}
+	}
+
+	opts, err := p.DatastoreOptions()
+	if err != nil {
+		return datastore.ConnectParams{}, err
+	}
+	params.Options = defaults.Merge(opts)
+	params.Profile = true
+
+	if p.PasswordFrom != nil {
+		if p.Password != "" {
+			return datastore.ConnectParams{}, fmt.Errorf("password and password_from cannot both be set")
+		}
+		params.PasswordSource, err = p.PasswordFrom.DatastoreSource()
+		if err != nil {
+			return datastore.ConnectParams{}, err
+		}
+	}
+
+	if p.SSH != nil {
+		params.SSH, err = p.SSH.DatastoreOptions()
+		if err != nil {
+			return datastore.ConnectParams{}, err
+		}
+	}
+
+	return params, nil
+}
+
+// User is a caller of the HTTP transport identified by a bearer token or an API key
+type User struct {
+	Tokens  []string `yaml:"tokens" json:"tokens"`
+	APIKeys []string `yaml:"api_keys" json:"api_keys"`
+	Role    string   `yaml:"role" json:"role"`
+}
+
+// Role decides which connection profiles, tools and statement classes its users may use.
+// A "*" entry allows everything.
+type Role struct {
+	Profiles   []string `yaml:"profiles" json:"profiles"`
+	Tools      []string `yaml:"tools" json:"tools"`
+	Statements []string `yaml:"statements" json:"statements"`
+}
+
+// Limit restricts the request rate and concurrency. Zero values are unlimited.
+type Limit struct {
+	RequestsPerMinute float64 `yaml:"requests_per_minute" json:"requests_per_minute"`
+	Burst             int     `yaml:"burst" json:"burst"`
+	MaxConcurrent     int     `yaml:"max_concurrent" json:"max_concurrent"`
+}
+
+// Limits configures the rate limits per session and per connection profile
+type Limits struct {
+	// Session applies to every client session
+	Session Limit `yaml:"session" json:"session"`
+	// Profile applies to every connection profile without a specific limit
+	Profile Limit `yaml:"profile" json:"profile"`
+	// Profiles overrides the limit of individual connection profiles by name
+	Profiles map[string]Limit `yaml:"profiles" json:"profiles"`
+}
+
+// Enabled reports whether any limit is configured
+func (l Limits) Enabled() bool {
+	return l.Session != (Limit{}) || l.Profile != (Limit{}) || len(l.Profiles) > 0
+}
+
+// Config is the server configuration file
+type Config struct {
+	Profiles map[string]Profile `yaml:"profiles" json:"profiles"`
+	Users    map[string]User    `yaml:"users" json:"users"`
+	Roles    map[string]Role    `yaml:"roles" json:"roles"`
+	Limits   Limits             `yaml:"limits" json:"limits"`
+	// Connection holds the default options of every connection
+	Connection ConnectionOptions `yaml:"connection" json:"connection"`
+}
+
+// Load reads a YAML or JSON configuration file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	c := &Config{}
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(data, c)
+	} else {
+		err = yaml.Unmarshal(data, c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file: %w", err)
+	}
+	return c, nil
+}
+
+// Validate checks the references between users, roles and profiles
+func (c *Config) Validate() error {
+	if _, err := c.Connection.DatastoreOptions(); err != nil {
+		return fmt.Errorf("connection: %w", err)
+	}
+
+	for name, p := range c.Profiles {
+		if p.Host == "" && p.Socket == "" && p.DSN == "" {
+			return fmt.Errorf("profile %s has no host", name)
+		}
+		if _, err := p.ConnectParams(datastore.Options{}); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+
+	for name, u := range c.Users {
+		if len(u.Tokens) == 0 && len(u.APIKeys) == 0 {
+			return fmt.Errorf("user %s has no token or API key", name)
+		}
+		if _, ok := c.Roles[u.Role]; !ok {
+			return fmt.Errorf("user %s has unknown role %q", name, u.Role)
+		}
+	}
+
+	for name, r := range c.Roles {
+		for _, p := range r.Profiles {
+			if _, ok := c.Profiles[p]; !ok && p != "*" {
+				return fmt.Errorf("role %s references unknown profile %q", name, p)
+			}
+		}
+	}
+	for name := range c.Limits.Profiles {
+		if _, ok := c.Profiles[name]; !ok {
+			return fmt.Errorf("limits reference unknown profile %q", name)
+		}
+	}
+	return nil
+}
+
+// Profile returns the connection profile with the given name
+func (c *Config) Profile(name string) (Profile, bool) {
+	p, ok := c.Profiles[name]
+	return p, ok
+}
+
+// ProfileNames returns the names of all connection profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConnectionDefaults returns the default options of every connection
+func (c *Config) ConnectionDefaults() datastore.Options {
+	// Validated when the configuration is loaded
+	opts, _ := c.Connection.DatastoreOptions()
+	return opts
+}
+
+// Global configuration, empty unless a configuration file is loaded
+var Default = &Config{}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exampleConfig = `
+profiles:
+  replica:
+    host: replica.internal
+    username: reader
+    password: secret
+    database: app
+    max_open_conns: 4
+    read_timeout: 30s
+  warehouse:
+    dsn: "analyst@tcp(warehouse.internal:3306)/dw"
+    password_from:
+      env: WAREHOUSE_PASSWORD
+    ssh:
+      host: bastion.example.com
+      user: tunnel
+      key_file: /home/tunnel/.ssh/id_ed25519
+      keep_alive: 1m
+connection:
+  charset: utf8mb4
+  read_timeout: 10s
+users:
+  alice:
+    tokens: ["alice-token"]
+    role: analyst
+roles:
+  analyst:
+    profiles: [replica]
+    tools: ["*"]
+    statements: [read]
+`
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(exampleConfig), 0o600))
+
+	c, err := Load(path)
+	require.NoError(t, err)
+
+	p, ok := c.Profile("replica")
+	assert.True(t, ok)
+	assert.Equal(t, "replica.internal", p.Host)
+	assert.Equal(t, []string{"replica", "warehouse"}, c.ProfileNames())
+
+	params, err := p.ConnectParams(c.ConnectionDefaults())
+	require.NoError(t, err)
+	assert.Equal(t, "3306", params.Port)
+	assert.Equal(t, 4, params.Options.MaxOpenConns)
+	assert.Equal(t, "utf8mb4", params.Options.Charset)
+	assert.Equal(t, 30*time.Second, params.Options.ReadTimeout)
+
+	params, err = c.Profiles["warehouse"].ConnectParams(c.ConnectionDefaults())
+	require.NoError(t, err)
+	assert.Equal(t, "warehouse.internal", params.Host)
+	assert.Equal(t, "dw", params.Database)
+	assert.Empty(t, params.Password)
+	assert.Equal(t, "WAREHOUSE_PASSWORD", params.PasswordSource.Env)
+	assert.Equal(t, "bastion.example.com:22", params.SSH.Addr())
+	assert.Equal(t, "tunnel", params.SSH.User)
+	assert.Equal(t, time.Minute, params.SSH.KeepAlive)
+	assert.Equal(t, "analyst", c.Users["alice"].Role)
+	assert.Equal(t, []string{"read"}, c.Roles["analyst"].Statements)
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"profiles": {"local": {"host": "127.0.0.1", "port": "3307"}}}`), 0o600))
+
+	c, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "3307", c.Profiles["local"].Port)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{
+			name:   "profile without host",
+			config: Config{Profiles: map[string]Profile{"p": {}}},
+		},
+		{
+			name:   "user without credentials",
+			config: Config{Users: map[string]User{"u": {Role: "r"}}, Roles: map[string]Role{"r": {}}},
+		},
+		{
+			name:   "unknown role",
+			config: Config{Users: map[string]User{"u": {Tokens: []string{"t"}, Role: "missing"}}},
+		},
+		{
+			name:   "invalid duration",
+			config: Config{Profiles: map[string]Profile{"p": {Host: "h", ConnectionOptions: ConnectionOptions{ReadTimeout: "soon"}}}},
+		},
+		{
+			name:   "invalid dsn",
+			config: Config{Profiles: map[string]Profile{"p": {DSN: "not a dsn"}}},
+		},
+		{
+			name:   "ssh without credentials",
+			config: Config{Profiles: map[string]Profile{"p": {Host: "h", SSH: &SSH{Host: "bastion", User: "tunnel"}}}},
+		},
+		{
+			name:   "password_from without source",
+			config: Config{Profiles: map[string]Profile{"p": {Host: "h", PasswordFrom: &PasswordFrom{}}}},
+		},
+		{
+			name:   "password_from with two sources",
+			config: Config{Profiles: map[string]Profile{"p": {Host: "h", PasswordFrom: &PasswordFrom{Env: "PW", File: "/run/secrets/pw"}}}},
+		},
+		{
+			name:   "password and password_from",
+			config: Config{Profiles: map[string]Profile{"p": {Host: "h", Password: "pw", PasswordFrom: &PasswordFrom{Env: "PW"}}}},
+		},
+		{
+			name:   "unknown profile",
+			config: Config{Roles: map[string]Role{"r": {Profiles: []string{"missing"}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.config.Validate())
+		})
+	}
+}
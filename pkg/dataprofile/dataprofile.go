@@ -0,0 +1,385 @@
+// Package dataprofile computes the data distribution of the columns of a table
+// from bounded samples: null ratios, distinct counts, ranges, frequent values,
+// lengths and histograms.
+package dataprofile
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sqlutil"
+)
+
+// Defaults and limits of the profile options
+const (
+	DefaultSampleSize = 10000
+	MaxSampleSize     = 1000000
+	DefaultTop        = 5
+	MaxTop            = 100
+	DefaultBuckets    = 10
+	MaxBuckets        = 100
+)
+
+// Options select the columns to profile and bound the work done
+type Options struct {
+	// Columns are the columns to profile, all columns if empty
+	Columns []string
+	// SampleSize is the number of rows read from the table
+	SampleSize int
+	// Top is the number of most frequent values reported per column
+	Top int
+	// Buckets is the number of histogram buckets computed from the sample
+	Buckets int
+	// Exact reads the whole table instead of a sample
+	Exact bool
+}
+
+// Validate fills the unset options with their defaults and checks their limits
+func (o *Options) Validate() error {
+	if o.SampleSize == 0 {
+		o.SampleSize = DefaultSampleSize
+	}
+	if o.Top == 0 {
+		o.Top = DefaultTop
+	}
+	if o.Buckets == 0 {
+		o.Buckets = DefaultBuckets
+	}
+	if o.SampleSize < 1 || o.SampleSize > MaxSampleSize {
+		return fmt.Errorf("sample_size must be between 1 and %d", MaxSampleSize)
+	}
+	if o.Top < 1 || o.Top > MaxTop {
+		return fmt.Errorf("top must be between 1 and %d", MaxTop)
+	}
+	if o.Buckets < 1 || o.Buckets > MaxBuckets {
+		return fmt.Errorf("buckets must be between 1 and %d", MaxBuckets)
+	}
+	return nil
+}
+
+// TableProfile is the profile of the columns of a table
+type TableProfile struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// TableRows is the estimated row count of information_schema
+	TableRows *int64 `json:"table_rows,omitempty"`
+	// SampleRows is the number of rows the statistics are computed from
+	SampleRows int `json:"sample_rows"`
+	// Sampled is set when the sample does not cover the whole table
+	Sampled bool            `json:"sampled"`
+	Columns []ColumnProfile `json:"columns"`
+}
+
+// ColumnProfile is the data distribution of a column in the sample
+type ColumnProfile struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	NullCount int64   `json:"null_count"`
+	NullRatio float64 `json:"null_ratio"`
+	// DistinctCount is estimated for the whole table when the sample does not cover it
+	DistinctCount       *int64       `json:"distinct_count,omitempty"`
+	DistinctApproximate bool         `json:"distinct_approximate,omitempty"`
+	Min                 *string      `json:"min,omitempty"`
+	Max                 *string      `json:"max,omitempty"`
+	AvgLength           *float64     `json:"avg_length,omitempty"`
+	Top                 []ValueCount `json:"top,omitempty"`
+	Histogram           *Histogram   `json:"histogram,omitempty"`
+}
+
+// ValueCount is a value and the number of sampled rows holding it
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// kind groups column types by the statistics that make sense for them
+type kind int
+
+const (
+	kindOther kind = iota
+	kindNumeric
+	kindTemporal
+	kindString
+	kindBinary
+)
+
+var kindByType = map[string]kind{
+	"tinyint": kindNumeric, "smallint": kindNumeric, "mediumint": kindNumeric, "int": kindNumeric, "integer": kindNumeric,
+	"bigint": kindNumeric, "decimal": kindNumeric, "numeric": kindNumeric, "float": kindNumeric, "double": kindNumeric, "real": kindNumeric,
+	"date": kindTemporal, "datetime": kindTemporal, "timestamp": kindTemporal, "time": kindTemporal, "year": kindTemporal,
+	"char": kindString, "varchar": kindString, "tinytext": kindString, "text": kindString, "mediumtext": kindString,
+	"longtext": kindString, "enum": kindString, "set": kindString,
+	"binary": kindBinary, "varbinary": kindBinary, "tinyblob": kindBinary, "blob": kindBinary, "mediumblob": kindBinary, "longblob": kindBinary,
+}
+
+// columnKind returns the kind of a column type such as "int unsigned" or "varchar(255)"
+func columnKind(columnType string) kind {
+	base := strings.ToLower(columnType)
+	if i := strings.IndexAny(base, "( "); i >= 0 {
+		base = base[:i]
+	}
+	return kindByType[base]
+}
+
+// ordered reports whether values of the kind have a meaningful order and frequencies
+func (k kind) ordered() bool {
+	return k == kindNumeric || k == kindTemporal || k == kindString
+}
+
+// Profile computes the profile of the columns of a table. Statistics are computed
+// by the server over the first SampleSize rows of the table in primary key
+// order, or the whole table when Exact is set. Every statistic is computed over
+// the same rows. Histograms maintained by the server in
+// information_schema.COLUMN_STATISTICS are preferred over sampled ones.
+func Profile(ctx context.Context, ds datastore.DatastoreInterface, table *catalog.Table, opts Options) (*TableProfile, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	columns, err := selectColumns(table, opts.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = sqlutil.QuoteIdentifier(c.Name)
+	}
+	sample := "SELECT " + strings.Join(names, ", ") + " FROM " + sqlutil.QuoteQualified(table.Schema, table.Name)
+	if !opts.Exact {
+		// Every statistic is a query of its own, which must read the same rows
+		sample += " ORDER BY " + strings.Join(sampleOrder(table, names), ", ") + fmt.Sprintf(" LIMIT %d", opts.SampleSize)
+	}
+	sample = "(" + sample + ") AS sample"
+
+	p := &TableProfile{Schema: table.Schema, Table: table.Name, TableRows: table.Rows, Columns: make([]ColumnProfile, len(columns))}
+	if err := aggregate(ctx, ds, sample, columns, p); err != nil {
+		return nil, err
+	}
+	p.Sampled = !opts.Exact && p.SampleRows == opts.SampleSize
+
+	histograms, err := columnStatistics(ctx, ds, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range columns {
+		cp := &p.Columns[i]
+		k := columnKind(c.Type)
+		column := sqlutil.QuoteIdentifier(c.Name)
+
+		if k.ordered() && cp.NullCount < int64(p.SampleRows) {
+			if cp.Top, err = topValues(ctx, ds, sample, column, opts.Top); err != nil {
+				return nil, fmt.Errorf("failed to profile column %s: %w", c.Name, err)
+			}
+		}
+
+		if p.Sampled && cp.DistinctCount != nil {
+			if err := estimateDistinct(ctx, ds, sample, column, p, cp); err != nil {
+				return nil, fmt.Errorf("failed to profile column %s: %w", c.Name, err)
+			}
+		}
+
+		if h, ok := histograms[c.Name]; ok {
+			cp.Histogram = h
+		} else if (k == kindNumeric || k == kindTemporal) && cp.NullCount < int64(p.SampleRows) {
+			if cp.Histogram, err = sampleHistogram(ctx, ds, sample, column, opts.Buckets, p.SampleRows); err != nil {
+				return nil, fmt.Errorf("failed to profile column %s: %w", c.Name, err)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// sampleOrder returns the columns ordering the rows of a sample: the primary key,
+// or the quoted profiled columns of tables without one. Rows equal in all of
+// them are interchangeable, so the sample always holds the same values.
+func sampleOrder(table *catalog.Table, columns []string) []string {
+	var key []string
+	for _, c := range table.Columns {
+		if c.Key == "PRI" {
+			key = append(key, sqlutil.QuoteIdentifier(c.Name))
+		}
+	}
+	if len(key) == 0 {
+		return columns
+	}
+	return key
+}
+
+// selectColumns returns the columns of the table to profile, in table order
+func selectColumns(table *catalog.Table, names []string) ([]catalog.Column, error) {
+	if len(names) == 0 {
+		return table.Columns, nil
+	}
+
+	selected := map[string]bool{}
+	for _, name := range names {
+		found := false
+		for _, c := range table.Columns {
+			if strings.EqualFold(c.Name, name) {
+				selected[c.Name] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("column %s does not exist in %s.%s", name, table.Schema, table.Name)
+		}
+	}
+
+	var columns []catalog.Column
+	for _, c := range table.Columns {
+		if selected[c.Name] {
+			columns = append(columns, c)
+		}
+	}
+	return columns, nil
+}
+
+// aggregate computes the row count and the per column aggregates of the sample in one query
+func aggregate(ctx context.Context, ds datastore.DatastoreInterface, sample string, columns []catalog.Column, p *TableProfile) error {
+	exprs := []string{"COUNT(*)"}
+	// targets are where the aggregates of each column are scanned into
+	type targets struct {
+		nonNull, distinct sql.NullInt64
+		min, max, avgLen  sql.NullString
+		hasDistinct       bool
+	}
+	t := make([]targets, len(columns))
+	var sampleRows int64
+	dest := []interface{}{&sampleRows}
+
+	for i, c := range columns {
+		k := columnKind(c.Type)
+		column := sqlutil.QuoteIdentifier(c.Name)
+
+		exprs = append(exprs, "COUNT("+column+")")
+		dest = append(dest, &t[i].nonNull)
+		if k != kindOther {
+			t[i].hasDistinct = true
+			exprs = append(exprs, "COUNT(DISTINCT "+column+")")
+			dest = append(dest, &t[i].distinct)
+		}
+		if k.ordered() {
+			exprs = append(exprs, "MIN("+column+")", "MAX("+column+")")
+			dest = append(dest, &t[i].min, &t[i].max)
+		}
+		switch k {
+		case kindString:
+			exprs = append(exprs, "AVG(CHAR_LENGTH("+column+"))")
+			dest = append(dest, &t[i].avgLen)
+		case kindBinary:
+			exprs = append(exprs, "AVG(LENGTH("+column+"))")
+			dest = append(dest, &t[i].avgLen)
+		}
+	}
+
+	rows, err := ds.QueryContext(ctx, "SELECT "+strings.Join(exprs, ", ")+" FROM "+sample)
+	if err != nil {
+		return fmt.Errorf("failed to sample table: %w", err)
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to sample table: %w", err)
+	}
+
+	p.SampleRows = int(sampleRows)
+	for i, c := range columns {
+		cp := ColumnProfile{Name: c.Name, Type: c.Type, NullCount: sampleRows - t[i].nonNull.Int64}
+		if sampleRows > 0 {
+			cp.NullRatio = float64(cp.NullCount) / float64(sampleRows)
+		}
+		if t[i].hasDistinct {
+			distinct := t[i].distinct.Int64
+			cp.DistinctCount = &distinct
+		}
+		if t[i].min.Valid {
+			cp.Min, cp.Max = &t[i].min.String, &t[i].max.String
+		}
+		if t[i].avgLen.Valid {
+			if avg, err := strconv.ParseFloat(t[i].avgLen.String, 64); err == nil {
+				cp.AvgLength = &avg
+			}
+		}
+		p.Columns[i] = cp
+	}
+	return nil
+}
+
+// topValues returns the most frequent non-NULL values of a column in the sample
+func topValues(ctx context.Context, ds datastore.DatastoreInterface, sample, column string, top int) ([]ValueCount, error) {
+	rows, err := ds.QueryContext(ctx, fmt.Sprintf("SELECT %[1]s, COUNT(*) FROM %[2]s WHERE %[1]s IS NOT NULL GROUP BY %[1]s ORDER BY COUNT(*) DESC, %[1]s LIMIT %[3]d", column, sample, top))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load frequent values: %w", err)
+	}
+	defer rows.Close()
+
+	var values []ValueCount
+	for rows.Next() {
+		var v ValueCount
+		if err := rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return values, nil
+}
+
+// estimateDistinct scales the distinct count of the sample to the whole table with
+// the GEE estimator, from the number of values seen only once in the sample
+func estimateDistinct(ctx context.Context, ds datastore.DatastoreInterface, sample, column string, p *TableProfile, cp *ColumnProfile) error {
+	cp.DistinctApproximate = true
+	nonNull := int64(p.SampleRows) - cp.NullCount
+	if p.TableRows == nil || nonNull == 0 {
+		return nil
+	}
+
+	rows, err := ds.QueryContext(ctx, fmt.Sprintf("SELECT SUM(n = 1) FROM (SELECT COUNT(*) AS n FROM %[2]s WHERE %[1]s IS NOT NULL GROUP BY %[1]s) AS frequencies", column, sample))
+	if err != nil {
+		return fmt.Errorf("failed to estimate distinct values: %w", err)
+	}
+	defer rows.Close()
+
+	var singletons sql.NullInt64
+	if rows.Next() {
+		if err := rows.Scan(&singletons); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to estimate distinct values: %w", err)
+	}
+
+	// The non-NULL rows of the table, assuming the sample has the table's null ratio
+	total := float64(*p.TableRows) * float64(nonNull) / float64(p.SampleRows)
+	estimate := gee(*cp.DistinctCount, singletons.Int64, nonNull, total)
+	cp.DistinctCount = &estimate
+	return nil
+}
+
+// gee estimates the distinct values of total rows from a sample of n rows holding
+// distinct values, singletons of which occur once. A sample of unique values is
+// taken for a key, which GEE would underestimate.
+func gee(distinct, singletons, n int64, total float64) int64 {
+	estimate := math.Sqrt(total/float64(n))*float64(singletons) + float64(distinct-singletons)
+	if singletons == n {
+		estimate = total
+	}
+	estimate = math.Min(estimate, total)
+	return int64(math.Max(math.Round(estimate), float64(distinct)))
+}
@@ -0,0 +1,213 @@
+package dataprofile
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/mysqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnKind(t *testing.T) {
+	tests := map[string]kind{
+		"int unsigned":        kindNumeric,
+		"BIGINT(20) UNSIGNED": kindNumeric,
+		"decimal(10,2)":       kindNumeric,
+		"datetime(6)":         kindTemporal,
+		"year":                kindTemporal,
+		"varchar(255)":        kindString,
+		"enum('new','paid')":  kindString,
+		"varbinary(16)":       kindBinary,
+		"longblob":            kindBinary,
+		"json":                kindOther,
+		"bit(1)":              kindOther,
+	}
+	for columnType, expected := range tests {
+		assert.Equal(t, expected, columnKind(columnType), columnType)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	opts := Options{}
+	require.NoError(t, opts.Validate())
+	assert.Equal(t, Options{SampleSize: DefaultSampleSize, Top: DefaultTop, Buckets: DefaultBuckets}, opts)
+
+	for _, invalid := range []Options{
+		{SampleSize: -1},
+		{SampleSize: MaxSampleSize + 1},
+		{Top: MaxTop + 1},
+		{Buckets: -5},
+	} {
+		assert.Error(t, invalid.Validate(), "%+v", invalid)
+	}
+}
+
+func TestParseHistogram(t *testing.T) {
+	singleton := `{"buckets": [["base64:type254:bmV3", 0.25], ["base64:type254:cGFpZA==", 0.9]], "data-type": "string", "null-values": 0.1, "histogram-type": "singleton"}`
+	h, err := parseHistogram([]byte(singleton))
+	require.NoError(t, err)
+	assert.Equal(t, HistogramColumnStatistics, h.Source)
+	assert.Equal(t, "singleton", h.Type)
+	require.Len(t, h.Buckets, 2)
+	assert.Equal(t, "new", h.Buckets[0].Lower)
+	assert.Equal(t, "paid", h.Buckets[1].Upper)
+	assert.InDelta(t, 0.25, h.Buckets[0].Frequency, 1e-9)
+	assert.InDelta(t, 0.65, h.Buckets[1].Frequency, 1e-9)
+
+	equiHeight := `{"buckets": [[1, 50, 0.5, 50], [51, 12345678901234567, 1.0, 40]], "histogram-type": "equi-height"}`
+	h, err = parseHistogram([]byte(equiHeight))
+	require.NoError(t, err)
+	assert.Equal(t, []Bucket{
+		{Lower: "1", Upper: "50", Frequency: 0.5, Distinct: 50},
+		{Lower: "51", Upper: "12345678901234567", Frequency: 0.5, Distinct: 40},
+	}, h.Buckets)
+
+	_, err = parseHistogram([]byte(`{"buckets": [[1]], "histogram-type": "equi-height"}`))
+	assert.Error(t, err)
+}
+
+func TestSampleOrder(t *testing.T) {
+	keyed := &catalog.Table{Columns: []catalog.Column{{Name: "tenant", Key: "PRI"}, {Name: "id", Key: "PRI"}, {Name: "total"}}}
+	assert.Equal(t, []string{"`tenant`", "`id`"}, sampleOrder(keyed, []string{"`total`"}))
+
+	// Without a primary key, rows tied on every profiled column hold the same values
+	heap := &catalog.Table{Columns: []catalog.Column{{Name: "message"}, {Name: "level", Key: "MUL"}}}
+	assert.Equal(t, []string{"`message`", "`level`"}, sampleOrder(heap, []string{"`message`", "`level`"}))
+}
+
+func TestGEE(t *testing.T) {
+	// All values of the sample are unique: likely a key, scaled to the table
+	assert.Equal(t, int64(1000), gee(100, 100, 100, 1000))
+	// No value seen once: the sample has seen all values
+	assert.Equal(t, int64(3), gee(3, 0, 100, 1000))
+	// Never less than seen
+	assert.Equal(t, int64(10), gee(10, 1, 100, 5))
+}
+
+// sample is the derived table of TestProfile, ordered by primary key so that
+// every statistic reads the same rows
+const sample = "(SELECT `id`, `status`, `payload` FROM `shop`.`orders` ORDER BY `id` LIMIT 4) AS sample"
+
+// histogramQuery is the query computing the sampled histogram of a column
+func histogramQuery(column, sample string, buckets int) string {
+	return fmt.Sprintf("SELECT MIN(v), MAX(v), COUNT(*), COUNT(DISTINCT v) FROM (SELECT v, MIN(tile) OVER (PARTITION BY v) AS bucket FROM (SELECT %[1]s AS v, NTILE(%[3]d) OVER (ORDER BY %[1]s) AS tile FROM %[2]s WHERE %[1]s IS NOT NULL) AS tiles) AS buckets GROUP BY bucket ORDER BY bucket", column, sample, buckets)
+}
+
+func TestProfile(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SELECT COUNT(*), COUNT(`id`), COUNT(DISTINCT `id`), MIN(`id`), MAX(`id`), COUNT(`status`), COUNT(DISTINCT `status`), MIN(`status`), MAX(`status`), AVG(CHAR_LENGTH(`status`)), COUNT(`payload`), COUNT(DISTINCT `payload`), AVG(LENGTH(`payload`)) FROM "+sample, mysqltest.Result{
+		Columns: []string{"c1", "c2", "c3", "c4", "c5", "c6", "c7", "c8", "c9", "c10", "c11", "c12", "c13"},
+		Rows:    [][]interface{}{{4, 4, 4, 1, 4, 3, 2, "new", "paid", "3.6667", 0, 0, nil}},
+	})
+	server.Handle("SELECT COLUMN_NAME, HISTOGRAM FROM information_schema.COLUMN_STATISTICS WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?", mysqltest.Result{
+		Columns: []string{"COLUMN_NAME", "HISTOGRAM"},
+		Rows:    [][]interface{}{{"status", `{"buckets": [["base64:type254:bmV3", 0.6], ["base64:type254:cGFpZA==", 0.9]], "histogram-type": "singleton"}`}},
+	})
+	server.Handle("SELECT `id`, COUNT(*) FROM "+sample+" WHERE `id` IS NOT NULL GROUP BY `id` ORDER BY COUNT(*) DESC, `id` LIMIT 2", mysqltest.Result{
+		Columns: []string{"id", "COUNT(*)"},
+		Rows:    [][]interface{}{{1, 1}, {2, 1}},
+	})
+	server.Handle("SELECT `status`, COUNT(*) FROM "+sample+" WHERE `status` IS NOT NULL GROUP BY `status` ORDER BY COUNT(*) DESC, `status` LIMIT 2", mysqltest.Result{
+		Columns: []string{"status", "COUNT(*)"},
+		Rows:    [][]interface{}{{"new", 2}, {"paid", 1}},
+	})
+	server.Handle("SELECT SUM(n = 1) FROM (SELECT COUNT(*) AS n FROM "+sample+" WHERE `id` IS NOT NULL GROUP BY `id`) AS frequencies", mysqltest.Result{
+		Columns: []string{"SUM(n = 1)"},
+		Rows:    [][]interface{}{{4}},
+	})
+	server.Handle("SELECT SUM(n = 1) FROM (SELECT COUNT(*) AS n FROM "+sample+" WHERE `status` IS NOT NULL GROUP BY `status`) AS frequencies", mysqltest.Result{
+		Columns: []string{"SUM(n = 1)"},
+		Rows:    [][]interface{}{{1}},
+	})
+	server.Handle(histogramQuery("`id`", sample, 2), mysqltest.Result{
+		Columns: []string{"MIN(v)", "MAX(v)", "COUNT(*)", "COUNT(DISTINCT v)"},
+		Rows:    [][]interface{}{{1, 2, 2, 2}, {3, 4, 2, 2}},
+	})
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	tableRows := int64(400)
+	table := &catalog.Table{Schema: "shop", Name: "orders", Rows: &tableRows, Columns: []catalog.Column{
+		{Name: "id", Type: "int unsigned", Key: "PRI"},
+		{Name: "status", Type: "varchar(20)"},
+		{Name: "payload", Type: "blob"},
+		{Name: "created_at", Type: "datetime"},
+	}}
+
+	p, err := Profile(context.Background(), ds, table, Options{Columns: []string{"payload", "ID", "status"}, SampleSize: 4, Top: 2, Buckets: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 4, p.SampleRows)
+	assert.True(t, p.Sampled)
+	require.Len(t, p.Columns, 3)
+
+	// Columns are profiled in table order
+	id, status, payload := p.Columns[0], p.Columns[1], p.Columns[2]
+	assert.Equal(t, "id", id.Name)
+	assert.Equal(t, "1", *id.Min)
+	assert.Equal(t, "4", *id.Max)
+	assert.True(t, id.DistinctApproximate)
+	assert.Equal(t, int64(400), *id.DistinctCount)
+	assert.Equal(t, []ValueCount{{Value: "1", Count: 1}, {Value: "2", Count: 1}}, id.Top)
+	assert.Equal(t, &Histogram{Source: HistogramSample, Type: "equi-height", Buckets: []Bucket{
+		{Lower: "1", Upper: "2", Frequency: 0.5, Distinct: 2},
+		{Lower: "3", Upper: "4", Frequency: 0.5, Distinct: 2},
+	}}, id.Histogram)
+
+	assert.Equal(t, int64(1), status.NullCount)
+	assert.InDelta(t, 0.25, status.NullRatio, 1e-9)
+	assert.InDelta(t, 3.6667, *status.AvgLength, 1e-9)
+	assert.Equal(t, []ValueCount{{Value: "new", Count: 2}, {Value: "paid", Count: 1}}, status.Top)
+	// The server histogram is preferred over the sample
+	assert.Equal(t, HistogramColumnStatistics, status.Histogram.Source)
+
+	// A column of NULLs has no values to describe
+	assert.Equal(t, 1.0, payload.NullRatio)
+	assert.Nil(t, payload.AvgLength)
+	assert.Nil(t, payload.Top)
+	assert.Nil(t, payload.Histogram)
+
+	_, err = Profile(context.Background(), ds, table, Options{Columns: []string{"missing"}})
+	assert.EqualError(t, err, "column missing does not exist in shop.orders")
+}
+
+// Test that exact profiles compute every statistic over the whole table
+func TestProfileExact(t *testing.T) {
+	const whole = "(SELECT `id` FROM `shop`.`orders`) AS sample"
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SELECT COUNT(*), COUNT(`id`), COUNT(DISTINCT `id`), MIN(`id`), MAX(`id`) FROM "+whole, mysqltest.Result{
+		Columns: []string{"c1", "c2", "c3", "c4", "c5"},
+		Rows:    [][]interface{}{{4, 4, 4, 1, 4}},
+	})
+	server.Handle("SELECT COLUMN_NAME, HISTOGRAM FROM information_schema.COLUMN_STATISTICS WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?", mysqltest.Result{
+		Columns: []string{"COLUMN_NAME", "HISTOGRAM"},
+	})
+	server.Handle("SELECT `id`, COUNT(*) FROM "+whole+" WHERE `id` IS NOT NULL GROUP BY `id` ORDER BY COUNT(*) DESC, `id` LIMIT 1", mysqltest.Result{
+		Columns: []string{"id", "COUNT(*)"},
+		Rows:    [][]interface{}{{1, 1}},
+	})
+	server.Handle(histogramQuery("`id`", whole, 2), mysqltest.Result{
+		Columns: []string{"MIN(v)", "MAX(v)", "COUNT(*)", "COUNT(DISTINCT v)"},
+		Rows:    [][]interface{}{{1, 2, 2, 2}, {3, 4, 2, 2}},
+	})
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	table := &catalog.Table{Schema: "shop", Name: "orders", Columns: []catalog.Column{{Name: "id", Type: "int"}}}
+	p, err := Profile(context.Background(), ds, table, Options{SampleSize: 2, Top: 1, Buckets: 2, Exact: true})
+	require.NoError(t, err)
+	assert.Equal(t, 4, p.SampleRows)
+	assert.False(t, p.Sampled)
+	assert.Equal(t, int64(4), *p.Columns[0].DistinctCount)
+	assert.Equal(t, &Histogram{Source: HistogramSample, Type: "equi-height", Buckets: []Bucket{
+		{Lower: "1", Upper: "2", Frequency: 0.5, Distinct: 2},
+		{Lower: "3", Upper: "4", Frequency: 0.5, Distinct: 2},
+	}}, p.Columns[0].Histogram)
+}
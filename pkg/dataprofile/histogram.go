@@ -0,0 +1,171 @@
+package dataprofile
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Sources of histograms
+const (
+	HistogramColumnStatistics = "column_statistics"
+	HistogramSample           = "sample"
+)
+
+// Errors of servers without information_schema.COLUMN_STATISTICS or window functions
+const (
+	errUnknownTable = 1109
+	errParse        = 1064
+)
+
+// Histogram is the distribution of the non-NULL values of a column
+type Histogram struct {
+	// Source is column_statistics for the histograms of ANALYZE TABLE ... UPDATE HISTOGRAM,
+	// or sample for equi-height histograms computed from the sample
+	Source string `json:"source"`
+	// Type is equi-height or singleton
+	Type    string   `json:"type"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Bucket is a range of values of a histogram. Singleton buckets hold one value,
+// their lower and upper bounds are equal.
+type Bucket struct {
+	Lower string `json:"lower"`
+	Upper string `json:"upper"`
+	// Frequency is the fraction of the rows whose value falls in the bucket
+	Frequency float64 `json:"frequency"`
+	// Distinct is the number of distinct values of an equi-height bucket
+	Distinct int64 `json:"distinct,omitempty"`
+}
+
+// columnStatistics loads the histograms maintained by the server for the columns
+// of a table, by column name. Servers without histograms have none.
+func columnStatistics(ctx context.Context, ds datastore.DatastoreInterface, schema, table string) (map[string]*Histogram, error) {
+	histograms := map[string]*Histogram{}
+
+	rows, err := ds.QueryContext(ctx, "SELECT COLUMN_NAME, HISTOGRAM FROM information_schema.COLUMN_STATISTICS WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?", schema, table)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errUnknownTable {
+		return histograms, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load column statistics: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column string
+		var data []byte
+		if err := rows.Scan(&column, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		h, err := parseHistogram(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid histogram of column %s: %w", column, err)
+		}
+		histograms[column] = h
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return histograms, nil
+}
+
+// parseHistogram reads a histogram of information_schema.COLUMN_STATISTICS. Its
+// buckets hold cumulative frequencies: [value, frequency] for singleton histograms
+// and [lower, upper, frequency, distinct] for equi-height ones.
+func parseHistogram(data []byte) (*Histogram, error) {
+	var raw struct {
+		Type    string          `json:"histogram-type"`
+		Buckets [][]interface{} `json:"buckets"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	h := &Histogram{Source: HistogramColumnStatistics, Type: raw.Type, Buckets: []Bucket{}}
+	var previous float64
+	for _, b := range raw.Buckets {
+		var bucket Bucket
+		var cumulative json.Number
+		switch {
+		case raw.Type == "singleton" && len(b) == 2:
+			bucket.Lower = histogramValue(b[0])
+			bucket.Upper = bucket.Lower
+			cumulative, _ = b[1].(json.Number)
+		case raw.Type == "equi-height" && len(b) == 4:
+			bucket.Lower = histogramValue(b[0])
+			bucket.Upper = histogramValue(b[1])
+			cumulative, _ = b[2].(json.Number)
+			distinct, _ := b[3].(json.Number)
+			bucket.Distinct, _ = distinct.Int64()
+		default:
+			return nil, fmt.Errorf("unexpected %s bucket %v", raw.Type, b)
+		}
+
+		frequency, err := cumulative.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid frequency in bucket %v", b)
+		}
+		bucket.Frequency = frequency - previous
+		previous = frequency
+		h.Buckets = append(h.Buckets, bucket)
+	}
+	return h, nil
+}
+
+// histogramValue formats a bucket value. Strings are stored as
+// base64:type<N>:<base64 data>.
+func histogramValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if rest, ok := strings.CutPrefix(s, "base64:"); ok {
+		if _, encoded, ok := strings.Cut(rest, ":"); ok {
+			if decoded, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+				return string(decoded)
+			}
+		}
+	}
+	return s
+}
+
+// sampleHistogram computes an equi-height histogram of the non-NULL values of a
+// column in the sample. The server splits the ordered values into tiles and
+// moves every value to the first tile holding it, so that a value never spans
+// two buckets. Servers without window functions have no sampled histograms.
+func sampleHistogram(ctx context.Context, ds datastore.DatastoreInterface, sample, column string, buckets, sampleRows int) (*Histogram, error) {
+	tiles := fmt.Sprintf("SELECT %[1]s AS v, NTILE(%[3]d) OVER (ORDER BY %[1]s) AS tile FROM %[2]s WHERE %[1]s IS NOT NULL", column, sample, buckets)
+	rows, err := ds.QueryContext(ctx, "SELECT MIN(v), MAX(v), COUNT(*), COUNT(DISTINCT v) FROM (SELECT v, MIN(tile) OVER (PARTITION BY v) AS bucket FROM ("+tiles+") AS tiles) AS buckets GROUP BY bucket ORDER BY bucket")
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errParse {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute histogram: %w", err)
+	}
+	defer rows.Close()
+
+	h := &Histogram{Source: HistogramSample, Type: "equi-height", Buckets: []Bucket{}}
+	for rows.Next() {
+		var b Bucket
+		var count int64
+		if err := rows.Scan(&b.Lower, &b.Upper, &count, &b.Distinct); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		b.Frequency = float64(count) / float64(sampleRows)
+		h.Buckets = append(h.Buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return h, nil
+}
@@ -0,0 +1,103 @@
+package datastore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/optionfile"
+)
+
+// DefaultGroups are the option file groups read for connection defaults, later
+// groups overriding earlier ones
+var DefaultGroups = []string{"client", "mysql-mcp"}
+
+// Defaults fill the settings that the parameters of a connection leave unset.
+// They are usually read from MySQL option files with DefaultsFromOptionFile.
+var Defaults ConnectParams
+
+// DefaultsFromOptionFile reads the connection settings of the groups of an option file
+func DefaultsFromOptionFile(f optionfile.File, groups ...string) (ConnectParams, error) {
+	options := f.Options(groups...)
+
+	d := ConnectParams{
+		Host:     options["host"],
+		Port:     options["port"],
+		Socket:   options["socket"],
+		Username: options["user"],
+		Password: options["password"],
+		Database: options["database"],
+		Options: Options{
+			Charset: options["default_character_set"],
+			SSLCA:   options["ssl_ca"],
+			SSLCert: options["ssl_cert"],
+			SSLKey:  options["ssl_key"],
+		},
+	}
+
+	// The mysql client spells modes as VERIFY_IDENTITY
+	if mode, ok := options["ssl_mode"]; ok {
+		d.Options.SSLMode = strings.ToLower(strings.ReplaceAll(mode, "_", "-"))
+		if err := ValidateSSLMode(d.Options.SSLMode); err != nil {
+			return ConnectParams{}, err
+		}
+	}
+	if _, ok := options["skip_ssl"]; ok {
+		d.Options.SSLMode = SSLModeDisabled
+	}
+
+	if timeout, ok := options["connect_timeout"]; ok {
+		seconds, err := strconv.Atoi(timeout)
+		if err != nil {
+			return ConnectParams{}, fmt.Errorf("invalid connect_timeout %q", timeout)
+		}
+		d.Options.Timeout = time.Duration(seconds) * time.Second
+	}
+
+	return d, nil
+}
+
+// WithDefaults fills the unset settings of the parameters from d. The address is
+// only taken from d when the parameters have none, together with its port, and
+// is localhost when d has none either. The credentials and TLS settings of d
+// are only used for the server of d, never for another address or a profile.
+func (p ConnectParams) WithDefaults(d ConnectParams) ConnectParams {
+	// A DSN is complete, only the options apply to it
+	if p.DSN != "" {
+		p.Options = d.Options.WithoutTLS().Merge(p.Options)
+		return p
+	}
+
+	// The address of d includes its port, the default one when it has none
+	sameServer := p.Host == "" && p.Socket == ""
+	if sameServer {
+		p.Host = d.Host
+		p.Socket = d.Socket
+		if p.Host == "" && p.Socket == "" {
+			p.Host = "localhost"
+		}
+		if d.Port != "" {
+			p.Port = d.Port
+		} else if p.Port != "" && p.Port != "3306" {
+			sameServer = false
+		}
+	}
+
+	defaults := d.Options
+	if !sameServer || p.Profile {
+		defaults = defaults.WithoutTLS()
+	}
+	p.Options = defaults.Merge(p.Options)
+
+	if sameServer && p.Username == "" {
+		p.Username = d.Username
+	}
+	if sameServer && p.Password == "" && !p.PasswordSource.Enabled() {
+		p.Password = d.Password
+	}
+	if p.Database == "" {
+		p.Database = d.Database
+	}
+	return p
+}
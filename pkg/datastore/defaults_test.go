@@ -0,0 +1,146 @@
+package datastore
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/mysqltest"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/optionfile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultsFromOptionFile(t *testing.T) {
+	f, err := optionfile.Parse(strings.NewReader(`
+[client]
+host = db.internal
+port = 3307
+user = app
+password = secret
+ssl-mode = VERIFY_IDENTITY
+ssl-ca = /etc/mysql/ca.pem
+default-character-set = utf8mb4
+connect-timeout = 5
+
+[mysql-mcp]
+user = mcp
+database = shop
+
+[mysql]
+database = ignored
+`))
+	require.NoError(t, err)
+
+	d, err := DefaultsFromOptionFile(f, DefaultGroups...)
+	require.NoError(t, err)
+	assert.Equal(t, "db.internal", d.Host)
+	assert.Equal(t, "3307", d.Port)
+	assert.Equal(t, "mcp", d.Username)
+	assert.Equal(t, "secret", d.Password)
+	assert.Equal(t, "shop", d.Database)
+	assert.Equal(t, SSLModeVerifyIdentity, d.Options.SSLMode)
+	assert.Equal(t, "/etc/mysql/ca.pem", d.Options.SSLCA)
+	assert.Equal(t, "utf8mb4", d.Options.Charset)
+	assert.Equal(t, 5*time.Second, d.Options.Timeout)
+
+	for _, content := range []string{"[client]\nssl-mode = sometimes\n", "[client]\nconnect-timeout = soon\n"} {
+		f, err := optionfile.Parse(strings.NewReader(content))
+		require.NoError(t, err)
+		_, err = DefaultsFromOptionFile(f, "client")
+		assert.Error(t, err, content)
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	d := ConnectParams{
+		Host: "db.internal", Port: "3307", Username: "app", Password: "secret", Database: "shop",
+		Options: Options{Charset: "utf8mb4", SSLMode: SSLModeRequired},
+	}
+
+	tests := []struct {
+		name     string
+		params   ConnectParams
+		expected ConnectParams
+	}{
+		{
+			name:   "unset parameters",
+			params: ConnectParams{Port: "3306"},
+			expected: ConnectParams{
+				Host: "db.internal", Port: "3307", Username: "app", Password: "secret", Database: "shop",
+				Options: Options{Charset: "utf8mb4", SSLMode: SSLModeRequired},
+			},
+		},
+		{
+			name:   "explicit parameters",
+			params: ConnectParams{Host: "replica.internal", Port: "3306", Username: "reader", Password: "pw", Database: "app", Options: Options{SSLMode: SSLModeDisabled}},
+			expected: ConnectParams{
+				Host: "replica.internal", Port: "3306", Username: "reader", Password: "pw", Database: "app",
+				Options: Options{Charset: "utf8mb4", SSLMode: SSLModeDisabled},
+			},
+		},
+		{
+			name:   "socket",
+			params: ConnectParams{Socket: "/tmp/mysql.sock", Port: "3306", PasswordSource: PasswordSource{Env: "PW"}},
+			expected: ConnectParams{
+				Socket: "/tmp/mysql.sock", Port: "3306", Database: "shop", PasswordSource: PasswordSource{Env: "PW"},
+				Options: Options{Charset: "utf8mb4"},
+			},
+		},
+		{
+			name:   "credentials of another server",
+			params: ConnectParams{Host: "attacker.example", Port: "3306"},
+			expected: ConnectParams{
+				Host: "attacker.example", Port: "3306", Database: "shop",
+				Options: Options{Charset: "utf8mb4"},
+			},
+		},
+		{
+			name:   "profile",
+			params: ConnectParams{Host: "db.internal", Port: "3307", Username: "reader", Options: Options{SSLCA: "/etc/mysql/ca.pem"}, Profile: true},
+			expected: ConnectParams{
+				Host: "db.internal", Port: "3307", Username: "reader", Database: "shop", Profile: true,
+				Options: Options{Charset: "utf8mb4", SSLCA: "/etc/mysql/ca.pem"},
+			},
+		},
+		{
+			name:   "dsn",
+			params: ConnectParams{DSN: "reader@tcp(replica.internal:3306)/app", Host: "replica.internal", Port: "3306", Username: "reader", Database: "app"},
+			expected: ConnectParams{
+				DSN: "reader@tcp(replica.internal:3306)/app", Host: "replica.internal", Port: "3306", Username: "reader", Database: "app",
+				Options: Options{Charset: "utf8mb4"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.params.WithDefaults(d))
+		})
+	}
+
+	// A host without a port is the server of the default port
+	d = ConnectParams{Host: "db.internal", Username: "app", Password: "secret"}
+	assert.Equal(t, ConnectParams{Host: "db.internal", Port: "3306", Username: "app", Password: "secret"}, ConnectParams{Port: "3306"}.WithDefaults(d))
+	assert.Equal(t, ConnectParams{Host: "db.internal", Port: "3307"}, ConnectParams{Port: "3307"}.WithDefaults(d))
+
+	// Without an address the credentials are used for localhost, like the mysql client does
+	d = ConnectParams{Username: "app", Password: "secret"}
+	assert.Equal(t, ConnectParams{Host: "localhost", Port: "3306", Username: "app", Password: "secret"}, ConnectParams{Port: "3306"}.WithDefaults(d))
+}
+
+func TestConnectWithDefaults(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+
+	previous := Defaults
+	Defaults = ConnectParams{Socket: server.Addr, Username: "app", Database: "shop"}
+	defer func() { Defaults = previous }()
+
+	d := &MySQLDatastore{}
+	require.NoError(t, d.Connect(context.Background(), ConnectParams{Port: "3306"}))
+	defer d.Close()
+
+	assert.Equal(t, "app@unix("+server.Addr+")/shop", d.Identity())
+	assert.Equal(t, []string{"shop"}, server.Databases())
+}
@@ -0,0 +1,198 @@
+package datastore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ConnectionState is the health of a connection
+type ConnectionState string
+
+// Connection states
+const (
+	StateDisconnected ConnectionState = "disconnected"
+	StateConnected    ConnectionState = "connected"
+	// StateDegraded means the last health check failed and the next one decides whether to reconnect
+	StateDegraded     ConnectionState = "degraded"
+	StateReconnecting ConnectionState = "reconnecting"
+	// StateFailed means reconnecting gave up, a new connect is needed
+	StateFailed ConnectionState = "failed"
+)
+
+// Health describes the state of a connection
+type Health struct {
+	State     ConnectionState `json:"state"`
+	Since     time.Time       `json:"since"`
+	LastCheck time.Time       `json:"last_check,omitempty"`
+	LastError string          `json:"last_error,omitempty"`
+	// Attempts counts the reconnection attempts of the reconnecting state
+	Attempts int `json:"reconnect_attempts,omitempty"`
+}
+
+// Usable reports whether queries can be sent over the connection
+func (h Health) Usable() bool {
+	return h.State == StateConnected || h.State == StateDegraded
+}
+
+// HealthNotifier is implemented by datastores reporting changes of their health
+type HealthNotifier interface {
+	NotifyHealth(listener func(Health))
+}
+
+// HealthCheck configures the monitoring of connections
+type HealthCheck struct {
+	// Interval between pings, monitoring is disabled when it is zero
+	Interval time.Duration
+	// InitialBackoff is the wait after the first failed reconnection, doubled up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxAttempts is the number of reconnections before giving up
+	MaxAttempts int
+}
+
+// DefaultHealthCheck is the monitoring applied to new connections
+var DefaultHealthCheck = HealthCheck{
+	Interval:       15 * time.Second,
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	MaxAttempts:    10,
+}
+
+// healthMonitor pings a connection on an interval and reconnects it when pings keep failing
+type healthMonitor struct {
+	check     HealthCheck
+	ping      func(ctx context.Context) error
+	reconnect func(ctx context.Context) error
+	notify    func(Health)
+
+	mu     sync.Mutex
+	health Health
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newHealthMonitor(check HealthCheck, ping, reconnect func(ctx context.Context) error, notify func(Health)) *healthMonitor {
+	return &healthMonitor{
+		check:     check,
+		ping:      ping,
+		reconnect: reconnect,
+		notify:    notify,
+		health:    Health{State: StateConnected, Since: time.Now()},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Health returns the current state
+func (m *healthMonitor) Health() Health {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.health
+}
+
+// set records a state, notifying the listener when it changed
+func (m *healthMonitor) set(state ConnectionState, err error, attempts int) {
+	m.mu.Lock()
+	changed := m.health.State != state || m.health.Attempts != attempts
+	now := time.Now()
+	if m.health.State != state {
+		m.health.Since = now
+	}
+	m.health.State = state
+	m.health.LastCheck = now
+	m.health.Attempts = attempts
+	m.health.LastError = ""
+	if err != nil {
+		m.health.LastError = err.Error()
+	}
+	health := m.health
+	m.mu.Unlock()
+
+	if changed && m.notify != nil {
+		m.notify(health)
+	}
+}
+
+// start runs the monitor until Stop is called or reconnecting gives up
+func (m *healthMonitor) start() {
+	go func() {
+		defer close(m.done)
+
+		ticker := time.NewTicker(m.check.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+
+			if !m.checkOnce() {
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the monitoring and waits for a running check to finish
+func (m *healthMonitor) Stop() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	<-m.done
+}
+
+// checkOnce pings the connection. A first failure degrades the connection, a
+// second one starts reconnecting. It returns false once the monitor gave up.
+func (m *healthMonitor) checkOnce() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), m.pingTimeout())
+	err := m.ping(ctx)
+	cancel()
+
+	if err == nil {
+		m.set(StateConnected, nil, 0)
+		return true
+	}
+	if m.Health().State == StateConnected {
+		m.set(StateDegraded, err, 0)
+		return true
+	}
+	return m.reconnectWithBackoff(err)
+}
+
+// reconnectWithBackoff reopens the connection until it succeeds, the monitor is
+// stopped or the attempts are exhausted
+func (m *healthMonitor) reconnectWithBackoff(err error) bool {
+	backoff := m.check.InitialBackoff
+	for attempt := 1; attempt <= m.check.MaxAttempts; attempt++ {
+		m.set(StateReconnecting, err, attempt)
+
+		ctx, cancel := context.WithTimeout(context.Background(), m.pingTimeout())
+		err = m.reconnect(ctx)
+		cancel()
+		if err == nil {
+			m.set(StateConnected, nil, 0)
+			return true
+		}
+
+		select {
+		case <-m.stop:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, m.check.MaxBackoff)
+	}
+
+	m.set(StateFailed, err, 0)
+	return false
+}
+
+// pingTimeout bounds a ping or a reconnection
+func (m *healthMonitor) pingTimeout() time.Duration {
+	return max(m.check.Interval, 5*time.Second)
+}
@@ -0,0 +1,126 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/mysqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testHealthCheck = HealthCheck{
+	Interval:       10 * time.Millisecond,
+	InitialBackoff: 5 * time.Millisecond,
+	MaxBackoff:     20 * time.Millisecond,
+	MaxAttempts:    3,
+}
+
+// stateRecorder collects the notified states
+type stateRecorder struct {
+	mu     sync.Mutex
+	states []ConnectionState
+}
+
+func (r *stateRecorder) notify(h Health) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, h.State)
+}
+
+func (r *stateRecorder) get() []ConnectionState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ConnectionState(nil), r.states...)
+}
+
+func TestHealthMonitorCheck(t *testing.T) {
+	pingErr := errors.New("connection refused")
+	reconnectErr := errors.New("connection refused")
+	reconnects := 0
+
+	var recorder stateRecorder
+	m := newHealthMonitor(testHealthCheck,
+		func(ctx context.Context) error { return pingErr },
+		func(ctx context.Context) error { reconnects++; return reconnectErr },
+		recorder.notify,
+	)
+
+	// A first failure degrades the connection
+	assert.True(t, m.checkOnce())
+	assert.Equal(t, StateDegraded, m.Health().State)
+	assert.Equal(t, "connection refused", m.Health().LastError)
+
+	// A second one reconnects, giving up after the attempts are exhausted
+	assert.False(t, m.checkOnce())
+	assert.Equal(t, StateFailed, m.Health().State)
+	assert.Equal(t, 3, reconnects)
+	assert.Equal(t, []ConnectionState{StateDegraded, StateReconnecting, StateReconnecting, StateReconnecting, StateFailed}, recorder.get())
+
+	// A successful reconnection restores the connection
+	m.set(StateDegraded, nil, 0)
+	reconnectErr = nil
+	assert.True(t, m.checkOnce())
+	assert.Equal(t, StateConnected, m.Health().State)
+
+	// So does a successful ping of a degraded connection
+	m.set(StateDegraded, nil, 0)
+	pingErr = nil
+	assert.True(t, m.checkOnce())
+	assert.Equal(t, StateConnected, m.Health().State)
+}
+
+func TestHealthMonitorStop(t *testing.T) {
+	m := newHealthMonitor(testHealthCheck,
+		func(ctx context.Context) error { return nil },
+		func(ctx context.Context) error { return nil },
+		nil,
+	)
+	m.start()
+	m.Stop()
+	// Stopping twice is a no-op
+	m.Stop()
+}
+
+func TestReconnectAfterServerRestart(t *testing.T) {
+	previous := DefaultHealthCheck
+	DefaultHealthCheck = testHealthCheck
+	DefaultHealthCheck.MaxAttempts = 100
+	defer func() { DefaultHealthCheck = previous }()
+
+	server := mysqltest.NewUnixServer(t)
+
+	var recorder stateRecorder
+	d := &MySQLDatastore{}
+	d.NotifyHealth(recorder.notify)
+	require.NoError(t, d.Connect(context.Background(), ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer d.Close()
+	assert.Equal(t, StateConnected, d.Health().State)
+
+	// The server goes away
+	server.Close()
+	assert.Eventually(t, func() bool {
+		return d.Health().State == StateReconnecting
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.False(t, d.IsConnected())
+	assert.Error(t, d.CheckConnection())
+
+	// and comes back on the same socket
+	restarted := mysqltest.NewServer(t, "unix", server.Addr)
+	assert.Eventually(t, func() bool {
+		return d.Health().State == StateConnected
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.True(t, d.IsConnected())
+	assert.Positive(t, restarted.Connections())
+
+	states := recorder.get()
+	assert.Contains(t, states, StateDegraded)
+	assert.Contains(t, states, StateReconnecting)
+	assert.Equal(t, StateConnected, states[len(states)-1])
+
+	require.NoError(t, d.Close())
+	assert.Equal(t, StateDisconnected, d.Health().State)
+}
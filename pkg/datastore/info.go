@@ -0,0 +1,107 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+)
+
+// sessionInfoQuery reads the session settings reported by Info
+const sessionInfoQuery = "SELECT DATABASE(), VERSION(), @@SESSION.sql_mode, @@SESSION.time_zone, @@SESSION.character_set_connection, @@SESSION.collation_connection"
+
+// ConnectionInfo describes what a datastore is connected to
+type ConnectionInfo struct {
+	Host   string `json:"host,omitempty"`
+	Port   string `json:"port,omitempty"`
+	Socket string `json:"socket,omitempty"`
+	// SSHHost is the bastion the connection goes through
+	SSHHost  string `json:"ssh_host,omitempty"`
+	User     string `json:"user"`
+	Database string `json:"database"`
+
+	ServerVersion string `json:"server_version"`
+	SQLMode       string `json:"sql_mode"`
+	TimeZone      string `json:"time_zone"`
+	CharacterSet  string `json:"character_set"`
+	Collation     string `json:"collation"`
+	// TLSCipher is empty when the connection is not encrypted
+	TLSCipher string `json:"tls_cipher,omitempty"`
+	TLS       bool   `json:"tls"`
+
+	State ConnectionState `json:"state"`
+	Pool  PoolStats       `json:"pool"`
+}
+
+// PoolStats are the statistics of the connection pool
+type PoolStats struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDuration       string `json:"wait_duration"`
+	MaxIdleClosed      int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+}
+
+// Info reports the server and session settings of the connection and the pool statistics
+func (d *MySQLDatastore) Info(ctx context.Context) (ConnectionInfo, error) {
+	if err := d.CheckConnection(); err != nil {
+		return ConnectionInfo{}, err
+	}
+
+	d.mu.RLock()
+	params := d.params
+	conn := d.conn
+	state := d.health().State
+	d.mu.RUnlock()
+	if conn == nil {
+		return ConnectionInfo{}, fmt.Errorf("not connected to a database, use connect tool first")
+	}
+	db := conn.db
+
+	info := ConnectionInfo{
+		Socket: params.SocketPath(),
+		User:   params.Username,
+		State:  state,
+	}
+	if info.Socket == "" {
+		info.Host = params.Host
+		info.Port = params.Port
+	}
+	if params.SSH.Enabled() {
+		info.SSHHost = params.SSH.Addr()
+	}
+
+	var database *string
+	err := db.QueryRowContext(ctx, sessionInfoQuery).Scan(
+		&database, &info.ServerVersion, &info.SQLMode, &info.TimeZone, &info.CharacterSet, &info.Collation,
+	)
+	if err != nil {
+		return ConnectionInfo{}, fmt.Errorf("failed to read session settings: %w", err)
+	}
+	if database != nil {
+		info.Database = *database
+	}
+
+	info.TLSCipher, err = d.TLSCipher(ctx)
+	if err != nil {
+		return ConnectionInfo{}, err
+	}
+	info.TLS = info.TLSCipher != ""
+
+	stats := db.Stats()
+	info.Pool = PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration.String(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+
+	return info, nil
+}
@@ -6,9 +6,16 @@ import (
 )
 
 type DatastoreInterface interface {
-	Connect(ctx context.Context, host, port, username, password, database string) error
+	Connect(ctx context.Context, params ConnectParams) error
 	CheckConnection() error
 	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Conn(ctx context.Context) (*sql.Conn, error)
 	IsConnected() bool
+	Close() error
+	Identity() string
+	TLSCipher(ctx context.Context) (string, error)
+	Health() Health
+	Info(ctx context.Context) (ConnectionInfo, error)
+	UseDatabase(ctx context.Context, database string) error
 }
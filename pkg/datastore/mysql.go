@@ -4,90 +4,437 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
 )
 
 type MySQLDatastore struct {
-	DB *sql.DB
+	// connectMu serializes Connect, UseDatabase and Close, which replace the
+	// connection in several steps
+	connectMu sync.Mutex
+	mu        sync.RWMutex
+	conn      *connection
+	params    ConnectParams
+	// generation counts the connections installed by Connect, UseDatabase and
+	// Close, so that a reconnection never replaces a newer connection
+	generation int
+	// monitor pings the connection and reconnects it, nil when monitoring is disabled
+	monitor  *healthMonitor
+	listener func(Health)
+}
+
+// connection is an open pool with the SSH tunnel it dials through, if any
+type connection struct {
+	db       *sql.DB
+	identity string
+	// resultOptions are the driver settings changing the values queries return
+	resultOptions string
+	tunnel        *sshTunnel
+	dialName      string
+}
+
+// ResultOptioner is implemented by datastores whose driver settings change
+// the values queries return, such as the time zone or character set
+type ResultOptioner interface {
+	ResultOptions() string
 }
 
 func (d *MySQLDatastore) IsConnected() bool {
-	return d.DB != nil
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.conn != nil && d.health().Usable()
 }
 
 func (d *MySQLDatastore) CheckConnection() error {
-	if !d.IsConnected() {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.conn == nil {
 		return fmt.Errorf("not connected to a database, use connect tool first")
 	}
+	if h := d.health(); !h.Usable() {
+		return fmt.Errorf("connection to MySQL is %s: %s", h.State, h.LastError)
+	}
 	return nil
 }
 
+// Health returns the state of the connection
+func (d *MySQLDatastore) Health() Health {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.health()
+}
+
+func (d *MySQLDatastore) health() Health {
+	switch {
+	case d.monitor != nil:
+		return d.monitor.Health()
+	case d.conn != nil:
+		return Health{State: StateConnected}
+	}
+	return Health{State: StateDisconnected}
+}
+
+// NotifyHealth registers the listener called when the health of the connection changes
+func (d *MySQLDatastore) NotifyHealth(listener func(Health)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.listener = listener
+}
+
 func (d *MySQLDatastore) Close() error {
-	if d.DB != nil {
-		return d.DB.Close()
+	d.connectMu.Lock()
+	defer d.connectMu.Unlock()
+
+	return d.close()
+}
+
+// close closes the connection, the caller holds connectMu
+func (d *MySQLDatastore) close() error {
+	// Stop the monitor first, a running reconnection needs the lock
+	d.mu.Lock()
+	monitor := d.monitor
+	d.monitor = nil
+	d.mu.Unlock()
+	if monitor != nil {
+		monitor.Stop()
 	}
-	return nil
+
+	d.mu.Lock()
+	conn := d.conn
+	d.conn = nil
+	d.generation++
+	d.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	return conn.close()
+}
+
+// Identity identifies the current connection as user@tcp(host:port)/database,
+// with the bastion of an SSH tunnel
+func (d *MySQLDatastore) Identity() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.conn == nil {
+		return ""
+	}
+	return d.conn.identity
+}
+
+// ResultOptions describes the time zone, character set, collation and time
+// parsing of the current connection
+func (d *MySQLDatastore) ResultOptions() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.conn == nil {
+		return ""
+	}
+	return d.conn.resultOptions
 }
 
 func (d *MySQLDatastore) Connection() *sql.DB {
-	return d.DB
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.conn == nil {
+		return nil
+	}
+	return d.conn.db
 }
 
-func (d *MySQLDatastore) Connect(ctx context.Context, host, port, username, password, database string) error {
+func (d *MySQLDatastore) Connect(ctx context.Context, params ConnectParams) error {
+	d.connectMu.Lock()
+	defer d.connectMu.Unlock()
+
 	// Close existing connection if any
-	if d.IsConnected() {
-		d.Close()
+	d.close()
+
+	// Settings of the option files fill what the parameters leave unset
+	params = params.WithDefaults(Defaults)
+
+	conn, err := openConnection(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.conn = conn
+	d.params = params
+	d.generation++
+	if check := DefaultHealthCheck; check.Interval > 0 {
+		d.monitor = newHealthMonitor(check, d.ping, d.reconnect, d.notify)
+		d.monitor.start()
+	}
+	return nil
+}
+
+// UseDatabase makes database the default schema of every pooled connection.
+// The pool is reopened with the new schema so that no connection keeps the old one.
+func (d *MySQLDatastore) UseDatabase(ctx context.Context, database string) error {
+	d.connectMu.Lock()
+	defer d.connectMu.Unlock()
+
+	if err := d.CheckConnection(); err != nil {
+		return err
+	}
+
+	exists, err := d.databaseExists(ctx, database)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("unknown database %q", database)
+	}
+
+	d.mu.RLock()
+	params := d.params
+	d.mu.RUnlock()
+
+	params, err = params.WithDatabase(database)
+	if err != nil {
+		return err
+	}
+	conn, err := openConnection(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	old := d.conn
+	d.conn = conn
+	d.params = params
+	d.generation++
+	d.mu.Unlock()
+
+	if old != nil {
+		old.close()
 	}
+	return nil
+}
 
-	// Create DSN (Data Source Name)
-	c := mysql.Config{
-		User:   username,
-		Passwd: password,
-		Addr:   fmt.Sprintf("%s:%s", host, port),
-		Net:    "tcp",
+// databaseExists checks that the schema exists and is visible to the user
+func (d *MySQLDatastore) databaseExists(ctx context.Context, database string) (bool, error) {
+	rows, err := d.QueryContext(ctx, "SHOW DATABASES")
+	if err != nil {
+		return false, fmt.Errorf("failed to list databases: %w", err)
 	}
+	defer rows.Close()
 
-	if len(database) > 0 {
-		c.DBName = database
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if name == database {
+			return true, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return false, nil
+}
+
+// ping checks the current connection
+func (d *MySQLDatastore) ping(ctx context.Context) error {
+	db := d.Connection()
+	if db == nil {
+		return fmt.Errorf("not connected")
+	}
+	return db.PingContext(ctx)
+}
+
+// reconnect replaces the connection by a new one opened with the same parameters
+func (d *MySQLDatastore) reconnect(ctx context.Context) error {
+	d.mu.RLock()
+	params := d.params
+	generation := d.generation
+	d.mu.RUnlock()
+
+	conn, err := openConnection(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	if d.generation != generation {
+		// The connection was replaced or closed while dialing
+		d.mu.Unlock()
+		conn.close()
+		return nil
+	}
+	old := d.conn
+	d.conn = conn
+	d.mu.Unlock()
+
+	if old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// notify forwards a health change to the listener
+func (d *MySQLDatastore) notify(h Health) {
+	d.mu.RLock()
+	listener := d.listener
+	d.mu.RUnlock()
+	if listener != nil {
+		listener(h)
+	}
+}
+
+// openConnection opens and pings a pool with the given parameters
+func openConnection(ctx context.Context, params ConnectParams) (*connection, error) {
+	// Create the driver configuration
+	c, err := buildConfig(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the password now so that reconnections pick up rotated secrets
+	if params.PasswordSource.Enabled() {
+		c.Passwd, err = params.PasswordSource.Resolve(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve password: %w", err)
+		}
+	}
+
+	// The connector keeps its own copy of the TLS config, so the registration is only needed until then
+	tlsName, err := applyTLS(c, params.Options)
+	if err != nil {
+		return nil, err
+	}
+	if tlsName != "" {
+		defer mysql.DeregisterTLSConfig(tlsName)
+	}
+
+	conn := &connection{identity: identity(c, params.SSH), resultOptions: resultOptions(c)}
+
+	// Reach the database through the bastion
+	if params.SSH.Enabled() {
+		tunnel, err := openSSHTunnel(params.SSH)
+		if err != nil {
+			return nil, err
+		}
+		conn.tunnel = tunnel
+		conn.dialName = fmt.Sprintf("mcp-ssh-%d", tunnelSeq.Add(1))
+		mysql.RegisterDialContext(conn.dialName, tunnel.DialContext)
+		c.Net = conn.dialName
 	}
 
 	// Open database connection
-	var err error
-	d.DB, err = sql.Open("mysql", c.FormatDSN())
+	connector, err := mysql.NewConnector(c)
 	if err != nil {
-		return fmt.Errorf("failed to open database connection: %w", err)
+		conn.close()
+		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
+	conn.db = sql.OpenDB(connector)
 
 	// Configure connection pool
-	d.DB.SetMaxOpenConns(10)
-	d.DB.SetMaxIdleConns(5)
-	d.DB.SetConnMaxLifetime(time.Minute * 5)
+	o := params.Options
+	conn.db.SetMaxOpenConns(valueOrDefault(o.MaxOpenConns, DefaultMaxOpenConns))
+	conn.db.SetMaxIdleConns(valueOrDefault(o.MaxIdleConns, DefaultMaxIdleConns))
+	conn.db.SetConnMaxLifetime(valueOrDefault(o.ConnMaxLifetime, DefaultConnMaxLifetime))
+	conn.db.SetConnMaxIdleTime(o.ConnMaxIdleTime)
 
 	// Test connection
 	ctxTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	err = d.DB.PingContext(ctxTimeout)
+	err = conn.db.PingContext(ctxTimeout)
 	if err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+		conn.close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return nil
+	return conn, nil
 }
 
-func (d *MySQLDatastore) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	return d.DB.QueryContext(ctx, query, args...)
+// resultOptions lists the driver settings changing the values queries return
+func resultOptions(c *mysql.Config) string {
+	params := make([]string, 0, len(c.Params))
+	for name, value := range c.Params {
+		params = append(params, name+"="+value)
+	}
+	sort.Strings(params)
+	return fmt.Sprintf("loc=%s&parseTime=%t&collation=%s&%s", c.Loc, c.ParseTime, c.Collation, strings.Join(params, "&"))
 }
 
-func (d *MySQLDatastore) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	return d.DB.ExecContext(ctx, query, args...)
+// identity identifies a server and schema as user@network(address)/database.
+// Through an SSH tunnel the address is the one the bastion dials, often
+// 127.0.0.1:3306, so the bastion is part of the identity.
+func identity(c *mysql.Config, tunnel SSHOptions) string {
+	via := ""
+	if tunnel.Enabled() {
+		via = fmt.Sprintf("ssh(%s@%s)+", tunnel.User, tunnel.Addr())
+	}
+	return fmt.Sprintf("%s@%s%s(%s)/%s", c.User, via, c.Net, c.Addr, c.DBName)
 }
 
-// Global instance of MySQLDatastore
-var DB *MySQLDatastore
+// close closes the pool, deregisters the dialer and closes the SSH tunnel
+func (c *connection) close() error {
+	var err error
+	if c.db != nil {
+		err = c.db.Close()
+	}
+	if c.tunnel != nil {
+		mysql.DeregisterDialContext(c.dialName)
+		c.tunnel.Close()
+	}
+	return err
+}
 
-func init() {
-	DB = &MySQLDatastore{}
+// TLSCipher returns the cipher negotiated for the connection, or an empty string when it is not encrypted
+func (d *MySQLDatastore) TLSCipher(ctx context.Context) (string, error) {
+	db := d.Connection()
+	if db == nil {
+		return "", fmt.Errorf("not connected to a database, use connect tool first")
+	}
+	var name, cipher string
+	err := db.QueryRowContext(ctx, "SHOW SESSION STATUS LIKE 'Ssl_cipher'").Scan(&name, &cipher)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the TLS cipher: %w", err)
+	}
+	return cipher, nil
+}
+
+func valueOrDefault[T comparable](value, def T) T {
+	var zero T
+	if value == zero {
+		return def
+	}
+	return value
+}
+
+func (d *MySQLDatastore) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	db := d.Connection()
+	if db == nil {
+		return nil, fmt.Errorf("not connected to a database, use connect tool first")
+	}
+	return db.QueryContext(ctx, query, args...)
+}
+
+// Conn pins a connection of the pool, for statements that depend on session state
+func (d *MySQLDatastore) Conn(ctx context.Context) (*sql.Conn, error) {
+	db := d.Connection()
+	if db == nil {
+		return nil, fmt.Errorf("not connected to a database, use connect tool first")
+	}
+	return db.Conn(ctx)
+}
+
+func (d *MySQLDatastore) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db := d.Connection()
+	if db == nil {
+		return nil, fmt.Errorf("not connected to a database, use connect tool first")
+	}
+	return db.ExecContext(ctx, query, args...)
 }
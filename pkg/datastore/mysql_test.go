@@ -0,0 +1,142 @@
+package datastore
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/mysqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectUnixSocket(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SELECT 1", mysqltest.Result{Columns: []string{"1"}, Rows: [][]interface{}{{1}}})
+
+	tests := []struct {
+		name   string
+		params ConnectParams
+	}{
+		{name: "socket", params: ConnectParams{Socket: server.Addr, Username: "app", Database: "shop"}},
+		{name: "unix host", params: ConnectParams{Host: "unix://" + server.Addr, Username: "app", Database: "shop"}},
+		{name: "dsn", params: ConnectParams{DSN: "app@unix(" + server.Addr + ")/shop"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &MySQLDatastore{}
+			require.NoError(t, d.Connect(context.Background(), tt.params))
+			defer d.Close()
+
+			assert.True(t, d.IsConnected())
+			assert.Equal(t, "app@unix("+server.Addr+")/shop", d.Identity())
+
+			var one int
+			require.NoError(t, d.Connection().QueryRowContext(context.Background(), "SELECT 1").Scan(&one))
+			assert.Equal(t, 1, one)
+		})
+	}
+	assert.Contains(t, server.Databases(), "shop")
+}
+
+func TestConnectTCP(t *testing.T) {
+	server := mysqltest.NewTCPServer(t)
+	server.Handle("SHOW SESSION STATUS LIKE 'Ssl_cipher'", mysqltest.Result{
+		Columns: []string{"Variable_name", "Value"},
+		Rows:    [][]interface{}{{"Ssl_cipher", ""}},
+	})
+
+	host, port, err := net.SplitHostPort(server.Addr)
+	require.NoError(t, err)
+
+	d := &MySQLDatastore{}
+	require.NoError(t, d.Connect(context.Background(), ConnectParams{Host: host, Port: port, Username: "app"}))
+	defer d.Close()
+
+	assert.Equal(t, "app@tcp("+server.Addr+")/", d.Identity())
+	cipher, err := d.TLSCipher(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, cipher)
+}
+
+func TestConnectFailure(t *testing.T) {
+	d := &MySQLDatastore{}
+	err := d.Connect(context.Background(), ConnectParams{Socket: "/nonexistent/mysql.sock", Username: "app"})
+	assert.Error(t, err)
+	assert.False(t, d.IsConnected())
+}
+
+func TestNotConnected(t *testing.T) {
+	d := &MySQLDatastore{}
+
+	_, err := d.QueryContext(context.Background(), "SELECT 1")
+	assert.ErrorContains(t, err, "not connected to a database")
+	_, err = d.ExecContext(context.Background(), "DO 1")
+	assert.ErrorContains(t, err, "not connected to a database")
+	_, err = d.Conn(context.Background())
+	assert.ErrorContains(t, err, "not connected to a database")
+	_, err = d.TLSCipher(context.Background())
+	assert.ErrorContains(t, err, "not connected to a database")
+}
+
+func TestUseDatabase(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SHOW DATABASES", mysqltest.Result{
+		Columns: []string{"Database"},
+		Rows:    [][]interface{}{{"information_schema"}, {"reporting"}, {"shop"}},
+	})
+
+	d := &MySQLDatastore{}
+	assert.Error(t, d.UseDatabase(context.Background(), "reporting"))
+
+	require.NoError(t, d.Connect(context.Background(), ConnectParams{Socket: server.Addr, Username: "app", Database: "shop"}))
+	defer d.Close()
+
+	err := d.UseDatabase(context.Background(), "missing")
+	assert.ErrorContains(t, err, `unknown database "missing"`)
+	assert.Equal(t, "app@unix("+server.Addr+")/shop", d.Identity())
+
+	require.NoError(t, d.UseDatabase(context.Background(), "reporting"))
+	assert.Equal(t, "app@unix("+server.Addr+")/reporting", d.Identity())
+	assert.Equal(t, []string{"shop", "reporting"}, server.Databases())
+
+	// New pooled connections and reconnections use the new database too
+	require.NoError(t, d.reconnect(context.Background()))
+	assert.Equal(t, []string{"shop", "reporting", "reporting"}, server.Databases())
+}
+
+func TestInfo(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle(sessionInfoQuery, mysqltest.Result{
+		Columns: []string{"DATABASE()", "VERSION()", "sql_mode", "time_zone", "character_set_connection", "collation_connection"},
+		Rows:    [][]interface{}{{nil, "8.0.36", "STRICT_TRANS_TABLES", "SYSTEM", "utf8mb4", "utf8mb4_0900_ai_ci"}},
+	})
+	server.Handle("SHOW SESSION STATUS LIKE 'Ssl_cipher'", mysqltest.Result{
+		Columns: []string{"Variable_name", "Value"},
+		Rows:    [][]interface{}{{"Ssl_cipher", "TLS_AES_256_GCM_SHA384"}},
+	})
+
+	d := &MySQLDatastore{}
+	_, err := d.Info(context.Background())
+	assert.Error(t, err)
+
+	require.NoError(t, d.Connect(context.Background(), ConnectParams{Socket: server.Addr, Username: "app", Options: Options{MaxOpenConns: 3}}))
+	defer d.Close()
+
+	info, err := d.Info(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, server.Addr, info.Socket)
+	assert.Empty(t, info.Host)
+	assert.Equal(t, "app", info.User)
+	assert.Empty(t, info.Database)
+	assert.Equal(t, "8.0.36", info.ServerVersion)
+	assert.Equal(t, "STRICT_TRANS_TABLES", info.SQLMode)
+	assert.Equal(t, "SYSTEM", info.TimeZone)
+	assert.Equal(t, "utf8mb4", info.CharacterSet)
+	assert.Equal(t, "utf8mb4_0900_ai_ci", info.Collation)
+	assert.True(t, info.TLS)
+	assert.Equal(t, StateConnected, info.State)
+	assert.Equal(t, 3, info.Pool.MaxOpenConnections)
+	assert.Positive(t, info.Pool.OpenConnections)
+}
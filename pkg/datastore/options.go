@@ -0,0 +1,261 @@
+package datastore
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Default connection pool settings
+const (
+	DefaultMaxOpenConns    = 10
+	DefaultMaxIdleConns    = 5
+	DefaultConnMaxLifetime = 5 * time.Minute
+)
+
+// unixHostPrefix marks a host given as the path of a Unix socket
+const unixHostPrefix = "unix://"
+
+// ConnectParams holds the parameters of a connection
+type ConnectParams struct {
+	Host string
+	Port string
+	// Socket is the path of a Unix socket, used instead of Host and Port
+	Socket   string
+	Username string
+	Password string
+	// PasswordSource replaces Password when set
+	PasswordSource PasswordSource
+	Database       string
+	// DSN is a raw data source name. When set, it replaces the fields above and
+	// Options only override what it sets explicitly.
+	DSN     string
+	Options Options
+	// SSH routes the connection through a bastion host
+	SSH SSHOptions
+	// Profile is set for the connections of a configuration profile, which
+	// keep their own TLS settings
+	Profile bool
+}
+
+// Options configures the connection pool and the driver. Zero values keep the
+// defaults, and nil flags the setting of the DSN or of the driver.
+type Options struct {
+	MaxOpenConns      int
+	MaxIdleConns      int
+	ConnMaxLifetime   time.Duration
+	ConnMaxIdleTime   time.Duration
+	Charset           string
+	Collation         string
+	TimeZone          string
+	ParseTime         *bool
+	Timeout           time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	InterpolateParams *bool
+	// SSLMode is one of SSLModes. SSLServerName overrides the host name checked
+	// by verify-identity.
+	SSLMode       string
+	SSLCA         string
+	SSLCert       string
+	SSLKey        string
+	SSLServerName string
+}
+
+// HasTLS reports whether any of the TLS options is set
+func (o Options) HasTLS() bool {
+	return o.SSLMode != "" || o.SSLCA != "" || o.SSLCert != "" || o.SSLKey != "" || o.SSLServerName != ""
+}
+
+// WithoutTLS returns the options with the TLS options cleared
+func (o Options) WithoutTLS() Options {
+	o.SSLMode, o.SSLCA, o.SSLCert, o.SSLKey, o.SSLServerName = "", "", "", "", ""
+	return o
+}
+
+// Merge returns the options with every non-zero field of override applied. A
+// flag set to false in override turns it off.
+func (o Options) Merge(override Options) Options {
+	if override.MaxOpenConns != 0 {
+		o.MaxOpenConns = override.MaxOpenConns
+	}
+	if override.MaxIdleConns != 0 {
+		o.MaxIdleConns = override.MaxIdleConns
+	}
+	if override.ConnMaxLifetime != 0 {
+		o.ConnMaxLifetime = override.ConnMaxLifetime
+	}
+	if override.ConnMaxIdleTime != 0 {
+		o.ConnMaxIdleTime = override.ConnMaxIdleTime
+	}
+	if override.Charset != "" {
+		o.Charset = override.Charset
+	}
+	if override.Collation != "" {
+		o.Collation = override.Collation
+	}
+	if override.TimeZone != "" {
+		o.TimeZone = override.TimeZone
+	}
+	if override.Timeout != 0 {
+		o.Timeout = override.Timeout
+	}
+	if override.ReadTimeout != 0 {
+		o.ReadTimeout = override.ReadTimeout
+	}
+	if override.WriteTimeout != 0 {
+		o.WriteTimeout = override.WriteTimeout
+	}
+	if override.SSLMode != "" {
+		o.SSLMode = override.SSLMode
+	}
+	if override.SSLCA != "" {
+		o.SSLCA = override.SSLCA
+	}
+	if override.SSLCert != "" {
+		o.SSLCert = override.SSLCert
+	}
+	if override.SSLKey != "" {
+		o.SSLKey = override.SSLKey
+	}
+	if override.SSLServerName != "" {
+		o.SSLServerName = override.SSLServerName
+	}
+	if override.ParseTime != nil {
+		o.ParseTime = override.ParseTime
+	}
+	if override.InterpolateParams != nil {
+		o.InterpolateParams = override.InterpolateParams
+	}
+	return o
+}
+
+// ParseDSN validates a data source name and returns the connection parameters it describes
+func ParseDSN(dsn string) (ConnectParams, error) {
+	c, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return ConnectParams{}, fmt.Errorf("invalid dsn: %w", err)
+	}
+	// Statements are classified for permissions one at a time
+	if c.MultiStatements {
+		return ConnectParams{}, fmt.Errorf("invalid dsn: multiStatements is not supported")
+	}
+
+	params := ConnectParams{
+		Username: c.User,
+		Password: c.Passwd,
+		Database: c.DBName,
+		DSN:      dsn,
+	}
+	if c.Net == "unix" {
+		params.Socket = c.Addr
+		return params, nil
+	}
+	params.Host, params.Port, err = net.SplitHostPort(c.Addr)
+	if err != nil {
+		params.Host = c.Addr
+	}
+	return params, nil
+}
+
+// SocketPath returns the Unix socket of the connection, given either as Socket
+// or as a unix:// host. It is empty for TCP connections.
+func (p ConnectParams) SocketPath() string {
+	if p.Socket != "" {
+		return p.Socket
+	}
+	if strings.HasPrefix(p.Host, unixHostPrefix) {
+		return strings.TrimPrefix(p.Host, unixHostPrefix)
+	}
+	return ""
+}
+
+// Addr returns the host:port address, or the socket path, of the connection
+func (p ConnectParams) Addr() string {
+	if socket := p.SocketPath(); socket != "" {
+		return socket
+	}
+	return net.JoinHostPort(p.Host, p.Port)
+}
+
+// WithDatabase returns the parameters with the default database replaced,
+// rewriting the DSN when there is one
+func (p ConnectParams) WithDatabase(database string) (ConnectParams, error) {
+	p.Database = database
+	if p.DSN != "" {
+		c, err := mysql.ParseDSN(p.DSN)
+		if err != nil {
+			return ConnectParams{}, fmt.Errorf("invalid dsn: %w", err)
+		}
+		c.DBName = database
+		p.DSN = c.FormatDSN()
+	}
+	return p, nil
+}
+
+// buildConfig creates the driver configuration of the connection
+func buildConfig(params ConnectParams) (*mysql.Config, error) {
+	var c *mysql.Config
+	if params.DSN != "" {
+		var err error
+		c, err = mysql.ParseDSN(params.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dsn: %w", err)
+		}
+		if c.MultiStatements {
+			return nil, fmt.Errorf("invalid dsn: multiStatements is not supported")
+		}
+	} else {
+		c = mysql.NewConfig()
+		c.User = params.Username
+		c.Passwd = params.Password
+		c.Net = "tcp"
+		c.Addr = params.Addr()
+		c.DBName = params.Database
+		if params.SocketPath() != "" {
+			c.Net = "unix"
+		}
+	}
+
+	if params.SSH.Enabled() && c.Net != "tcp" {
+		return nil, fmt.Errorf("ssh tunnels only support TCP connections")
+	}
+
+	o := params.Options
+	if o.Charset != "" {
+		if c.Params == nil {
+			c.Params = map[string]string{}
+		}
+		c.Params["charset"] = o.Charset
+	}
+	if o.Collation != "" {
+		c.Collation = o.Collation
+	}
+	if o.TimeZone != "" {
+		loc, err := time.LoadLocation(o.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone: %w", err)
+		}
+		c.Loc = loc
+	}
+	if o.ParseTime != nil {
+		c.ParseTime = *o.ParseTime
+	}
+	if o.Timeout != 0 {
+		c.Timeout = o.Timeout
+	}
+	if o.ReadTimeout != 0 {
+		c.ReadTimeout = o.ReadTimeout
+	}
+	if o.WriteTimeout != 0 {
+		c.WriteTimeout = o.WriteTimeout
+	}
+	if o.InterpolateParams != nil {
+		c.InterpolateParams = *o.InterpolateParams
+	}
+
+	return c, nil
+}
@@ -0,0 +1,150 @@
+package datastore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildConfig(t *testing.T) {
+	c, err := buildConfig(ConnectParams{
+		Host:     "db.internal",
+		Port:     "3307",
+		Username: "reader",
+		Password: "secret",
+		Database: "app",
+		Options: Options{
+			Charset:           "utf8mb4",
+			Collation:         "utf8mb4_unicode_ci",
+			TimeZone:          "Asia/Tokyo",
+			ParseTime:         boolPtr(true),
+			Timeout:           3 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			InterpolateParams: boolPtr(true),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "tcp", c.Net)
+	assert.Equal(t, "db.internal:3307", c.Addr)
+	assert.Equal(t, "reader", c.User)
+	assert.Equal(t, "app", c.DBName)
+	assert.Equal(t, "utf8mb4", c.Params["charset"])
+	assert.Equal(t, "utf8mb4_unicode_ci", c.Collation)
+	assert.Equal(t, "Asia/Tokyo", c.Loc.String())
+	assert.True(t, c.ParseTime)
+	assert.Equal(t, 3*time.Second, c.Timeout)
+	assert.Equal(t, 30*time.Second, c.ReadTimeout)
+	assert.Equal(t, 10*time.Second, c.WriteTimeout)
+	assert.True(t, c.InterpolateParams)
+}
+
+func TestBuildConfigFromDSN(t *testing.T) {
+	c, err := buildConfig(ConnectParams{
+		DSN:     "reader:secret@tcp(db.internal:3307)/app?readTimeout=5s",
+		Options: Options{ParseTime: boolPtr(true)},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "db.internal:3307", c.Addr)
+	assert.Equal(t, 5*time.Second, c.ReadTimeout)
+	assert.True(t, c.ParseTime)
+
+	// Flags set to false turn off those of the DSN, unset ones keep them
+	c, err = buildConfig(ConnectParams{
+		DSN:     "reader:secret@tcp(db.internal:3307)/app?parseTime=true&interpolateParams=true",
+		Options: Options{ParseTime: boolPtr(false)},
+	})
+	require.NoError(t, err)
+	assert.False(t, c.ParseTime)
+	assert.True(t, c.InterpolateParams)
+
+	_, err = buildConfig(ConnectParams{DSN: "not a dsn"})
+	assert.Error(t, err)
+}
+
+func TestBuildConfigSocket(t *testing.T) {
+	tests := []struct {
+		name   string
+		params ConnectParams
+	}{
+		{name: "socket", params: ConnectParams{Socket: "/var/run/mysqld/mysqld.sock", Port: "3306", Username: "app"}},
+		{name: "unix host", params: ConnectParams{Host: "unix:///var/run/mysqld/mysqld.sock", Port: "3306", Username: "app"}},
+		{name: "dsn", params: ConnectParams{DSN: "app@unix(/var/run/mysqld/mysqld.sock)/"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := buildConfig(tt.params)
+			require.NoError(t, err)
+			assert.Equal(t, "unix", c.Net)
+			assert.Equal(t, "/var/run/mysqld/mysqld.sock", c.Addr)
+		})
+	}
+
+	assert.Equal(t, "/var/run/mysqld/mysqld.sock", ConnectParams{Host: "unix:///var/run/mysqld/mysqld.sock"}.Addr())
+
+	_, err := buildConfig(ConnectParams{Socket: "/var/run/mysqld/mysqld.sock", SSH: SSHOptions{Host: "bastion"}})
+	assert.Error(t, err)
+}
+
+func TestParseDSN(t *testing.T) {
+	p, err := ParseDSN("reader:secret@tcp(db.internal:3307)/app")
+	require.NoError(t, err)
+	assert.Equal(t, "db.internal", p.Host)
+	assert.Equal(t, "3307", p.Port)
+	assert.Equal(t, "reader", p.Username)
+	assert.Equal(t, "secret", p.Password)
+	assert.Equal(t, "app", p.Database)
+
+	p, err = ParseDSN("reader@unix(/tmp/mysql.sock)/app")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/mysql.sock", p.Socket)
+	assert.Equal(t, "/tmp/mysql.sock", p.Addr())
+
+	_, err = ParseDSN("reader@db.internal")
+	assert.Error(t, err)
+
+	// Statements are checked one at a time, several cannot be sent at once
+	_, err = ParseDSN("reader@tcp(db.internal:3307)/app?multiStatements=true")
+	assert.EqualError(t, err, "invalid dsn: multiStatements is not supported")
+}
+
+func TestWithDatabase(t *testing.T) {
+	p, err := ConnectParams{Host: "db.internal", Database: "app"}.WithDatabase("reporting")
+	require.NoError(t, err)
+	assert.Equal(t, "reporting", p.Database)
+	assert.Empty(t, p.DSN)
+
+	p, err = ConnectParams{DSN: "reader:secret@tcp(db.internal:3307)/app?parseTime=true"}.WithDatabase("reporting")
+	require.NoError(t, err)
+	c, err := buildConfig(p)
+	require.NoError(t, err)
+	assert.Equal(t, "reporting", c.DBName)
+	assert.Equal(t, "secret", c.Passwd)
+	assert.True(t, c.ParseTime)
+}
+
+func TestMerge(t *testing.T) {
+	defaults := Options{MaxOpenConns: 10, Charset: "utf8mb4", ReadTimeout: time.Minute}
+	merged := defaults.Merge(Options{MaxOpenConns: 20, ParseTime: boolPtr(true), SSLMode: "required"})
+
+	assert.Equal(t, 20, merged.MaxOpenConns)
+	assert.Equal(t, "utf8mb4", merged.Charset)
+	assert.Equal(t, time.Minute, merged.ReadTimeout)
+	assert.Equal(t, boolPtr(true), merged.ParseTime)
+	assert.Equal(t, "required", merged.SSLMode)
+
+	// An override turns off flags of the defaults, unset flags keep them
+	merged = merged.Merge(Options{ParseTime: boolPtr(false)})
+	assert.Equal(t, boolPtr(false), merged.ParseTime)
+	merged = merged.Merge(Options{})
+	assert.Equal(t, boolPtr(false), merged.ParseTime)
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
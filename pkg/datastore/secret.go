@@ -0,0 +1,124 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/optionfile"
+)
+
+// passwordCommandTimeout bounds the time a password command may take
+const passwordCommandTimeout = 10 * time.Second
+
+// PasswordSource tells where to read the password of a connection instead of
+// keeping it in the parameters. It is read on every connection and reconnection.
+type PasswordSource struct {
+	// Env is an environment variable holding the password
+	Env string
+	// File is a file holding the password, such as a Docker or Kubernetes secret
+	File string
+	// Command prints the password on its standard output
+	Command []string
+	// OptionFile is a my.cnf style file whose OptionGroup (default client)
+	// holds the password
+	OptionFile  string
+	OptionGroup string
+	// LoginPath is a group of the mysql_config_editor login path file
+	LoginPath string
+}
+
+// Enabled reports whether the password is read from a source
+func (s PasswordSource) Enabled() bool {
+	return s.Env != "" || s.File != "" || len(s.Command) > 0 || s.OptionFile != "" || s.LoginPath != ""
+}
+
+// Validate checks that a single source is set
+func (s PasswordSource) Validate() error {
+	n := 0
+	for _, set := range []bool{s.Env != "", s.File != "", len(s.Command) > 0, s.OptionFile != "", s.LoginPath != ""} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("only one of env, file, command, option_file and login_path can be set")
+	}
+	if s.OptionGroup != "" && s.OptionFile == "" {
+		return fmt.Errorf("option_group requires option_file")
+	}
+	return nil
+}
+
+// Resolve reads the password. Errors never include the password.
+func (s PasswordSource) Resolve(ctx context.Context) (string, error) {
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
+
+	switch {
+	case s.Env != "":
+		password, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("password environment variable %s is not set", s.Env)
+		}
+		return password, nil
+
+	case s.File != "":
+		data, err := os.ReadFile(expandHome(s.File))
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+
+	case len(s.Command) > 0:
+		return runPasswordCommand(ctx, s.Command)
+
+	case s.OptionFile != "":
+		group := s.OptionGroup
+		if group == "" {
+			group = "client"
+		}
+		return optionFilePassword(expandHome(s.OptionFile), group)
+
+	case s.LoginPath != "":
+		path, err := optionfile.LoginPathFile()
+		if err != nil {
+			return "", err
+		}
+		return optionFilePassword(path, s.LoginPath)
+	}
+	return "", fmt.Errorf("no password source")
+}
+
+// runPasswordCommand returns the first line printed by the command
+func runPasswordCommand(ctx context.Context, command []string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, passwordCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	// Let the command prompt or report errors, its output is the secret
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("password command %s failed: %w", command[0], err)
+	}
+	password, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSuffix(password, "\r"), nil
+}
+
+// optionFilePassword reads the password option of a group
+func optionFilePassword(path, group string) (string, error) {
+	f, err := optionfile.Load(path)
+	if err != nil {
+		return "", err
+	}
+	password, ok := f.Get(group, "password")
+	if !ok {
+		return "", fmt.Errorf("no password in group [%s] of %s", group, path)
+	}
+	return password, nil
+}
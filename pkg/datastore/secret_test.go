@@ -0,0 +1,87 @@
+package datastore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/mysqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordSourceResolve(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "password")
+	require.NoError(t, os.WriteFile(secretFile, []byte("from-file\n"), 0o600))
+	optionFile := filepath.Join(dir, "my.cnf")
+	require.NoError(t, os.WriteFile(optionFile, []byte("[client]\npassword = from-client\n[mysql-mcp]\npassword = \"from group\"\n"), 0o600))
+	t.Setenv("TEST_DB_PASSWORD", "from-env")
+
+	tests := []struct {
+		name     string
+		source   PasswordSource
+		password string
+	}{
+		{name: "env", source: PasswordSource{Env: "TEST_DB_PASSWORD"}, password: "from-env"},
+		{name: "file", source: PasswordSource{File: secretFile}, password: "from-file"},
+		{name: "command", source: PasswordSource{Command: []string{"sh", "-c", "printf 'from-command\\nignored'"}}, password: "from-command"},
+		{name: "option file", source: PasswordSource{OptionFile: optionFile}, password: "from-client"},
+		{name: "option group", source: PasswordSource{OptionFile: optionFile, OptionGroup: "mysql-mcp"}, password: "from group"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, tt.source.Enabled())
+			password, err := tt.source.Resolve(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.password, password)
+		})
+	}
+}
+
+func TestPasswordSourceErrors(t *testing.T) {
+	optionFile := filepath.Join(t.TempDir(), "my.cnf")
+	require.NoError(t, os.WriteFile(optionFile, []byte("[client]\nuser = app\n"), 0o600))
+
+	tests := []struct {
+		name   string
+		source PasswordSource
+	}{
+		{name: "unset env", source: PasswordSource{Env: "TEST_DB_PASSWORD_UNSET"}},
+		{name: "missing file", source: PasswordSource{File: "/nonexistent/password"}},
+		{name: "failing command", source: PasswordSource{Command: []string{"false"}}},
+		{name: "no password option", source: PasswordSource{OptionFile: optionFile}},
+		{name: "two sources", source: PasswordSource{Env: "A", File: "b"}},
+		{name: "group without file", source: PasswordSource{LoginPath: "client", OptionGroup: "client"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.source.Resolve(context.Background())
+			assert.Error(t, err)
+		})
+	}
+	assert.False(t, PasswordSource{}.Enabled())
+}
+
+func TestConnectResolvesPassword(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+
+	d := &MySQLDatastore{}
+	params := ConnectParams{Socket: server.Addr, Username: "app", PasswordSource: PasswordSource{Env: "TEST_DB_PASSWORD"}}
+
+	err := d.Connect(context.Background(), params)
+	assert.ErrorContains(t, err, "failed to resolve password")
+	assert.Zero(t, server.Connections())
+
+	t.Setenv("TEST_DB_PASSWORD", "secret")
+	require.NoError(t, d.Connect(context.Background(), params))
+	defer d.Close()
+	assert.NotContains(t, d.Identity(), "secret")
+
+	// Reconnections read the secret again
+	require.NoError(t, os.Unsetenv("TEST_DB_PASSWORD"))
+	assert.ErrorContains(t, d.reconnect(context.Background()), "failed to resolve password")
+}
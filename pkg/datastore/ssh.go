@@ -0,0 +1,299 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Default SSH tunnel settings
+const (
+	DefaultSSHPort      = "22"
+	DefaultSSHKeepAlive = 30 * time.Second
+	sshDialTimeout      = 10 * time.Second
+)
+
+// errTunnelClosed is returned when dialing through a closed tunnel
+var errTunnelClosed = errors.New("ssh tunnel is closed")
+
+// tunnelSeq numbers the dialers registered with the driver
+var tunnelSeq atomic.Uint64
+
+// SSHOptions configures an SSH tunnel through a bastion host. The tunnel is
+// used when Host is set.
+type SSHOptions struct {
+	Host string
+	Port string
+	User string
+	// KeyFile is a private key, decrypted with Passphrase when it is encrypted
+	KeyFile    string
+	Passphrase string
+	// KnownHosts verifies the bastion host key, ~/.ssh/known_hosts by default.
+	// Paths may start with ~/.
+	KnownHosts string
+	// Agent authenticates to the bastion with the keys of the ssh-agent at
+	// SSH_AUTH_SOCK. The agent is not forwarded, as the tunnel opens no session
+	// on the bastion that could use it.
+	Agent bool
+	// KeepAlive is the interval of the tunnel health checks
+	KeepAlive time.Duration
+}
+
+// Enabled reports whether connections go through an SSH tunnel
+func (o SSHOptions) Enabled() bool {
+	return o.Host != ""
+}
+
+// Addr returns the host:port address of the bastion
+func (o SSHOptions) Addr() string {
+	return net.JoinHostPort(o.Host, valueOrDefault(o.Port, DefaultSSHPort))
+}
+
+// sshTunnel forwards connections through an SSH client, re-establishing it
+// when the bastion connection is lost
+type sshTunnel struct {
+	addr      string
+	config    *ssh.ClientConfig
+	keepAlive time.Duration
+	agentConn net.Conn
+
+	mu     sync.Mutex
+	client *ssh.Client
+	closed bool
+	stop   chan struct{}
+}
+
+// openSSHTunnel connects to the bastion and starts the health checks
+func openSSHTunnel(o SSHOptions) (*sshTunnel, error) {
+	if o.User == "" {
+		return nil, fmt.Errorf("ssh user is required")
+	}
+
+	t := &sshTunnel{
+		addr:      o.Addr(),
+		keepAlive: valueOrDefault(o.KeepAlive, DefaultSSHKeepAlive),
+		stop:      make(chan struct{}),
+	}
+
+	var auth []ssh.AuthMethod
+	if o.KeyFile != "" {
+		signer, err := loadSSHKey(expandHome(o.KeyFile), o.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if o.Agent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, fmt.Errorf("ssh agent requested but SSH_AUTH_SOCK is not set")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ssh agent: %w", err)
+		}
+		t.agentConn = conn
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if len(auth) == 0 {
+		t.Close()
+		return nil, fmt.Errorf("ssh key_file or agent is required")
+	}
+
+	knownHosts := expandHome(valueOrDefault(o.KnownHosts, "~/.ssh/known_hosts"))
+	hostKeyCallback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		t.Close()
+		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+
+	t.config = &ssh.ClientConfig{
+		User:            o.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	}
+
+	if _, err := t.connect(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	go t.healthCheck()
+
+	return t, nil
+}
+
+// expandHome replaces a leading ~/ of path by the home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// loadSSHKey reads a private key file
+func loadSSHKey(path, passphrase string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ssh key: %w", err)
+	}
+	var signer ssh.Signer
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(pem)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh key %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// connect returns the SSH client, connecting to the bastion when there is none.
+// The bastion is dialed without holding the lock, so that a slow or unreachable
+// bastion does not block Close; when concurrent callers both dial, the first
+// client wins and the others are closed.
+func (t *sshTunnel) connect() (*ssh.Client, error) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, errTunnelClosed
+	}
+	if client := t.client; client != nil {
+		t.mu.Unlock()
+		return client, nil
+	}
+	t.mu.Unlock()
+
+	client, err := ssh.Dial("tcp", t.addr, t.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh host %s: %w", t.addr, err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		client.Close()
+		return nil, errTunnelClosed
+	}
+	if t.client != nil {
+		client.Close()
+		return t.client, nil
+	}
+	t.client = client
+	return client, nil
+}
+
+// reset drops client so that the next use reconnects. It is a no-op when another
+// caller already replaced it.
+func (t *sshTunnel) reset(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == client {
+		t.client.Close()
+		t.client = nil
+	}
+}
+
+// DialContext opens a connection to addr through the tunnel. A failure is retried
+// once over a new bastion connection, as the current one may have died silently.
+func (t *sshTunnel) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	client, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.DialContext(ctx, "tcp", addr)
+	if err == nil {
+		return conn, nil
+	}
+
+	t.reset(client)
+	client, err = t.connect()
+	if err != nil {
+		return nil, err
+	}
+	conn, err = client.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s through ssh tunnel: %w", addr, err)
+	}
+	return conn, nil
+}
+
+// healthCheck sends keepalives to the bastion and reconnects when they fail
+func (t *sshTunnel) healthCheck() {
+	ticker := time.NewTicker(t.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+
+		client, err := t.connect()
+		if err != nil {
+			// Retried on the next tick
+			continue
+		}
+		if err := t.ping(client); err != nil {
+			t.reset(client)
+			t.connect()
+		}
+	}
+}
+
+// ping sends a keepalive request, giving up after the keepalive interval
+func (t *sshTunnel) ping(client *ssh.Client) error {
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(t.keepAlive):
+		return fmt.Errorf("ssh keepalive timed out")
+	}
+}
+
+// Close stops the health checks and closes the bastion connection
+func (t *sshTunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	close(t.stop)
+
+	var err error
+	if t.client != nil {
+		err = t.client.Close()
+		t.client = nil
+	}
+	if t.agentConn != nil {
+		t.agentConn.Close()
+	}
+	return err
+}
@@ -0,0 +1,274 @@
+package datastore
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/mysqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testBastion is an in-process SSH server forwarding direct-tcpip channels
+type testBastion struct {
+	addr       string
+	keyFile    string
+	knownHosts string
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newTestBastion(t *testing.T) *testBastion {
+	t.Helper()
+	dir := t.TempDir()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+
+	clientPublic, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	require.NoError(t, err)
+	authorized, err := ssh.NewPublicKey(clientPublic)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(authorized.Marshal()) {
+				return nil, assert.AnError
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	b := &testBastion{
+		addr:       listener.Addr().String(),
+		keyFile:    filepath.Join(dir, "id_ed25519"),
+		knownHosts: filepath.Join(dir, "known_hosts"),
+	}
+	require.NoError(t, os.WriteFile(b.keyFile, pem.EncodeToMemory(block), 0o600))
+	line := knownhosts.Line([]string{knownhosts.Normalize(b.addr)}, hostSigner.PublicKey())
+	require.NoError(t, os.WriteFile(b.knownHosts, []byte(line+"\n"), 0o600))
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.conns = append(b.conns, conn)
+			b.mu.Unlock()
+			go b.serve(conn, config)
+		}
+	}()
+	return b
+}
+
+func (b *testBastion) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.FormatUint(uint64(target.Port), 10)))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			upstream.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			defer channel.Close()
+			defer upstream.Close()
+			go io.Copy(upstream, channel)
+			io.Copy(channel, upstream)
+		}()
+	}
+}
+
+// dropConnections simulates a lost bastion connection
+func (b *testBastion) dropConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = nil
+}
+
+// startEchoServer stands in for the database behind the bastion
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func echo(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer conn.Close()
+	_, err := conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestSSHTunnel(t *testing.T) {
+	bastion := newTestBastion(t)
+	target := startEchoServer(t)
+
+	host, port, err := net.SplitHostPort(bastion.addr)
+	require.NoError(t, err)
+	tunnel, err := openSSHTunnel(SSHOptions{
+		Host:       host,
+		Port:       port,
+		User:       "tunnel",
+		KeyFile:    bastion.keyFile,
+		KnownHosts: bastion.knownHosts,
+		KeepAlive:  50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	conn, err := tunnel.DialContext(context.Background(), target)
+	require.NoError(t, err)
+	echo(t, conn)
+
+	// The tunnel is re-established after the bastion connection is lost
+	bastion.dropConnections()
+	conn, err = tunnel.DialContext(context.Background(), target)
+	require.NoError(t, err)
+	echo(t, conn)
+
+	// Dialing through a closed tunnel fails
+	require.NoError(t, tunnel.Close())
+	_, err = tunnel.DialContext(context.Background(), target)
+	assert.ErrorIs(t, err, errTunnelClosed)
+}
+
+func TestSSHTunnelHealthCheck(t *testing.T) {
+	bastion := newTestBastion(t)
+
+	host, port, err := net.SplitHostPort(bastion.addr)
+	require.NoError(t, err)
+	tunnel, err := openSSHTunnel(SSHOptions{Host: host, Port: port, User: "tunnel", KeyFile: bastion.keyFile, KnownHosts: bastion.knownHosts, KeepAlive: 20 * time.Millisecond})
+	require.NoError(t, err)
+	defer tunnel.Close()
+
+	tunnel.mu.Lock()
+	first := tunnel.client
+	tunnel.mu.Unlock()
+
+	bastion.dropConnections()
+	assert.Eventually(t, func() bool {
+		tunnel.mu.Lock()
+		defer tunnel.mu.Unlock()
+		return tunnel.client != nil && tunnel.client != first
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestOpenSSHTunnelErrors(t *testing.T) {
+	bastion := newTestBastion(t)
+	host, port, err := net.SplitHostPort(bastion.addr)
+	require.NoError(t, err)
+
+	otherHosts := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(otherHosts, nil, 0o600))
+
+	tests := []struct {
+		name    string
+		options SSHOptions
+	}{
+		{name: "no user", options: SSHOptions{Host: host, Port: port, KeyFile: bastion.keyFile, KnownHosts: bastion.knownHosts}},
+		{name: "no credentials", options: SSHOptions{Host: host, Port: port, User: "tunnel", KnownHosts: bastion.knownHosts}},
+		{name: "missing key", options: SSHOptions{Host: host, Port: port, User: "tunnel", KeyFile: "/nonexistent/id_ed25519", KnownHosts: bastion.knownHosts}},
+		{name: "unknown host key", options: SSHOptions{Host: host, Port: port, User: "tunnel", KeyFile: bastion.keyFile, KnownHosts: otherHosts}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := openSSHTunnel(tt.options)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestConnectSSHIdentity(t *testing.T) {
+	// The same database address seen from two bastions is two servers
+	server := mysqltest.NewTCPServer(t)
+	host, port, err := net.SplitHostPort(server.Addr)
+	require.NoError(t, err)
+
+	var identities []string
+	for _, bastion := range []*testBastion{newTestBastion(t), newTestBastion(t)} {
+		sshHost, sshPort, err := net.SplitHostPort(bastion.addr)
+		require.NoError(t, err)
+		d := &MySQLDatastore{}
+		require.NoError(t, d.Connect(context.Background(), ConnectParams{
+			Host: host, Port: port, Username: "app", Database: "shop",
+			SSH: SSHOptions{Host: sshHost, Port: sshPort, User: "tunnel", KeyFile: bastion.keyFile, KnownHosts: bastion.knownHosts},
+		}))
+		defer d.Close()
+
+		assert.Equal(t, "app@ssh(tunnel@"+bastion.addr+")+tcp("+server.Addr+")/shop", d.Identity())
+		identities = append(identities, d.Identity())
+	}
+	assert.NotEqual(t, identities[0], identities[1])
+}
@@ -0,0 +1,165 @@
+package datastore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// SSL modes, named after the --ssl-mode values of the mysql client
+const (
+	SSLModeDisabled       = "disabled"
+	SSLModePreferred      = "preferred"
+	SSLModeRequired       = "required"
+	SSLModeVerifyCA       = "verify-ca"
+	SSLModeVerifyIdentity = "verify-identity"
+)
+
+// SSLModes lists the supported SSL modes
+var SSLModes = []string{SSLModeDisabled, SSLModePreferred, SSLModeRequired, SSLModeVerifyCA, SSLModeVerifyIdentity}
+
+// tlsConfigSeq numbers the TLS configurations registered with the driver
+var tlsConfigSeq atomic.Uint64
+
+// ValidateSSLMode checks that mode is empty or one of SSLModes
+func ValidateSSLMode(mode string) error {
+	if mode == "" {
+		return nil
+	}
+	for _, m := range SSLModes {
+		if strings.EqualFold(mode, m) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid ssl_mode %q, expected one of %s", mode, strings.Join(SSLModes, ", "))
+}
+
+// sslMode returns the effective SSL mode of the options. Without an explicit mode,
+// a CA bundle implies verify-ca and a client certificate implies required, like the
+// mysql client does.
+func (o Options) sslMode() string {
+	switch {
+	case o.SSLMode != "":
+		return strings.ToLower(o.SSLMode)
+	case o.SSLCA != "":
+		return SSLModeVerifyCA
+	case o.SSLCert != "" || o.SSLKey != "":
+		return SSLModeRequired
+	}
+	return ""
+}
+
+// applyTLS configures TLS on the driver configuration. Custom settings are registered
+// with mysql.RegisterTLSConfig; the returned name must be deregistered once the
+// connector is created. It is empty when nothing was registered.
+func applyTLS(c *mysql.Config, o Options) (string, error) {
+	mode := o.sslMode()
+	if mode == "" {
+		// Keep whatever the DSN asked for
+		return "", nil
+	}
+	if err := ValidateSSLMode(mode); err != nil {
+		return "", err
+	}
+
+	// The explicit mode replaces any tls setting of the DSN
+	c.TLS = nil
+	c.AllowFallbackToPlaintext = false
+	if mode == SSLModeDisabled {
+		c.TLSConfig = "false"
+		return "", nil
+	}
+
+	host, _, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		host = c.Addr
+	}
+	tlsConfig, err := newTLSConfig(mode, o, host)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("mcp-mysql-client-%d", tlsConfigSeq.Add(1))
+	if err := mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return "", fmt.Errorf("failed to register TLS config: %w", err)
+	}
+	c.TLSConfig = name
+	c.AllowFallbackToPlaintext = mode == SSLModePreferred
+	return name, nil
+}
+
+// newTLSConfig builds the TLS configuration of an SSL mode other than disabled
+func newTLSConfig(mode string, o Options, host string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if o.SSLCA != "" {
+		pem, err := os.ReadFile(o.SSLCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ssl_ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ssl_ca %s", o.SSLCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if o.SSLCert != "" || o.SSLKey != "" {
+		if o.SSLCert == "" || o.SSLKey == "" {
+			return nil, fmt.Errorf("ssl_cert and ssl_key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(o.SSLCert, o.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	switch mode {
+	case SSLModePreferred, SSLModeRequired:
+		// Encrypt without verifying the server
+		tlsConfig.InsecureSkipVerify = true
+	case SSLModeVerifyCA:
+		// Verify the chain but not the host name
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = verifyChain(tlsConfig.RootCAs)
+	case SSLModeVerifyIdentity:
+		tlsConfig.ServerName = host
+		if o.SSLServerName != "" {
+			tlsConfig.ServerName = o.SSLServerName
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// verifyChain returns a certificate check verifying the server chain against roots,
+// or the system pool when roots is nil, without checking the host name
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("server sent no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("invalid server certificate: %w", err)
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		return err
+	}
+}
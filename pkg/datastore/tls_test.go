@@ -0,0 +1,196 @@
+package datastore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPKI is a CA and a server certificate issued for db.internal
+type testPKI struct {
+	caFile     string
+	certFile   string
+	keyFile    string
+	serverCert tls.Certificate
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "db.internal"},
+		DNSNames:     []string{"db.internal"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	pki := testPKI{
+		caFile:   filepath.Join(dir, "ca.pem"),
+		certFile: filepath.Join(dir, "cert.pem"),
+		keyFile:  filepath.Join(dir, "key.pem"),
+	}
+	writePEM(t, pki.caFile, "CERTIFICATE", caDER)
+	writePEM(t, pki.certFile, "CERTIFICATE", der)
+	writePEM(t, pki.keyFile, "EC PRIVATE KEY", keyDER)
+
+	pki.serverCert, err = tls.LoadX509KeyPair(pki.certFile, pki.keyFile)
+	require.NoError(t, err)
+	return pki
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+}
+
+// handshake runs a TLS handshake between the client config and a server presenting cert
+func handshake(t *testing.T, client *tls.Config, cert tls.Certificate) error {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), client)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestApplyTLS(t *testing.T) {
+	pki := newTestPKI(t)
+
+	tests := []struct {
+		name         string
+		options      Options
+		expectConfig string
+		expectError  bool
+		fallback     bool
+	}{
+		{name: "no tls options", options: Options{}, expectConfig: ""},
+		{name: "disabled", options: Options{SSLMode: "disabled"}, expectConfig: "false"},
+		{name: "preferred", options: Options{SSLMode: "PREFERRED"}, expectConfig: "mcp-mysql-client-", fallback: true},
+		{name: "required", options: Options{SSLMode: "required"}, expectConfig: "mcp-mysql-client-"},
+		{name: "ca implies verify-ca", options: Options{SSLCA: pki.caFile}, expectConfig: "mcp-mysql-client-"},
+		{name: "client certificate", options: Options{SSLMode: "verify-identity", SSLCA: pki.caFile, SSLCert: pki.certFile, SSLKey: pki.keyFile}, expectConfig: "mcp-mysql-client-"},
+		{name: "invalid mode", options: Options{SSLMode: "sometimes"}, expectError: true},
+		{name: "missing ca", options: Options{SSLMode: "verify-ca", SSLCA: "/nonexistent/ca.pem"}, expectError: true},
+		{name: "cert without key", options: Options{SSLMode: "required", SSLCert: pki.certFile}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mysql.NewConfig()
+			c.Addr = "db.internal:3306"
+
+			name, err := applyTLS(c, tt.options)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if name != "" {
+				defer mysql.DeregisterTLSConfig(name)
+				assert.Equal(t, name, c.TLSConfig)
+			}
+
+			assert.Contains(t, c.TLSConfig, tt.expectConfig)
+			assert.Equal(t, tt.fallback, c.AllowFallbackToPlaintext)
+
+			// The registered name must be usable by the driver
+			_, err = mysql.NewConnector(c)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestApplyTLSOverridesDSN(t *testing.T) {
+	c, err := mysql.ParseDSN("reader:secret@tcp(db.internal:3306)/app?tls=skip-verify")
+	require.NoError(t, err)
+
+	_, err = applyTLS(c, Options{SSLMode: "disabled"})
+	require.NoError(t, err)
+	assert.Nil(t, c.TLS)
+	assert.Equal(t, "false", c.TLSConfig)
+}
+
+func TestTLSVerification(t *testing.T) {
+	pki := newTestPKI(t)
+
+	tests := []struct {
+		name        string
+		mode        string
+		host        string
+		options     Options
+		expectError bool
+	}{
+		{name: "required accepts any certificate", mode: SSLModeRequired, host: "127.0.0.1"},
+		{name: "verify-ca ignores the host name", mode: SSLModeVerifyCA, host: "127.0.0.1", options: Options{SSLCA: pki.caFile}},
+		{name: "verify-ca rejects unknown issuers", mode: SSLModeVerifyCA, host: "127.0.0.1", expectError: true},
+		{name: "verify-identity checks the host name", mode: SSLModeVerifyIdentity, host: "db.internal", options: Options{SSLCA: pki.caFile}},
+		{name: "verify-identity rejects other hosts", mode: SSLModeVerifyIdentity, host: "127.0.0.1", options: Options{SSLCA: pki.caFile}, expectError: true},
+		{name: "server name override", mode: SSLModeVerifyIdentity, host: "127.0.0.1", options: Options{SSLCA: pki.caFile, SSLServerName: "db.internal"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := newTLSConfig(tt.mode, tt.options, tt.host)
+			require.NoError(t, err)
+
+			err = handshake(t, config, pki.serverCert)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
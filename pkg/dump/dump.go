@@ -0,0 +1,537 @@
+// Package dump writes mysqldump-compatible logical dumps of databases and
+// tables: CREATE statements followed by extended INSERT statements, read in
+// one consistent snapshot.
+package dump
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sqlutil"
+)
+
+// Defaults and limits of the rows per INSERT statement
+const (
+	DefaultBatchRows = 1000
+	MaxBatchRows     = 100000
+)
+
+// maxInsertBytes splits INSERT statements longer than this, well below the
+// default max_allowed_packet
+const maxInsertBytes = 1 << 20
+
+// Options select the objects and rows of a dump
+type Options struct {
+	// Databases are the databases to dump
+	Databases []string
+	// Tables restricts the dump to these tables and views of a single database
+	Tables []string
+	// CreateDatabases adds CREATE DATABASE and USE statements, otherwise the dump
+	// loads into the current database. Dumps of several databases always have them.
+	CreateDatabases bool
+	// Where filters the rows of tables by database.table name
+	Where map[string]string
+	// BatchRows is the number of rows per INSERT statement
+	BatchRows int
+	// NoData only dumps the CREATE statements
+	NoData bool
+}
+
+// Validate checks the options and applies the defaults
+func (o *Options) Validate() error {
+	if len(o.Databases) == 0 {
+		return fmt.Errorf("at least one database is required")
+	}
+	if len(o.Databases) > 1 {
+		if len(o.Tables) > 0 {
+			return fmt.Errorf("tables can only be selected in a single database")
+		}
+		o.CreateDatabases = true
+	}
+	if o.BatchRows == 0 {
+		o.BatchRows = DefaultBatchRows
+	}
+	if o.BatchRows < 1 || o.BatchRows > MaxBatchRows {
+		return fmt.Errorf("batch_size must be between 1 and %d", MaxBatchRows)
+	}
+	for table, where := range o.Where {
+		schema, _, ok := strings.Cut(table, ".")
+		if !ok || !slices.Contains(o.Databases, schema) {
+			return fmt.Errorf("invalid filter of table %s: expected a table of a dumped database as database.table", table)
+		}
+		// Filters are appended to SELECT statements and must stay one condition
+		// of the table, without reading other tables
+		if statements, err := sqlutil.Split(where); err != nil || len(statements) != 1 || sqlutil.ContainsSymbol(where, ";") {
+			return fmt.Errorf("invalid filter of table %s: expected a single condition", table)
+		}
+		for _, word := range sqlutil.Keywords(where) {
+			if slices.Contains(filterKeywords, word) {
+				return fmt.Errorf("invalid filter of table %s: %s is not allowed in conditions", table, word)
+			}
+		}
+		if sqlutil.Classify(FilterStatement(table, where)) != sqlutil.ClassRead {
+			return fmt.Errorf("invalid filter of table %s: expected a single condition", table)
+		}
+	}
+	return nil
+}
+
+// filterKeywords are the keywords of subqueries, unions and exports, refused in
+// filters so that they only select rows of their table
+var filterKeywords = []string{"SELECT", "UNION", "TABLE", "VALUES", "INTO"}
+
+// FilterStatement returns the statement reading the rows of a database.table
+// kept by a filter, as it is classified for permissions
+func FilterStatement(table, where string) string {
+	schema, name, _ := strings.Cut(table, ".")
+	return "SELECT * FROM " + sqlutil.QuoteQualified(schema, name) + " WHERE (" + where + ")"
+}
+
+// Summary describes the content of a dump
+type Summary struct {
+	Tables []TableSummary `json:"tables"`
+	Views  []string       `json:"views"`
+}
+
+// TableSummary is a dumped table with its number of rows
+type TableSummary struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	Rows   int64  `json:"rows"`
+	Where  string `json:"where,omitempty"`
+}
+
+// object is a table or view of a dump
+type object struct {
+	table  catalog.Table
+	create string
+}
+
+// Dump writes a dump of the selected objects. Metadata and rows are read with
+// conn, which runs a read-only transaction with a consistent snapshot and is
+// left with changed session settings.
+func Dump(ctx context.Context, conn *sql.Conn, w io.Writer, opts Options) (*Summary, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	// TIMESTAMP values are dumped in UTC like mysqldump, and the dump loads
+	// them back in UTC
+	for _, stmt := range []string{
+		"SET SESSION TIME_ZONE = '+00:00'",
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+	} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("failed to start the dump transaction: %w", err)
+		}
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "ROLLBACK")
+
+	// Rows are returned in the character set of the results, which the dump
+	// loads them with. Without one, values keep the character set of their column.
+	var version string
+	var charset sql.NullString
+	if err := conn.QueryRowContext(ctx, "SELECT VERSION(), @@character_set_results").Scan(&version, &charset); err != nil {
+		return nil, fmt.Errorf("failed to read the server version: %w", err)
+	}
+	if !charset.Valid {
+		charset.String = "binary"
+	}
+
+	bw := bufio.NewWriter(w)
+	d := &dumper{ctx: ctx, conn: conn, w: bw, opts: opts, summary: &Summary{Tables: []TableSummary{}, Views: []string{}}}
+	d.printf("-- MySQL dump of mcp-mysql-client\n--\n-- Databases: %s\n-- ------------------------------------------------------\n-- Server version\t%s\n\n", strings.Join(opts.Databases, ", "), version)
+	d.printf(header+"\n", charset.String)
+
+	for _, schema := range opts.Databases {
+		if err := d.database(schema); err != nil {
+			return nil, err
+		}
+	}
+
+	d.printf("%s\n-- Dump completed\n", footer)
+	if d.err == nil {
+		d.err = bw.Flush()
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to write dump: %w", d.err)
+	}
+	return d.summary, nil
+}
+
+// header and footer save and restore the session settings of the loading
+// client, as written by mysqldump. The header is formatted with the character
+// set of the dump.
+const header = `/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;
+/*!40101 SET @OLD_CHARACTER_SET_RESULTS=@@CHARACTER_SET_RESULTS */;
+/*!40101 SET @OLD_COLLATION_CONNECTION=@@COLLATION_CONNECTION */;
+/*!40101 SET NAMES %s */;
+/*!40103 SET @OLD_TIME_ZONE=@@TIME_ZONE */;
+/*!40103 SET TIME_ZONE='+00:00' */;
+/*!40014 SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0 */;
+/*!40014 SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0 */;
+/*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
+/*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
+`
+
+const footer = `/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
+
+/*!40101 SET SQL_MODE=@OLD_SQL_MODE */;
+/*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */;
+/*!40014 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */;
+/*!40101 SET CHARACTER_SET_CLIENT=@OLD_CHARACTER_SET_CLIENT */;
+/*!40101 SET CHARACTER_SET_RESULTS=@OLD_CHARACTER_SET_RESULTS */;
+/*!40101 SET COLLATION_CONNECTION=@OLD_COLLATION_CONNECTION */;
+/*!40111 SET SQL_NOTES=@OLD_SQL_NOTES */;
+`
+
+// dumper writes a dump, keeping the first write error
+type dumper struct {
+	ctx     context.Context
+	conn    *sql.Conn
+	w       *bufio.Writer
+	opts    Options
+	summary *Summary
+	err     error
+}
+
+func (d *dumper) printf(format string, args ...interface{}) {
+	if d.err == nil {
+		_, d.err = fmt.Fprintf(d.w, format, args...)
+	}
+}
+
+// database dumps the selected tables of a database, then its views
+func (d *dumper) database(schema string) error {
+	s := catalog.InformationSchema{DS: d.conn}
+
+	charset, collation, err := d.schemaCharset(schema)
+	if err != nil {
+		return err
+	}
+	tables, err := s.Tables(d.ctx, []string{schema})
+	if err != nil {
+		return err
+	}
+	columns, err := s.Columns(d.ctx, schema)
+	if err != nil {
+		return err
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+
+	if len(d.opts.Tables) > 0 {
+		selected := map[string]catalog.Table{}
+		for _, t := range tables {
+			selected[t.Name] = t
+		}
+		tables = tables[:0]
+		for _, name := range d.opts.Tables {
+			t, ok := selected[name]
+			if !ok {
+				return fmt.Errorf("table %s.%s does not exist", schema, name)
+			}
+			tables = append(tables, t)
+		}
+	}
+	for table := range d.opts.Where {
+		if name, ok := strings.CutPrefix(table, schema+"."); ok && !hasTable(tables, name) {
+			return fmt.Errorf("invalid filter of table %s: the table is not dumped", table)
+		}
+	}
+
+	if d.opts.CreateDatabases {
+		d.printf("--\n-- Current Database: %s\n--\n\n", sqlutil.QuoteIdentifier(schema))
+		d.printf("CREATE DATABASE /*!32312 IF NOT EXISTS*/ %s /*!40100 DEFAULT CHARACTER SET %s COLLATE %s */;\n\n", sqlutil.QuoteIdentifier(schema), charset, collation)
+		d.printf("USE %s;\n\n", sqlutil.QuoteIdentifier(schema))
+	}
+
+	// SHOW CREATE leaves the objects of the default database unqualified, so
+	// that views load into another database
+	if _, err := d.conn.ExecContext(d.ctx, "USE "+sqlutil.QuoteIdentifier(schema)); err != nil {
+		return fmt.Errorf("failed to use database %s: %w", schema, err)
+	}
+
+	var views []object
+	for _, t := range tables {
+		kind := "TABLE"
+		if t.Type == "VIEW" {
+			kind = "VIEW"
+		}
+		create, err := d.showCreate(kind, t.Name)
+		if err != nil {
+			return err
+		}
+		t.Columns = columns[t.Name]
+		o := object{table: t, create: create}
+		if kind == "VIEW" {
+			views = append(views, o)
+			continue
+		}
+		if err := d.table(o); err != nil {
+			return err
+		}
+	}
+
+	// Views are created after the tables, and after the views they select from
+	for _, v := range orderViews(views) {
+		name := sqlutil.QuoteIdentifier(v.table.Name)
+		d.printf("--\n-- View structure for view %s\n--\n\n", name)
+		d.printf("DROP VIEW IF EXISTS %s;\n%s;\n\n", name, v.create)
+		d.summary.Views = append(d.summary.Views, schema+"."+v.table.Name)
+	}
+	return d.err
+}
+
+// schemaCharset returns the default character set and collation of a database
+func (d *dumper) schemaCharset(schema string) (string, string, error) {
+	rows, err := d.conn.QueryContext(d.ctx, "SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", schema)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load database: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", "", fmt.Errorf("failed to load database: %w", err)
+		}
+		return "", "", fmt.Errorf("database %s does not exist", schema)
+	}
+	var charset, collation string
+	if err := rows.Scan(&charset, &collation); err != nil {
+		return "", "", fmt.Errorf("failed to scan row: %w", err)
+	}
+	return charset, collation, nil
+}
+
+// showCreate returns the CREATE statement of a table or view of the default database
+func (d *dumper) showCreate(kind, name string) (string, error) {
+	rows, err := d.conn.QueryContext(d.ctx, "SHOW CREATE "+kind+" "+sqlutil.QuoteIdentifier(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to show definition of %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", fmt.Errorf("failed to get column names: %w", err)
+	}
+	// The statement follows the name, other columns are character sets
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", fmt.Errorf("failed to show definition of %s: %w", name, err)
+		}
+		return "", fmt.Errorf("failed to show definition of %s: not found", name)
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return "", fmt.Errorf("failed to scan row: %w", err)
+	}
+	if len(values) < 2 || !values[1].Valid {
+		return "", fmt.Errorf("the definition of %s is not visible to the current user", name)
+	}
+	return values[1].String, nil
+}
+
+func hasTable(tables []catalog.Table, name string) bool {
+	for _, t := range tables {
+		if t.Name == name && t.Type != "VIEW" {
+			return true
+		}
+	}
+	return false
+}
+
+// table dumps the structure and rows of a table
+func (d *dumper) table(o object) error {
+	name := sqlutil.QuoteIdentifier(o.table.Name)
+	d.printf("--\n-- Table structure for table %s\n--\n\n", name)
+	d.printf("DROP TABLE IF EXISTS %s;\n%s;\n\n", name, o.create)
+	if d.opts.NoData {
+		return d.err
+	}
+
+	where := d.opts.Where[o.table.Schema+"."+o.table.Name]
+	d.printf("--\n-- Dumping data for table %s\n--\n", name)
+	if where != "" {
+		d.printf("-- WHERE:  %s\n", strings.ReplaceAll(where, "\n", " "))
+	}
+	d.printf("\nLOCK TABLES %s WRITE;\n/*!40000 ALTER TABLE %s DISABLE KEYS */;\n", name, name)
+
+	rows, err := d.rows(o.table, where)
+	if err != nil {
+		return err
+	}
+
+	d.printf("/*!40000 ALTER TABLE %s ENABLE KEYS */;\nUNLOCK TABLES;\n\n", name)
+	d.summary.Tables = append(d.summary.Tables, TableSummary{Schema: o.table.Schema, Name: o.table.Name, Rows: rows, Where: where})
+	return d.err
+}
+
+// rows writes the rows of a table as INSERT statements of at most BatchRows
+// rows, ordered by primary key so that dumps of unchanged tables are identical
+func (d *dumper) rows(t catalog.Table, where string) (int64, error) {
+	var columns, key []string
+	var kinds []valueKind
+	generated := false
+	for _, c := range t.Columns {
+		// Generated columns are computed again when loading
+		if strings.Contains(c.Extra, "GENERATED") && !strings.Contains(c.Extra, "DEFAULT_GENERATED") {
+			generated = true
+			continue
+		}
+		columns = append(columns, sqlutil.QuoteIdentifier(c.Name))
+		kinds = append(kinds, kindOf(c.Type))
+		if c.Key == "PRI" {
+			key = append(key, sqlutil.QuoteIdentifier(c.Name))
+		}
+	}
+
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM " + sqlutil.QuoteQualified(t.Schema, t.Name)
+	if where != "" {
+		query += " WHERE (" + where + ")"
+	}
+	if len(key) > 0 {
+		query += " ORDER BY " + strings.Join(key, ", ")
+	}
+
+	insert := "INSERT INTO " + sqlutil.QuoteIdentifier(t.Name)
+	if generated {
+		// Without the generated columns, the columns must be listed
+		insert += " (" + strings.Join(columns, ", ") + ")"
+	}
+	insert += " VALUES "
+
+	rows, err := d.conn.QueryContext(d.ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read table %s.%s: %w", t.Schema, t.Name, err)
+	}
+	defer rows.Close()
+
+	values := make([]sql.RawBytes, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	var count int64
+	var statement strings.Builder
+	batch := 0
+	flush := func() {
+		if batch > 0 {
+			d.printf("%s;\n", statement.String())
+			statement.Reset()
+			batch = 0
+		}
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return 0, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if batch == 0 {
+			statement.WriteString(insert)
+		} else {
+			statement.WriteByte(',')
+		}
+		statement.WriteByte('(')
+		for i, v := range values {
+			if i > 0 {
+				statement.WriteByte(',')
+			}
+			statement.WriteString(literal(v, kinds[i]))
+		}
+		statement.WriteByte(')')
+		batch++
+		count++
+		if batch >= d.opts.BatchRows || statement.Len() >= maxInsertBytes {
+			flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read table %s.%s: %w", t.Schema, t.Name, err)
+	}
+	flush()
+	return count, nil
+}
+
+// valueKind chooses how the values of a column are written
+type valueKind int
+
+const (
+	kindQuoted valueKind = iota
+	kindNumeric
+	kindBinary
+)
+
+// kindOf returns the kind of the values of a column type such as "int unsigned"
+func kindOf(columnType string) valueKind {
+	base, _, _ := strings.Cut(strings.ToLower(columnType), "(")
+	base, _, _ = strings.Cut(base, " ")
+	switch base {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "decimal", "numeric", "float", "double", "real":
+		return kindNumeric
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "bit",
+		"geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection", "geomcollection":
+		return kindBinary
+	}
+	return kindQuoted
+}
+
+// literal writes a value read with the text protocol as a SQL literal. Binary
+// values are written in hex like mysqldump --hex-blob.
+func literal(v sql.RawBytes, kind valueKind) string {
+	switch {
+	case v == nil:
+		return "NULL"
+	case kind == kindNumeric:
+		return string(v)
+	case kind == kindBinary && len(v) == 0:
+		return "''"
+	case kind == kindBinary:
+		return "0x" + strings.ToUpper(hex.EncodeToString(v))
+	}
+	return sqlutil.QuoteString(string(v))
+}
+
+// orderViews sorts views after the views they select from. Dependencies are
+// found by quoted name: a column of the same name only changes the order.
+func orderViews(views []object) []object {
+	var ordered []object
+	created := map[string]bool{}
+	for len(views) > 0 {
+		var pending []object
+		for _, v := range views {
+			ready := true
+			for _, other := range views {
+				if other.table.Name != v.table.Name && !created[other.table.Name] &&
+					strings.Contains(v.create, sqlutil.QuoteIdentifier(other.table.Name)) {
+					ready = false
+				}
+			}
+			if ready {
+				ordered = append(ordered, v)
+				created[v.table.Name] = true
+			} else {
+				pending = append(pending, v)
+			}
+		}
+		if len(pending) == len(views) {
+			// A cycle, which MySQL does not allow: keep the remaining order
+			return append(ordered, pending...)
+		}
+		views = pending
+	}
+	return ordered
+}
@@ -0,0 +1,248 @@
+package dump
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/mysqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := map[string]valueKind{
+		"int unsigned":   kindNumeric,
+		"BIGINT(20)":     kindNumeric,
+		"decimal(10,2)":  kindNumeric,
+		"double":         kindNumeric,
+		"varchar(255)":   kindQuoted,
+		"datetime(6)":    kindQuoted,
+		"json":           kindQuoted,
+		"enum('a','b')":  kindQuoted,
+		"varbinary(16)":  kindBinary,
+		"longblob":       kindBinary,
+		"bit(1)":         kindBinary,
+		"point":          kindBinary,
+		"set('x','y')":   kindQuoted,
+		"year":           kindQuoted,
+		"text":           kindQuoted,
+		"mediumint(8)":   kindNumeric,
+		"binary(16)":     kindBinary,
+		"geomcollection": kindBinary,
+	}
+	for columnType, expected := range tests {
+		assert.Equal(t, expected, kindOf(columnType), columnType)
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	assert.Equal(t, "NULL", literal(nil, kindQuoted))
+	assert.Equal(t, "NULL", literal(nil, kindBinary))
+	assert.Equal(t, "-1.50", literal(sql.RawBytes("-1.50"), kindNumeric))
+	assert.Equal(t, "''", literal(sql.RawBytes{}, kindQuoted))
+	assert.Equal(t, "''", literal(sql.RawBytes{}, kindBinary))
+	assert.Equal(t, "0x00FF", literal(sql.RawBytes{0, 255}, kindBinary))
+	assert.Equal(t, `'it\'s\n\\'`, literal(sql.RawBytes("it's\n\\"), kindQuoted))
+}
+
+func TestOptionsValidate(t *testing.T) {
+	opts := Options{Databases: []string{"shop"}}
+	require.NoError(t, opts.Validate())
+	assert.Equal(t, DefaultBatchRows, opts.BatchRows)
+
+	tests := map[string]Options{
+		"at least one database is required":                                                           {},
+		"tables can only be selected in a single database":                                            {Databases: []string{"shop", "crm"}, Tables: []string{"orders"}},
+		"batch_size must be between 1 and 100000":                                                     {Databases: []string{"shop"}, BatchRows: MaxBatchRows + 1},
+		"invalid filter of table orders: expected a table of a dumped database as database.table":     {Databases: []string{"shop"}, Where: map[string]string{"orders": "id > 1"}},
+		"invalid filter of table crm.orders: expected a table of a dumped database as database.table": {Databases: []string{"shop"}, Where: map[string]string{"crm.orders": "id > 1"}},
+		"invalid filter of table shop.orders: expected a single condition":                            {Databases: []string{"shop"}, Where: map[string]string{"shop.orders": "1; DROP TABLE orders"}},
+		"invalid filter of table shop.orders: SELECT is not allowed in conditions":                    {Databases: []string{"shop"}, Where: map[string]string{"shop.orders": "id IN (SELECT user_id FROM crm.secrets)"}},
+		"invalid filter of table shop.orders: UNION is not allowed in conditions":                     {Databases: []string{"shop"}, Where: map[string]string{"shop.orders": "1 /*!50000 UNION ALL */"}},
+		"invalid filter of table shop.orders: INTO is not allowed in conditions":                      {Databases: []string{"shop"}, Where: map[string]string{"shop.orders": "1 INTO OUTFILE '/tmp/orders'"}},
+	}
+	for expected, opts := range tests {
+		assert.EqualError(t, opts.Validate(), expected)
+	}
+}
+
+func TestOrderViews(t *testing.T) {
+	views := []object{
+		{table: catalog.Table{Name: "a"}, create: "CREATE VIEW `a` AS select `id` from `b`"},
+		{table: catalog.Table{Name: "b"}, create: "CREATE VIEW `b` AS select `id` from `c`"},
+		{table: catalog.Table{Name: "c"}, create: "CREATE VIEW `c` AS select `id` from `orders`"},
+		{table: catalog.Table{Name: "d"}, create: "CREATE VIEW `d` AS select 1"},
+	}
+	var names []string
+	for _, v := range orderViews(views) {
+		names = append(names, v.table.Name)
+	}
+	assert.Equal(t, []string{"c", "d", "b", "a"}, names)
+}
+
+// handleShop answers the queries of a dump of the shop database with an orders
+// table of three rows and a view
+func handleShop(server *mysqltest.Server) {
+	for _, stmt := range []string{
+		"SET SESSION TIME_ZONE = '+00:00'",
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+		"USE `shop`",
+		"ROLLBACK",
+	} {
+		server.Handle(stmt, mysqltest.Result{})
+	}
+	server.Handle("SELECT VERSION(), @@character_set_results", mysqltest.Result{Columns: []string{"VERSION()", "@@character_set_results"}, Rows: [][]interface{}{{"8.0.36", "utf8mb4"}}})
+	server.Handle("SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", mysqltest.Result{
+		Columns: []string{"DEFAULT_CHARACTER_SET_NAME", "DEFAULT_COLLATION_NAME"},
+		Rows:    [][]interface{}{{"utf8mb4", "utf8mb4_0900_ai_ci"}},
+	})
+	server.Handle("SELECT TABLE_SCHEMA, TABLE_NAME, TABLE_TYPE, TABLE_ROWS, TABLE_COMMENT, COALESCE(CREATE_TIME, ''), COALESCE(UPDATE_TIME, ''), COALESCE(ENGINE, ''), COALESCE(TABLE_COLLATION, ''), COALESCE(ROW_FORMAT, ''), COALESCE(CREATE_OPTIONS, '') FROM information_schema.TABLES WHERE TABLE_SCHEMA IN (?)", mysqltest.Result{
+		Columns: []string{"TABLE_SCHEMA", "TABLE_NAME", "TABLE_TYPE", "TABLE_ROWS", "TABLE_COMMENT", "CREATE_TIME", "UPDATE_TIME", "ENGINE", "TABLE_COLLATION", "ROW_FORMAT", "CREATE_OPTIONS"},
+		Rows: [][]interface{}{
+			{"shop", "orders", "BASE TABLE", 3, "", "", "", "InnoDB", "utf8mb4_0900_ai_ci", "Dynamic", ""},
+			{"shop", "open_orders", "VIEW", nil, "", "", "", "", "", "", ""},
+		},
+	})
+	server.Handle("SELECT TABLE_NAME, COLUMN_NAME, ORDINAL_POSITION, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COLUMN_DEFAULT, EXTRA, COLUMN_COMMENT FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, ORDINAL_POSITION", mysqltest.Result{
+		Columns: []string{"TABLE_NAME", "COLUMN_NAME", "ORDINAL_POSITION", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_KEY", "COLUMN_DEFAULT", "EXTRA", "COLUMN_COMMENT"},
+		Rows: [][]interface{}{
+			{"open_orders", "id", 1, "int", "NO", "", nil, "", ""},
+			{"orders", "id", 1, "int", "NO", "PRI", nil, "", ""},
+			{"orders", "status", 2, "varchar(20)", "YES", "", nil, "", ""},
+			{"orders", "token", 3, "varbinary(4)", "YES", "", nil, "", ""},
+			{"orders", "total", 4, "decimal(10,2)", "NO", "", nil, "VIRTUAL GENERATED", ""},
+		},
+	})
+	server.Handle("SHOW CREATE TABLE `orders`", mysqltest.Result{
+		Columns: []string{"Table", "Create Table"},
+		Rows:    [][]interface{}{{"orders", "CREATE TABLE `orders` (\n  `id` int NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB"}},
+	})
+	server.Handle("SHOW CREATE VIEW `open_orders`", mysqltest.Result{
+		Columns: []string{"View", "Create View", "character_set_client", "collation_connection"},
+		Rows:    [][]interface{}{{"open_orders", "CREATE VIEW `open_orders` AS select `id` from `orders`", "utf8mb4", "utf8mb4_0900_ai_ci"}},
+	})
+	server.Handle("SELECT `id`, `status`, `token` FROM `shop`.`orders` ORDER BY `id`", mysqltest.Result{
+		Columns: []string{"id", "status", "token"},
+		Rows:    [][]interface{}{{1, "new", "\x01\x02"}, {2, "it's", nil}, {3, nil, ""}},
+	})
+	server.Handle("SELECT `id`, `status`, `token` FROM `shop`.`orders` WHERE (id > 1) ORDER BY `id`", mysqltest.Result{
+		Columns: []string{"id", "status", "token"},
+		Rows:    [][]interface{}{{2, "it's", nil}, {3, nil, ""}},
+	})
+}
+
+func connect(t *testing.T, server *mysqltest.Server) *sql.Conn {
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	t.Cleanup(func() { ds.Close() })
+	conn, err := ds.Conn(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestDump(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	handleShop(server)
+	conn := connect(t, server)
+
+	var buf bytes.Buffer
+	summary, err := Dump(context.Background(), conn, &buf, Options{Databases: []string{"shop"}, BatchRows: 2, CreateDatabases: true})
+	require.NoError(t, err)
+	assert.Equal(t, &Summary{Tables: []TableSummary{{Schema: "shop", Name: "orders", Rows: 3}}, Views: []string{"shop.open_orders"}}, summary)
+
+	out := buf.String()
+	assert.Contains(t, out, "-- Server version\t8.0.36\n")
+	// The dump loads with the character set its rows were read in
+	assert.Contains(t, out, "/*!40101 SET NAMES utf8mb4 */;\n")
+	assert.Contains(t, out, "CREATE DATABASE /*!32312 IF NOT EXISTS*/ `shop` /*!40100 DEFAULT CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci */;\n\nUSE `shop`;\n")
+	assert.Contains(t, out, "DROP TABLE IF EXISTS `orders`;\nCREATE TABLE `orders` (")
+	// Rows are batched, without the generated column
+	assert.Contains(t, out, "/*!40000 ALTER TABLE `orders` DISABLE KEYS */;\n"+
+		"INSERT INTO `orders` (`id`, `status`, `token`) VALUES (1,'new',0x0102),(2,'it\\'s',NULL);\n"+
+		"INSERT INTO `orders` (`id`, `status`, `token`) VALUES (3,NULL,'');\n"+
+		"/*!40000 ALTER TABLE `orders` ENABLE KEYS */;\n")
+	// The view comes after the table
+	assert.Less(t, bytes.Index(buf.Bytes(), []byte("UNLOCK TABLES")), bytes.Index(buf.Bytes(), []byte("DROP VIEW IF EXISTS `open_orders`;\nCREATE VIEW `open_orders` AS select `id` from `orders`;\n")))
+	assert.True(t, bytes.HasSuffix(buf.Bytes(), []byte("-- Dump completed\n")))
+
+	// The transaction is started before reading and rolled back
+	queries := server.Queries()
+	assert.Equal(t, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY", queries[2])
+	assert.Contains(t, queries, "ROLLBACK")
+}
+
+func TestDumpFiltered(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	handleShop(server)
+	conn := connect(t, server)
+
+	var buf bytes.Buffer
+	summary, err := Dump(context.Background(), conn, &buf, Options{Databases: []string{"shop"}, Tables: []string{"orders"}, Where: map[string]string{"shop.orders": "id > 1"}})
+	require.NoError(t, err)
+	assert.Equal(t, &Summary{Tables: []TableSummary{{Schema: "shop", Name: "orders", Rows: 2, Where: "id > 1"}}, Views: []string{}}, summary)
+	assert.Contains(t, buf.String(), "-- WHERE:  id > 1\n")
+	assert.NotContains(t, buf.String(), "CREATE DATABASE")
+	assert.NotContains(t, buf.String(), "open_orders")
+
+	_, err = Dump(context.Background(), conn, io.Discard, Options{Databases: []string{"shop"}, Tables: []string{"missing"}})
+	assert.EqualError(t, err, "table shop.missing does not exist")
+	_, err = Dump(context.Background(), conn, io.Discard, Options{Databases: []string{"shop"}, Tables: []string{"open_orders"}, Where: map[string]string{"shop.orders": "id > 1"}})
+	assert.EqualError(t, err, "invalid filter of table shop.orders: the table is not dumped")
+
+	// Without data only the structure is dumped
+	buf.Reset()
+	summary, err = Dump(context.Background(), conn, &buf, Options{Databases: []string{"shop"}, Tables: []string{"orders"}, NoData: true})
+	require.NoError(t, err)
+	assert.Empty(t, summary.Tables)
+	assert.NotContains(t, buf.String(), "INSERT")
+}
+
+func TestWriteFile(t *testing.T) {
+	previous := Dir
+	defer func() { Dir = previous }()
+
+	Dir = ""
+	_, _, err := WriteFile("shop.sql", func(w io.Writer) error { return nil })
+	assert.EqualError(t, err, "no dump directory is configured, start the server with -dump-dir")
+
+	Dir = t.TempDir()
+	for _, file := range []string{"../shop.sql", "/tmp/shop.sql", ".."} {
+		_, _, err = WriteFile(file, func(w io.Writer) error { return nil })
+		assert.EqualError(t, err, `invalid dump file name "`+file+`"`)
+	}
+
+	path, size, err := WriteFile("shop.sql.gz", func(w io.Writer) error {
+		_, err := io.WriteString(w, "SELECT 1;\n")
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(Dir, "shop.sql.gz"), path)
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	info, err := f.Stat()
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), size)
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT 1;\n", string(data))
+
+	// A failed dump leaves no file
+	_, _, err = WriteFile("failed.sql", func(w io.Writer) error { return assert.AnError })
+	assert.ErrorIs(t, err, assert.AnError)
+	entries, err := os.ReadDir(Dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,69 @@
+package dump
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir is the directory dump files are written to, set at startup. Dumps are
+// only returned inline when it is empty.
+var Dir string
+
+// Path returns the path of a dump file of Dir. Files are named without
+// directories so that tools cannot write elsewhere.
+func Path(file string) (string, error) {
+	if Dir == "" {
+		return "", fmt.Errorf("no dump directory is configured, start the server with -dump-dir")
+	}
+	if file == "" || file != filepath.Base(file) || file == ".." {
+		return "", fmt.Errorf("invalid dump file name %q", file)
+	}
+	return filepath.Join(Dir, file), nil
+}
+
+// WriteFile writes a dump to a file of Dir, compressed with gzip when the name
+// ends in .gz. The file is renamed into place once complete, so that a failed
+// dump never leaves a truncated file. It returns the path and size of the file.
+func WriteFile(file string, write func(io.Writer) error) (string, int64, error) {
+	path, err := Path(file)
+	if err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(Dir, "."+file+".*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create dump file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if strings.HasSuffix(file, ".gz") {
+		zw := gzip.NewWriter(tmp)
+		if err := write(zw); err != nil {
+			return "", 0, err
+		}
+		if err := zw.Close(); err != nil {
+			return "", 0, fmt.Errorf("failed to write dump file: %w", err)
+		}
+	} else if err := write(tmp); err != nil {
+		return "", 0, err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write dump file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, fmt.Errorf("failed to write dump file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", 0, fmt.Errorf("failed to write dump file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, fmt.Errorf("failed to write dump file: %w", err)
+	}
+	return path, info.Size(), nil
+}
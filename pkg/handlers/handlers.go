@@ -1,34 +1,170 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/auth"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/cache"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/config"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/dataprofile"
 	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/dump"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/history"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/ratelimit"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sampling"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/savedqueries"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/schemadiff"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/session"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/snapshot"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sqlutil"
 	"github.com/bonyuta0204/mcp-mysql-client/pkg/utils"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
 // ConnectHandler establishes a connection to the MySQL database
 func ConnectHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return withDatastoreInstance(connectHandler, ctx, request, datastore.DB)
+	s := session.Default.FromContext(ctx)
+	result, err := withDatastoreInstance(connectHandler, ctx, request, s.Datastore)
+	if err == nil {
+		profile, _ := request.Params.Arguments["profile"].(string)
+		s.SetProfile(profile)
+	}
+	return result, err
+}
+
+// DisconnectHandler closes the connection of the session
+func DisconnectHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	s := session.Default.FromContext(ctx)
+	result, err := withDatastoreInstance(disconnectHandler, ctx, request, s.Datastore)
+	if err == nil {
+		s.SetProfile("")
+	}
+	return result, err
+}
+
+func ConnectionInfoHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(connectionInfoHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func UseDatabaseHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(useDatabaseHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func RunScriptHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(runScriptHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func CallProcedureHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(callProcedureHandler, ctx, request, sessionDatastore(ctx))
 }
 
 func QueryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return withDatastoreInstance(queryHandler, ctx, request, datastore.DB)
+	return withDatastoreInstance(queryHandler, ctx, request, sessionDatastore(ctx))
 }
 
 func ListDatabasesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return withDatastoreInstance(listDatabasesHandler, ctx, request, datastore.DB)
+	return withDatastoreInstance(listDatabasesHandler, ctx, request, sessionDatastore(ctx))
 }
 
 func ListTablesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return withDatastoreInstance(listTablesHandler, ctx, request, datastore.DB)
+	return withDatastoreInstance(listTablesHandler, ctx, request, sessionDatastore(ctx))
 }
 
 func DescribeTableHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return withDatastoreInstance(describeTableHandler, ctx, request, datastore.DB)
+	return withDatastoreInstance(describeTableHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func ListRoutinesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(listObjectsHandler("routines", catalog.InformationSchema.Routines, (*snapshot.Snapshot).ListRoutines), ctx, request, sessionDatastore(ctx))
+}
+
+func ListTriggersHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(listObjectsHandler("triggers", catalog.InformationSchema.Triggers, (*snapshot.Snapshot).ListTriggers), ctx, request, sessionDatastore(ctx))
+}
+
+func ListViewsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(listObjectsHandler("views", catalog.InformationSchema.Views, (*snapshot.Snapshot).ListViews), ctx, request, sessionDatastore(ctx))
+}
+
+func ListEventsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(listObjectsHandler("events", catalog.InformationSchema.Events, (*snapshot.Snapshot).ListEvents), ctx, request, sessionDatastore(ctx))
+}
+
+func ShowDefinitionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(showDefinitionHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func ProfileTableHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(profileTableHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func SampleRowsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(sampleRowsHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func SchemaDiffHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(schemaDiffHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func SnapshotSchemaHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(snapshotSchemaHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func CompareToSnapshotHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(compareToSnapshotHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func DumpHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(dumpHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func QueryHistoryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(queryHistoryHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func RerunQueryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(rerunQueryHandler, ctx, request, sessionDatastore(ctx))
+}
+
+// SavedQueryHandler returns a handler running the given saved query with the tool arguments as parameters
+func SavedQueryHandler(q *savedqueries.Query) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return withDatastoreInstance(func(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+			return savedQueryHandler(ctx, q, request.Params.Arguments, ds)
+		}, ctx, request, sessionDatastore(ctx))
+	}
+}
+
+// RunSavedQueryHandler returns a handler running a saved query of the library selected by name
+func RunSavedQueryHandler(lib *savedqueries.Library) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return withDatastoreInstance(func(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+			return runSavedQueryHandler(ctx, request, ds, lib)
+		}, ctx, request, sessionDatastore(ctx))
+	}
+}
+
+func ClearCacheHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(clearCacheHandler, ctx, request, sessionDatastore(ctx))
+}
+
+func ConnectionStatusHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return withDatastoreInstance(connectionStatusHandler, ctx, request, sessionDatastore(ctx))
+}
+
+// sessionDatastore returns the datastore of the client session of the request
+func sessionDatastore(ctx context.Context) datastore.DatastoreInterface {
+	return session.Default.FromContext(ctx).Datastore
 }
 
 func withDatastoreInstance(handler func(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error), ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
@@ -36,39 +172,240 @@ func withDatastoreInstance(handler func(ctx context.Context, request mcp.CallToo
 }
 
 func connectHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
-	// Extract connection parameters
-	host, ok := request.Params.Arguments["host"].(string)
-	if !ok {
-		return nil, fmt.Errorf("host is required")
+	var params datastore.ConnectParams
+	var via string
+
+	profileName, _ := request.Params.Arguments["profile"].(string)
+	dsn, _ := request.Params.Arguments["dsn"].(string)
+
+	switch {
+	case profileName != "":
+		// Use the connection parameters of a profile
+		var err error
+		params, err = profileParams(ctx, profileName)
+		if err != nil {
+			return nil, err
+		}
+		via = fmt.Sprintf(" using profile %s", profileName)
+
+	case dsn != "":
+		if err := auth.CheckProfile(ctx, ""); err != nil {
+			return nil, err
+		}
+
+		var err error
+		params, err = datastore.ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		params.Options = config.Default.ConnectionDefaults()
+
+	default:
+		if err := auth.CheckProfile(ctx, ""); err != nil {
+			return nil, err
+		}
+
+		// Extract connection parameters, the option file defaults can replace the required ones
+		defaults := datastore.Defaults
+		host, _ := request.Params.Arguments["host"].(string)
+		socket, _ := request.Params.Arguments["socket"].(string)
+		// Like the mysql client, option files with credentials but no address
+		// connect to localhost
+		if host == "" && socket == "" && defaults.Host == "" && defaults.Socket == "" && defaults.Username == "" {
+			return nil, fmt.Errorf("host is required")
+		}
+
+		port, ok := request.Params.Arguments["port"].(string)
+		if !ok {
+			port = "3306"
+		}
+
+		// The credentials of the option files are only used for their server
+		defaultServer := host == "" && socket == ""
+		username, ok := request.Params.Arguments["username"].(string)
+		if !ok && (defaults.Username == "" || !defaultServer) {
+			return nil, fmt.Errorf("username is required")
+		}
+
+		password, ok := request.Params.Arguments["password"].(string)
+		if !ok && (defaults.Password == "" || !defaultServer) {
+			return nil, fmt.Errorf("password is required")
+		}
+
+		database, ok := request.Params.Arguments["database"].(string)
+		if !ok {
+			database = ""
+		}
+
+		params = datastore.ConnectParams{
+			Host:     host,
+			Port:     port,
+			Socket:   socket,
+			Username: username,
+			Password: password,
+			Database: database,
+			Options:  config.Default.ConnectionDefaults(),
+		}
 	}
 
-	port, ok := request.Params.Arguments["port"].(string)
-	if !ok {
-		port = "3306"
+	// Options given to the tool override the configured ones
+	options, err := connectOptions(request.Params.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	if profileName != "" && options.HasTLS() {
+		return nil, fmt.Errorf("the TLS options of profile %s cannot be overridden", profileName)
 	}
+	params.Options = params.Options.Merge(options)
 
-	username, ok := request.Params.Arguments["username"].(string)
-	if !ok {
-		return nil, fmt.Errorf("username is required")
+	// Connect to the database
+	if err := ds.Connect(ctx, params); err != nil {
+		return nil, err
 	}
 
-	password, ok := request.Params.Arguments["password"].(string)
-	if !ok {
-		return nil, fmt.Errorf("password is required")
+	addr := params.WithDefaults(datastore.Defaults).Addr()
+	result := mcp.NewToolResultText(fmt.Sprintf("Successfully connected to MySQL at %s%s", addr, via))
+
+	// Report the negotiated cipher of encrypted connections
+	cipher, err := ds.TLSCipher(ctx)
+	if err != nil {
+		result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("TLS status unknown: %v", err)))
+	} else if cipher != "" {
+		result.Content = append(result.Content, mcp.NewTextContent("TLS cipher: "+cipher))
+	}
+
+	return result, nil
+}
+
+// profileParams returns the connection parameters of a profile the caller may use
+func profileParams(ctx context.Context, name string) (datastore.ConnectParams, error) {
+	if err := auth.CheckProfile(ctx, name); err != nil {
+		return datastore.ConnectParams{}, err
 	}
 
-	database, ok := request.Params.Arguments["database"].(string)
+	profile, ok := config.Default.Profile(name)
 	if !ok {
-		database = ""
+		return datastore.ConnectParams{}, fmt.Errorf("unknown connection profile %q", name)
 	}
 
-	// Connect to the database
-	err := ds.Connect(ctx, host, port, username, password, database)
+	params, err := profile.ConnectParams(config.Default.ConnectionDefaults())
+	if err != nil {
+		return datastore.ConnectParams{}, fmt.Errorf("invalid connection profile %s: %w", name, err)
+	}
+	return params, nil
+}
+
+// disconnectHandler closes the connection and its pool
+func disconnectHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	identity := ds.Identity()
+	if identity == "" {
+		return mcp.NewToolResultText("Not connected to a database"), nil
+	}
+
+	if err := ds.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close connection: %w", err)
+	}
+
+	return mcp.NewToolResultText("Disconnected from " + identity), nil
+}
+
+// connectionInfoHandler reports what the connection is connected to
+func connectionInfoHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	if err := ds.CheckConnection(); err != nil {
+		return nil, err
+	}
+
+	info, err := ds.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := json.MarshalIndent(info, "", "  ")
 	if err != nil {
+		return nil, fmt.Errorf("failed to marshal connection info: %w", err)
+	}
+
+	return mcp.NewToolResultText(string(result)), nil
+}
+
+// useDatabaseHandler changes the default database of every pooled connection
+func useDatabaseHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	if err := ds.CheckConnection(); err != nil {
 		return nil, err
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Successfully connected to MySQL at %s:%s", host, port)), nil
+	database, _ := request.Params.Arguments["database"].(string)
+	database = strings.Trim(database, "`")
+	if database == "" {
+		return nil, fmt.Errorf("database is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := ds.UseDatabase(ctx, database); err != nil {
+		return nil, fmt.Errorf("failed to use database %s: %w", database, err)
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Now using database %s (%s)", database, ds.Identity())), nil
+}
+
+// connectOptions extracts the optional pool and driver settings of the connect tool
+func connectOptions(arguments map[string]interface{}) (datastore.Options, error) {
+	var o datastore.Options
+
+	if v, ok := arguments["max_open_conns"].(float64); ok {
+		o.MaxOpenConns = int(v)
+	}
+	if v, ok := arguments["max_idle_conns"].(float64); ok {
+		o.MaxIdleConns = int(v)
+	}
+	o.Charset, _ = arguments["charset"].(string)
+	o.Collation, _ = arguments["collation"].(string)
+	o.TimeZone, _ = arguments["time_zone"].(string)
+	// Flags given as false turn off the setting of a DSN or a profile
+	if v, ok := arguments["parse_time"].(bool); ok {
+		o.ParseTime = &v
+	}
+	if v, ok := arguments["interpolate_params"].(bool); ok {
+		o.InterpolateParams = &v
+	}
+	o.SSLMode, _ = arguments["ssl_mode"].(string)
+	o.SSLCA, _ = arguments["ssl_ca"].(string)
+	o.SSLCert, _ = arguments["ssl_cert"].(string)
+	o.SSLKey, _ = arguments["ssl_key"].(string)
+	o.SSLServerName, _ = arguments["ssl_server_name"].(string)
+
+	durations := map[string]*time.Duration{
+		"conn_max_lifetime":  &o.ConnMaxLifetime,
+		"conn_max_idle_time": &o.ConnMaxIdleTime,
+		"timeout":            &o.Timeout,
+		"read_timeout":       &o.ReadTimeout,
+		"write_timeout":      &o.WriteTimeout,
+	}
+	for name, dest := range durations {
+		v, ok := arguments[name].(string)
+		if !ok || v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return datastore.Options{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		*dest = d
+	}
+
+	if o.TimeZone != "" {
+		if _, err := time.LoadLocation(o.TimeZone); err != nil {
+			return datastore.Options{}, fmt.Errorf("invalid time_zone: %w", err)
+		}
+	}
+
+	if err := datastore.ValidateSSLMode(o.SSLMode); err != nil {
+		return datastore.Options{}, err
+	}
+
+	return o, nil
 }
 
 // QueryHandler executes a SQL query
@@ -81,129 +418,1566 @@ func queryHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore
 	// Extract query
 	sql := request.Params.Arguments["sql"].(string)
 
+	return executeQuery(ctx, ds, sql)
+}
+
+// cacheScope identifies the connection of cached results: its profile, its
+// identity and the driver settings changing the values its queries return
+func cacheScope(ctx context.Context, ds datastore.DatastoreInterface) string {
+	scope := session.Default.FromContext(ctx).Profile() + "\x00" + ds.Identity()
+	if o, ok := ds.(datastore.ResultOptioner); ok {
+		scope += "\x00" + o.ResultOptions()
+	}
+	return scope
+}
+
+// executeQuery runs a query, formats its result and records it in the query history.
+// Deterministic reads are served from the result cache when it is enabled.
+func executeQuery(ctx context.Context, ds datastore.DatastoreInterface, sql string, args ...interface{}) (*mcp.CallToolResult, error) {
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	// Execute query
-	rows, err := ds.QueryContext(ctx, sql)
+	class := sqlutil.Classify(sql)
+	if err := auth.CheckStatement(ctx, class); err != nil {
+		return nil, err
+	}
+
+	entry := history.Entry{SQL: sql, Args: args, StartedAt: time.Now()}
+
+	var cacheKey string
+	cacheable := cache.Default != nil && sqlutil.IsDeterministicRead(sql)
+	if cacheable {
+		cacheKey = cache.Key(cacheScope(ctx, ds), sql, args...)
+		if cached, ok := cache.Default.Get(cacheKey); ok {
+			entry.RowCount = cached.RowCount
+			entry.Status = history.StatusOK
+			entry.Cached = true
+			recordHistory(ctx, entry)
+
+			result := mcp.NewToolResultText(cached.Result)
+			result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("Served from cache (stored %s ago)", time.Since(cached.StoredAt).Round(time.Second))))
+			return result, nil
+		}
+	}
+
+	result, rowCount, err := runQuery(ctx, ds, sql, args...)
+	entry.DurationMs = time.Since(entry.StartedAt).Milliseconds()
+	entry.RowCount = rowCount
+	entry.Status = history.StatusOK
 	if err != nil {
-		return nil, fmt.Errorf("query execution failed: %w", err)
+		entry.Status = history.StatusError
+		entry.Error = err.Error()
 	}
-	defer rows.Close()
 
-	// Format the result
-	result, err := utils.FormatQueryResultAsJson(rows)
+	recordHistory(ctx, entry)
+
 	if err != nil {
 		return nil, err
 	}
 
+	if cache.Default != nil {
+		if cacheable {
+			cache.Default.Put(cacheKey, ds.Identity(), cache.Entry{Result: result, RowCount: rowCount})
+		} else if class == sqlutil.ClassWrite || class == sqlutil.ClassDDL {
+			// Cached results of this connection may be stale now
+			cache.Default.Invalidate(ds.Identity())
+		}
+	}
+
+	// Our own DDL changes the schema catalog of this connection
+	if class == sqlutil.ClassDDL {
+		catalog.Default.For(ds.Identity()).Invalidate()
+	}
+
 	return mcp.NewToolResultText(result), nil
 }
 
-// ListDatabasesHandler lists all databases
-func listDatabasesHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
-	// Check if connected to a database
+func runQuery(ctx context.Context, ds datastore.DatastoreInterface, sql string, args ...interface{}) (string, int, error) {
+	// Execute query
+	rows, err := ds.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return "", 0, fmt.Errorf("query execution failed: %w", err)
+	}
+	defer rows.Close()
+
+	// Format the result
+	return utils.FormatQueryResultAsJsonWithCount(rows)
+}
+
+// Error modes of run_script
+const (
+	onErrorStop     = "stop"
+	onErrorContinue = "continue"
+)
+
+// statusSkipped marks the statements of a script not run after an error
+const statusSkipped = "skipped"
+
+// scriptResult is the outcome of a statement of a script
+type scriptResult struct {
+	Statement    string          `json:"statement"`
+	Status       string          `json:"status"`
+	Rows         json.RawMessage `json:"rows,omitempty"`
+	RowCount     *int            `json:"row_count,omitempty"`
+	RowsAffected *int64          `json:"rows_affected,omitempty"`
+	LastInsertID *int64          `json:"last_insert_id,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	DurationMs   int64           `json:"duration_ms"`
+}
+
+// runScriptHandler runs the statements of a script in order on one connection
+func runScriptHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
 	if err := ds.CheckConnection(); err != nil {
 		return nil, err
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
+	script, _ := request.Params.Arguments["script"].(string)
+	onError, _ := request.Params.Arguments["on_error"].(string)
+	if onError == "" {
+		onError = onErrorStop
+	}
+	if onError != onErrorStop && onError != onErrorContinue {
+		return nil, fmt.Errorf("invalid on_error %q, expected %s or %s", onError, onErrorStop, onErrorContinue)
+	}
 
-	// Execute query to list databases
-	rows, err := ds.QueryContext(ctx, "SHOW DATABASES")
+	statements, err := sqlutil.Split(script)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list databases: %w", err)
+		return nil, fmt.Errorf("failed to split script: %w", err)
+	}
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("script has no statements")
 	}
-	defer rows.Close()
 
-	// Format the result
-	result, err := utils.FormatQueryResultAsJson(rows)
+	// The whole script is rejected when one of its statements is not allowed
+	for i, statement := range statements {
+		if err := auth.CheckStatement(ctx, sqlutil.Classify(statement)); err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+
+	// Variables and temporary tables only live in the session that created them
+	conn, err := ds.Conn(ctx)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get a connection: %w", err)
 	}
+	defer discardConn(conn)
 
-	return mcp.NewToolResultText(result), nil
-}
+	results := make([]scriptResult, len(statements))
+	var failed, skipped int
+	var wrote, changedSchema bool
+	for i, statement := range statements {
+		results[i] = scriptResult{Statement: statement}
+		if failed > 0 && onError == onErrorStop {
+			results[i].Status = statusSkipped
+			skipped++
+			continue
+		}
 
-// ListTablesHandler lists all tables in a database
-func listTablesHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
-	// Check if connected to a database
-	if err := ds.CheckConnection(); err != nil {
-		return nil, err
+		class := sqlutil.Classify(statement)
+		results[i].runOn(ctx, conn, class)
+		if results[i].Status == string(history.StatusError) {
+			failed++
+			continue
+		}
+		wrote = wrote || class == sqlutil.ClassWrite || class == sqlutil.ClassDDL
+		changedSchema = changedSchema || class == sqlutil.ClassDDL
 	}
 
-	// Extract database name if provided
-	var query string
-	database, ok := request.Params.Arguments["database"].(string)
+	// Like executeQuery, writes make cached results stale and DDL the schema catalog
+	if wrote && cache.Default != nil {
+		cache.Default.Invalidate(ds.Identity())
+	}
+	if changedSchema {
+		catalog.Default.For(ds.Identity()).Invalidate()
+	}
 
-	if ok && database != "" {
-		query = fmt.Sprintf("SELECT TABLE_SCHEMA, TABLE_NAME, TABLE_ROWS, TABLE_COMMENT FROM information_schema.tables WHERE TABLE_SCHEMA = '%s'", database)
-	} else {
-		query = "SELECT TABLE_SCHEMA, TABLE_NAME, TABLE_ROWS, TABLE_COMMENT FROM information_schema.tables WHERE TABLE_SCHEMA NOT IN ('information_schema', 'performance_schema', 'sys', 'mysql')"
+	output, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal results to JSON: %w", err)
 	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	result := mcp.NewToolResultText(string(output))
+	result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("%d statements: %d ok, %d failed, %d skipped",
+		len(statements), len(statements)-failed-skipped, failed, skipped)))
+	result.IsError = failed > 0
+	return result, nil
+}
+
+// discardConn closes a pinned connection without returning it to the pool, so
+// that its variables and temporary tables do not leak into later queries
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
+
+// runOn runs the statement on the connection and records it in the query history
+func (r *scriptResult) runOn(ctx context.Context, conn *sql.Conn, class sqlutil.StatementClass) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	// Execute query to list tables
-	rows, err := ds.QueryContext(ctx, query)
+	entry := history.Entry{SQL: r.Statement, StartedAt: time.Now()}
+	err := r.execute(ctx, conn, class)
+	entry.DurationMs = time.Since(entry.StartedAt).Milliseconds()
+	r.DurationMs = entry.DurationMs
+
+	entry.Status = history.StatusOK
+	if r.RowCount != nil {
+		entry.RowCount = *r.RowCount
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to list tables: %w", err)
+		entry.Status = history.StatusError
+		entry.Error = err.Error()
+		r.Error = err.Error()
 	}
-	defer rows.Close()
+	r.Status = string(entry.Status)
+	recordHistory(ctx, entry)
+}
 
-	// Format the result
-	result, err := utils.FormatQueryResultAsJson(rows)
+// execute queries reads and executes the other statements
+func (r *scriptResult) execute(ctx context.Context, conn *sql.Conn, class sqlutil.StatementClass) error {
+	if class == sqlutil.ClassRead {
+		rows, err := conn.QueryContext(ctx, r.Statement)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		formatted, count, err := utils.FormatQueryResultAsJsonWithCount(rows)
+		if err != nil {
+			return err
+		}
+		r.Rows = json.RawMessage(formatted)
+		r.RowCount = &count
+		return nil
+	}
+
+	res, err := conn.ExecContext(ctx, r.Statement)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if affected, err := res.RowsAffected(); err == nil {
+		r.RowsAffected = &affected
+	}
+	if id, err := res.LastInsertId(); err == nil && id != 0 {
+		r.LastInsertID = &id
 	}
+	return nil
+}
 
-	return mcp.NewToolResultText(result), nil
+// resultSet is a result set returned by a stored procedure
+type resultSet struct {
+	Rows     json.RawMessage `json:"rows"`
+	RowCount int             `json:"row_count"`
 }
 
-// DescribeTableHandler describes a table structure
-func describeTableHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
-	// Check if connected to a database
+// routineCall is the outcome of a call_procedure
+type routineCall struct {
+	Routine     string             `json:"routine"`
+	Type        string             `json:"type"`
+	ResultSets  []resultSet        `json:"result_sets,omitempty"`
+	OutParams   map[string]*string `json:"out_params,omitempty"`
+	ReturnValue *string            `json:"return_value,omitempty"`
+	DurationMs  int64              `json:"duration_ms"`
+}
+
+// callProcedureHandler calls a stored procedure or function with the arguments bound
+// according to its signature
+func callProcedureHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
 	if err := ds.CheckConnection(); err != nil {
 		return nil, err
 	}
 
-	// Extract table name
-	table := request.Params.Arguments["table"].(string)
+	name, _ := request.Params.Arguments["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
 
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	// The statements run by a routine are not known in advance
+	if err := auth.CheckStatement(ctx, sqlutil.Classify("CALL "+name)); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	// Execute query to describe table
-	rows, err := ds.QueryContext(ctx, fmt.Sprintf("DESCRIBE %s", table))
+	schema, routineName, err := qualifiedName(ctx, ds, name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to describe table %s: %w", table, err)
+		return nil, fmt.Errorf("failed to call %s: %w", name, err)
 	}
-	defer rows.Close()
 
-	// Format the result
-	result, err := utils.FormatQueryResultAsJson(rows)
+	routine, ok, err := catalog.InformationSchema{DS: ds}.Routine(ctx, schema, routineName)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to call %s: %w", name, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("failed to call %s: routine does not exist", name)
 	}
 
-	// We need to modify the result to show columns instead of rows
-	// Extract the row count from the result
-	rowCountIndex := len(result) - 20 // Approximate position of the row count
-	for i := rowCountIndex; i < len(result); i++ {
-		if result[i] == '\n' {
-			result = result[:i]
-			break
-		}
+	values, err := bindRoutineArgs(routine, request.Params.Arguments["args"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", name, err)
 	}
 
-	// Add a table-specific summary
-	result += fmt.Sprintf("\n%s table structure described successfully", table)
+	// OUT and INOUT parameters are passed as session variables, read back after the call
+	conn, err := ds.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a connection: %w", err)
+	}
+	defer discardConn(conn)
 
-	return mcp.NewToolResultText(result), nil
+	call := routineCall{Routine: schema + "." + routineName, Type: routine.Type}
+	started := time.Now()
+	if routine.Type == catalog.RoutineFunction {
+		err = callFunction(ctx, conn, routine, values, &call)
+	} else {
+		err = callProcedure(ctx, conn, routine, values, &call)
+	}
+	call.DurationMs = time.Since(started).Milliseconds()
+
+	entry := history.Entry{SQL: "CALL " + sqlutil.QuoteQualified(schema, routineName), Args: values, StartedAt: started, DurationMs: call.DurationMs, Status: history.StatusOK}
+	if err != nil {
+		entry.Status = history.StatusError
+		entry.Error = err.Error()
+	}
+	recordHistory(ctx, entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", name, err)
+	}
+
+	// Routines may write, cached results of this connection may be stale now
+	if cache.Default != nil {
+		cache.Default.Invalidate(ds.Identity())
+	}
+
+	result, err := json.MarshalIndent(call, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal results to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(result)), nil
+}
+
+// bindRoutineArgs returns the value of every parameter of the routine, in order.
+// Arguments are given by parameter name; OUT parameters take no value.
+func bindRoutineArgs(routine *catalog.Routine, args interface{}) ([]interface{}, error) {
+	values := make([]interface{}, len(routine.Parameters))
+
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+
+	switch args := args.(type) {
+	case map[string]interface{}:
+		for key := range args {
+			found := false
+			for _, p := range routine.Parameters {
+				found = found || strings.EqualFold(p.Name, key)
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown parameter %s", key)
+			}
+		}
+		for i, p := range routine.Parameters {
+			v, ok := lookupFold(args, p.Name)
+			if !ok && p.Mode != "OUT" {
+				return nil, fmt.Errorf("missing argument %s", p.Name)
+			}
+			values[i] = routineArg(v)
+		}
+	default:
+		return nil, fmt.Errorf("args must be an object")
+	}
+
+	for i, p := range routine.Parameters {
+		if p.Mode == "OUT" && values[i] != nil {
+			return nil, fmt.Errorf("%s is an OUT parameter and takes no value", p.Name)
+		}
+	}
+	return values, nil
+}
+
+// routineArg converts a JSON value, passing whole numbers as integers
+func routineArg(v interface{}) interface{} {
+	if f, ok := v.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return v
+}
+
+func lookupFold(m map[string]interface{}, key string) (interface{}, bool) {
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// outVariable is the session variable holding an OUT or INOUT parameter
+func outVariable(p catalog.Parameter) string {
+	return fmt.Sprintf("@mcp_param_%d", p.Position)
+}
+
+// callProcedure runs CALL and reads every result set and the OUT parameters
+func callProcedure(ctx context.Context, conn *sql.Conn, routine *catalog.Routine, values []interface{}, call *routineCall) error {
+	var placeholders, outputs []string
+	var inArgs []interface{}
+	for i, p := range routine.Parameters {
+		switch p.Mode {
+		case "IN":
+			placeholders = append(placeholders, "?")
+			inArgs = append(inArgs, values[i])
+			continue
+		case "INOUT":
+			if _, err := conn.ExecContext(ctx, "SET "+outVariable(p)+" = ?", values[i]); err != nil {
+				return fmt.Errorf("failed to set %s: %w", p.Name, err)
+			}
+		case "OUT":
+			if _, err := conn.ExecContext(ctx, "SET "+outVariable(p)+" = NULL"); err != nil {
+				return fmt.Errorf("failed to reset %s: %w", p.Name, err)
+			}
+		}
+		placeholders = append(placeholders, outVariable(p))
+		outputs = append(outputs, outVariable(p)+" AS "+sqlutil.QuoteIdentifier(p.Name))
+	}
+
+	rows, err := conn.QueryContext(ctx, "CALL "+sqlutil.QuoteQualified(routine.Schema, routine.Name)+"("+strings.Join(placeholders, ", ")+")", inArgs...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for {
+		// Statements of the procedure that return no rows end with an empty result
+		if columns, err := rows.Columns(); err == nil && len(columns) > 0 {
+			formatted, count, err := utils.FormatQueryResultAsJsonWithCount(rows)
+			if err != nil {
+				return err
+			}
+			call.ResultSets = append(call.ResultSets, resultSet{Rows: json.RawMessage(formatted), RowCount: count})
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	rows, err = conn.QueryContext(ctx, "SELECT "+strings.Join(outputs, ", "))
+	if err != nil {
+		return fmt.Errorf("failed to read OUT parameters: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to read OUT parameters: %w", err)
+	}
+	outValues := make([]sql.NullString, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range outValues {
+		ptrs[i] = &outValues[i]
+	}
+	if rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read OUT parameters: %w", err)
+	}
+
+	call.OutParams = map[string]*string{}
+	for i, column := range columns {
+		call.OutParams[column] = nil
+		if outValues[i].Valid {
+			call.OutParams[column] = &outValues[i].String
+		}
+	}
+	return nil
+}
+
+// callFunction selects the return value of a function
+func callFunction(ctx context.Context, conn *sql.Conn, routine *catalog.Routine, values []interface{}, call *routineCall) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	var value sql.NullString
+	err := conn.QueryRowContext(ctx, "SELECT "+sqlutil.QuoteQualified(routine.Schema, routine.Name)+"("+placeholders+")", values...).Scan(&value)
+	if err != nil {
+		return err
+	}
+	if value.Valid {
+		call.ReturnValue = &value.String
+	}
+	return nil
+}
+
+// recordHistory records a statement in the history of the caller and of its
+// client session
+func recordHistory(ctx context.Context, entry history.Entry) {
+	entry.User = auth.UserName(ctx)
+	entry.Session = session.Default.FromContext(ctx).ID
+	history.Default.Record(entry)
+}
+
+// historyFilter restricts the history to the statements of the caller:
+// authenticated users see their own statements of every session, also of
+// earlier runs, anonymous callers only those of their client session
+func historyFilter(ctx context.Context) history.Filter {
+	if user := auth.UserName(ctx); user != "" {
+		return history.Filter{User: user}
+	}
+	return history.Filter{Session: session.Default.FromContext(ctx).ID}
+}
+
+// ownsHistoryEntry reports whether the entry matches the history filter of the caller
+func ownsHistoryEntry(ctx context.Context, entry history.Entry) bool {
+	filter := historyFilter(ctx)
+	if filter.User != "" {
+		return entry.User == filter.User
+	}
+	return entry.Session == filter.Session
+}
+
+// queryHistoryHandler lists previously executed statements
+func queryHistoryHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	filter := historyFilter(ctx)
+	filter.Limit = 20
+
+	if search, ok := request.Params.Arguments["search"].(string); ok {
+		filter.Text = search
+	}
+
+	if status, ok := request.Params.Arguments["status"].(string); ok && status != "" && status != "all" {
+		if status != string(history.StatusOK) && status != string(history.StatusError) {
+			return nil, fmt.Errorf("invalid status %q, expected ok, error or all", status)
+		}
+		filter.Status = history.Status(status)
+	}
+
+	if limit, ok := request.Params.Arguments["limit"].(float64); ok {
+		filter.Limit = int(limit)
+	}
+
+	result, err := json.MarshalIndent(history.Default.Search(filter), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query history: %w", err)
+	}
+
+	return mcp.NewToolResultText(string(result)), nil
+}
+
+// rerunQueryHandler executes a statement from the query history again
+func rerunQueryHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	// Check if connected to a database
+	if err := ds.CheckConnection(); err != nil {
+		return nil, err
+	}
+
+	id, ok := request.Params.Arguments["id"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("id is required")
+	}
+
+	entry, ok := history.Default.Get(int(id))
+	if !ok || !ownsHistoryEntry(ctx, entry) {
+		return nil, fmt.Errorf("no query with id %d in history", int(id))
+	}
+
+	return executeQuery(ctx, ds, entry.SQL, entry.Args...)
+}
+
+// clearCacheHandler removes the cached query results of the connection of the
+// caller. Results of other connections may belong to other users and are kept.
+func clearCacheHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	if cache.Default == nil {
+		return mcp.NewToolResultText("Result cache is disabled"), nil
+	}
+
+	// Check if connected to a database
+	if err := ds.CheckConnection(); err != nil {
+		return nil, err
+	}
+
+	removed := cache.Default.Invalidate(ds.Identity())
+	return mcp.NewToolResultText(fmt.Sprintf("Removed %d cached result(s)", removed)), nil
+}
+
+// connectionStatusHandler reports the health of the connection as tracked by the health monitor
+func connectionStatusHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	h := ds.Health()
+
+	status := map[string]interface{}{"state": h.State}
+	if identity := ds.Identity(); identity != "" {
+		status["connection"] = identity
+	}
+	if !h.Since.IsZero() {
+		status["since"] = h.Since
+	}
+	if !h.LastCheck.IsZero() {
+		status["last_check"] = h.LastCheck
+	}
+	if h.LastError != "" {
+		status["last_error"] = h.LastError
+	}
+	if h.Attempts > 0 {
+		status["reconnect_attempts"] = h.Attempts
+	}
+
+	result, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal connection status: %w", err)
+	}
+
+	return mcp.NewToolResultText(string(result)), nil
+}
+
+// runSavedQueryHandler executes a saved query selected by the name argument
+func runSavedQueryHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface, lib *savedqueries.Library) (*mcp.CallToolResult, error) {
+	name, ok := request.Params.Arguments["name"].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	q, ok := lib.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown saved query %q", name)
+	}
+
+	params, ok := request.Params.Arguments["params"].(map[string]interface{})
+	if !ok {
+		params = map[string]interface{}{}
+	}
+
+	return savedQueryHandler(ctx, q, params, ds)
+}
+
+// savedQueryHandler binds the parameters of a saved query and executes it
+func savedQueryHandler(ctx context.Context, q *savedqueries.Query, params map[string]interface{}, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	// Check if connected to a database
+	if err := ds.CheckConnection(); err != nil {
+		return nil, err
+	}
+
+	sql, args, err := q.Bind(params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters for saved query %s: %w", q.Name, err)
+	}
+
+	return executeQuery(ctx, ds, sql, args...)
+}
+
+// ListDatabasesHandler lists all databases
+func listDatabasesHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	// Check if connected to a database
+	if err := ds.CheckConnection(); err != nil {
+		return nil, err
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	// Execute query to list databases
+	rows, err := ds.QueryContext(ctx, "SHOW DATABASES")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	defer rows.Close()
+
+	// Format the result
+	result, err := utils.FormatQueryResultAsJson(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return mcp.NewToolResultText(result), nil
+}
+
+// ListTablesHandler lists all tables in a database
+func listTablesHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	// Extract database name if provided, all user databases are listed otherwise
+	database, _ := request.Params.Arguments["database"].(string)
+
+	var tables []catalog.Table
+	var offline []*snapshot.Snapshot
+	if err := ds.CheckConnection(); err != nil {
+		// Answer from the snapshots while disconnected
+		if offline, err = offlineSnapshots(ctx, database, err); err != nil {
+			return nil, err
+		}
+		for _, s := range offline {
+			tables = append(tables, s.Tables...)
+			for _, v := range s.Views {
+				tables = append(tables, catalog.Table{Schema: v.Schema, Name: v.Name, Type: "VIEW"})
+			}
+		}
+	} else {
+		// Create context with timeout
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		// Load tables from the schema catalog
+		if tables, err = catalog.Default.For(ds.Identity()).Tables(ctx, catalog.InformationSchema{DS: ds}, database); err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+	}
+
+	results := []map[string]string{}
+	for _, t := range tables {
+		rowCount := "NULL"
+		if t.Rows != nil {
+			rowCount = fmt.Sprintf("%d", *t.Rows)
+		}
+		results = append(results, map[string]string{
+			"TABLE_SCHEMA":  t.Schema,
+			"TABLE_NAME":    t.Name,
+			"TABLE_ROWS":    rowCount,
+			"TABLE_COMMENT": t.Comment,
+		})
+	}
+
+	result, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal results to JSON: %w", err)
+	}
+
+	return withOfflineNote(mcp.NewToolResultText(string(result)), offline), nil
+}
+
+// profileTableHandler computes the data distribution of the columns of a table
+func profileTableHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	if err := ds.CheckConnection(); err != nil {
+		return nil, err
+	}
+
+	table, _ := request.Params.Arguments["table"].(string)
+	if table == "" {
+		return nil, fmt.Errorf("table is required")
+	}
+
+	opts := dataprofile.Options{}
+	if columns, ok := request.Params.Arguments["columns"].([]interface{}); ok {
+		for _, c := range columns {
+			name, ok := c.(string)
+			if !ok {
+				return nil, fmt.Errorf("columns must be an array of column names")
+			}
+			opts.Columns = append(opts.Columns, name)
+		}
+	}
+	if v, ok := request.Params.Arguments["sample_size"].(float64); ok {
+		opts.SampleSize = int(v)
+	}
+	if v, ok := request.Params.Arguments["top"].(float64); ok {
+		opts.Top = int(v)
+	}
+	if v, ok := request.Params.Arguments["buckets"].(float64); ok {
+		opts.Buckets = int(v)
+	}
+	opts.Exact, _ = request.Params.Arguments["exact"].(bool)
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Profiling only reads, but reads a lot
+	if err := auth.CheckStatement(ctx, sqlutil.ClassRead); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	schema, name, err := qualifiedName(ctx, ds, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to profile table %s: %w", table, err)
+	}
+	t, ok, err := catalog.Default.For(ds.Identity()).Table(ctx, catalog.InformationSchema{DS: ds}, schema, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to profile table %s: %w", table, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("failed to profile table %s: table does not exist", table)
+	}
+
+	profile, err := dataprofile.Profile(ctx, ds, t, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to profile table %s: %w", table, err)
+	}
+
+	result, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal results to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(result)), nil
+}
+
+// defaultMaxValueLength is the length sampled values are truncated to by default
+const defaultMaxValueLength = 200
+
+// sampleRowsHandler reads a few rows of a table without scanning it, shortening
+// long text and binary values
+func sampleRowsHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	if err := ds.CheckConnection(); err != nil {
+		return nil, err
+	}
+
+	table, _ := request.Params.Arguments["table"].(string)
+	if table == "" {
+		return nil, fmt.Errorf("table is required")
+	}
+
+	opts := sampling.Options{}
+	strategy, _ := request.Params.Arguments["strategy"].(string)
+	opts.Strategy = sampling.Strategy(strategy)
+	if columns, ok := request.Params.Arguments["columns"].([]interface{}); ok {
+		for _, c := range columns {
+			name, ok := c.(string)
+			if !ok {
+				return nil, fmt.Errorf("columns must be an array of column names")
+			}
+			opts.Columns = append(opts.Columns, name)
+		}
+	}
+	if v, ok := request.Params.Arguments["limit"].(float64); ok {
+		opts.Limit = int(v)
+	}
+	format := utils.FormatOptions{MaxValueLength: defaultMaxValueLength, SummarizeBinary: true}
+	if v, ok := request.Params.Arguments["max_length"].(float64); ok {
+		if v < 0 {
+			return nil, fmt.Errorf("max_length must not be negative")
+		}
+		format.MaxValueLength = int(v)
+	}
+
+	if err := auth.CheckStatement(ctx, sqlutil.ClassRead); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	schema, name, err := qualifiedName(ctx, ds, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample table %s: %w", table, err)
+	}
+	t, ok, err := catalog.Default.For(ds.Identity()).Table(ctx, catalog.InformationSchema{DS: ds}, schema, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample table %s: %w", table, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("failed to sample table %s: table does not exist", table)
+	}
+
+	q, err := sampling.Build(ctx, ds, t, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample table %s: %w", table, err)
+	}
+
+	rows, err := ds.QueryContext(ctx, q.SQL, q.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	output, count, err := utils.FormatQueryResultAsJsonWithOptions(rows, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format results: %w", err)
+	}
+
+	result := mcp.NewToolResultText(output)
+	result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("%d rows of %s.%s (%s)", count, schema, name, q.Strategy)))
+	return result, nil
+}
+
+// listObjectsHandler returns a handler listing the schema objects loaded by load,
+// such as the routines or triggers of a database
+func listObjectsHandler[T any](objects string, load func(catalog.InformationSchema, context.Context, catalog.ObjectFilter) ([]T, error), loadOffline func(*snapshot.Snapshot, catalog.ObjectFilter) []T) func(context.Context, mcp.CallToolRequest, datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+		// All user databases are listed unless a database is given
+		f := catalog.ObjectFilter{}
+		f.Schema, _ = request.Params.Arguments["database"].(string)
+		f.Table, _ = request.Params.Arguments["table"].(string)
+		f.WithBodies, _ = request.Params.Arguments["include_definitions"].(bool)
+
+		var list []T
+		var offline []*snapshot.Snapshot
+		if err := ds.CheckConnection(); err != nil {
+			// Answer from the snapshots while disconnected
+			if offline, err = offlineSnapshots(ctx, f.Schema, err); err != nil {
+				return nil, err
+			}
+			list = []T{}
+			for _, s := range offline {
+				list = append(list, loadOffline(s, f)...)
+			}
+		} else {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			if list, err = load(catalog.InformationSchema{DS: ds}, ctx, f); err != nil {
+				return nil, fmt.Errorf("failed to list %s: %w", objects, err)
+			}
+		}
+
+		result, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal results to JSON: %w", err)
+		}
+		return withOfflineNote(mcp.NewToolResultText(string(result)), offline), nil
+	}
+}
+
+// showDefinitionHandler returns the CREATE statement of a table, view, routine, trigger or event
+func showDefinitionHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	if err := ds.CheckConnection(); err != nil {
+		return nil, err
+	}
+
+	objectType, _ := request.Params.Arguments["type"].(string)
+	name, _ := request.Params.Arguments["name"].(string)
+	if objectType == "" || name == "" {
+		return nil, fmt.Errorf("type and name are required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	schema, objectName, err := qualifiedName(ctx, ds, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to show definition of %s: %w", name, err)
+	}
+
+	definition, err := catalog.InformationSchema{DS: ds}.Definition(ctx, objectType, schema, objectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to show definition of %s: %w", name, err)
+	}
+
+	result, err := json.MarshalIndent(definition, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal results to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(result)), nil
+}
+
+// schemaSide is one of the schemas compared by schema_diff
+type schemaSide struct {
+	Profile string `json:"profile,omitempty"`
+	Schema  string `json:"schema"`
+	ds      datastore.DatastoreInterface
+}
+
+// schemaDiff is the result of schema_diff
+type schemaDiff struct {
+	Source    *schemaSide `json:"source"`
+	Target    *schemaSide `json:"target"`
+	Identical bool        `json:"identical"`
+	schemadiff.Diff
+	*schemadiff.Script
+}
+
+// schemaDiffHandler compares the tables of two schemas of the session connection
+// or of connection profiles, optionally with the statements migrating the target
+func schemaDiffHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	if err := auth.CheckStatement(ctx, sqlutil.ClassRead); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	source, closeSource, err := openSchemaSide(ctx, request.Params.Arguments, "source", ds)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSource()
+	target, closeTarget, err := openSchemaSide(ctx, request.Params.Arguments, "target", ds)
+	if err != nil {
+		return nil, err
+	}
+	defer closeTarget()
+	if source.Profile == target.Profile && source.Schema == target.Schema {
+		return nil, fmt.Errorf("source and target are the same schema %s", source.Schema)
+	}
+
+	sourceTables, err := catalog.InformationSchema{DS: source.ds}.Schema(ctx, source.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load source schema %s: %w", source.Schema, err)
+	}
+	targetTables, err := catalog.InformationSchema{DS: target.ds}.Schema(ctx, target.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load target schema %s: %w", target.Schema, err)
+	}
+
+	diff := &schemaDiff{Source: source, Target: target, Diff: schemadiff.Compare(source.Schema, sourceTables, target.Schema, targetTables)}
+	diff.Identical = diff.Diff.Identical()
+
+	if alter, _ := request.Params.Arguments["alter"].(bool); alter {
+		// Added tables are created as defined in the source
+		diff.Script, err = diff.Diff.Script(target.Schema, func(name string) (string, error) {
+			definition, err := catalog.InformationSchema{DS: source.ds}.Definition(ctx, "table", source.Schema, name)
+			if err != nil {
+				return "", fmt.Errorf("failed to load definition of %s.%s: %w", source.Schema, name, err)
+			}
+			return definition.SQL, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal results to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(result)), nil
+}
+
+// openSchemaSide resolves the source or target of schema_diff. A profile opens
+// a connection of its own, closed by the returned function; without a profile
+// the session connection is used. The schema defaults to the current database.
+func openSchemaSide(ctx context.Context, arguments map[string]interface{}, side string, ds datastore.DatastoreInterface) (*schemaSide, func(), error) {
+	s := &schemaSide{ds: ds}
+	s.Profile, _ = arguments[side+"_profile"].(string)
+	s.Schema, _ = arguments[side].(string)
+	s.Schema = strings.Trim(s.Schema, "`")
+
+	closeConn := func() {}
+	if s.Profile == "" {
+		if err := ds.CheckConnection(); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		conn, closeProfile, err := openProfile(ctx, s.Profile)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.ds = conn
+		closeConn = closeProfile
+	}
+
+	if s.Schema == "" {
+		database, err := currentDatabase(ctx, s.ds)
+		if err == nil && database == "" {
+			err = fmt.Errorf("%s is required when no database is selected", side)
+		}
+		if err != nil {
+			closeConn()
+			return nil, nil, err
+		}
+		s.Schema = database
+	}
+	return s, closeConn, nil
+}
+
+// openProfile opens a connection of its own with a connection profile, closed
+// by the returned function. The connection is admitted by the rate limits of
+// its profile unless the session request was already admitted on it.
+func openProfile(ctx context.Context, name string) (*datastore.MySQLDatastore, func(), error) {
+	params, err := profileParams(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	release := func() {}
+	if ratelimit.Default != nil && name != session.Default.FromContext(ctx).ConnectionKey() {
+		release, err = ratelimit.Default.Acquire("", name)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	conn := &datastore.MySQLDatastore{}
+	if err := conn.Connect(ctx, params); err != nil {
+		release()
+		return nil, nil, fmt.Errorf("failed to connect with profile %s: %w", name, err)
+	}
+	return conn, func() {
+		conn.Close()
+		release()
+	}, nil
+}
+
+// snapshotSchemaHandler saves the catalog of a schema to a snapshot file of the
+// snapshot directory, or returns it when snapshots are not saved to files
+func snapshotSchemaHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	if err := ds.CheckConnection(); err != nil {
+		return nil, err
+	}
+
+	format := snapshot.JSON
+	if f, _ := request.Params.Arguments["format"].(string); f != "" {
+		format = snapshot.Format(f)
+	}
+	file, _ := request.Params.Arguments["file"].(string)
+	if file != "" {
+		if _, err := snapshot.FormatOf(file); err != nil {
+			return nil, err
+		}
+	}
+	if err := auth.CheckStatement(ctx, sqlutil.ClassRead); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	schema, err := requestedSchema(ctx, request, ds)
+	if err != nil {
+		return nil, err
+	}
+	s, err := snapshot.Take(ctx, ds, session.Default.FromContext(ctx).Profile(), schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot schema %s: %w", schema, err)
+	}
+	summary := fmt.Sprintf("%d tables, %d views, %d routines, %d triggers and %d events", len(s.Tables), len(s.Views), len(s.Routines), len(s.Triggers), len(s.Events))
+
+	if file == "" && snapshot.Default.Dir() == "" {
+		// Without a snapshot directory the client keeps the snapshot
+		data, err := s.Marshal(format)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Default.Add(s)
+		result := mcp.NewToolResultText(string(data))
+		result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("Snapshot of %s with %s, not saved to a file without -snapshot-dir", schema, summary)))
+		return result, nil
+	}
+
+	if file != "" {
+		// The extension of the file name wins over the format
+		format, _ = snapshot.FormatOf(file)
+	}
+	path, err := snapshot.Default.Save(s, file, format)
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Saved snapshot of %s with %s to %s", schema, summary, path)), nil
+}
+
+// compareToSnapshotHandler reports the changes of a live schema since a snapshot
+func compareToSnapshotHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	if err := ds.CheckConnection(); err != nil {
+		return nil, err
+	}
+	if err := auth.CheckStatement(ctx, sqlutil.ClassRead); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	// The snapshot is read from a file, or is the latest snapshot of the schema
+	// of the profile of the session
+	profile := session.Default.FromContext(ctx).Profile()
+	var saved *snapshot.Snapshot
+	schema, _ := request.Params.Arguments["database"].(string)
+	schema = strings.Trim(schema, "`")
+	if file, _ := request.Params.Arguments["file"].(string); file != "" {
+		var err error
+		if saved, err = snapshot.Default.Load(file); err != nil {
+			return nil, err
+		}
+		if err := auth.CheckProfile(ctx, saved.Profile); err != nil {
+			return nil, err
+		}
+		if schema == "" {
+			schema = saved.Schema
+		}
+	} else {
+		var err error
+		if schema, err = requestedSchema(ctx, request, ds); err != nil {
+			return nil, err
+		}
+		var ok bool
+		if saved, ok = snapshot.Default.Get(profile, schema); !ok {
+			return nil, fmt.Errorf("no snapshot of %s is loaded, take one with snapshot_schema or give its file", schema)
+		}
+	}
+
+	live, err := snapshot.Take(ctx, ds, profile, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare schema %s: %w", schema, err)
+	}
+
+	result, err := json.MarshalIndent(snapshot.Compare(saved, live), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal results to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(result)), nil
+}
+
+// maxInlineDump is the largest dump returned inline when the server has no dump directory
+const maxInlineDump = 1 << 20
+
+// dumpResult describes a dump written by the dump tool
+type dumpResult struct {
+	Profile string `json:"profile,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Bytes   int64  `json:"bytes"`
+	*dump.Summary
+}
+
+// dumpHandler writes a mysqldump-compatible dump of databases or tables to a
+// file of the dump directory, or returns it when the server has none
+func dumpHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	args := request.Params.Arguments
+
+	opts := dump.Options{}
+	databases, err := stringArgs(args, "databases")
+	if err != nil {
+		return nil, err
+	}
+	for _, database := range databases {
+		opts.Databases = append(opts.Databases, strings.Trim(database, "`"))
+	}
+	tables, err := stringArgs(args, "tables")
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := args["batch_size"].(float64); ok {
+		opts.BatchRows = int(v)
+	}
+	opts.NoData, _ = args["no_data"].(bool)
+	opts.CreateDatabases, _ = args["create_databases"].(bool)
+
+	gz, _ := args["gzip"].(bool)
+	file, _ := args["file"].(string)
+	if gz && file != "" && !strings.HasSuffix(file, ".gz") {
+		file += ".gz"
+	}
+	if file != "" || (gz && dump.Dir == "") {
+		// Checks the file name, and that there is a dump directory to write to
+		if _, err := dump.Path(file); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := auth.CheckStatement(ctx, sqlutil.ClassRead); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	// A profile dumps another server, such as staging, without switching the session
+	profile, _ := args["profile"].(string)
+	if profile != "" {
+		conn, closeConn, err := openProfile(ctx, profile)
+		if err != nil {
+			return nil, err
+		}
+		defer closeConn()
+		ds = conn
+	}
+	if err := ds.CheckConnection(); err != nil {
+		return nil, err
+	}
+
+	// Qualified tables select their database
+	for _, table := range tables {
+		schema, name, qualified := strings.Cut(table, ".")
+		if !qualified {
+			opts.Tables = append(opts.Tables, strings.Trim(schema, "`"))
+			continue
+		}
+		schema = strings.Trim(schema, "`")
+		if len(opts.Databases) == 0 {
+			opts.Databases = []string{schema}
+		}
+		if len(opts.Databases) > 1 || opts.Databases[0] != schema {
+			return nil, fmt.Errorf("tables can only be selected in a single database")
+		}
+		opts.Tables = append(opts.Tables, strings.Trim(name, "`"))
+	}
+	if len(opts.Databases) == 0 {
+		database, err := currentDatabase(ctx, ds)
+		if err != nil {
+			return nil, err
+		}
+		if database == "" {
+			return nil, fmt.Errorf("databases are required when no database is selected")
+		}
+		opts.Databases = []string{database}
+	}
+
+	// Filters of unqualified tables apply to the single dumped database
+	if where, ok := args["where"].(map[string]interface{}); ok {
+		opts.Where = map[string]string{}
+		for table, condition := range where {
+			c, ok := condition.(string)
+			if !ok {
+				return nil, fmt.Errorf("where must map tables to conditions")
+			}
+			if !strings.Contains(table, ".") && len(opts.Databases) == 1 {
+				table = opts.Databases[0] + "." + table
+			}
+			opts.Where[strings.ReplaceAll(table, "`", "")] = c
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	for table, where := range opts.Where {
+		if err := auth.CheckStatement(ctx, sqlutil.Classify(dump.FilterStatement(table, where))); err != nil {
+			return nil, err
+		}
+	}
+
+	// The dump changes the session settings of its connection, which is not reused
+	conn, err := ds.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer discardConn(conn)
+
+	result := &dumpResult{Profile: profile}
+	if file == "" && dump.Dir == "" {
+		// Without a dump directory the client receives the dump
+		buf := &limitedBuffer{limit: maxInlineDump}
+		if result.Summary, err = dump.Dump(ctx, conn, buf, opts); err != nil {
+			return nil, err
+		}
+		result.Bytes = int64(buf.Len())
+		summary, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal results to JSON: %w", err)
+		}
+		toolResult := mcp.NewToolResultText(buf.String())
+		toolResult.Content = append(toolResult.Content, mcp.NewTextContent(string(summary)))
+		return toolResult, nil
+	}
+
+	if file == "" {
+		file = strings.Join(opts.Databases, "-") + ".sql"
+		if gz {
+			file += ".gz"
+		}
+	}
+	result.Path, result.Bytes, err = dump.WriteFile(file, func(w io.Writer) error {
+		var err error
+		result.Summary, err = dump.Dump(ctx, conn, w, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal results to JSON: %w", err)
+	}
+	return mcp.NewToolResultText(string(summary)), nil
+}
+
+// limitedBuffer is a buffer refusing to grow beyond its limit
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("the dump is larger than %d bytes, start the server with -dump-dir to write it to a file", b.limit)
+	}
+	return b.Buffer.Write(p)
+}
+
+// stringArgs returns an array argument of strings
+func stringArgs(args map[string]interface{}, name string) ([]string, error) {
+	values, ok := args[name].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	var list []string
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be an array of names", name)
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// requestedSchema returns the database argument, or the current database
+func requestedSchema(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (string, error) {
+	if database, _ := request.Params.Arguments["database"].(string); database != "" {
+		return strings.Trim(database, "`"), nil
+	}
+	database, err := currentDatabase(ctx, ds)
+	if err != nil {
+		return "", err
+	}
+	if database == "" {
+		return "", fmt.Errorf("database is required when no database is selected")
+	}
+	return database, nil
+}
+
+// DescribeTableHandler describes a table structure
+func describeTableHandler(ctx context.Context, request mcp.CallToolRequest, ds datastore.DatastoreInterface) (*mcp.CallToolResult, error) {
+	// Extract table name
+	table := request.Params.Arguments["table"].(string)
+
+	var t *catalog.Table
+	var offline []*snapshot.Snapshot
+	if err := ds.CheckConnection(); err != nil {
+		// Answer from the snapshots while disconnected
+		if t, offline, err = offlineTable(ctx, table, err); err != nil {
+			return nil, err
+		}
+	} else {
+		// Create context with timeout
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		schema, name, err := qualifiedName(ctx, ds, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe table %s: %w", table, err)
+		}
+
+		// Load the table from the schema catalog
+		var ok bool
+		if t, ok, err = catalog.Default.For(ds.Identity()).Table(ctx, catalog.InformationSchema{DS: ds}, schema, name); err != nil {
+			return nil, fmt.Errorf("failed to describe table %s: %w", table, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("failed to describe table %s: table does not exist", table)
+		}
+	}
+
+	// Use the same fields as DESCRIBE
+	results := []map[string]string{}
+	for _, c := range t.Columns {
+		nullable := "NO"
+		if c.Nullable {
+			nullable = "YES"
+		}
+		def := "NULL"
+		if c.Default != nil {
+			def = *c.Default
+		}
+		results = append(results, map[string]string{
+			"Field":   c.Name,
+			"Type":    c.Type,
+			"Null":    nullable,
+			"Key":     c.Key,
+			"Default": def,
+			"Extra":   c.Extra,
+		})
+	}
+
+	result, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal results to JSON: %w", err)
+	}
+
+	// Add a table-specific summary
+	return withOfflineNote(mcp.NewToolResultText(fmt.Sprintf("%s\n%s table structure described successfully", result, table)), offline), nil
+}
+
+// qualifiedName splits a name optionally qualified as database.name. The current
+// database is used unless qualified.
+func qualifiedName(ctx context.Context, ds datastore.DatastoreInterface, name string) (string, string, error) {
+	schema, object, qualified := strings.Cut(name, ".")
+	if !qualified {
+		object = schema
+		var err error
+		if schema, err = currentDatabase(ctx, ds); err != nil {
+			return "", "", err
+		}
+		if schema == "" {
+			return "", "", fmt.Errorf("no database selected, qualify the table as database.table")
+		}
+	}
+	return strings.Trim(schema, "`"), strings.Trim(object, "`"), nil
+}
+
+// currentDatabase returns the default database of the connection, empty if none
+func currentDatabase(ctx context.Context, ds datastore.DatastoreInterface) (string, error) {
+	rows, err := ds.QueryContext(ctx, "SELECT DATABASE()")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var database sql.NullString
+	if rows.Next() {
+		if err := rows.Scan(&database); err != nil {
+			return "", fmt.Errorf("failed to scan row: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return database.String, nil
+}
+
+// offlineSnapshots returns the snapshots answering schema questions while
+// disconnected: the snapshots of a schema, or of all schemas if none is given,
+// taken with the connection profiles the caller may use. connErr is returned
+// when there is no such snapshot.
+func offlineSnapshots(ctx context.Context, schema string, connErr error) ([]*snapshot.Snapshot, error) {
+	schema = strings.Trim(schema, "`")
+	var snapshots []*snapshot.Snapshot
+	for _, s := range snapshot.Default.All() {
+		if schema != "" && s.Schema != schema {
+			continue
+		}
+		if auth.CheckProfile(ctx, s.Profile) != nil {
+			continue
+		}
+		snapshots = append(snapshots, s)
+	}
+	if len(snapshots) == 0 {
+		return nil, connErr
+	}
+	return snapshots, nil
+}
+
+// offlineTable finds a table, optionally qualified as database.table, in the
+// snapshots. The name must match a single loaded snapshot.
+func offlineTable(ctx context.Context, table string, connErr error) (*catalog.Table, []*snapshot.Snapshot, error) {
+	schema, name, qualified := strings.Cut(table, ".")
+	if !qualified {
+		name, schema = schema, ""
+	}
+	snapshots, err := offlineSnapshots(ctx, schema, connErr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(snapshots) > 1 && qualified {
+		return nil, nil, fmt.Errorf("failed to describe table %s: not connected and snapshots of several profiles are loaded, connect to choose one", table)
+	}
+	if len(snapshots) > 1 {
+		return nil, nil, fmt.Errorf("failed to describe table %s: not connected and several snapshots are loaded, qualify the table as database.table", table)
+	}
+	t, ok := snapshots[0].Table(strings.Trim(name, "`"))
+	if !ok {
+		return nil, nil, fmt.Errorf("failed to describe table %s: table does not exist in the snapshot of %s", table, snapshots[0].Schema)
+	}
+	return t, snapshots, nil
+}
+
+// withOfflineNote tells in a second content item that a result was answered
+// from snapshots
+func withOfflineNote(result *mcp.CallToolResult, snapshots []*snapshot.Snapshot) *mcp.CallToolResult {
+	if len(snapshots) == 0 {
+		return result
+	}
+	taken := make([]string, len(snapshots))
+	for i, s := range snapshots {
+		taken[i] = fmt.Sprintf("%s taken at %s", s.Schema, s.TakenAt.Format(time.RFC3339))
+		if s.Profile != "" {
+			taken[i] = fmt.Sprintf("%s of profile %s taken at %s", s.Schema, s.Profile, s.TakenAt.Format(time.RFC3339))
+		}
+	}
+	result.Content = append(result.Content, mcp.NewTextContent("Not connected, answered from the snapshot of "+strings.Join(taken, ", ")))
+	return result
 }
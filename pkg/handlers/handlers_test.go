@@ -3,24 +3,44 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/auth"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/cache"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/config"
 	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/dump"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/history"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/mysqltest"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/savedqueries"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/session"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/snapshot"
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockDatastore is a mock implementation of datastore.DatastoreInterface
 type MockDatastore struct {
 	mock.Mock
 	isConnected bool
+	tlsCipher   string
+	health      datastore.Health
 }
 
 // Connect mocks the Connect method
-func (m *MockDatastore) Connect(ctx context.Context, host, port, username, password, database string) error {
-	args := m.Called(ctx, host, port, username, password, database)
+func (m *MockDatastore) Connect(ctx context.Context, params datastore.ConnectParams) error {
+	args := m.Called(ctx, params)
 	if args.Error(0) == nil {
 		m.isConnected = true
 	}
@@ -51,6 +71,46 @@ func (m *MockDatastore) ExecContext(ctx context.Context, query string, args ...i
 	return nil, nil
 }
 
+// Conn mocks the Conn method
+func (m *MockDatastore) Conn(ctx context.Context) (*sql.Conn, error) {
+	args := m.Called(ctx)
+	conn, _ := args.Get(0).(*sql.Conn)
+	return conn, args.Error(1)
+}
+
+// Close mocks the Close method
+func (m *MockDatastore) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// Identity mocks the Identity method
+func (m *MockDatastore) Identity() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+// TLSCipher mocks the TLSCipher method
+func (m *MockDatastore) TLSCipher(ctx context.Context) (string, error) {
+	return m.tlsCipher, nil
+}
+
+// Health mocks the Health method
+func (m *MockDatastore) Health() datastore.Health {
+	return m.health
+}
+
+// Info mocks the Info method
+func (m *MockDatastore) Info(ctx context.Context) (datastore.ConnectionInfo, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(datastore.ConnectionInfo), args.Error(1)
+}
+
+func (m *MockDatastore) UseDatabase(ctx context.Context, database string) error {
+	args := m.Called(ctx, database)
+	return args.Error(0)
+}
+
 // Helper function to create a mock datastore
 func createMockDatastore() *MockDatastore {
 	mockDS := new(MockDatastore)
@@ -95,7 +155,9 @@ func TestConnectHandler(t *testing.T) {
 			mockDS := createMockDatastore()
 
 			// Set expectations
-			mockDS.On("Connect", mock.Anything, "localhost", "3306", "user", "password", mock.Anything).Return(tt.connectError)
+			mockDS.On("Connect", mock.Anything, mock.MatchedBy(func(p datastore.ConnectParams) bool {
+				return p.Host == "localhost" && p.Port == "3306" && p.Username == "user" && p.Password == "password"
+			})).Return(tt.connectError)
 
 			// Create request
 			request := mcp.CallToolRequest{}
@@ -121,6 +183,258 @@ func TestConnectHandler(t *testing.T) {
 	}
 }
 
+// Test ConnectHandler with a connection profile
+func TestConnectHandlerWithProfile(t *testing.T) {
+	previous := config.Default
+	config.Default = &config.Config{
+		Profiles: map[string]config.Profile{
+			"replica": {Host: "replica.internal", Username: "reader", Password: "secret", Database: "app"},
+		},
+	}
+	defer func() { config.Default = previous }()
+
+	restricted := auth.WithIdentity(context.Background(), &auth.Identity{User: "alice", Role: config.Role{Profiles: []string{"replica"}}})
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		arguments   map[string]interface{}
+		expectCall  bool
+		expectError bool
+	}{
+		{
+			name:       "profile",
+			ctx:        context.Background(),
+			arguments:  map[string]interface{}{"profile": "replica"},
+			expectCall: true,
+		},
+		{
+			name:        "unknown profile",
+			ctx:         context.Background(),
+			arguments:   map[string]interface{}{"profile": "missing"},
+			expectError: true,
+		},
+		{
+			name:       "allowed profile",
+			ctx:        restricted,
+			arguments:  map[string]interface{}{"profile": "replica"},
+			expectCall: true,
+		},
+		{
+			name:        "direct connection not allowed",
+			ctx:         restricted,
+			arguments:   map[string]interface{}{"host": "localhost", "username": "user", "password": "password"},
+			expectError: true,
+		},
+		{
+			name:        "TLS disabled",
+			ctx:         restricted,
+			arguments:   map[string]interface{}{"profile": "replica", "ssl_mode": "disabled"},
+			expectError: true,
+		},
+		{
+			name:        "TLS files",
+			ctx:         context.Background(),
+			arguments:   map[string]interface{}{"profile": "replica", "ssl_ca": "/etc/shadow"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDS := createMockDatastore()
+			if tt.expectCall {
+				mockDS.On("Connect", mock.Anything, datastore.ConnectParams{
+					Host:     "replica.internal",
+					Port:     "3306",
+					Username: "reader",
+					Password: "secret",
+					Database: "app",
+					Profile:  true,
+				}).Return(nil)
+			}
+
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = tt.arguments
+
+			result, err := connectHandler(tt.ctx, request, mockDS)
+
+			mockDS.AssertExpectations(t)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, result)
+			} else {
+				assert.NoError(t, err)
+				assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "using profile replica")
+			}
+		})
+	}
+}
+
+// Test ConnectHandler with defaults of the option files
+func TestConnectHandlerWithOptionFileDefaults(t *testing.T) {
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{}
+
+	// Without defaults the address and credentials are required
+	_, err := connectHandler(context.Background(), request, createMockDatastore())
+	assert.EqualError(t, err, "host is required")
+
+	previous := datastore.Defaults
+	datastore.Defaults = datastore.ConnectParams{Host: "db.internal", Port: "3307", Username: "app", Password: "secret"}
+	defer func() { datastore.Defaults = previous }()
+
+	mockDS := createMockDatastore()
+	mockDS.On("Connect", mock.Anything, mock.MatchedBy(func(p datastore.ConnectParams) bool {
+		return p.Host == "" && p.Username == "" && p.Password == ""
+	})).Return(nil)
+
+	result, err := connectHandler(context.Background(), request, mockDS)
+	assert.NoError(t, err)
+	assert.Equal(t, "Successfully connected to MySQL at db.internal:3307", result.Content[0].(mcp.TextContent).Text)
+	mockDS.AssertExpectations(t)
+
+	// The default credentials are not sent to another server
+	request.Params.Arguments = map[string]interface{}{"host": "other.internal"}
+	_, err = connectHandler(context.Background(), request, createMockDatastore())
+	assert.EqualError(t, err, "username is required")
+
+	// Credentials without an address connect to localhost
+	datastore.Defaults = datastore.ConnectParams{Username: "app", Password: "secret"}
+	request.Params.Arguments = map[string]interface{}{}
+	mockDS = createMockDatastore()
+	mockDS.On("Connect", mock.Anything, mock.Anything).Return(nil)
+	result, err = connectHandler(context.Background(), request, mockDS)
+	assert.NoError(t, err)
+	assert.Equal(t, "Successfully connected to MySQL at localhost:3306", result.Content[0].(mcp.TextContent).Text)
+}
+
+// Test ConnectHandler options
+func TestConnectHandlerOptions(t *testing.T) {
+	tests := []struct {
+		name         string
+		arguments    map[string]interface{}
+		expectError  bool
+		expectedAddr string
+		check        func(t *testing.T, p datastore.ConnectParams)
+	}{
+		{
+			name: "pool and driver options",
+			arguments: map[string]interface{}{
+				"host": "localhost", "username": "user", "password": "password",
+				"max_open_conns": float64(20), "conn_max_lifetime": "1m", "charset": "utf8mb4",
+				"time_zone": "UTC", "parse_time": true, "read_timeout": "30s", "interpolate_params": true,
+			},
+			expectedAddr: "localhost:3306",
+			check: func(t *testing.T, p datastore.ConnectParams) {
+				assert.Equal(t, 20, p.Options.MaxOpenConns)
+				assert.Equal(t, time.Minute, p.Options.ConnMaxLifetime)
+				assert.Equal(t, "utf8mb4", p.Options.Charset)
+				assert.Equal(t, "UTC", p.Options.TimeZone)
+				require.NotNil(t, p.Options.ParseTime)
+				assert.True(t, *p.Options.ParseTime)
+				assert.Equal(t, 30*time.Second, p.Options.ReadTimeout)
+				require.NotNil(t, p.Options.InterpolateParams)
+				assert.True(t, *p.Options.InterpolateParams)
+			},
+		},
+		{
+			name:         "dsn",
+			arguments:    map[string]interface{}{"dsn": "reader:secret@tcp(db.internal:3307)/app?parseTime=true"},
+			expectedAddr: "db.internal:3307",
+			check: func(t *testing.T, p datastore.ConnectParams) {
+				assert.Equal(t, "reader", p.Username)
+				assert.Equal(t, "app", p.Database)
+				assert.Equal(t, "reader:secret@tcp(db.internal:3307)/app?parseTime=true", p.DSN)
+			},
+		},
+		{
+			name:        "invalid dsn",
+			arguments:   map[string]interface{}{"dsn": "not a dsn"},
+			expectError: true,
+		},
+		{
+			name:        "invalid duration",
+			arguments:   map[string]interface{}{"host": "localhost", "username": "user", "password": "password", "read_timeout": "soon"},
+			expectError: true,
+		},
+		{
+			name:        "invalid time zone",
+			arguments:   map[string]interface{}{"host": "localhost", "username": "user", "password": "password", "time_zone": "Mars/Olympus"},
+			expectError: true,
+		},
+		{
+			name: "tls options",
+			arguments: map[string]interface{}{
+				"host": "localhost", "username": "user", "password": "password",
+				"ssl_mode": "verify-identity", "ssl_ca": "/etc/ssl/ca.pem", "ssl_server_name": "db.example.com",
+			},
+			expectedAddr: "localhost:3306",
+			check: func(t *testing.T, p datastore.ConnectParams) {
+				assert.Equal(t, "verify-identity", p.Options.SSLMode)
+				assert.Equal(t, "/etc/ssl/ca.pem", p.Options.SSLCA)
+				assert.Equal(t, "db.example.com", p.Options.SSLServerName)
+			},
+		},
+		{
+			name:         "unix socket",
+			arguments:    map[string]interface{}{"socket": "/var/run/mysqld/mysqld.sock", "username": "user", "password": "password"},
+			expectedAddr: "/var/run/mysqld/mysqld.sock",
+			check: func(t *testing.T, p datastore.ConnectParams) {
+				assert.Equal(t, "/var/run/mysqld/mysqld.sock", p.Socket)
+			},
+		},
+		{
+			name:        "invalid ssl mode",
+			arguments:   map[string]interface{}{"host": "localhost", "username": "user", "password": "password", "ssl_mode": "sometimes"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDS := createMockDatastore()
+			var params datastore.ConnectParams
+			if !tt.expectError {
+				mockDS.On("Connect", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+					params = args.Get(1).(datastore.ConnectParams)
+				}).Return(nil)
+			}
+
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = tt.arguments
+
+			result, err := connectHandler(context.Background(), request, mockDS)
+
+			mockDS.AssertExpectations(t)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, result)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "Successfully connected to MySQL at "+tt.expectedAddr, result.Content[0].(mcp.TextContent).Text)
+				tt.check(t, params)
+			}
+		})
+	}
+}
+
+func TestConnectHandlerReportsTLSCipher(t *testing.T) {
+	mockDS := createMockDatastore()
+	mockDS.tlsCipher = "TLS_AES_256_GCM_SHA384"
+	mockDS.On("Connect", mock.Anything, mock.Anything).Return(nil)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{"host": "localhost", "username": "user", "password": "password"}
+
+	result, err := connectHandler(context.Background(), request, mockDS)
+	assert.NoError(t, err)
+	assert.Len(t, result.Content, 2)
+	assert.Equal(t, "TLS cipher: TLS_AES_256_GCM_SHA384", result.Content[1].(mcp.TextContent).Text)
+}
+
 // Test QueryHandler
 func TestQueryHandler(t *testing.T) {
 	tests := []struct {
@@ -329,6 +643,1237 @@ func TestDescribeTableHandler(t *testing.T) {
 	}
 }
 
+// Test runScriptHandler
+func TestRunScriptHandler(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SET @limit = 2", mysqltest.Result{})
+	server.Handle("CREATE TEMPORARY TABLE recent (id INT)", mysqltest.Result{})
+	server.Handle("INSERT INTO recent VALUES (1), (2)", mysqltest.Result{AffectedRows: 2})
+	server.Handle("SELECT id FROM recent", mysqltest.Result{Columns: []string{"id"}, Rows: [][]interface{}{{1}, {2}}})
+	server.HandleError("SELECT * FROM missing", 1146, "Table 'shop.missing' doesn't exist")
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	h, err := history.New("", 10)
+	require.NoError(t, err)
+	previous := history.Default
+	history.Default = h
+	defer func() { history.Default = previous }()
+
+	script := "SET @limit = 2;\nCREATE TEMPORARY TABLE recent (id INT);\nSELECT * FROM missing;\nINSERT INTO recent VALUES (1), (2);\nSELECT id FROM recent;"
+
+	tests := []struct {
+		name     string
+		onError  string
+		statuses []string
+	}{
+		{name: "stop on error", statuses: []string{"ok", "ok", "error", "skipped", "skipped"}},
+		{name: "continue on error", onError: "continue", statuses: []string{"ok", "ok", "error", "ok", "ok"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = map[string]interface{}{"script": script, "on_error": tt.onError}
+			result, err := runScriptHandler(context.Background(), request, ds)
+			require.NoError(t, err)
+			assert.True(t, result.IsError)
+
+			var results []scriptResult
+			require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &results))
+			require.Len(t, results, len(tt.statuses))
+			for i, status := range tt.statuses {
+				assert.Equal(t, status, results[i].Status, results[i].Statement)
+			}
+			assert.Contains(t, results[2].Error, "doesn't exist")
+
+			if tt.onError == "continue" {
+				assert.Equal(t, int64(2), *results[3].RowsAffected)
+				assert.Equal(t, 2, *results[4].RowCount)
+				assert.JSONEq(t, `[{"id": "1"}, {"id": "2"}]`, string(results[4].Rows))
+				assert.Equal(t, "5 statements: 4 ok, 1 failed, 0 skipped", result.Content[1].(mcp.TextContent).Text)
+			} else {
+				assert.Equal(t, "5 statements: 2 ok, 1 failed, 2 skipped", result.Content[1].(mcp.TextContent).Text)
+			}
+
+			// The script runs on one connection, which is not returned to the pool
+			assert.Zero(t, ds.Connection().Stats().OpenConnections)
+		})
+	}
+
+	// Executed statements are recorded in the query history
+	entries := h.Search(history.Filter{})
+	assert.Len(t, entries, 8)
+}
+
+// Test runScriptHandler argument errors
+func TestRunScriptHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		arguments map[string]interface{}
+		err       string
+	}{
+		{name: "empty script", ctx: context.Background(), arguments: map[string]interface{}{"script": " ;; "}, err: "script has no statements"},
+		{name: "unterminated string", ctx: context.Background(), arguments: map[string]interface{}{"script": "SELECT 'a"}, err: "failed to split script: line 1: unterminated quoted string"},
+		{name: "invalid mode", ctx: context.Background(), arguments: map[string]interface{}{"script": "SELECT 1", "on_error": "retry"}, err: `invalid on_error "retry", expected stop or continue`},
+		{
+			name:      "statement not allowed",
+			ctx:       auth.WithIdentity(context.Background(), &auth.Identity{User: "alice", Role: config.Role{Statements: []string{"read"}}}),
+			arguments: map[string]interface{}{"script": "SELECT 1; DELETE FROM users"},
+			err:       "statement 2:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDS := createMockDatastore()
+			mockDS.On("CheckConnection").Return(nil)
+
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = tt.arguments
+			_, err := runScriptHandler(tt.ctx, request, mockDS)
+			assert.ErrorContains(t, err, tt.err)
+			// Nothing runs when the script is rejected
+			mockDS.AssertNotCalled(t, "Conn", mock.Anything)
+		})
+	}
+}
+
+// routineQueries are the information_schema queries loading a routine signature
+const (
+	routineQuery    = "SELECT ROUTINE_TYPE, COALESCE(DTD_IDENTIFIER, '') FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = ? AND ROUTINE_NAME = ?"
+	parametersQuery = "SELECT ORDINAL_POSITION, COALESCE(PARAMETER_NAME, ''), COALESCE(PARAMETER_MODE, ''), DTD_IDENTIFIER FROM information_schema.PARAMETERS WHERE SPECIFIC_SCHEMA = ? AND SPECIFIC_NAME = ? AND ROUTINE_TYPE = ? AND ORDINAL_POSITION > 0 ORDER BY ORDINAL_POSITION"
+)
+
+func TestCallProcedureHandler(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SELECT DATABASE()", mysqltest.Result{Columns: []string{"DATABASE()"}, Rows: [][]interface{}{{"shop"}}})
+	server.Handle(routineQuery, mysqltest.Result{Columns: []string{"ROUTINE_TYPE", "DTD_IDENTIFIER"}, Rows: [][]interface{}{{"PROCEDURE", ""}}})
+	server.Handle(parametersQuery, mysqltest.Result{
+		Columns: []string{"ORDINAL_POSITION", "PARAMETER_NAME", "PARAMETER_MODE", "DTD_IDENTIFIER"},
+		Rows: [][]interface{}{
+			{1, "customer_id", "IN", "int"},
+			{2, "note", "INOUT", "varchar(255)"},
+			{3, "order_id", "OUT", "int"},
+		},
+	})
+	server.Handle("SET @mcp_param_2 = ?", mysqltest.Result{})
+	server.Handle("SET @mcp_param_3 = NULL", mysqltest.Result{})
+	server.HandleResults("CALL `shop`.`place_order`(?, @mcp_param_2, @mcp_param_3)",
+		mysqltest.Result{Columns: []string{"sku", "quantity"}, Rows: [][]interface{}{{"A-1", 2}, {"B-7", 1}}},
+		mysqltest.Result{Columns: []string{"total"}, Rows: [][]interface{}{{"42.50"}}},
+		mysqltest.Result{},
+	)
+	server.Handle("SELECT @mcp_param_2 AS `note`, @mcp_param_3 AS `order_id`", mysqltest.Result{
+		Columns: []string{"note", "order_id"},
+		Rows:    [][]interface{}{{"gift wrapped", 1001}},
+	})
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{
+		"name": "place_order",
+		"args": map[string]interface{}{"customer_id": float64(7), "note": "gift"},
+	}
+	result, err := callProcedureHandler(context.Background(), request, ds)
+	require.NoError(t, err)
+
+	var call routineCall
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &call))
+	assert.Equal(t, "shop.place_order", call.Routine)
+	assert.Equal(t, "PROCEDURE", call.Type)
+	require.Len(t, call.ResultSets, 2)
+	assert.Equal(t, 2, call.ResultSets[0].RowCount)
+	assert.JSONEq(t, `[{"sku": "A-1", "quantity": "2"}, {"sku": "B-7", "quantity": "1"}]`, string(call.ResultSets[0].Rows))
+	assert.JSONEq(t, `[{"total": "42.50"}]`, string(call.ResultSets[1].Rows))
+	assert.Equal(t, "gift wrapped", *call.OutParams["note"])
+	assert.Equal(t, "1001", *call.OutParams["order_id"])
+	assert.Nil(t, call.ReturnValue)
+
+	// Arguments are bound as placeholders, whole numbers as integers
+	var bound [][]interface{}
+	for _, e := range server.Executions() {
+		if e.Query == "SET @mcp_param_2 = ?" || strings.HasPrefix(e.Query, "CALL") {
+			bound = append(bound, e.Args)
+		}
+	}
+	assert.Equal(t, [][]interface{}{{"gift"}, {int64(7)}}, bound)
+
+	// The connection holding the session variables is not returned to the pool
+	assert.Zero(t, ds.Connection().Stats().OpenConnections)
+}
+
+func TestCallProcedureHandlerFunction(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle(routineQuery, mysqltest.Result{Columns: []string{"ROUTINE_TYPE", "DTD_IDENTIFIER"}, Rows: [][]interface{}{{"FUNCTION", "decimal(10,2)"}}})
+	server.Handle(parametersQuery, mysqltest.Result{
+		Columns: []string{"ORDINAL_POSITION", "PARAMETER_NAME", "PARAMETER_MODE", "DTD_IDENTIFIER"},
+		Rows:    [][]interface{}{{1, "order_id", "", "int"}},
+	})
+	server.Handle("SELECT `shop`.`order_total`(?)", mysqltest.Result{Columns: []string{"total"}, Rows: [][]interface{}{{"42.50"}}})
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{"name": "shop.order_total", "args": map[string]interface{}{"ORDER_ID": float64(1001)}}
+	result, err := callProcedureHandler(context.Background(), request, ds)
+	require.NoError(t, err)
+
+	var call routineCall
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &call))
+	assert.Equal(t, "FUNCTION", call.Type)
+	assert.Equal(t, "42.50", *call.ReturnValue)
+	assert.Empty(t, call.ResultSets)
+
+	// Unknown routines and mismatched arguments are rejected before the call
+	server.Handle(routineQuery, mysqltest.Result{Columns: []string{"ROUTINE_TYPE", "DTD_IDENTIFIER"}})
+	request.Params.Arguments = map[string]interface{}{"name": "shop.missing"}
+	_, err = callProcedureHandler(context.Background(), request, ds)
+	assert.EqualError(t, err, "failed to call shop.missing: routine does not exist")
+}
+
+func TestBindRoutineArgs(t *testing.T) {
+	routine := &catalog.Routine{Name: "place_order", Parameters: []catalog.Parameter{
+		{Position: 1, Name: "customer_id", Mode: "IN"},
+		{Position: 2, Name: "note", Mode: "INOUT"},
+		{Position: 3, Name: "order_id", Mode: "OUT"},
+	}}
+
+	tests := []struct {
+		name     string
+		args     interface{}
+		expected []interface{}
+		err      string
+	}{
+		{name: "by name", args: map[string]interface{}{"customer_id": float64(7), "note": nil}, expected: []interface{}{int64(7), nil, nil}},
+		{name: "fractional number", args: map[string]interface{}{"customer_id": 1.5, "note": "x"}, expected: []interface{}{1.5, "x", nil}},
+		{name: "missing argument", args: map[string]interface{}{"customer_id": float64(7)}, err: "missing argument note"},
+		{name: "no arguments", args: nil, err: "missing argument customer_id"},
+		{name: "unknown parameter", args: map[string]interface{}{"customer_id": float64(7), "note": "x", "discount": float64(5)}, err: "unknown parameter discount"},
+		{name: "value for OUT parameter", args: map[string]interface{}{"customer_id": float64(7), "note": "x", "order_id": float64(1)}, err: "order_id is an OUT parameter and takes no value"},
+		{name: "not an object", args: []interface{}{float64(7)}, err: "args must be an object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := bindRoutineArgs(routine, tt.args)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, values)
+		})
+	}
+}
+
+func TestListObjectsHandlers(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SELECT TRIGGER_SCHEMA, TRIGGER_NAME, EVENT_OBJECT_TABLE, EVENT_MANIPULATION, ACTION_TIMING, ACTION_ORDER, DEFINER, COALESCE(CREATED, ''), COALESCE(ACTION_STATEMENT, '') FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = ? AND EVENT_OBJECT_TABLE = ? ORDER BY TRIGGER_SCHEMA, EVENT_OBJECT_TABLE, EVENT_MANIPULATION, ACTION_TIMING, ACTION_ORDER", mysqltest.Result{
+		Columns: []string{"TRIGGER_SCHEMA", "TRIGGER_NAME", "EVENT_OBJECT_TABLE", "EVENT_MANIPULATION", "ACTION_TIMING", "ACTION_ORDER", "DEFINER", "CREATED", "ACTION_STATEMENT"},
+		Rows:    [][]interface{}{{"shop", "orders_audit", "orders", "UPDATE", "AFTER", 1, "app@%", "2024-05-01 10:00:00.00", "INSERT INTO audit VALUES (OLD.id)"}},
+	})
+	server.Handle("SELECT ROUTINE_SCHEMA, ROUTINE_NAME, ROUTINE_TYPE, COALESCE(DTD_IDENTIFIER, ''), DEFINER, SECURITY_TYPE, SQL_DATA_ACCESS, IS_DETERMINISTIC, ROUTINE_COMMENT, CREATED, LAST_ALTERED, '' FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA NOT IN ('information_schema', 'performance_schema', 'sys', 'mysql') ORDER BY ROUTINE_SCHEMA, ROUTINE_NAME, ROUTINE_TYPE", mysqltest.Result{
+		Columns: []string{"ROUTINE_SCHEMA", "ROUTINE_NAME", "ROUTINE_TYPE", "DTD_IDENTIFIER", "DEFINER", "SECURITY_TYPE", "SQL_DATA_ACCESS", "IS_DETERMINISTIC", "ROUTINE_COMMENT", "CREATED", "LAST_ALTERED", "ROUTINE_DEFINITION"},
+		Rows: [][]interface{}{
+			{"shop", "order_total", "FUNCTION", "decimal(10,2)", "app@%", "INVOKER", "READS SQL DATA", "YES", "", "2024-05-01 10:00:00", "2024-05-01 10:00:00", ""},
+			{"shop", "place_order", "PROCEDURE", "", "app@%", "DEFINER", "MODIFIES SQL DATA", "NO", "Creates an order", "2024-05-01 10:00:00", "2024-05-02 09:00:00", ""},
+		},
+	})
+	server.Handle("SELECT SPECIFIC_SCHEMA, SPECIFIC_NAME, ROUTINE_TYPE, ORDINAL_POSITION, COALESCE(PARAMETER_NAME, ''), COALESCE(PARAMETER_MODE, ''), DTD_IDENTIFIER FROM information_schema.PARAMETERS WHERE SPECIFIC_SCHEMA NOT IN ('information_schema', 'performance_schema', 'sys', 'mysql') AND ORDINAL_POSITION > 0 ORDER BY SPECIFIC_SCHEMA, SPECIFIC_NAME, ORDINAL_POSITION", mysqltest.Result{
+		Columns: []string{"SPECIFIC_SCHEMA", "SPECIFIC_NAME", "ROUTINE_TYPE", "ORDINAL_POSITION", "PARAMETER_NAME", "PARAMETER_MODE", "DTD_IDENTIFIER"},
+		Rows: [][]interface{}{
+			{"shop", "order_total", "FUNCTION", 1, "order_id", "", "int"},
+			{"shop", "place_order", "PROCEDURE", 1, "customer_id", "IN", "int"},
+			{"shop", "place_order", "PROCEDURE", 2, "order_id", "OUT", "int"},
+		},
+	})
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{"database": "shop", "table": "orders", "include_definitions": true}
+	result, err := listObjectsHandler("triggers", catalog.InformationSchema.Triggers, (*snapshot.Snapshot).ListTriggers)(context.Background(), request, ds)
+	require.NoError(t, err)
+	var triggers []catalog.Trigger
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &triggers))
+	assert.Equal(t, []catalog.Trigger{{
+		Schema: "shop", Name: "orders_audit", Table: "orders", Event: "UPDATE", Timing: "AFTER", Order: 1,
+		Definer: "app@%", Created: "2024-05-01 10:00:00.00", Body: "INSERT INTO audit VALUES (OLD.id)",
+	}}, triggers)
+
+	// Routines of all user databases, with their parameters and without bodies
+	request.Params.Arguments = map[string]interface{}{}
+	result, err = listObjectsHandler("routines", catalog.InformationSchema.Routines, (*snapshot.Snapshot).ListRoutines)(context.Background(), request, ds)
+	require.NoError(t, err)
+	var routines []catalog.Routine
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &routines))
+	require.Len(t, routines, 2)
+	assert.Equal(t, "decimal(10,2)", routines[0].Returns)
+	assert.True(t, routines[0].Deterministic)
+	assert.Equal(t, []catalog.Parameter{{Position: 1, Name: "order_id", Mode: "IN", Type: "int"}}, routines[0].Parameters)
+	assert.Equal(t, "DEFINER", routines[1].SecurityType)
+	assert.Equal(t, "MODIFIES SQL DATA", routines[1].DataAccess)
+	assert.Len(t, routines[1].Parameters, 2)
+	assert.Empty(t, routines[1].Body)
+
+	// Errors of information_schema are reported with the listed objects
+	server.HandleError("SELECT TABLE_SCHEMA, TABLE_NAME, DEFINER, SECURITY_TYPE, CHECK_OPTION, IS_UPDATABLE, '' FROM information_schema.VIEWS WHERE TABLE_SCHEMA NOT IN ('information_schema', 'performance_schema', 'sys', 'mysql') ORDER BY TABLE_SCHEMA, TABLE_NAME", 1142, "SELECT command denied")
+	_, err = listObjectsHandler("views", catalog.InformationSchema.Views, (*snapshot.Snapshot).ListViews)(context.Background(), request, ds)
+	assert.ErrorContains(t, err, "failed to list views: failed to load views:")
+}
+
+func TestShowDefinitionHandler(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SELECT DATABASE()", mysqltest.Result{Columns: []string{"DATABASE()"}, Rows: [][]interface{}{{"shop"}}})
+	server.Handle("SHOW CREATE TRIGGER `shop`.`orders_audit`", mysqltest.Result{
+		Columns: []string{"Trigger", "sql_mode", "SQL Original Statement", "character_set_client", "collation_connection", "Database Collation", "Created"},
+		Rows: [][]interface{}{{
+			"orders_audit", "STRICT_TRANS_TABLES", "CREATE TRIGGER orders_audit AFTER UPDATE ON orders FOR EACH ROW INSERT INTO audit VALUES (OLD.id)",
+			"utf8mb4", "utf8mb4_0900_ai_ci", "utf8mb4_0900_ai_ci", "2024-05-01 10:00:00.00",
+		}},
+	})
+	server.Handle("SHOW CREATE PROCEDURE `reporting`.`refresh`", mysqltest.Result{
+		Columns: []string{"Procedure", "sql_mode", "Create Procedure", "character_set_client", "collation_connection", "Database Collation"},
+		Rows:    [][]interface{}{{"refresh", "", nil, "utf8mb4", "utf8mb4_0900_ai_ci", "utf8mb4_0900_ai_ci"}},
+	})
+	server.HandleError("SHOW CREATE VIEW `shop`.`missing`", 1146, "Table 'shop.missing' doesn't exist")
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{"type": "trigger", "name": "orders_audit"}
+	result, err := showDefinitionHandler(context.Background(), request, ds)
+	require.NoError(t, err)
+	var definition catalog.Definition
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &definition))
+	assert.Equal(t, "shop", definition.Schema)
+	assert.Equal(t, "CREATE TRIGGER orders_audit AFTER UPDATE ON orders FOR EACH ROW INSERT INTO audit VALUES (OLD.id)", definition.SQL)
+	assert.Equal(t, "STRICT_TRANS_TABLES", definition.Attributes["sql_mode"])
+	assert.NotContains(t, definition.Attributes, "Trigger")
+
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		err       string
+	}{
+		{name: "invalid type", arguments: map[string]interface{}{"type": "index", "name": "shop.idx"}, err: `failed to show definition of shop.idx: invalid type "index", expected one of table, view, procedure, function, trigger, event`},
+		{name: "definition not visible", arguments: map[string]interface{}{"type": "procedure", "name": "reporting.refresh"}, err: "failed to show definition of reporting.refresh: the definition of procedure reporting.refresh is not visible to the current user"},
+		{name: "missing object", arguments: map[string]interface{}{"type": "view", "name": "missing"}, err: "doesn't exist"},
+		{name: "missing name", arguments: map[string]interface{}{"type": "view"}, err: "type and name are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = tt.arguments
+			_, err := showDefinitionHandler(context.Background(), request, ds)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+// Test profileTableHandler argument errors
+func TestProfileTableHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments map[string]interface{}
+		err       string
+	}{
+		{name: "missing table", arguments: map[string]interface{}{}, err: "table is required"},
+		{name: "invalid columns", arguments: map[string]interface{}{"table": "orders", "columns": []interface{}{float64(1)}}, err: "columns must be an array of column names"},
+		{name: "sample too large", arguments: map[string]interface{}{"table": "orders", "sample_size": float64(2000000)}, err: "sample_size must be between 1 and 1000000"},
+		{name: "invalid top", arguments: map[string]interface{}{"table": "orders", "top": float64(-1)}, err: "top must be between 1 and 100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDS := createMockDatastore()
+			mockDS.On("CheckConnection").Return(nil)
+
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = tt.arguments
+			_, err := profileTableHandler(context.Background(), request, mockDS)
+			assert.EqualError(t, err, tt.err)
+			mockDS.AssertNotCalled(t, "QueryContext", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestSampleRowsHandler(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SELECT TABLE_SCHEMA, COUNT(*), COALESCE(MAX(CREATE_TIME), ''), COALESCE(MAX(UPDATE_TIME), '') FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? GROUP BY TABLE_SCHEMA", mysqltest.Result{
+		Columns: []string{"TABLE_SCHEMA", "COUNT(*)", "CREATE_TIME", "UPDATE_TIME"},
+		Rows:    [][]interface{}{{"shop", 1, "2024-05-01 10:00:00", ""}},
+	})
+	server.Handle("SELECT TABLE_SCHEMA, TABLE_NAME, TABLE_TYPE, TABLE_ROWS, TABLE_COMMENT, COALESCE(CREATE_TIME, ''), COALESCE(UPDATE_TIME, ''), COALESCE(ENGINE, ''), COALESCE(TABLE_COLLATION, ''), COALESCE(ROW_FORMAT, ''), COALESCE(CREATE_OPTIONS, '') FROM information_schema.TABLES WHERE TABLE_SCHEMA IN (?)", mysqltest.Result{
+		Columns: []string{"TABLE_SCHEMA", "TABLE_NAME", "TABLE_TYPE", "TABLE_ROWS", "TABLE_COMMENT", "CREATE_TIME", "UPDATE_TIME", "ENGINE", "TABLE_COLLATION", "ROW_FORMAT", "CREATE_OPTIONS"},
+		Rows:    [][]interface{}{{"shop", "documents", "BASE TABLE", 2, "", "2024-05-01 10:00:00", "", "InnoDB", "utf8mb4_0900_ai_ci", "Dynamic", ""}},
+	})
+	server.Handle("SELECT TABLE_NAME, COLUMN_NAME, ORDINAL_POSITION, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COLUMN_DEFAULT, EXTRA, COLUMN_COMMENT FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, ORDINAL_POSITION", mysqltest.Result{
+		Columns: []string{"TABLE_NAME", "COLUMN_NAME", "ORDINAL_POSITION", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_KEY", "COLUMN_DEFAULT", "EXTRA", "COLUMN_COMMENT"},
+		Rows: [][]interface{}{
+			{"documents", "id", 1, "varchar(36)", "NO", "PRI", nil, "", ""},
+			{"documents", "body", 2, "text", "YES", "", nil, "", ""},
+			{"documents", "thumbnail", 3, "blob", "YES", "", nil, "", ""},
+		},
+	})
+	server.Handle("SELECT `id`, `body`, `thumbnail` FROM `shop`.`documents` ORDER BY `id` LIMIT 2", mysqltest.Result{
+		Columns: []string{"id", "body", "thumbnail"},
+		Rows: [][]interface{}{
+			{"a", "Grüße aus Köln", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x10"},
+			{"b", "short", nil},
+		},
+	})
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	// Tables without an integer key are sampled from their first rows
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{"table": "shop.documents", "limit": float64(2), "max_length": float64(5)}
+	result, err := sampleRowsHandler(context.Background(), request, ds)
+	require.NoError(t, err)
+	require.Len(t, result.Content, 2)
+	assert.JSONEq(t, `[
+		{"id": "a", "body": "Grüße... (14 characters)", "thumbnail": "<binary 20 bytes: 89504e470d0a1a0a0000000d49484452...>"},
+		{"id": "b", "body": "short", "thumbnail": "NULL"}
+	]`, result.Content[0].(mcp.TextContent).Text)
+	assert.Equal(t, "2 rows of shop.documents (first)", result.Content[1].(mcp.TextContent).Text)
+
+	request.Params.Arguments = map[string]interface{}{"table": "shop.documents", "strategy": "random"}
+	_, err = sampleRowsHandler(context.Background(), request, ds)
+	assert.EqualError(t, err, "failed to sample table shop.documents: random sampling of shop.documents requires a single-column integer primary key")
+
+	request.Params.Arguments = map[string]interface{}{"table": "shop.missing"}
+	_, err = sampleRowsHandler(context.Background(), request, ds)
+	assert.EqualError(t, err, "failed to sample table shop.missing: table does not exist")
+}
+
+// handleSchema answers the catalog queries of schema_diff with the given tables, columns and indexes
+func handleSchema(server *mysqltest.Server, tables, columns, indexes [][]interface{}) {
+	server.Handle("SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", mysqltest.Result{Columns: []string{"SCHEMA_NAME"}, Rows: [][]interface{}{{"shop"}}})
+	server.Handle("SELECT TABLE_SCHEMA, TABLE_NAME, TABLE_TYPE, TABLE_ROWS, TABLE_COMMENT, COALESCE(CREATE_TIME, ''), COALESCE(UPDATE_TIME, ''), COALESCE(ENGINE, ''), COALESCE(TABLE_COLLATION, ''), COALESCE(ROW_FORMAT, ''), COALESCE(CREATE_OPTIONS, '') FROM information_schema.TABLES WHERE TABLE_SCHEMA IN (?)", mysqltest.Result{
+		Columns: []string{"TABLE_SCHEMA", "TABLE_NAME", "TABLE_TYPE", "TABLE_ROWS", "TABLE_COMMENT", "CREATE_TIME", "UPDATE_TIME", "ENGINE", "TABLE_COLLATION", "ROW_FORMAT", "CREATE_OPTIONS"},
+		Rows:    tables,
+	})
+	server.Handle("SELECT TABLE_NAME, COLUMN_NAME, ORDINAL_POSITION, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COLUMN_DEFAULT, EXTRA, COLUMN_COMMENT FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, ORDINAL_POSITION", mysqltest.Result{
+		Columns: []string{"TABLE_NAME", "COLUMN_NAME", "ORDINAL_POSITION", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_KEY", "COLUMN_DEFAULT", "EXTRA", "COLUMN_COMMENT"},
+		Rows:    columns,
+	})
+	server.Handle("SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COALESCE(COLUMN_NAME, ''), SUB_PART, COALESCE(COLLATION, ''), INDEX_TYPE, INDEX_COMMENT FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, INDEX_NAME = 'PRIMARY' DESC, INDEX_NAME, SEQ_IN_INDEX", mysqltest.Result{
+		Columns: []string{"TABLE_NAME", "INDEX_NAME", "NON_UNIQUE", "COLUMN_NAME", "SUB_PART", "COLLATION", "INDEX_TYPE", "INDEX_COMMENT"},
+		Rows:    indexes,
+	})
+	server.Handle("SELECT k.TABLE_NAME, k.CONSTRAINT_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_SCHEMA, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME, r.UPDATE_RULE, r.DELETE_RULE FROM information_schema.KEY_COLUMN_USAGE k JOIN information_schema.REFERENTIAL_CONSTRAINTS r ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.TABLE_NAME = k.TABLE_NAME AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME WHERE k.TABLE_SCHEMA = ? AND k.REFERENCED_TABLE_NAME IS NOT NULL ORDER BY k.TABLE_NAME, k.CONSTRAINT_NAME, k.ORDINAL_POSITION", mysqltest.Result{
+		Columns: []string{"TABLE_NAME", "CONSTRAINT_NAME", "COLUMN_NAME", "REFERENCED_TABLE_SCHEMA", "REFERENCED_TABLE_NAME", "REFERENCED_COLUMN_NAME", "UPDATE_RULE", "DELETE_RULE"},
+	})
+}
+
+// Test schemaDiffHandler comparing the session connection with a profile
+func TestSchemaDiffHandler(t *testing.T) {
+	production := mysqltest.NewUnixServer(t)
+	handleSchema(production,
+		[][]interface{}{
+			{"shop", "orders", "BASE TABLE", 10, "", "", "", "InnoDB", "utf8mb4_0900_ai_ci", "Dynamic", ""},
+			{"shop", "customers", "BASE TABLE", 5, "", "", "", "InnoDB", "utf8mb4_0900_ai_ci", "Dynamic", ""},
+			{"shop", "open_orders", "VIEW", nil, "", "", "", "", "", "", ""},
+		},
+		[][]interface{}{
+			{"customers", "id", 1, "int", "NO", "PRI", nil, "", ""},
+			{"orders", "id", 1, "int", "NO", "PRI", nil, "", ""},
+			{"orders", "status", 2, "varchar(20)", "NO", "MUL", "new", "", ""},
+		},
+		[][]interface{}{
+			{"customers", "PRIMARY", 0, "id", nil, "A", "BTREE", ""},
+			{"orders", "PRIMARY", 0, "id", nil, "A", "BTREE", ""},
+			{"orders", "status", 1, "status", nil, "A", "BTREE", ""},
+		})
+	production.Handle("SHOW CREATE TABLE `shop`.`customers`", mysqltest.Result{
+		Columns: []string{"Table", "Create Table"},
+		Rows:    [][]interface{}{{"customers", "CREATE TABLE `customers` (\n  `id` int NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB"}},
+	})
+
+	staging := mysqltest.NewUnixServer(t)
+	handleSchema(staging,
+		[][]interface{}{{"shop", "orders", "BASE TABLE", 3, "", "", "", "InnoDB", "utf8mb4_0900_ai_ci", "Dynamic", ""}},
+		[][]interface{}{
+			{"orders", "id", 1, "int", "NO", "PRI", nil, "", ""},
+			{"orders", "status", 2, "varchar(10)", "NO", "", "new", "", ""},
+		},
+		[][]interface{}{{"orders", "PRIMARY", 0, "id", nil, "A", "BTREE", ""}})
+
+	previous := config.Default
+	config.Default = &config.Config{Profiles: map[string]config.Profile{
+		"staging": {Socket: staging.Addr, Username: "app"},
+	}}
+	defer func() { config.Default = previous }()
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: production.Addr, Username: "app"}))
+	defer ds.Close()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{"source": "shop", "target": "shop", "target_profile": "staging", "alter": true}
+	result, err := schemaDiffHandler(context.Background(), request, ds)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"source": {"schema": "shop"},
+		"target": {"profile": "staging", "schema": "shop"},
+		"identical": false,
+		"added_tables": ["customers"],
+		"removed_tables": [],
+		"changed_tables": [{
+			"name": "orders",
+			"changed_columns": [{
+				"name": "status",
+				"source": {"name": "status", "position": 2, "type": "varchar(20)", "nullable": false, "key": "MUL", "default": "new"},
+				"target": {"name": "status", "position": 2, "type": "varchar(10)", "nullable": false, "default": "new"}
+			}],
+			"added_indexes": [{"name": "status", "unique": false, "columns": [{"name": "status"}], "type": "BTREE"}]
+		}],
+		"statements": [
+			"SET FOREIGN_KEY_CHECKS = 0",
+			"ALTER TABLE `+"`shop`.`orders`"+` MODIFY COLUMN `+"`status`"+` varchar(20) NOT NULL DEFAULT 'new', ADD INDEX `+"`status` (`status`)"+`",
+			"CREATE TABLE `+"`shop`.`customers`"+` (\n  `+"`id`"+` int NOT NULL,\n  PRIMARY KEY (`+"`id`"+`)\n) ENGINE=InnoDB",
+			"SET FOREIGN_KEY_CHECKS = 1"
+		]
+	}`, result.Content[0].(mcp.TextContent).Text)
+
+	// The profile connection is closed, the session connection is kept
+	assert.NoError(t, ds.CheckConnection())
+}
+
+// Test schemaDiffHandler argument errors
+func TestSchemaDiffHandlerErrors(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SELECT DATABASE()", mysqltest.Result{Columns: []string{"DATABASE()"}, Rows: [][]interface{}{{nil}}})
+	server.Handle("SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", mysqltest.Result{Columns: []string{"SCHEMA_NAME"}})
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		arguments map[string]interface{}
+		err       string
+	}{
+		{name: "same schema", ctx: context.Background(), arguments: map[string]interface{}{"source": "shop", "target": "`shop`"}, err: "source and target are the same schema shop"},
+		{name: "no database selected", ctx: context.Background(), arguments: map[string]interface{}{"source": "shop"}, err: "target is required when no database is selected"},
+		{name: "unknown profile", ctx: context.Background(), arguments: map[string]interface{}{"source_profile": "missing"}, err: `unknown connection profile "missing"`},
+		{name: "missing schema", ctx: context.Background(), arguments: map[string]interface{}{"source": "shop", "target": "staging"}, err: "failed to load source schema shop: schema shop does not exist"},
+		{
+			name:      "write-only role",
+			ctx:       auth.WithIdentity(context.Background(), &auth.Identity{User: "alice", Role: config.Role{Statements: []string{"write"}}}),
+			arguments: map[string]interface{}{"source": "shop", "target": "staging"},
+			err:       "permission denied: user alice may not execute read statements",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = tt.arguments
+			_, err := schemaDiffHandler(tt.ctx, request, ds)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+// handleObjects answers the view, routine, trigger and event queries of a snapshot of shop
+func handleObjects(server *mysqltest.Server) {
+	server.Handle("SELECT TABLE_SCHEMA, TABLE_NAME, DEFINER, SECURITY_TYPE, CHECK_OPTION, IS_UPDATABLE, COALESCE(VIEW_DEFINITION, '') FROM information_schema.VIEWS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_SCHEMA, TABLE_NAME", mysqltest.Result{
+		Columns: []string{"TABLE_SCHEMA", "TABLE_NAME", "DEFINER", "SECURITY_TYPE", "CHECK_OPTION", "IS_UPDATABLE", "VIEW_DEFINITION"},
+		Rows:    [][]interface{}{{"shop", "open_orders", "app@%", "DEFINER", "NONE", "YES", "select `id` from `shop`.`orders`"}},
+	})
+	server.Handle("SELECT ROUTINE_SCHEMA, ROUTINE_NAME, ROUTINE_TYPE, COALESCE(DTD_IDENTIFIER, ''), DEFINER, SECURITY_TYPE, SQL_DATA_ACCESS, IS_DETERMINISTIC, ROUTINE_COMMENT, CREATED, LAST_ALTERED, COALESCE(ROUTINE_DEFINITION, '') FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = ? ORDER BY ROUTINE_SCHEMA, ROUTINE_NAME, ROUTINE_TYPE", mysqltest.Result{
+		Columns: []string{"ROUTINE_SCHEMA", "ROUTINE_NAME", "ROUTINE_TYPE", "DTD_IDENTIFIER", "DEFINER", "SECURITY_TYPE", "SQL_DATA_ACCESS", "IS_DETERMINISTIC", "ROUTINE_COMMENT", "CREATED", "LAST_ALTERED", "ROUTINE_DEFINITION"},
+	})
+	server.Handle("SELECT SPECIFIC_SCHEMA, SPECIFIC_NAME, ROUTINE_TYPE, ORDINAL_POSITION, COALESCE(PARAMETER_NAME, ''), COALESCE(PARAMETER_MODE, ''), DTD_IDENTIFIER FROM information_schema.PARAMETERS WHERE SPECIFIC_SCHEMA = ? AND ORDINAL_POSITION > 0 ORDER BY SPECIFIC_SCHEMA, SPECIFIC_NAME, ORDINAL_POSITION", mysqltest.Result{
+		Columns: []string{"SPECIFIC_SCHEMA", "SPECIFIC_NAME", "ROUTINE_TYPE", "ORDINAL_POSITION", "PARAMETER_NAME", "PARAMETER_MODE", "DTD_IDENTIFIER"},
+	})
+	server.Handle("SELECT TRIGGER_SCHEMA, TRIGGER_NAME, EVENT_OBJECT_TABLE, EVENT_MANIPULATION, ACTION_TIMING, ACTION_ORDER, DEFINER, COALESCE(CREATED, ''), COALESCE(ACTION_STATEMENT, '') FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = ? ORDER BY TRIGGER_SCHEMA, EVENT_OBJECT_TABLE, EVENT_MANIPULATION, ACTION_TIMING, ACTION_ORDER", mysqltest.Result{
+		Columns: []string{"TRIGGER_SCHEMA", "TRIGGER_NAME", "EVENT_OBJECT_TABLE", "EVENT_MANIPULATION", "ACTION_TIMING", "ACTION_ORDER", "DEFINER", "CREATED", "ACTION_STATEMENT"},
+	})
+	server.Handle("SELECT EVENT_SCHEMA, EVENT_NAME, DEFINER, EVENT_TYPE, COALESCE(EXECUTE_AT, ''), COALESCE(INTERVAL_VALUE, ''), COALESCE(INTERVAL_FIELD, ''), COALESCE(STARTS, ''), COALESCE(ENDS, ''), STATUS, ON_COMPLETION, COALESCE(LAST_EXECUTED, ''), COALESCE(EVENT_DEFINITION, '') FROM information_schema.EVENTS WHERE EVENT_SCHEMA = ? ORDER BY EVENT_SCHEMA, EVENT_NAME", mysqltest.Result{
+		Columns: []string{"EVENT_SCHEMA", "EVENT_NAME", "DEFINER", "EVENT_TYPE", "EXECUTE_AT", "INTERVAL_VALUE", "INTERVAL_FIELD", "STARTS", "ENDS", "STATUS", "ON_COMPLETION", "LAST_EXECUTED", "EVENT_DEFINITION"},
+	})
+}
+
+// Test snapshotSchemaHandler and compareToSnapshotHandler
+func TestSnapshotHandlers(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	handleSchema(server,
+		[][]interface{}{{"shop", "orders", "BASE TABLE", 10, "", "2024-05-01 10:00:00", "", "InnoDB", "utf8mb4_0900_ai_ci", "Dynamic", ""}},
+		[][]interface{}{{"orders", "id", 1, "int", "NO", "PRI", nil, "", ""}},
+		[][]interface{}{{"orders", "PRIMARY", 0, "id", nil, "A", "BTREE", ""}})
+	handleObjects(server)
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	previous := snapshot.Default
+	defer func() { snapshot.Default = previous }()
+
+	// Snapshots are saved to the snapshot directory
+	dir := t.TempDir()
+	snapshot.Default = snapshot.NewStore(dir)
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{"database": "shop", "format": "yaml"}
+	result, err := snapshotSchemaHandler(context.Background(), request, ds)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "shop.yaml")
+	assert.Equal(t, "Saved snapshot of shop with 1 tables, 1 views, 0 routines, 0 triggers and 0 events to "+path, result.Content[0].(mcp.TextContent).Text)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	saved, err := snapshot.Parse(data, snapshot.YAML)
+	require.NoError(t, err)
+	// Statistics are left out of snapshots
+	assert.Nil(t, saved.Tables[0].Rows)
+	assert.Empty(t, saved.Tables[0].CreateTime)
+
+	request.Params.Arguments = map[string]interface{}{"database": "shop", "file": "../shop.json"}
+	_, err = snapshotSchemaHandler(context.Background(), request, ds)
+	assert.EqualError(t, err, `invalid snapshot file name "../shop.json"`)
+
+	// Without a directory the snapshot is returned
+	snapshot.Default = snapshot.NewStore("")
+	request.Params.Arguments = map[string]interface{}{"database": "shop"}
+	result, err = snapshotSchemaHandler(context.Background(), request, ds)
+	require.NoError(t, err)
+	require.Len(t, result.Content, 2)
+	returned, err := snapshot.Parse([]byte(result.Content[0].(mcp.TextContent).Text), snapshot.JSON)
+	require.NoError(t, err)
+	assert.Equal(t, "orders", returned.Tables[0].Name)
+	assert.Equal(t, "Snapshot of shop with 1 tables, 1 views, 0 routines, 0 triggers and 0 events, not saved to a file without -snapshot-dir", result.Content[1].(mcp.TextContent).Text)
+
+	// A column added since the snapshot is drift
+	server.Handle("SELECT TABLE_NAME, COLUMN_NAME, ORDINAL_POSITION, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COLUMN_DEFAULT, EXTRA, COLUMN_COMMENT FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, ORDINAL_POSITION", mysqltest.Result{
+		Columns: []string{"TABLE_NAME", "COLUMN_NAME", "ORDINAL_POSITION", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_KEY", "COLUMN_DEFAULT", "EXTRA", "COLUMN_COMMENT"},
+		Rows:    [][]interface{}{{"orders", "id", 1, "int", "NO", "PRI", nil, "", ""}, {"orders", "note", 2, "text", "YES", "", nil, "", ""}},
+	})
+	request.Params.Arguments = map[string]interface{}{"database": "shop"}
+	result, err = compareToSnapshotHandler(context.Background(), request, ds)
+	require.NoError(t, err)
+	var drift snapshot.Drift
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &drift))
+	assert.False(t, drift.Identical)
+	require.Len(t, drift.Tables.ChangedTables, 1)
+	assert.Equal(t, "note", drift.Tables.ChangedTables[0].AddedColumns[0].Name)
+	assert.Empty(t, drift.Views.Changed)
+
+	request.Params.Arguments = map[string]interface{}{"database": "billing"}
+	_, err = compareToSnapshotHandler(context.Background(), request, ds)
+	assert.EqualError(t, err, "no snapshot of billing is loaded, take one with snapshot_schema or give its file")
+}
+
+// Test the schema tools answering from snapshots while disconnected
+func TestOfflineSchemaHandlers(t *testing.T) {
+	previous := snapshot.Default
+	snapshot.Default = snapshot.NewStore("")
+	defer func() { snapshot.Default = previous }()
+	snapshot.Default.Add(&snapshot.Snapshot{
+		Version: snapshot.FormatVersion,
+		Schema:  "shop",
+		TakenAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Tables: []catalog.Table{{Schema: "shop", Name: "orders", Type: "BASE TABLE", Columns: []catalog.Column{
+			{Name: "id", Position: 1, Type: "int", Key: "PRI"},
+		}}},
+		Views: []catalog.View{{Schema: "shop", Name: "open_orders", Body: "select 1"}},
+	})
+
+	ds := &datastore.MySQLDatastore{}
+	note := "Not connected, answered from the snapshot of shop taken at 2024-05-01T10:00:00Z"
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{}
+	result, err := listTablesHandler(context.Background(), request, ds)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"TABLE_SCHEMA": "shop", "TABLE_NAME": "orders", "TABLE_ROWS": "NULL", "TABLE_COMMENT": ""},
+		{"TABLE_SCHEMA": "shop", "TABLE_NAME": "open_orders", "TABLE_ROWS": "NULL", "TABLE_COMMENT": ""}
+	]`, result.Content[0].(mcp.TextContent).Text)
+	assert.Equal(t, note, result.Content[1].(mcp.TextContent).Text)
+
+	for _, table := range []string{"orders", "shop.orders"} {
+		request.Params.Arguments = map[string]interface{}{"table": table}
+		result, err = describeTableHandler(context.Background(), request, ds)
+		require.NoError(t, err, table)
+		assert.Contains(t, result.Content[0].(mcp.TextContent).Text, `"Field": "id"`)
+		assert.Equal(t, note, result.Content[1].(mcp.TextContent).Text)
+	}
+	request.Params.Arguments = map[string]interface{}{"table": "shop.customers"}
+	_, err = describeTableHandler(context.Background(), request, ds)
+	assert.EqualError(t, err, "failed to describe table shop.customers: table does not exist in the snapshot of shop")
+
+	request.Params.Arguments = map[string]interface{}{"database": "shop"}
+	result, err = listObjectsHandler("views", catalog.InformationSchema.Views, (*snapshot.Snapshot).ListViews)(context.Background(), request, ds)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"schema": "shop", "name": "open_orders", "definer": "", "security_type": "", "check_option": "", "updatable": false}]`, result.Content[0].(mcp.TextContent).Text)
+
+	// Schemas without a snapshot report the connection error
+	request.Params.Arguments = map[string]interface{}{"database": "billing"}
+	_, err = listTablesHandler(context.Background(), request, ds)
+	assert.Equal(t, ds.CheckConnection(), err)
+
+	// Callers only see the snapshots of the profiles they may use
+	snapshot.Default.Add(&snapshot.Snapshot{
+		Version: snapshot.FormatVersion,
+		Schema:  "shop",
+		Profile: "replica",
+		TakenAt: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+		Tables:  []catalog.Table{{Schema: "shop", Name: "refunds", Type: "BASE TABLE"}},
+	})
+	restricted := auth.WithIdentity(context.Background(), &auth.Identity{User: "alice", Role: config.Role{Profiles: []string{"replica"}}})
+	request.Params.Arguments = map[string]interface{}{"database": "shop"}
+	result, err = listTablesHandler(restricted, request, ds)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"TABLE_SCHEMA": "shop", "TABLE_NAME": "refunds", "TABLE_ROWS": "NULL", "TABLE_COMMENT": ""}]`, result.Content[0].(mcp.TextContent).Text)
+	assert.Equal(t, "Not connected, answered from the snapshot of shop of profile replica taken at 2024-05-02T10:00:00Z", result.Content[1].(mcp.TextContent).Text)
+
+	request.Params.Arguments = map[string]interface{}{"table": "shop.orders"}
+	_, err = describeTableHandler(restricted, request, ds)
+	assert.EqualError(t, err, "failed to describe table shop.orders: table does not exist in the snapshot of shop")
+	_, err = describeTableHandler(context.Background(), request, ds)
+	assert.EqualError(t, err, "failed to describe table shop.orders: not connected and snapshots of several profiles are loaded, connect to choose one")
+
+	restricted = auth.WithIdentity(context.Background(), &auth.Identity{User: "bob", Role: config.Role{Profiles: []string{"staging"}}})
+	_, err = describeTableHandler(restricted, request, ds)
+	assert.Equal(t, ds.CheckConnection(), err)
+}
+
+// Test that cached results are only served to connections with the same
+// profile and result options
+func TestQueryHandlerCacheScope(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SELECT id FROM users", mysqltest.Result{Columns: []string{"id"}, Rows: [][]interface{}{{1}}})
+
+	previous := cache.Default
+	cache.Default = cache.New(time.Minute, 10, 0)
+	defer func() { cache.Default = previous }()
+
+	connect := func(options datastore.Options) *datastore.MySQLDatastore {
+		ds := &datastore.MySQLDatastore{}
+		require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app", Options: options}))
+		t.Cleanup(func() { ds.Close() })
+		return ds
+	}
+	utc := connect(datastore.Options{})
+	parseTime := true
+	tokyo := connect(datastore.Options{TimeZone: "Asia/Tokyo", ParseTime: &parseTime})
+	require.Equal(t, utc.Identity(), tokyo.Identity())
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{"sql": "SELECT id FROM users"}
+	cached := func(ds datastore.DatastoreInterface) bool {
+		result, err := queryHandler(context.Background(), request, ds)
+		require.NoError(t, err)
+		return len(result.Content) == 2
+	}
+
+	assert.False(t, cached(utc))
+	assert.True(t, cached(utc))
+	// Other driver settings return other values
+	assert.False(t, cached(tokyo))
+
+	// The same connection of another profile has entries of its own
+	s := session.Default.FromContext(context.Background())
+	s.SetProfile("staging")
+	defer s.SetProfile("")
+	assert.False(t, cached(utc))
+	assert.True(t, cached(utc))
+}
+
+// Test that clearCacheHandler only removes the results of the connection of the caller
+func TestClearCacheHandler(t *testing.T) {
+	previous := cache.Default
+	cache.Default = cache.New(time.Minute, 10, 0)
+	defer func() { cache.Default = previous }()
+
+	cache.Default.Put("shop", "app@tcp(db:3306)/shop", cache.Entry{Result: "[]"})
+	cache.Default.Put("payroll", "hr@tcp(db:3306)/payroll", cache.Entry{Result: "[]"})
+
+	mockDS := createMockDatastore()
+	mockDS.On("CheckConnection").Return(nil)
+	mockDS.On("Identity").Return("app@tcp(db:3306)/shop")
+
+	result, err := clearCacheHandler(context.Background(), mcp.CallToolRequest{}, mockDS)
+	require.NoError(t, err)
+	assert.Equal(t, "Removed 1 cached result(s)", result.Content[0].(mcp.TextContent).Text)
+	mockDS.AssertExpectations(t)
+
+	_, ok := cache.Default.Get("payroll")
+	assert.True(t, ok)
+}
+
+// Test dumpHandler returning a dump inline and writing it to the dump directory
+func TestDumpHandler(t *testing.T) {
+	server := mysqltest.NewUnixServer(t)
+	handleSchema(server,
+		[][]interface{}{{"shop", "orders", "BASE TABLE", 2, "", "", "", "InnoDB", "utf8mb4_0900_ai_ci", "Dynamic", ""}},
+		[][]interface{}{{"orders", "id", 1, "int", "NO", "PRI", nil, "", ""}, {"orders", "status", 2, "varchar(20)", "NO", "", "new", "", ""}},
+		nil)
+	for _, stmt := range []string{
+		"SET SESSION TIME_ZONE = '+00:00'",
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+		"USE `shop`",
+		"ROLLBACK",
+	} {
+		server.Handle(stmt, mysqltest.Result{})
+	}
+	server.Handle("SELECT DATABASE()", mysqltest.Result{Columns: []string{"DATABASE()"}, Rows: [][]interface{}{{nil}}})
+	server.Handle("SELECT VERSION(), @@character_set_results", mysqltest.Result{Columns: []string{"VERSION()", "@@character_set_results"}, Rows: [][]interface{}{{"8.0.36", "utf8mb4"}}})
+	server.Handle("SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", mysqltest.Result{
+		Columns: []string{"DEFAULT_CHARACTER_SET_NAME", "DEFAULT_COLLATION_NAME"},
+		Rows:    [][]interface{}{{"utf8mb4", "utf8mb4_0900_ai_ci"}},
+	})
+	server.Handle("SHOW CREATE TABLE `orders`", mysqltest.Result{
+		Columns: []string{"Table", "Create Table"},
+		Rows:    [][]interface{}{{"orders", "CREATE TABLE `orders` (\n  `id` int NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB"}},
+	})
+	server.Handle("SELECT `id`, `status` FROM `shop`.`orders` WHERE (status = 'new') ORDER BY `id`", mysqltest.Result{
+		Columns: []string{"id", "status"},
+		Rows:    [][]interface{}{{1, "new"}, {4, "new"}},
+	})
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	previous := dump.Dir
+	defer func() { dump.Dir = previous }()
+
+	// Without a dump directory the dump is returned with its summary
+	dump.Dir = ""
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{"tables": []interface{}{"shop.orders"}, "where": map[string]interface{}{"orders": "status = 'new'"}}
+	result, err := dumpHandler(context.Background(), request, ds)
+	require.NoError(t, err)
+	require.Len(t, result.Content, 2)
+	out := result.Content[0].(mcp.TextContent).Text
+	assert.Contains(t, out, "INSERT INTO `orders` VALUES (1,'new'),(4,'new');\n")
+	assert.JSONEq(t, fmt.Sprintf(`{"bytes": %d, "tables": [{"schema": "shop", "name": "orders", "rows": 2, "where": "status = 'new'"}], "views": []}`, len(out)), result.Content[1].(mcp.TextContent).Text)
+
+	request.Params.Arguments = map[string]interface{}{"databases": []interface{}{"shop"}, "gzip": true}
+	_, err = dumpHandler(context.Background(), request, ds)
+	assert.EqualError(t, err, "no dump directory is configured, start the server with -dump-dir")
+
+	// With a dump directory the dump is written to a file named after the database
+	dump.Dir = t.TempDir()
+	request.Params.Arguments = map[string]interface{}{"databases": []interface{}{"shop"}, "tables": []interface{}{"orders"}, "where": map[string]interface{}{"orders": "status = 'new'"}, "gzip": true}
+	result, err = dumpHandler(context.Background(), request, ds)
+	require.NoError(t, err)
+	var written struct {
+		Path  string `json:"path"`
+		Bytes int64  `json:"bytes"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &written))
+	assert.Equal(t, filepath.Join(dump.Dir, "shop.sql.gz"), written.Path)
+	info, err := os.Stat(written.Path)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), written.Bytes)
+
+	tests := map[string]map[string]interface{}{
+		"tables can only be selected in a single database":                 {"tables": []interface{}{"shop.orders", "crm.customers"}},
+		"databases are required when no database is selected":              {"tables": []interface{}{"orders"}},
+		"invalid dump file name \"../shop.sql\"":                           {"databases": []interface{}{"shop"}, "file": "../shop.sql"},
+		"invalid filter of table shop.orders: expected a single condition": {"databases": []interface{}{"shop"}, "where": map[string]interface{}{"orders": "1; DELETE FROM orders"}},
+	}
+	for expected, arguments := range tests {
+		request.Params.Arguments = arguments
+		_, err = dumpHandler(context.Background(), request, ds)
+		assert.EqualError(t, err, expected)
+	}
+}
+
+// Test QueryHistoryHandler
+func TestQueryHistoryHandler(t *testing.T) {
+	h, err := history.New("", 10)
+	assert.NoError(t, err)
+	h.Record(history.Entry{SQL: "SELECT * FROM users", Session: session.DefaultID, Status: history.StatusOK})
+	h.Record(history.Entry{SQL: "SELECT * FROM missing", Session: session.DefaultID, Status: history.StatusError})
+	// Statements of other sessions are never listed to anonymous callers
+	h.Record(history.Entry{SQL: "SELECT * FROM secrets", Session: "other", Status: history.StatusError})
+	// Authenticated users see their statements of every session, but never those of others
+	h.Record(history.Entry{SQL: "SELECT * FROM orders", User: "alice", Session: "earlier", Status: history.StatusOK})
+	h.Record(history.Entry{SQL: "SELECT * FROM secrets", User: "bob", Session: "earlier", Status: history.StatusOK})
+
+	previous := history.Default
+	history.Default = h
+	defer func() { history.Default = previous }()
+
+	alice := auth.WithIdentity(context.Background(), &auth.Identity{User: "alice"})
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		arguments     map[string]interface{}
+		expectError   bool
+		expectedText  string
+		unexpectedSQL string
+	}{
+		{
+			name:          "filter by status",
+			arguments:     map[string]interface{}{"status": "error"},
+			expectedText:  "SELECT * FROM missing",
+			unexpectedSQL: "SELECT * FROM users",
+		},
+		{
+			name:          "search",
+			arguments:     map[string]interface{}{"search": "users"},
+			expectedText:  "SELECT * FROM users",
+			unexpectedSQL: "SELECT * FROM missing",
+		},
+		{
+			name:          "authenticated user across sessions",
+			ctx:           alice,
+			arguments:     map[string]interface{}{},
+			expectedText:  "SELECT * FROM orders",
+			unexpectedSQL: "SELECT * FROM users",
+		},
+		{
+			name:        "invalid status",
+			arguments:   map[string]interface{}{"status": "pending"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// History does not require a connection
+			mockDS := createMockDatastore()
+
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = tt.arguments
+
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			result, err := queryHistoryHandler(ctx, request, mockDS)
+
+			mockDS.AssertExpectations(t)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, result)
+			} else {
+				assert.NoError(t, err)
+				text := result.Content[0].(mcp.TextContent).Text
+				assert.Contains(t, text, tt.expectedText)
+				assert.NotContains(t, text, tt.unexpectedSQL)
+				assert.NotContains(t, text, "secrets")
+			}
+		})
+	}
+}
+
+// Test RerunQueryHandler
+func TestRerunQueryHandler(t *testing.T) {
+	h, err := history.New("", 10)
+	require.NoError(t, err)
+	h.Record(history.Entry{SQL: "SELECT * FROM secrets", Session: "other", Status: history.StatusOK})
+	h.Record(history.Entry{SQL: "SELECT * FROM secrets", User: "bob", Session: session.DefaultID, Status: history.StatusOK})
+	previous := history.Default
+	history.Default = h
+	defer func() { history.Default = previous }()
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		connected   bool
+		arguments   map[string]interface{}
+		expectError bool
+	}{
+		{
+			name:        "not connected",
+			connected:   false,
+			arguments:   map[string]interface{}{"id": float64(1)},
+			expectError: true,
+		},
+		{
+			name:        "unknown id",
+			connected:   true,
+			arguments:   map[string]interface{}{"id": float64(12345)},
+			expectError: true,
+		},
+		{
+			name:        "statement of another session",
+			connected:   true,
+			arguments:   map[string]interface{}{"id": float64(1)},
+			expectError: true,
+		},
+		{
+			name:        "statement of another user",
+			ctx:         auth.WithIdentity(context.Background(), &auth.Identity{User: "alice"}),
+			connected:   true,
+			arguments:   map[string]interface{}{"id": float64(2)},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDS := createMockDatastore()
+			if tt.connected {
+				mockDS.On("CheckConnection").Return(nil)
+			} else {
+				mockDS.On("CheckConnection").Return(errors.New("not connected"))
+			}
+
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = tt.arguments
+
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			result, err := rerunQueryHandler(ctx, request, mockDS)
+
+			mockDS.AssertExpectations(t)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, result)
+			}
+		})
+	}
+}
+
+// Test SavedQueryHandler
+func TestSavedQueryHandler(t *testing.T) {
+	q, err := savedqueries.Parse("user_by_id", "/*\nparams:\n  - name: id\n    type: integer\n    required: true\n*/\nSELECT * FROM users WHERE id = :id")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		connected   bool
+		params      map[string]interface{}
+		expectError bool
+	}{
+		{
+			name:        "not connected",
+			connected:   false,
+			params:      map[string]interface{}{"id": float64(1)},
+			expectError: true,
+		},
+		{
+			name:        "missing required parameter",
+			connected:   true,
+			params:      map[string]interface{}{},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDS := createMockDatastore()
+			if tt.connected {
+				mockDS.On("CheckConnection").Return(nil)
+			} else {
+				mockDS.On("CheckConnection").Return(errors.New("not connected"))
+			}
+
+			result, err := savedQueryHandler(context.Background(), q, tt.params, mockDS)
+
+			mockDS.AssertExpectations(t)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, result)
+			}
+		})
+	}
+}
+
+// Test useDatabaseHandler
+func TestUseDatabaseHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		database    interface{}
+		connected   bool
+		useErr      error
+		expectError bool
+	}{
+		{name: "not connected", database: "shop", expectError: true},
+		{name: "missing database", connected: true, expectError: true},
+		{name: "unknown database", database: "missing", connected: true, useErr: errors.New(`unknown database "missing"`), expectError: true},
+		{name: "quoted database", database: "`shop`", connected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDS := createMockDatastore()
+			if tt.connected {
+				mockDS.On("CheckConnection").Return(nil)
+			} else {
+				mockDS.On("CheckConnection").Return(errors.New("not connected"))
+			}
+			if tt.connected && tt.database != nil {
+				mockDS.On("UseDatabase", mock.Anything, strings.Trim(tt.database.(string), "`")).Return(tt.useErr)
+			}
+			if tt.connected && !tt.expectError {
+				mockDS.On("Identity").Return("app@tcp(db:3306)/shop")
+			}
+
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = map[string]interface{}{}
+			if tt.database != nil {
+				request.Params.Arguments["database"] = tt.database
+			}
+
+			result, err := useDatabaseHandler(context.Background(), request, mockDS)
+			mockDS.AssertExpectations(t)
+			if tt.expectError {
+				assert.Error(t, err)
+				assert.Nil(t, result)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "Now using database shop (app@tcp(db:3306)/shop)", result.Content[0].(mcp.TextContent).Text)
+		})
+	}
+}
+
+// Test disconnectHandler
+func TestDisconnectHandler(t *testing.T) {
+	mockDS := createMockDatastore()
+	mockDS.On("Identity").Return("app@tcp(db:3306)/shop").Once()
+	mockDS.On("Close").Return(nil)
+
+	result, err := disconnectHandler(context.Background(), mcp.CallToolRequest{}, mockDS)
+	assert.NoError(t, err)
+	assert.Equal(t, "Disconnected from app@tcp(db:3306)/shop", result.Content[0].(mcp.TextContent).Text)
+	mockDS.AssertExpectations(t)
+
+	// Disconnecting twice is not an error
+	mockDS.On("Identity").Return("")
+	result, err = disconnectHandler(context.Background(), mcp.CallToolRequest{}, mockDS)
+	assert.NoError(t, err)
+	assert.Equal(t, "Not connected to a database", result.Content[0].(mcp.TextContent).Text)
+	mockDS.AssertNumberOfCalls(t, "Close", 1)
+}
+
+// Test connectionInfoHandler
+func TestConnectionInfoHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		connected   bool
+		expectError bool
+	}{
+		{name: "not connected", connected: false, expectError: true},
+		{name: "connected", connected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDS := createMockDatastore()
+			if tt.connected {
+				mockDS.On("CheckConnection").Return(nil)
+				mockDS.On("Info", mock.Anything).Return(datastore.ConnectionInfo{
+					Host: "db", Port: "3306", User: "app", Database: "shop", ServerVersion: "8.0.36",
+					TLSCipher: "TLS_AES_256_GCM_SHA384", TLS: true, State: datastore.StateConnected,
+				}, nil)
+			} else {
+				mockDS.On("CheckConnection").Return(errors.New("not connected"))
+			}
+
+			result, err := connectionInfoHandler(context.Background(), mcp.CallToolRequest{}, mockDS)
+			mockDS.AssertExpectations(t)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			var info map[string]interface{}
+			assert.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &info))
+			assert.Equal(t, "shop", info["database"])
+			assert.Equal(t, "8.0.36", info["server_version"])
+			assert.Equal(t, true, info["tls"])
+			assert.Equal(t, "connected", info["state"])
+		})
+	}
+}
+
+// Test ConnectionStatusHandler
+func TestConnectionStatusHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		health   datastore.Health
+		identity string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "disconnected",
+			health:   datastore.Health{State: datastore.StateDisconnected},
+			expected: map[string]interface{}{"state": "disconnected"},
+		},
+		{
+			name:     "reconnecting",
+			health:   datastore.Health{State: datastore.StateReconnecting, LastError: "connection refused", Attempts: 2},
+			identity: "app@tcp(db:3306)/shop",
+			expected: map[string]interface{}{"state": "reconnecting", "connection": "app@tcp(db:3306)/shop", "last_error": "connection refused", "reconnect_attempts": float64(2)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDS := createMockDatastore()
+			mockDS.health = tt.health
+			mockDS.On("Identity").Return(tt.identity)
+
+			result, err := connectionStatusHandler(context.Background(), mcp.CallToolRequest{}, mockDS)
+			assert.NoError(t, err)
+
+			var status map[string]interface{}
+			assert.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &status))
+			assert.Equal(t, tt.expected, status)
+		})
+	}
+}
+
+// testSession is a client session with a fixed ID
+type testSession string
+
+func (s testSession) SessionID() string {
+	return string(s)
+}
+
+func (s testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return make(chan mcp.JSONRPCNotification, 1)
+}
+
+// Test sessionDatastore
+func TestSessionDatastore(t *testing.T) {
+	srv := server.NewMCPServer("test", "1.0.0")
+	ctxA := srv.WithContext(context.Background(), testSession("a"))
+	ctxB := srv.WithContext(context.Background(), testSession("b"))
+
+	// Each session gets its own datastore
+	assert.Same(t, sessionDatastore(ctxA), sessionDatastore(ctxA))
+	assert.NotSame(t, sessionDatastore(ctxA), sessionDatastore(ctxB))
+
+	// Requests without a session use the default session
+	assert.Same(t, session.Default.Get(session.DefaultID).Datastore, sessionDatastore(context.Background()))
+}
+
 // Test withDatastoreInstance
 func TestWithDatastoreInstance(t *testing.T) {
 	// Create mock datastore
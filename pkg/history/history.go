@@ -0,0 +1,245 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status describes the outcome of an executed statement
+type Status string
+
+const (
+	StatusOK    Status = "ok"
+	StatusError Status = "error"
+)
+
+// DefaultLimit is the number of entries kept when no limit is configured
+const DefaultLimit = 1000
+
+// Entry is a single executed statement
+type Entry struct {
+	ID         int           `json:"id"`
+	SQL        string        `json:"sql"`
+	Args       []interface{} `json:"args,omitempty"`
+	User       string        `json:"user,omitempty"`
+	Session    string        `json:"session,omitempty"`
+	StartedAt  time.Time     `json:"started_at"`
+	DurationMs int64         `json:"duration_ms"`
+	RowCount   int           `json:"row_count"`
+	Status     Status        `json:"status"`
+	Error      string        `json:"error,omitempty"`
+	Cached     bool          `json:"cached,omitempty"`
+}
+
+// Filter narrows down the entries returned by Search
+type Filter struct {
+	// Text is matched case-insensitively against the SQL of each entry
+	Text string
+	// Status restricts the result to entries with the given status, empty matches all
+	Status Status
+	// User restricts the result to entries executed by the given user, empty matches all
+	User string
+	// Session restricts the result to entries executed in the given client
+	// session, empty matches all
+	Session string
+	// Limit caps the number of returned entries, zero returns all
+	Limit int
+}
+
+// History keeps executed statements in memory and optionally persists them to a
+// JSON file. The file is written in the background, so that statements never
+// wait on the disk; Close writes the last entries.
+type History struct {
+	mu      sync.Mutex
+	entries []Entry
+	nextID  int
+	limit   int
+	path    string
+	closed  bool
+	// changed wakes up the writer of the file, done is closed once it has stopped
+	changed chan struct{}
+	done    chan struct{}
+}
+
+// New creates a history holding at most limit entries. If path is not empty,
+// entries are loaded from and saved to that file.
+func New(path string, limit int) (*History, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	h := &History{
+		nextID: 1,
+		limit:  limit,
+		path:   path,
+	}
+
+	if path == "" {
+		return h, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(data, &h.entries); err != nil {
+			return nil, fmt.Errorf("failed to parse history file: %w", err)
+		}
+	}
+
+	for _, e := range h.entries {
+		if e.ID >= h.nextID {
+			h.nextID = e.ID + 1
+		}
+	}
+	h.trim()
+
+	h.changed = make(chan struct{}, 1)
+	h.done = make(chan struct{})
+	go h.writeChanges()
+
+	return h, nil
+}
+
+// Record assigns an ID to the entry and appends it to the history
+func (h *History) Record(e Entry) Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e.ID = h.nextID
+	h.nextID++
+	h.entries = append(h.entries, e)
+	h.trim()
+
+	if h.changed != nil && !h.closed {
+		// A pending write saves this entry too
+		select {
+		case h.changed <- struct{}{}:
+		default:
+		}
+	}
+	return e
+}
+
+// Close stops writing the file in the background and writes the latest entries
+func (h *History) Close() error {
+	h.mu.Lock()
+	if h.changed == nil || h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.changed)
+	h.mu.Unlock()
+
+	<-h.done
+	return h.save()
+}
+
+// writeChanges saves the file after changes until the history is closed.
+// Failures are reported but do not stop later writes.
+func (h *History) writeChanges() {
+	defer close(h.done)
+	for range h.changed {
+		if err := h.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save query history: %v\n", err)
+		}
+	}
+}
+
+// Get returns the entry with the given ID
+func (h *History) Get(id int) (Entry, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, e := range h.entries {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Search returns matching entries, most recent first
+func (h *History) Search(f Filter) []Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	text := strings.ToLower(f.Text)
+	results := []Entry{}
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		e := h.entries[i]
+		if f.Status != "" && e.Status != f.Status {
+			continue
+		}
+		if f.User != "" && e.User != f.User {
+			continue
+		}
+		if f.Session != "" && e.Session != f.Session {
+			continue
+		}
+		if text != "" && !strings.Contains(strings.ToLower(e.SQL), text) {
+			continue
+		}
+		results = append(results, e)
+		if f.Limit > 0 && len(results) >= f.Limit {
+			break
+		}
+	}
+	return results
+}
+
+func (h *History) trim() {
+	if len(h.entries) > h.limit {
+		h.entries = h.entries[len(h.entries)-h.limit:]
+	}
+}
+
+// save writes the entries to the file, only holding the lock to copy them
+func (h *History) save() error {
+	if h.path == "" {
+		return nil
+	}
+
+	h.mu.Lock()
+	data, err := json.MarshalIndent(h.entries, "", "  ")
+	h.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated history
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), ".history-*")
+	if err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return nil
+}
+
+// Global history of the current session
+var Default *History
+
+func init() {
+	Default, _ = New("", DefaultLimit)
+}
@@ -0,0 +1,76 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndSearch(t *testing.T) {
+	h, err := New("", 10)
+	require.NoError(t, err)
+
+	h.Record(Entry{SQL: "SELECT * FROM users", Status: StatusOK, RowCount: 3})
+	h.Record(Entry{SQL: "SELECT * FROM missing", Session: "a", Status: StatusError, Error: "table doesn't exist"})
+	h.Record(Entry{SQL: "select count(*) from USERS", Status: StatusOK, RowCount: 1})
+
+	tests := []struct {
+		name        string
+		filter      Filter
+		expectedIDs []int
+	}{
+		{name: "all entries newest first", filter: Filter{}, expectedIDs: []int{3, 2, 1}},
+		{name: "case-insensitive search", filter: Filter{Text: "users"}, expectedIDs: []int{3, 1}},
+		{name: "status filter", filter: Filter{Status: StatusError}, expectedIDs: []int{2}},
+		{name: "limit", filter: Filter{Limit: 1}, expectedIDs: []int{3}},
+		{name: "session filter", filter: Filter{Session: "a"}, expectedIDs: []int{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []int{}
+			for _, e := range h.Search(tt.filter) {
+				ids = append(ids, e.ID)
+			}
+			assert.Equal(t, tt.expectedIDs, ids)
+		})
+	}
+}
+
+func TestLimitTrimsOldestEntries(t *testing.T) {
+	h, err := New("", 2)
+	require.NoError(t, err)
+
+	h.Record(Entry{SQL: "SELECT 1"})
+	h.Record(Entry{SQL: "SELECT 2"})
+	h.Record(Entry{SQL: "SELECT 3"})
+
+	_, ok := h.Get(1)
+	assert.False(t, ok)
+
+	e, ok := h.Get(3)
+	assert.True(t, ok)
+	assert.Equal(t, "SELECT 3", e.SQL)
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+
+	h, err := New(path, 10)
+	require.NoError(t, err)
+	h.Record(Entry{SQL: "SELECT 1", Status: StatusOK})
+	h.Record(Entry{SQL: "SELECT 2", Status: StatusOK})
+	// Close writes the entries not yet saved in the background
+	require.NoError(t, h.Close())
+
+	// Reload from disk and keep numbering where the previous run stopped
+	reloaded, err := New(path, 10)
+	require.NoError(t, err)
+	assert.Len(t, reloaded.Search(Filter{}), 2)
+
+	e := reloaded.Record(Entry{SQL: "SELECT 3"})
+	assert.Equal(t, 3, e.ID)
+	require.NoError(t, reloaded.Close())
+}
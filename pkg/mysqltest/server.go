@@ -0,0 +1,565 @@
+// Package mysqltest provides a MySQL protocol stand-in for tests. It accepts any
+// credentials and answers queries with canned results.
+package mysqltest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Protocol constants used by the stand-in
+const (
+	comQuit        = 0x01
+	comInitDB      = 0x02
+	comQuery       = 0x03
+	comPing        = 0x0e
+	comStmtPrepare = 0x16
+	comStmtExecute = 0x17
+	comStmtClose   = 0x19
+	comStmtReset   = 0x1a
+
+	statusAutocommit  = 0x0002
+	statusMoreResults = 0x0008
+
+	// CLIENT_LONG_PASSWORD | CLIENT_CONNECT_WITH_DB | CLIENT_PROTOCOL_41 | CLIENT_TRANSACTIONS | CLIENT_SECURE_CONNECTION
+	capabilitiesLower = 0x0001 | 0x0008 | 0x0200 | 0x2000 | 0x8000
+	// CLIENT_PLUGIN_AUTH
+	capabilitiesUpper = 0x0008
+
+	typeVarString  = 0xfd
+	charsetUTF8MB4 = 45
+)
+
+// Result is the answer to a query. Queries without columns get an OK packet.
+// Row values are sent as strings; nil is NULL.
+type Result struct {
+	Columns      []string
+	Rows         [][]interface{}
+	AffectedRows uint64
+	InsertID     uint64
+}
+
+// Error is a MySQL error returned for a query
+type Error struct {
+	Code    uint16
+	Message string
+}
+
+// Execution is a query received by the stand-in with the arguments of a
+// prepared statement, formatted with fmt.Sprint; nil is NULL
+type Execution struct {
+	Query string
+	Args  []interface{}
+}
+
+// Server is a MySQL stand-in listening on a Unix socket or a TCP address. Both
+// text queries and prepared statements are answered.
+type Server struct {
+	Network string
+	Addr    string
+
+	listener net.Listener
+
+	mu          sync.Mutex
+	results     map[string][]Result
+	errors      map[string]Error
+	executions  []Execution
+	databases   []string
+	conns       map[net.Conn]struct{}
+	connections int
+	wg          sync.WaitGroup
+}
+
+// NewUnixServer starts a stand-in on a Unix socket of a temporary directory
+func NewUnixServer(t testing.TB) *Server {
+	t.Helper()
+	// Socket paths are limited to about 100 bytes, shorter than some test temp dirs
+	dir, err := os.MkdirTemp("", "mysqltest")
+	if err != nil {
+		t.Fatalf("mysqltest: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return NewServer(t, "unix", filepath.Join(dir, "mysql.sock"))
+}
+
+// NewTCPServer starts a stand-in on a loopback TCP port
+func NewTCPServer(t testing.TB) *Server {
+	t.Helper()
+	return NewServer(t, "tcp", "127.0.0.1:0")
+}
+
+// NewServer starts a stand-in listening on addr. It is closed when the test ends.
+func NewServer(t testing.TB, network, addr string) *Server {
+	t.Helper()
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatalf("mysqltest: %v", err)
+	}
+
+	s := &Server{
+		Network:  network,
+		Addr:     listener.Addr().String(),
+		listener: listener,
+		results:  map[string][]Result{},
+		errors:   map[string]Error{},
+		conns:    map[net.Conn]struct{}{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Handle answers query with result. For prepared statements, query is the
+// statement with its ? placeholders.
+func (s *Server) Handle(query string, result Result) {
+	s.HandleResults(query, result)
+}
+
+// HandleResults answers query with several result sets, as a stored procedure does
+func (s *Server) HandleResults(query string, results ...Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[query] = results
+}
+
+// HandleError answers query with a MySQL error
+func (s *Server) HandleError(query string, code uint16, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[query] = Error{Code: code, Message: message}
+}
+
+// Queries returns the queries received so far
+func (s *Server) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queries := make([]string, len(s.executions))
+	for i, e := range s.executions {
+		queries[i] = e.Query
+	}
+	return queries
+}
+
+// Executions returns the queries received so far with their arguments
+func (s *Server) Executions() []Execution {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Execution(nil), s.executions...)
+}
+
+// Databases returns the schemas selected with COM_INIT_DB or at connection time
+func (s *Server) Databases() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.databases...)
+}
+
+// Connections returns the number of connections accepted so far
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+// DropConnections closes the open connections, as a server restart would
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Close stops the stand-in and closes its connections
+func (s *Server) Close() {
+	s.listener.Close()
+	s.DropConnections()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.connections++
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle runs the connection phase and then answers commands until the client quits
+func (s *Server) handle(conn net.Conn) {
+	c := &packetConn{r: bufio.NewReader(conn), w: conn}
+
+	if err := c.write(0, handshakePacket()); err != nil {
+		return
+	}
+	response, err := c.read()
+	if err != nil {
+		return
+	}
+	if db := handshakeDatabase(response); db != "" {
+		s.mu.Lock()
+		s.databases = append(s.databases, db)
+		s.mu.Unlock()
+	}
+	if err := c.write(2, okPacket(0, 0, statusAutocommit)); err != nil {
+		return
+	}
+
+	// Prepared statements of the connection by ID
+	stmts := map[uint32]string{}
+
+	for {
+		packet, err := c.read()
+		if err != nil || len(packet) == 0 {
+			return
+		}
+
+		switch packet[0] {
+		case comQuit:
+			return
+		case comPing, comStmtReset:
+			err = c.write(1, okPacket(0, 0, statusAutocommit))
+		case comInitDB:
+			s.mu.Lock()
+			s.databases = append(s.databases, string(packet[1:]))
+			s.mu.Unlock()
+			err = c.write(1, okPacket(0, 0, statusAutocommit))
+		case comQuery:
+			err = s.query(c, Execution{Query: strings.TrimSpace(string(packet[1:]))}, false)
+		case comStmtPrepare:
+			id := uint32(len(stmts) + 1)
+			stmts[id] = strings.TrimSpace(string(packet[1:]))
+			err = writePrepareOK(c, id, strings.Count(stmts[id], "?"))
+		case comStmtExecute:
+			var e Execution
+			e, err = parseExecute(packet, stmts)
+			if err != nil {
+				err = c.write(1, errPacket(Error{Code: 1210, Message: err.Error()}))
+				break
+			}
+			err = s.query(c, e, true)
+		case comStmtClose:
+			// No response
+		default:
+			err = c.write(1, errPacket(Error{Code: 1047, Message: "unknown command"}))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// query answers a COM_QUERY, or a COM_STMT_EXECUTE with binary rows
+func (s *Server) query(c *packetConn, e Execution, binary bool) error {
+	s.mu.Lock()
+	s.executions = append(s.executions, e)
+	results, ok := s.results[e.Query]
+	queryErr, failed := s.errors[e.Query]
+	s.mu.Unlock()
+
+	if failed {
+		return c.write(1, errPacket(queryErr))
+	}
+	if !ok {
+		return c.write(1, errPacket(Error{Code: 1064, Message: fmt.Sprintf("mysqltest: no result for %q", e.Query)}))
+	}
+
+	var packets [][]byte
+	for i, result := range results {
+		status := uint16(statusAutocommit)
+		if i < len(results)-1 {
+			status |= statusMoreResults
+		}
+
+		if len(result.Columns) == 0 {
+			packets = append(packets, okPacket(result.AffectedRows, result.InsertID, status))
+			continue
+		}
+
+		packets = append(packets, lengthEncodedInt(nil, uint64(len(result.Columns))))
+		for _, name := range result.Columns {
+			packets = append(packets, columnPacket(name))
+		}
+		packets = append(packets, eofPacket(statusAutocommit))
+		for _, row := range result.Rows {
+			if binary {
+				packets = append(packets, binaryRowPacket(row))
+			} else {
+				packets = append(packets, rowPacket(row))
+			}
+		}
+		packets = append(packets, eofPacket(status))
+	}
+
+	return writeAll(c, 1, packets)
+}
+
+// writePrepareOK answers a COM_STMT_PREPARE. The columns are only described
+// when the statement is executed.
+func writePrepareOK(c *packetConn, id uint32, params int) error {
+	p := []byte{0x00}
+	p = binary.LittleEndian.AppendUint32(p, id)
+	p = binary.LittleEndian.AppendUint16(p, 0)
+	p = binary.LittleEndian.AppendUint16(p, uint16(params))
+	p = append(p, 0, 0, 0)
+
+	packets := [][]byte{p}
+	if params > 0 {
+		for i := 0; i < params; i++ {
+			packets = append(packets, columnPacket("?"))
+		}
+		packets = append(packets, eofPacket(statusAutocommit))
+	}
+	return writeAll(c, 1, packets)
+}
+
+// parseExecute reads the statement and the arguments of a COM_STMT_EXECUTE
+func parseExecute(p []byte, stmts map[uint32]string) (Execution, error) {
+	if len(p) < 10 {
+		return Execution{}, fmt.Errorf("malformed execute packet")
+	}
+	query, ok := stmts[binary.LittleEndian.Uint32(p[1:])]
+	if !ok {
+		return Execution{}, fmt.Errorf("unknown statement")
+	}
+	e := Execution{Query: query}
+
+	n := strings.Count(query, "?")
+	if n == 0 {
+		return e, nil
+	}
+
+	pos := 10
+	nulls := p[pos : pos+(n+7)/8]
+	pos += len(nulls)
+	if p[pos] != 1 {
+		return Execution{}, fmt.Errorf("parameter types are not bound")
+	}
+	pos++
+	types := p[pos : pos+2*n]
+	pos += 2 * n
+
+	for i := 0; i < n; i++ {
+		if nulls[i/8]&(1<<(i%8)) != 0 {
+			e.Args = append(e.Args, nil)
+			continue
+		}
+		switch t := types[2*i]; t {
+		case 0x01: // TINY
+			e.Args = append(e.Args, int64(int8(p[pos])))
+			pos++
+		case 0x08: // LONGLONG
+			e.Args = append(e.Args, int64(binary.LittleEndian.Uint64(p[pos:])))
+			pos += 8
+		case 0x05: // DOUBLE
+			e.Args = append(e.Args, math.Float64frombits(binary.LittleEndian.Uint64(p[pos:])))
+			pos += 8
+		case 0x0f, 0xfc, 0xfd, 0xfe: // VARCHAR, BLOB, VAR_STRING, STRING
+			length, size := readLengthEncodedInt(p[pos:])
+			pos += size
+			e.Args = append(e.Args, string(p[pos:pos+int(length)]))
+			pos += int(length)
+		default:
+			return Execution{}, fmt.Errorf("unsupported parameter type 0x%02x", t)
+		}
+	}
+	return e, nil
+}
+
+// writeAll writes packets with consecutive sequence numbers
+func writeAll(c *packetConn, seq byte, packets [][]byte) error {
+	for _, p := range packets {
+		if err := c.write(seq, p); err != nil {
+			return err
+		}
+		seq++
+	}
+	return nil
+}
+
+// packetConn reads and writes MySQL packets
+type packetConn struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+func (c *packetConn) read() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, length)
+	_, err := io.ReadFull(c.r, payload)
+	return payload, err
+}
+
+func (c *packetConn) write(seq byte, payload []byte) error {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), seq}
+	_, err := c.w.Write(append(header, payload...))
+	return err
+}
+
+func handshakePacket() []byte {
+	p := []byte{10}
+	p = append(p, "8.0.0-mysqltest"...)
+	p = append(p, 0)
+	p = binary.LittleEndian.AppendUint32(p, 1)
+	p = append(p, "abcdefgh"...)
+	p = append(p, 0)
+	p = binary.LittleEndian.AppendUint16(p, capabilitiesLower)
+	p = append(p, charsetUTF8MB4)
+	p = binary.LittleEndian.AppendUint16(p, 0x0002)
+	p = binary.LittleEndian.AppendUint16(p, capabilitiesUpper)
+	p = append(p, 21)
+	p = append(p, make([]byte, 10)...)
+	p = append(p, "ijklmnopqrst"...)
+	p = append(p, 0)
+	p = append(p, "mysql_native_password"...)
+	return append(p, 0)
+}
+
+// handshakeDatabase extracts the schema of a HandshakeResponse41
+func handshakeDatabase(p []byte) string {
+	if len(p) < 32 {
+		return ""
+	}
+	flags := binary.LittleEndian.Uint32(p)
+	pos := 32
+	// user
+	end := strings.IndexByte(string(p[pos:]), 0)
+	if end < 0 {
+		return ""
+	}
+	pos += end + 1
+	// auth response
+	if pos >= len(p) {
+		return ""
+	}
+	pos += 1 + int(p[pos])
+	if flags&0x0008 == 0 || pos >= len(p) {
+		return ""
+	}
+	end = strings.IndexByte(string(p[pos:]), 0)
+	if end < 0 {
+		return ""
+	}
+	return string(p[pos : pos+end])
+}
+
+func okPacket(affectedRows, insertID uint64, status uint16) []byte {
+	p := []byte{0x00}
+	p = lengthEncodedInt(p, affectedRows)
+	p = lengthEncodedInt(p, insertID)
+	p = binary.LittleEndian.AppendUint16(p, status)
+	return binary.LittleEndian.AppendUint16(p, 0)
+}
+
+func errPacket(e Error) []byte {
+	p := []byte{0xff}
+	p = binary.LittleEndian.AppendUint16(p, e.Code)
+	p = append(p, "#HY000"...)
+	return append(p, e.Message...)
+}
+
+func eofPacket(status uint16) []byte {
+	return binary.LittleEndian.AppendUint16([]byte{0xfe, 0, 0}, status)
+}
+
+func columnPacket(name string) []byte {
+	var p []byte
+	for _, s := range []string{"def", "", "", "", name, name} {
+		p = lengthEncodedString(p, s)
+	}
+	p = append(p, 0x0c)
+	p = binary.LittleEndian.AppendUint16(p, charsetUTF8MB4)
+	p = binary.LittleEndian.AppendUint32(p, 1024)
+	p = append(p, typeVarString)
+	p = binary.LittleEndian.AppendUint16(p, 0)
+	p = append(p, 0)
+	return append(p, 0, 0)
+}
+
+func rowPacket(row []interface{}) []byte {
+	var p []byte
+	for _, v := range row {
+		if v == nil {
+			p = append(p, 0xfb)
+			continue
+		}
+		p = lengthEncodedString(p, fmt.Sprint(v))
+	}
+	return p
+}
+
+// binaryRowPacket encodes a row of a prepared statement result, where every
+// column is a VAR_STRING
+func binaryRowPacket(row []interface{}) []byte {
+	nulls := make([]byte, (len(row)+7+2)/8)
+	var values []byte
+	for i, v := range row {
+		if v == nil {
+			nulls[(i+2)/8] |= 1 << ((i + 2) % 8)
+			continue
+		}
+		values = lengthEncodedString(values, fmt.Sprint(v))
+	}
+	return append(append([]byte{0x00}, nulls...), values...)
+}
+
+func readLengthEncodedInt(p []byte) (uint64, int) {
+	switch p[0] {
+	case 0xfc:
+		return uint64(binary.LittleEndian.Uint16(p[1:])), 3
+	case 0xfd:
+		return uint64(p[1]) | uint64(p[2])<<8 | uint64(p[3])<<16, 4
+	case 0xfe:
+		return binary.LittleEndian.Uint64(p[1:]), 9
+	}
+	return uint64(p[0]), 1
+}
+
+func lengthEncodedInt(p []byte, n uint64) []byte {
+	switch {
+	case n < 251:
+		return append(p, byte(n))
+	case n < 1<<16:
+		return binary.LittleEndian.AppendUint16(append(p, 0xfc), uint16(n))
+	case n < 1<<24:
+		return append(p, 0xfd, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		return binary.LittleEndian.AppendUint64(append(p, 0xfe), n)
+	}
+}
+
+func lengthEncodedString(p []byte, s string) []byte {
+	return append(lengthEncodedInt(p, uint64(len(s))), s...)
+}
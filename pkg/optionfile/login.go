@@ -0,0 +1,73 @@
+package optionfile
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Layout of the login path file: 4 unused bytes, then the key, then every line
+// as a little-endian length followed by the AES-128-ECB encrypted line
+const (
+	loginUnusedLen = 4
+	loginKeyLen    = 20
+)
+
+// LoginPathFile returns the login path file used by the mysql client
+func LoginPathFile() (string, error) {
+	if path := os.Getenv("MYSQL_TEST_LOGIN_FILE"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the login path file: %w", err)
+	}
+	return filepath.Join(home, ".mylogin.cnf"), nil
+}
+
+// Decrypt returns the plain text of a login path file
+func Decrypt(data []byte) ([]byte, error) {
+	if len(data) < loginUnusedLen+loginKeyLen {
+		return nil, fmt.Errorf("file is too short")
+	}
+
+	// The 20 byte key is folded into an AES-128 key
+	key := make([]byte, aes.BlockSize)
+	for i, b := range data[loginUnusedLen : loginUnusedLen+loginKeyLen] {
+		key[i%aes.BlockSize] ^= b
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var plain bytes.Buffer
+	rest := data[loginUnusedLen+loginKeyLen:]
+	for len(rest) > 0 {
+		if len(rest) < 4 {
+			return nil, fmt.Errorf("truncated line length")
+		}
+		n := int(binary.LittleEndian.Uint32(rest))
+		rest = rest[4:]
+		if n > len(rest) || n == 0 || n%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("invalid line length %d", n)
+		}
+
+		line := make([]byte, n)
+		for i := 0; i < n; i += aes.BlockSize {
+			block.Decrypt(line[i:i+aes.BlockSize], rest[i:i+aes.BlockSize])
+		}
+		rest = rest[n:]
+
+		// Remove the PKCS#7 padding
+		pad := int(line[n-1])
+		if pad == 0 || pad > aes.BlockSize {
+			return nil, fmt.Errorf("invalid padding")
+		}
+		plain.Write(line[:n-pad])
+	}
+	return plain.Bytes(), nil
+}
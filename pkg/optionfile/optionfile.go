@@ -0,0 +1,243 @@
+// Package optionfile reads MySQL option files such as ~/.my.cnf and the
+// obfuscated login path file ~/.mylogin.cnf written by mysql_config_editor.
+package optionfile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File holds the options of an option file by group. Option names are
+// normalized so that dashes and underscores are interchangeable.
+type File map[string]map[string]string
+
+// Get returns the value of an option in a group
+func (f File) Get(group, name string) (string, bool) {
+	value, ok := f[group][normalizeName(name)]
+	return value, ok
+}
+
+// Merge applies the options of other over those of f
+func (f File) Merge(other File) {
+	for group, options := range other {
+		if f[group] == nil {
+			f[group] = map[string]string{}
+		}
+		for name, value := range options {
+			f[group][name] = value
+		}
+	}
+}
+
+// Options returns the options of the groups, later groups overriding earlier ones
+func (f File) Options(groups ...string) map[string]string {
+	options := map[string]string{}
+	for _, group := range groups {
+		for name, value := range f[group] {
+			options[name] = value
+		}
+	}
+	return options
+}
+
+// DefaultFiles returns the option files read by the mysql client, in the order
+// they are read
+func DefaultFiles() []string {
+	files := []string{"/etc/my.cnf", "/etc/mysql/my.cnf"}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".my.cnf"))
+	}
+	if path, err := LoginPathFile(); err == nil {
+		files = append(files, path)
+	}
+	return files
+}
+
+// LoadAll reads the option files that exist, later files overriding earlier ones
+func LoadAll(paths ...string) (File, error) {
+	f := File{}
+	for _, path := range paths {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		loaded, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		f.Merge(loaded)
+	}
+	return f, nil
+}
+
+// Load reads an option file and the files it includes, decrypting it when it is
+// a login path file
+func Load(path string) (File, error) {
+	p := &parser{file: File{}, seen: map[string]bool{}}
+	if err := p.load(path); err != nil {
+		return nil, err
+	}
+	return p.file, nil
+}
+
+// Parse reads options in the format of my.cnf. Included files are relative to
+// the working directory.
+func Parse(r io.Reader) (File, error) {
+	p := &parser{file: File{}, seen: map[string]bool{}}
+	if err := p.parse(r, "."); err != nil {
+		return nil, err
+	}
+	return p.file, nil
+}
+
+// parser accumulates the options of a file and of its includes
+type parser struct {
+	file File
+	// seen guards against include cycles
+	seen map[string]bool
+}
+
+func (p *parser) load(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to read option file: %w", err)
+	}
+	if p.seen[abs] {
+		return nil
+	}
+	p.seen[abs] = true
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return fmt.Errorf("failed to read option file: %w", err)
+	}
+	if strings.HasSuffix(abs, ".mylogin.cnf") {
+		data, err = Decrypt(data)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", path, err)
+		}
+	}
+
+	if err := p.parse(bytes.NewReader(data), filepath.Dir(abs)); err != nil {
+		return fmt.Errorf("invalid option file %s: %w", path, err)
+	}
+	return nil
+}
+
+// includeDir reads the .cnf files of a directory in name order
+func (p *parser) includeDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read option directory: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".cnf" {
+			continue
+		}
+		if err := p.load(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) parse(r io.Reader, dir string) error {
+	var group string
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if directive, path, ok := strings.Cut(line, " "); ok && (directive == "!include" || directive == "!includedir") {
+			path = strings.TrimSpace(path)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			var err error
+			if directive == "!include" {
+				err = p.load(path)
+			} else {
+				err = p.includeDir(path)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated group name", n)
+			}
+			group = strings.TrimSpace(line[1:end])
+			if p.file[group] == nil {
+				p.file[group] = map[string]string{}
+			}
+			continue
+		}
+
+		if group == "" {
+			return fmt.Errorf("line %d: option outside of a group", n)
+		}
+
+		name, value, hasValue := strings.Cut(line, "=")
+		name = normalizeName(strings.TrimSpace(name))
+		if !hasValue {
+			// A bare option name such as skip-ssl
+			p.file[group][name] = ""
+			continue
+		}
+		value, err := parseValue(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		p.file[group][name] = value
+	}
+	return scanner.Err()
+}
+
+// parseValue unquotes a value. Unquoted values end at a # comment.
+func parseValue(value string) (string, error) {
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		if i := strings.IndexByte(value, '#'); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		return unescape(value), nil
+	}
+
+	quote := value[0]
+	var b strings.Builder
+	for i := 1; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && i+1 < len(value):
+			i++
+			b.WriteString(unescape(value[i-1 : i+1]))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated quoted value")
+}
+
+// escapes are the escape sequences of option values
+var escapes = strings.NewReplacer(`\b`, "\b", `\t`, "\t", `\n`, "\n", `\r`, "\r", `\\`, `\`, `\s`, " ", `\"`, `"`, `\'`, `'`)
+
+func unescape(value string) string {
+	return escapes.Replace(value)
+}
+
+func normalizeName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "-", "_")
+}
@@ -0,0 +1,157 @@
+package optionfile
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exampleFile = `
+# Defaults of every client
+[client]
+user = app
+password = "s3cr#t \"quoted\""
+host=db.internal   # primary
+skip-ssl
+
+; Options of the mysql client only
+[mysql]
+default_character_set = utf8mb4
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(exampleFile))
+	require.NoError(t, err)
+
+	tests := []struct {
+		group, name, value string
+	}{
+		{"client", "user", "app"},
+		{"client", "password", `s3cr#t "quoted"`},
+		{"client", "host", "db.internal"},
+		{"client", "skip_ssl", ""},
+		{"mysql", "default-character-set", "utf8mb4"},
+	}
+	for _, tt := range tests {
+		value, ok := f.Get(tt.group, tt.name)
+		assert.True(t, ok, tt.name)
+		assert.Equal(t, tt.value, value, tt.name)
+	}
+
+	_, ok := f.Get("mysql", "user")
+	assert.False(t, ok)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, content := range []string{
+		"user = app",
+		"[client\nuser = app",
+		"[client]\npassword = 'unterminated",
+	} {
+		_, err := Parse(strings.NewReader(content))
+		assert.Error(t, err, content)
+	}
+}
+
+// encrypt writes a login path file as mysql_config_editor does
+func encrypt(t *testing.T, plain string) []byte {
+	t.Helper()
+	key := []byte("0123456789abcdefghij")
+	rkey := make([]byte, aes.BlockSize)
+	for i, b := range key {
+		rkey[i%aes.BlockSize] ^= b
+	}
+	block, err := aes.NewCipher(rkey)
+	require.NoError(t, err)
+
+	out := bytes.NewBuffer(make([]byte, loginUnusedLen))
+	out.Write(key)
+	for _, line := range strings.SplitAfter(plain, "\n") {
+		if line == "" {
+			continue
+		}
+		pad := aes.BlockSize - len(line)%aes.BlockSize
+		padded := append([]byte(line), bytes.Repeat([]byte{byte(pad)}, pad)...)
+		for i := 0; i < len(padded); i += aes.BlockSize {
+			block.Encrypt(padded[i:i+aes.BlockSize], padded[i:i+aes.BlockSize])
+		}
+		out.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(padded))))
+		out.Write(padded)
+	}
+	return out.Bytes()
+}
+
+func TestLoadLoginPathFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".mylogin.cnf")
+	require.NoError(t, os.WriteFile(path, encrypt(t, "[client]\nuser = \"app\"\n[warehouse]\nuser = \"analyst\"\npassword = \"dw-secret\"\n"), 0o600))
+
+	f, err := Load(path)
+	require.NoError(t, err)
+	password, ok := f.Get("warehouse", "password")
+	assert.True(t, ok)
+	assert.Equal(t, "dw-secret", password)
+	user, _ := f.Get("client", "user")
+	assert.Equal(t, "app", user)
+
+	_, err = Decrypt([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestLoginPathFile(t *testing.T) {
+	t.Setenv("MYSQL_TEST_LOGIN_FILE", "/tmp/test.mylogin.cnf")
+	path, err := LoginPathFile()
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/test.mylogin.cnf", path)
+}
+
+func TestLoadIncludes(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(confDir, 0o700))
+
+	files := map[string]string{
+		"my.cnf": "[client]\nuser = app\nport = 3306\n!include extra.cnf\n!includedir conf.d\n[mysql-mcp]\ndatabase = shop\n",
+		// Includes back to the main file are ignored
+		"extra.cnf":          "!include my.cnf\n[client]\nport = 3307\n",
+		"conf.d/10-host.cnf": "[client]\nhost = db.internal\n",
+		"conf.d/20-host.cnf": "[client]\nhost = replica.internal\n",
+		"conf.d/README":      "not an option file",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	f, err := Load(filepath.Join(dir, "my.cnf"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"user": "app", "port": "3307", "host": "replica.internal", "database": "shop",
+	}, f.Options("client", "mysql-mcp"))
+
+	// A missing include is an error
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.cnf"), []byte("!include missing.cnf\n"), 0o600))
+	_, err = Load(filepath.Join(dir, "broken.cnf"))
+	assert.Error(t, err)
+}
+
+func TestLoadAll(t *testing.T) {
+	dir := t.TempDir()
+	global := filepath.Join(dir, "global.cnf")
+	user := filepath.Join(dir, "user.cnf")
+	require.NoError(t, os.WriteFile(global, []byte("[client]\nhost = db.internal\nuser = root\n"), 0o600))
+	require.NoError(t, os.WriteFile(user, []byte("[client]\nuser = app\n"), 0o600))
+
+	f, err := LoadAll(global, filepath.Join(dir, "missing.cnf"), user)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"host": "db.internal", "user": "app"}, f.Options("client"))
+
+	require.NoError(t, os.WriteFile(user, []byte("user = app\n"), 0o600))
+	_, err = LoadAll(global, user)
+	assert.Error(t, err)
+}
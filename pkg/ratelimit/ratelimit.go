@@ -0,0 +1,196 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/config"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Error is returned when a request is rejected by a limit
+type Error struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Reason, e.RetryAfter.Round(100*time.Millisecond))
+}
+
+// Bucket is a token bucket refilled at a constant rate
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates a full bucket allowing requestsPerMinute on average and
+// burst requests at once
+func NewBucket(requestsPerMinute float64, burst int, now time.Time) *Bucket {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(requestsPerMinute/60)))
+	}
+	return &Bucket{
+		rate:   requestsPerMinute / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// Take removes a token from the bucket, or returns how long to wait until one is available
+func (b *Bucket) Take(now time.Time) (bool, time.Duration) {
+	if wait := b.Wait(now); wait > 0 {
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Wait returns how long to wait until a token is available, zero when one is,
+// without removing it
+func (b *Bucket) Wait(now time.Time) time.Duration {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Limiter enforces request rates per session and per connection profile and caps
+// the number of concurrent requests per connection profile
+type Limiter struct {
+	mu             sync.Mutex
+	limits         config.Limits
+	sessionBuckets map[string]*Bucket
+	profileBuckets map[string]*Bucket
+	inFlight       map[string]int
+	now            func() time.Time
+}
+
+// Default is the limiter of the server, nil when no limits are configured
+var Default *Limiter
+
+// New creates a limiter enforcing the given limits
+func New(limits config.Limits) *Limiter {
+	return &Limiter{
+		limits:         limits,
+		sessionBuckets: map[string]*Bucket{},
+		profileBuckets: map[string]*Bucket{},
+		inFlight:       map[string]int{},
+		now:            time.Now,
+	}
+}
+
+// Acquire admits a request of a session on a connection profile. The returned
+// release function must be called once the request has finished. An empty
+// profile, for sessions without a connection, only applies the session limit;
+// an empty session ID, for connections opened by an admitted request, only
+// applies the profile limits.
+func (l *Limiter) Acquire(sessionID, profile string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	profileLimit := l.profileLimit(profile)
+	if profile == "" {
+		profileLimit = config.Limit{}
+	}
+
+	if profileLimit.MaxConcurrent > 0 && l.inFlight[profile] >= profileLimit.MaxConcurrent {
+		return nil, &Error{
+			Reason:     fmt.Sprintf("too many concurrent statements on connection %s", profile),
+			RetryAfter: time.Second,
+		}
+	}
+
+	// Both buckets are checked before taking from either, so that a call rejected
+	// by one limit does not use up the other
+	var sessionBucket, profileBucket *Bucket
+	if sessionID != "" && l.limits.Session.RequestsPerMinute > 0 {
+		b, ok := l.sessionBuckets[sessionID]
+		if !ok {
+			b = NewBucket(l.limits.Session.RequestsPerMinute, l.limits.Session.Burst, now)
+			l.sessionBuckets[sessionID] = b
+		}
+		if wait := b.Wait(now); wait > 0 {
+			return nil, &Error{Reason: "rate limit exceeded for this session", RetryAfter: wait}
+		}
+		sessionBucket = b
+	}
+
+	if profileLimit.RequestsPerMinute > 0 {
+		b, ok := l.profileBuckets[profile]
+		if !ok {
+			b = NewBucket(profileLimit.RequestsPerMinute, profileLimit.Burst, now)
+			l.profileBuckets[profile] = b
+		}
+		if wait := b.Wait(now); wait > 0 {
+			return nil, &Error{Reason: fmt.Sprintf("rate limit exceeded for connection %s", profile), RetryAfter: wait}
+		}
+		profileBucket = b
+	}
+
+	if sessionBucket != nil {
+		sessionBucket.Take(now)
+	}
+	if profileBucket != nil {
+		profileBucket.Take(now)
+	}
+
+	if profile == "" {
+		return func() {}, nil
+	}
+
+	l.inFlight[profile]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.inFlight[profile]--
+			if l.inFlight[profile] == 0 {
+				delete(l.inFlight, profile)
+			}
+		})
+	}, nil
+}
+
+// Forget drops the state of a session that has ended
+func (l *Limiter) Forget(sessionID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.sessionBuckets, sessionID)
+}
+
+// profileLimit returns the limit of a profile, falling back to the default profile limit
+func (l *Limiter) profileLimit(profile string) config.Limit {
+	if limit, ok := l.limits.Profiles[profile]; ok {
+		return limit
+	}
+	return l.limits.Profile
+}
+
+// Wrap returns a tool handler admitting each call through the limiter. key returns
+// the session ID and connection profile of the call.
+func (l *Limiter) Wrap(key func(ctx context.Context) (string, string), handler func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		sessionID, profile := key(ctx)
+		release, err := l.Acquire(sessionID, profile)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		return handler(ctx, request)
+	}
+}
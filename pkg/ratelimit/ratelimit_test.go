@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	b := NewBucket(60, 2, now)
+
+	ok, _ := b.Take(now)
+	assert.True(t, ok)
+	ok, _ = b.Take(now)
+	assert.True(t, ok)
+
+	ok, wait := b.Take(now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	// One token per second is refilled
+	ok, _ = b.Take(now.Add(time.Second))
+	assert.True(t, ok)
+}
+
+func TestSessionRateLimit(t *testing.T) {
+	l := New(config.Limits{Session: config.Limit{RequestsPerMinute: 60, Burst: 1}})
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	release, err := l.Acquire("a", "replica")
+	require.NoError(t, err)
+	release()
+
+	_, err = l.Acquire("a", "replica")
+	var limitErr *Error
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, time.Second, limitErr.RetryAfter)
+	assert.Contains(t, err.Error(), "retry after 1s")
+
+	// Other sessions have their own bucket
+	_, err = l.Acquire("b", "replica")
+	assert.NoError(t, err)
+
+	// A forgotten session starts with a full bucket
+	l.Forget("a")
+	_, err = l.Acquire("a", "replica")
+	assert.NoError(t, err)
+}
+
+func TestProfileLimits(t *testing.T) {
+	l := New(config.Limits{
+		Profile:  config.Limit{RequestsPerMinute: 60, Burst: 1},
+		Profiles: map[string]config.Limit{"replica": {MaxConcurrent: 1}},
+	})
+
+	// The default profile limit is shared by all sessions
+	_, err := l.Acquire("a", "primary")
+	require.NoError(t, err)
+	_, err = l.Acquire("b", "primary")
+	assert.Error(t, err)
+
+	// The replica overrides the default limit with a concurrency cap
+	release, err := l.Acquire("a", "replica")
+	require.NoError(t, err)
+	_, err = l.Acquire("b", "replica")
+	assert.ErrorContains(t, err, "too many concurrent statements")
+
+	release()
+	release()
+	_, err = l.Acquire("b", "replica")
+	assert.NoError(t, err)
+}
+
+func TestRejectedCallKeepsTokens(t *testing.T) {
+	l := New(config.Limits{
+		Session:  config.Limit{RequestsPerMinute: 60, Burst: 1},
+		Profiles: map[string]config.Limit{"replica": {RequestsPerMinute: 60, Burst: 1}},
+	})
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	_, err := l.Acquire("", "replica")
+	require.NoError(t, err)
+
+	// The call rejected by the profile limit leaves the session token
+	_, err = l.Acquire("a", "replica")
+	assert.ErrorContains(t, err, "rate limit exceeded for connection replica")
+	_, err = l.Acquire("a", "primary")
+	assert.NoError(t, err)
+}
+
+func TestAcquireWithoutSessionOrProfile(t *testing.T) {
+	l := New(config.Limits{
+		Session: config.Limit{RequestsPerMinute: 60, Burst: 1},
+		Profile: config.Limit{RequestsPerMinute: 60, Burst: 1},
+	})
+
+	// Sessions without a connection do not share a profile bucket
+	_, err := l.Acquire("a", "")
+	require.NoError(t, err)
+	_, err = l.Acquire("b", "")
+	assert.NoError(t, err)
+
+	// Connections opened by an admitted request only take a profile token
+	_, err = l.Acquire("", "replica")
+	require.NoError(t, err)
+	_, err = l.Acquire("", "replica")
+	assert.ErrorContains(t, err, "rate limit exceeded for connection replica")
+	_, err = l.Acquire("", "primary")
+	assert.NoError(t, err)
+}
+
+func TestWrap(t *testing.T) {
+	l := New(config.Limits{Session: config.Limit{RequestsPerMinute: 1, Burst: 1}})
+	calls := 0
+	handler := l.Wrap(func(ctx context.Context) (string, string) {
+		return "a", ""
+	}, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calls++
+		return mcp.NewToolResultText("ok"), nil
+	})
+
+	_, err := handler(context.Background(), mcp.CallToolRequest{})
+	assert.NoError(t, err)
+	_, err = handler(context.Background(), mcp.CallToolRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,233 @@
+// Package sampling builds the queries reading a few rows of a table without
+// scanning it: the first or last rows by primary key, or rows at random points
+// of the primary key range.
+package sampling
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sqlutil"
+)
+
+// Strategy chooses the rows of a sample
+type Strategy string
+
+const (
+	// First reads the rows with the lowest primary keys
+	First Strategy = "first"
+	// Last reads the rows with the highest primary keys
+	Last Strategy = "last"
+	// Random reads the rows following random points of an integer primary key range
+	Random Strategy = "random"
+)
+
+// Strategies are the sampling strategies, in the order of the tool enum
+var Strategies = []string{string(Random), string(First), string(Last)}
+
+// Defaults and limits of the sample size
+const (
+	DefaultLimit = 10
+	MaxLimit     = 1000
+)
+
+// Options select the rows and columns of a sample
+type Options struct {
+	// Strategy is the sampling strategy. When empty, random sampling is used if
+	// the table allows it and the first rows otherwise.
+	Strategy Strategy
+	// Columns are the columns to read, all columns if empty
+	Columns []string
+	// Limit is the number of rows
+	Limit int
+}
+
+// Query is the statement reading a sample
+type Query struct {
+	SQL  string
+	Args []interface{}
+	// Strategy is the strategy that was applied
+	Strategy Strategy
+}
+
+// randUint64N picks a random point of a key range, replaced by tests
+var randUint64N = rand.Uint64N
+
+// Build returns the query reading a sample of a table. Random sampling first
+// picks the primary keys of the sample.
+func Build(ctx context.Context, ds datastore.DatastoreInterface, table *catalog.Table, opts Options) (*Query, error) {
+	if opts.Limit == 0 {
+		opts.Limit = DefaultLimit
+	}
+	if opts.Limit < 1 || opts.Limit > MaxLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+	}
+
+	columns, err := selectColumns(table, opts.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	var key []string
+	for _, c := range table.Columns {
+		if c.Key == "PRI" {
+			key = append(key, sqlutil.QuoteIdentifier(c.Name))
+		}
+	}
+	randomKey := len(key) == 1 && isInteger(primaryKeyType(table))
+
+	strategy := opts.Strategy
+	switch strategy {
+	case "":
+		strategy = First
+		if randomKey {
+			strategy = Random
+		}
+	case First:
+	case Last:
+		if len(key) == 0 {
+			return nil, fmt.Errorf("last rows of %s.%s are undefined without a primary key", table.Schema, table.Name)
+		}
+	case Random:
+		if !randomKey {
+			return nil, fmt.Errorf("random sampling of %s.%s requires a single-column integer primary key", table.Schema, table.Name)
+		}
+	default:
+		return nil, fmt.Errorf("invalid strategy %q, expected one of %s", strategy, strings.Join(Strategies, ", "))
+	}
+
+	selectFrom := "SELECT " + strings.Join(columns, ", ") + " FROM " + sqlutil.QuoteQualified(table.Schema, table.Name)
+	q := &Query{Strategy: strategy}
+	switch strategy {
+	case First:
+		q.SQL = selectFrom
+		if len(key) > 0 {
+			q.SQL += " ORDER BY " + strings.Join(key, ", ")
+		}
+		q.SQL += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	case Last:
+		q.SQL = selectFrom + " ORDER BY " + strings.Join(key, " DESC, ") + fmt.Sprintf(" DESC LIMIT %d", opts.Limit)
+	case Random:
+		keys, err := randomKeys(ctx, ds, table, key[0], opts.Limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			// The table is empty
+			q.SQL = selectFrom + " LIMIT 0"
+			return q, nil
+		}
+		q.SQL = selectFrom + " WHERE " + key[0] + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ") + ") ORDER BY " + key[0]
+		q.Args = keys
+	}
+	return q, nil
+}
+
+// randomKeys picks the first key following each of n random points of the key
+// range. Both lookups use the primary key index; gaps make some points pick the
+// same key, so fewer keys may be returned.
+func randomKeys(ctx context.Context, ds datastore.DatastoreInterface, table *catalog.Table, key string, n int) ([]interface{}, error) {
+	from := " FROM " + sqlutil.QuoteQualified(table.Schema, table.Name)
+
+	rows, err := ds.QueryContext(ctx, "SELECT MIN("+key+"), MAX("+key+")"+from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the key range: %w", err)
+	}
+	var low, high sql.NullInt64
+	if rows.Next() {
+		err = rows.Scan(&low, &high)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the key range: %w", err)
+	}
+	if !low.Valid {
+		return nil, nil
+	}
+
+	span := uint64(high.Int64) - uint64(low.Int64)
+	points := make([]string, n)
+	args := make([]interface{}, n)
+	for i := range points {
+		offset := span
+		if span < math.MaxUint64 {
+			offset = randUint64N(span + 1)
+		}
+		points[i] = "(SELECT " + key + from + " WHERE " + key + " >= ? ORDER BY " + key + " LIMIT 1)"
+		args[i] = int64(uint64(low.Int64) + offset)
+	}
+
+	rows, err = ds.QueryContext(ctx, strings.Join(points, " UNION "), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pick random keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []interface{}
+	for rows.Next() {
+		var k int64
+		if err := rows.Scan(&k); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return keys, nil
+}
+
+// selectColumns returns the quoted columns of the sample, in table order
+func selectColumns(table *catalog.Table, names []string) ([]string, error) {
+	selected := map[string]bool{}
+	for _, name := range names {
+		found := false
+		for _, c := range table.Columns {
+			if strings.EqualFold(c.Name, name) {
+				selected[c.Name] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("column %s does not exist in %s.%s", name, table.Schema, table.Name)
+		}
+	}
+
+	var columns []string
+	for _, c := range table.Columns {
+		if len(names) == 0 || selected[c.Name] {
+			columns = append(columns, sqlutil.QuoteIdentifier(c.Name))
+		}
+	}
+	return columns, nil
+}
+
+// primaryKeyType returns the type of the first primary key column
+func primaryKeyType(table *catalog.Table) string {
+	for _, c := range table.Columns {
+		if c.Key == "PRI" {
+			return c.Type
+		}
+	}
+	return ""
+}
+
+// isInteger reports whether a column type such as "bigint unsigned" holds integers
+func isInteger(columnType string) bool {
+	base, _, _ := strings.Cut(strings.ToLower(columnType), "(")
+	base, _, _ = strings.Cut(base, " ")
+	switch base {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package sampling
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/mysqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var orders = &catalog.Table{Schema: "shop", Name: "orders", Columns: []catalog.Column{
+	{Name: "id", Type: "bigint unsigned", Key: "PRI"},
+	{Name: "status", Type: "varchar(20)"},
+	{Name: "payload", Type: "blob"},
+}}
+
+var lines = &catalog.Table{Schema: "shop", Name: "order_lines", Columns: []catalog.Column{
+	{Name: "order_id", Type: "bigint", Key: "PRI"},
+	{Name: "sku", Type: "varchar(20)", Key: "PRI"},
+	{Name: "quantity", Type: "int"},
+}}
+
+var events = &catalog.Table{Schema: "shop", Name: "events", Columns: []catalog.Column{
+	{Name: "payload", Type: "json"},
+}}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name     string
+		table    *catalog.Table
+		opts     Options
+		expected string
+		strategy Strategy
+		err      string
+	}{
+		{
+			name:     "first rows by composite key",
+			table:    lines,
+			opts:     Options{Columns: []string{"QUANTITY", "sku"}},
+			expected: "SELECT `sku`, `quantity` FROM `shop`.`order_lines` ORDER BY `order_id`, `sku` LIMIT 10",
+			strategy: First,
+		},
+		{
+			name:     "last rows",
+			table:    lines,
+			opts:     Options{Strategy: Last, Limit: 3},
+			expected: "SELECT `order_id`, `sku`, `quantity` FROM `shop`.`order_lines` ORDER BY `order_id` DESC, `sku` DESC LIMIT 3",
+			strategy: Last,
+		},
+		{
+			name:     "first rows without a key",
+			table:    events,
+			opts:     Options{},
+			expected: "SELECT `payload` FROM `shop`.`events` LIMIT 10",
+			strategy: First,
+		},
+		{name: "last rows without a key", table: events, opts: Options{Strategy: Last}, err: "last rows of shop.events are undefined without a primary key"},
+		{name: "random composite key", table: lines, opts: Options{Strategy: Random}, err: "random sampling of shop.order_lines requires a single-column integer primary key"},
+		{name: "invalid strategy", table: orders, opts: Options{Strategy: "middle"}, err: `invalid strategy "middle", expected one of random, first, last`},
+		{name: "limit too large", table: orders, opts: Options{Limit: MaxLimit + 1}, err: "limit must be between 1 and 1000"},
+		{name: "unknown column", table: orders, opts: Options{Columns: []string{"total"}}, err: "column total does not exist in shop.orders"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Build(context.Background(), nil, tt.table, tt.opts)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, q.SQL)
+			assert.Equal(t, tt.strategy, q.Strategy)
+			assert.Empty(t, q.Args)
+		})
+	}
+}
+
+func TestBuildRandom(t *testing.T) {
+	offsets := []uint64{0, 500, 501}
+	previous := randUint64N
+	randUint64N = func(n uint64) uint64 {
+		assert.Equal(t, uint64(1000), n)
+		offset := offsets[0]
+		offsets = offsets[1:]
+		return offset
+	}
+	defer func() { randUint64N = previous }()
+
+	server := mysqltest.NewUnixServer(t)
+	server.Handle("SELECT MIN(`id`), MAX(`id`) FROM `shop`.`orders`", mysqltest.Result{Columns: []string{"MIN(`id`)", "MAX(`id`)"}, Rows: [][]interface{}{{1, 1000}}})
+	point := "(SELECT `id` FROM `shop`.`orders` WHERE `id` >= ? ORDER BY `id` LIMIT 1)"
+	// Points 501 and 502 fall in the same gap and pick the same key
+	server.Handle(point+" UNION "+point+" UNION "+point, mysqltest.Result{Columns: []string{"id"}, Rows: [][]interface{}{{1}, {640}}})
+
+	ds := &datastore.MySQLDatastore{}
+	require.NoError(t, ds.Connect(context.Background(), datastore.ConnectParams{Socket: server.Addr, Username: "app"}))
+	defer ds.Close()
+
+	// Random sampling is the default for integer keys
+	q, err := Build(context.Background(), ds, orders, Options{Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, Random, q.Strategy)
+	assert.Equal(t, "SELECT `id`, `status`, `payload` FROM `shop`.`orders` WHERE `id` IN (?, ?) ORDER BY `id`", q.SQL)
+	assert.Equal(t, []interface{}{int64(1), int64(640)}, q.Args)
+
+	executions := server.Executions()
+	assert.Equal(t, []interface{}{int64(1), int64(501), int64(502)}, executions[len(executions)-1].Args)
+
+	// An empty table has no key range
+	server.Handle("SELECT MIN(`id`), MAX(`id`) FROM `shop`.`orders`", mysqltest.Result{Columns: []string{"MIN(`id`)", "MAX(`id`)"}, Rows: [][]interface{}{{nil, nil}}})
+	q, err = Build(context.Background(), ds, orders, Options{Strategy: Random})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT `id`, `status`, `payload` FROM `shop`.`orders` LIMIT 0", q.SQL)
+}
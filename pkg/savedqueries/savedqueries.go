@@ -0,0 +1,293 @@
+package savedqueries
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sqlutil"
+	"gopkg.in/yaml.v3"
+)
+
+// Parameter types supported in the front-matter
+const (
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Param describes a named parameter referenced as :name in the query
+type Param struct {
+	Name        string      `yaml:"name"`
+	Type        string      `yaml:"type"`
+	Description string      `yaml:"description"`
+	Required    bool        `yaml:"required"`
+	Default     interface{} `yaml:"default"`
+}
+
+// Query is a saved query loaded from a .sql file
+type Query struct {
+	Name        string  `yaml:"name"`
+	Description string  `yaml:"description"`
+	Params      []Param `yaml:"params"`
+	SQL         string  `yaml:"-"`
+	Path        string  `yaml:"-"`
+}
+
+// Library holds the saved queries of a directory by name
+type Library struct {
+	queries map[string]*Query
+}
+
+// Load reads every .sql file in dir. Each file may start with a block comment
+// holding YAML front-matter that names the query and describes its parameters.
+func Load(dir string) (*Library, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list saved queries: %w", err)
+	}
+
+	lib := &Library{queries: map[string]*Query{}}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read saved query %s: %w", path, err)
+		}
+
+		q, err := Parse(strings.TrimSuffix(filepath.Base(path), ".sql"), string(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid saved query %s: %w", path, err)
+		}
+		q.Path = path
+
+		if _, exists := lib.queries[q.Name]; exists {
+			return nil, fmt.Errorf("duplicate saved query name %q in %s", q.Name, path)
+		}
+		lib.queries[q.Name] = q
+	}
+
+	return lib, nil
+}
+
+// Parse parses the content of a saved query file, using defaultName when the
+// front-matter does not name the query
+func Parse(defaultName, content string) (*Query, error) {
+	q := &Query{}
+
+	body := strings.TrimSpace(content)
+	if strings.HasPrefix(body, "/*") {
+		end := strings.Index(body, "*/")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated front-matter comment")
+		}
+		if err := yaml.Unmarshal([]byte(body[2:end]), q); err != nil {
+			return nil, fmt.Errorf("failed to parse front-matter: %w", err)
+		}
+		body = strings.TrimSpace(body[end+2:])
+	}
+
+	if q.Name == "" {
+		q.Name = defaultName
+	}
+	if !namePattern.MatchString(q.Name) {
+		return nil, fmt.Errorf("invalid query name %q", q.Name)
+	}
+
+	q.SQL = body
+	if q.SQL == "" {
+		return nil, fmt.Errorf("query %s has no SQL", q.Name)
+	}
+
+	declared := map[string]bool{}
+	for i := range q.Params {
+		p := &q.Params[i]
+		if !namePattern.MatchString(p.Name) {
+			return nil, fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		switch p.Type {
+		case "":
+			p.Type = TypeString
+		case TypeString, TypeInteger, TypeNumber, TypeBoolean:
+		default:
+			return nil, fmt.Errorf("parameter %s has unsupported type %q", p.Name, p.Type)
+		}
+		declared[p.Name] = true
+	}
+
+	// Every placeholder must be declared so the generated tool schema is complete
+	for _, name := range placeholders(q.SQL) {
+		if !declared[name] {
+			return nil, fmt.Errorf("parameter :%s is used but not declared", name)
+		}
+	}
+
+	return q, nil
+}
+
+// Names returns the names of all queries in the library, sorted
+func (l *Library) Names() []string {
+	names := make([]string, 0, len(l.queries))
+	for name := range l.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the query with the given name
+func (l *Library) Get(name string) (*Query, bool) {
+	q, ok := l.queries[name]
+	return q, ok
+}
+
+// Bind converts the named parameters of the query into positional placeholders
+// and returns the query together with its arguments in order
+func (q *Query) Bind(values map[string]interface{}) (string, []interface{}, error) {
+	params := map[string]Param{}
+	for _, p := range q.Params {
+		params[p.Name] = p
+	}
+
+	var args []interface{}
+	var bindErr error
+	query := rewritePlaceholders(q.SQL, func(name string) {
+		if bindErr != nil {
+			return
+		}
+		p := params[name]
+		value, ok := values[name]
+		if !ok || value == nil {
+			if p.Default == nil {
+				if p.Required {
+					bindErr = fmt.Errorf("parameter %s is required", name)
+					return
+				}
+				args = append(args, nil)
+				return
+			}
+			value = p.Default
+		}
+
+		converted, err := convert(p, value)
+		if err != nil {
+			bindErr = err
+			return
+		}
+		args = append(args, converted)
+	})
+	if bindErr != nil {
+		return "", nil, bindErr
+	}
+
+	return query, args, nil
+}
+
+// maxExactInteger is the largest integer a float64 holds exactly
+const maxExactInteger = 1 << 53
+
+func convert(p Param, value interface{}) (interface{}, error) {
+	switch p.Type {
+	case TypeInteger:
+		switch v := value.(type) {
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			// JSON numbers are exact integers up to 2^53 only
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("parameter %s must be an integer", p.Name)
+			}
+			if math.Abs(v) > maxExactInteger {
+				return nil, fmt.Errorf("parameter %s is out of range, pass integers beyond 2^53 as strings", p.Name)
+			}
+			return int64(v), nil
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %s must be an integer", p.Name)
+			}
+			return i, nil
+		}
+	case TypeNumber:
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %s must be a number", p.Name)
+			}
+			return f, nil
+		}
+	case TypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("parameter %s must be a boolean", p.Name)
+			}
+			return b, nil
+		}
+	default:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		default:
+			return fmt.Sprintf("%v", v), nil
+		}
+	}
+	return nil, fmt.Errorf("parameter %s must be of type %s", p.Name, p.Type)
+}
+
+// placeholders returns the parameter names referenced in the query, in order
+func placeholders(query string) []string {
+	var names []string
+	rewritePlaceholders(query, func(name string) {
+		names = append(names, name)
+	})
+	return names
+}
+
+// rewritePlaceholders replaces every :name placeholder outside of quotes and
+// comments with ? and calls fn with each name in order
+func rewritePlaceholders(query string, fn func(name string)) string {
+	return sqlutil.ReplaceCode(query, func(code string) string {
+		var b strings.Builder
+		for i := 0; i < len(code); {
+			if code[i] == ':' && i+1 < len(code) && isNameStart(code[i+1]) && (i == 0 || code[i-1] != ':') {
+				end := i + 1
+				for end < len(code) && isNameChar(code[end]) {
+					end++
+				}
+				fn(code[i+1 : end])
+				b.WriteByte('?')
+				i = end
+				continue
+			}
+			b.WriteByte(code[i])
+			i++
+		}
+		return b.String()
+	})
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,109 @@
+package savedqueries
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dailyActiveUsers = `/*
+description: Daily active users since a given day
+params:
+  - name: since
+    type: string
+    required: true
+  - name: min_events
+    type: integer
+    default: 1
+*/
+SELECT DATE(created_at) AS day, COUNT(DISTINCT user_id) AS users
+FROM events
+WHERE created_at >= :since AND event_count >= :min_events
+GROUP BY day
+`
+
+func TestParse(t *testing.T) {
+	q, err := Parse("daily_active_users", dailyActiveUsers)
+	require.NoError(t, err)
+
+	assert.Equal(t, "daily_active_users", q.Name)
+	assert.Equal(t, "Daily active users since a given day", q.Description)
+	assert.Len(t, q.Params, 2)
+	assert.True(t, q.Params[0].Required)
+	assert.Equal(t, TypeInteger, q.Params[1].Type)
+	assert.Contains(t, q.SQL, "SELECT DATE(created_at)")
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "undeclared parameter", content: "SELECT * FROM users WHERE id = :id"},
+		{name: "unsupported type", content: "/*\nparams:\n  - name: id\n    type: uuid\n*/\nSELECT :id"},
+		{name: "unterminated front-matter", content: "/*\nname: broken\nSELECT 1"},
+		{name: "empty query", content: "/*\nname: empty\n*/\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("query", tt.content)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	q, err := Parse("daily_active_users", dailyActiveUsers)
+	require.NoError(t, err)
+
+	query, args, err := q.Bind(map[string]interface{}{"since": "2025-01-01"})
+	require.NoError(t, err)
+	assert.Contains(t, query, "created_at >= ? AND event_count >= ?")
+	assert.Equal(t, []interface{}{"2025-01-01", int64(1)}, args)
+
+	_, args, err = q.Bind(map[string]interface{}{"since": "2025-01-01", "min_events": float64(5)})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"2025-01-01", int64(5)}, args)
+
+	_, _, err = q.Bind(map[string]interface{}{})
+	assert.Error(t, err)
+
+	_, _, err = q.Bind(map[string]interface{}{"since": "2025-01-01", "min_events": 1.5})
+	assert.Error(t, err)
+
+	// Integers beyond 2^53 lost precision as JSON numbers, strings keep it
+	_, _, err = q.Bind(map[string]interface{}{"since": "2025-01-01", "min_events": float64(1 << 60)})
+	assert.EqualError(t, err, "parameter min_events is out of range, pass integers beyond 2^53 as strings")
+	_, args, err = q.Bind(map[string]interface{}{"since": "2025-01-01", "min_events": "1152921504606846977"})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"2025-01-01", int64(1152921504606846977)}, args)
+}
+
+func TestBindIgnoresQuotesAndComments(t *testing.T) {
+	q, err := Parse("query", "/*\nparams:\n  - name: id\n*/\nSELECT ':id', `:id`, @v := 1 -- :id\nFROM t WHERE id = :id /* :id */")
+	require.NoError(t, err)
+
+	query, args, err := q.Bind(map[string]interface{}{"id": "42"})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT ':id', `:id`, @v := 1 -- :id\nFROM t WHERE id = ? /* :id */", query)
+	assert.Equal(t, []interface{}{"42"}, args)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "daily_active_users.sql"), []byte(dailyActiveUsers), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "funnel.sql"), []byte("/*\nname: order_funnel\n*/\nSELECT 1"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o644))
+
+	lib, err := Load(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"daily_active_users", "order_funnel"}, lib.Names())
+
+	q, ok := lib.Get("order_funnel")
+	assert.True(t, ok)
+	assert.Equal(t, "SELECT 1", q.SQL)
+}
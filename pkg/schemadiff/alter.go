@@ -0,0 +1,290 @@
+package schemadiff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/sqlutil"
+)
+
+// Script is the migration making the target schema match the source
+type Script struct {
+	Statements []string `json:"statements"`
+	// Warnings describe the differences the statements do not cover
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Script returns the statements making the target schema match the source.
+// createTable returns the CREATE TABLE statement of a source table, which is
+// run against the target schema. Foreign key checks are disabled while the
+// statements run so that tables may be created and dropped in any order.
+func (d Diff) Script(schema string, createTable func(name string) (string, error)) (*Script, error) {
+	s := &Script{Statements: []string{}}
+	if d.Identical() {
+		return s, nil
+	}
+
+	var drops, alters, adds []string
+	for _, td := range d.ChangedTables {
+		table := sqlutil.QuoteQualified(schema, td.Name)
+
+		// Foreign keys are dropped first and added last, so that the indexes
+		// and columns they use may change in between
+		var dropKeys []string
+		for _, name := range td.RemovedForeignKeys {
+			dropKeys = append(dropKeys, "DROP FOREIGN KEY "+sqlutil.QuoteIdentifier(name))
+		}
+		var addKeys []string
+		for _, k := range td.AddedForeignKeys {
+			addKeys = append(addKeys, "ADD "+foreignKeyDefinition(schema, k))
+		}
+		for _, c := range td.ChangedForeignKeys {
+			dropKeys = append(dropKeys, "DROP FOREIGN KEY "+sqlutil.QuoteIdentifier(c.Name))
+			addKeys = append(addKeys, "ADD "+foreignKeyDefinition(schema, c.Source))
+		}
+		if len(dropKeys) > 0 {
+			drops = append(drops, "ALTER TABLE "+table+" "+strings.Join(dropKeys, ", "))
+		}
+		if len(addKeys) > 0 {
+			adds = append(adds, "ALTER TABLE "+table+" "+strings.Join(addKeys, ", "))
+		}
+
+		clauses, warnings := alterClauses(td)
+		s.Warnings = append(s.Warnings, warnings...)
+		if len(clauses) > 0 {
+			alters = append(alters, "ALTER TABLE "+table+" "+strings.Join(clauses, ", "))
+		}
+	}
+
+	for _, name := range d.RemovedTables {
+		drops = append(drops, "DROP TABLE "+sqlutil.QuoteQualified(schema, name))
+	}
+	for _, name := range d.AddedTables {
+		create, err := createTable(name)
+		if err != nil {
+			return nil, err
+		}
+		// Qualify the created table with the target schema
+		prefix := "CREATE TABLE " + sqlutil.QuoteIdentifier(name)
+		if !strings.HasPrefix(create, prefix) {
+			return nil, fmt.Errorf("unexpected definition of table %s", name)
+		}
+		alters = append(alters, "CREATE TABLE "+sqlutil.QuoteQualified(schema, name)+strings.TrimPrefix(create, prefix))
+	}
+
+	s.Statements = append(s.Statements, "SET FOREIGN_KEY_CHECKS = 0")
+	s.Statements = append(s.Statements, drops...)
+	s.Statements = append(s.Statements, alters...)
+	s.Statements = append(s.Statements, adds...)
+	s.Statements = append(s.Statements, "SET FOREIGN_KEY_CHECKS = 1")
+	return s, nil
+}
+
+// alterClauses returns the clauses changing the columns, indexes and options
+// of a table
+func alterClauses(td TableDiff) (clauses, warnings []string) {
+	for _, name := range td.RemovedIndexes {
+		clauses = append(clauses, dropIndex(name))
+	}
+	for _, c := range td.ChangedIndexes {
+		clauses = append(clauses, dropIndex(c.Name))
+	}
+
+	for _, name := range td.RemovedColumns {
+		clauses = append(clauses, "DROP COLUMN "+sqlutil.QuoteIdentifier(name))
+	}
+	moved := map[string]bool{}
+	for _, c := range td.MovedColumns {
+		moved[c.Name] = true
+	}
+	for _, c := range td.ChangedColumns {
+		// Moved columns are changed as they are moved
+		if moved[c.Name] {
+			continue
+		}
+		definition, ok := columnDefinition(c.Source)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("generated column %s.%s must be changed by hand", td.Name, c.Name))
+			continue
+		}
+		clauses = append(clauses, "MODIFY COLUMN "+definition)
+	}
+	for _, c := range td.AddedColumns {
+		definition, ok := columnDefinition(c.Column)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("generated column %s.%s must be added by hand", td.Name, c.Name))
+			continue
+		}
+		clauses = append(clauses, "ADD COLUMN "+definition+columnPosition(c.After))
+	}
+	// Columns are moved after the added columns they may follow
+	for _, c := range td.MovedColumns {
+		definition, ok := columnDefinition(c.Column)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("generated column %s.%s must be moved by hand", td.Name, c.Name))
+			continue
+		}
+		clauses = append(clauses, "MODIFY COLUMN "+definition+columnPosition(c.After))
+	}
+
+	var added []catalog.Index
+	added = append(added, td.AddedIndexes...)
+	for _, c := range td.ChangedIndexes {
+		added = append(added, c.Source)
+	}
+	for _, i := range added {
+		definition, ok := indexDefinition(i)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("functional index %s.%s must be added by hand", td.Name, i.Name))
+			continue
+		}
+		clauses = append(clauses, "ADD "+definition)
+	}
+
+	for _, o := range td.ChangedOptions {
+		switch o.Name {
+		case "engine":
+			clauses = append(clauses, "ENGINE="+o.Source)
+		case "collation":
+			clauses = append(clauses, "COLLATE="+o.Source)
+		case "row_format":
+			clauses = append(clauses, "ROW_FORMAT="+o.Source)
+		case "comment":
+			clauses = append(clauses, "COMMENT="+sqlutil.QuoteString(o.Source))
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s of %s must be changed by hand: %q", o.Name, td.Name, o.Source))
+		}
+	}
+	return clauses, warnings
+}
+
+// columnPosition returns the position clause of a column following another
+// column, or the first column when after is empty
+func columnPosition(after string) string {
+	if after == "" {
+		return " FIRST"
+	}
+	return " AFTER " + sqlutil.QuoteIdentifier(after)
+}
+
+func dropIndex(name string) string {
+	if name == catalog.PrimaryKey {
+		return "DROP PRIMARY KEY"
+	}
+	return "DROP INDEX " + sqlutil.QuoteIdentifier(name)
+}
+
+// columnDefinition returns the definition of a column for ADD and MODIFY
+// COLUMN. Generated columns cannot be defined, the catalog does not load their
+// expression.
+func columnDefinition(c catalog.Column) (string, bool) {
+	var extra []string
+	generatedDefault := false
+	for _, word := range strings.Fields(c.Extra) {
+		switch strings.ToUpper(word) {
+		case "DEFAULT_GENERATED":
+			generatedDefault = true
+		case "VIRTUAL", "STORED", "GENERATED":
+			return "", false
+		default:
+			extra = append(extra, word)
+		}
+	}
+
+	definition := sqlutil.QuoteIdentifier(c.Name) + " " + c.Type
+	if c.Nullable {
+		definition += " NULL"
+	} else {
+		definition += " NOT NULL"
+	}
+	if c.Default != nil {
+		definition += " DEFAULT " + defaultValue(*c.Default, generatedDefault)
+	}
+	if len(extra) > 0 {
+		definition += " " + strings.Join(extra, " ")
+	}
+	if c.Comment != "" {
+		definition += " COMMENT " + sqlutil.QuoteString(c.Comment)
+	}
+	return definition, true
+}
+
+// defaultValue returns the DEFAULT clause value of a column. Generated defaults
+// are expressions: CURRENT_TIMESTAMP is written as is, others in parentheses.
+func defaultValue(value string, generated bool) string {
+	upper := strings.ToUpper(value)
+	switch {
+	case generated && (strings.HasPrefix(upper, "CURRENT_TIMESTAMP") || strings.HasPrefix(upper, "NOW(")):
+		return value
+	case generated:
+		return "(" + value + ")"
+	case strings.HasPrefix(value, "b'"):
+		// Bit values are shown as literals
+		return value
+	default:
+		return sqlutil.QuoteString(value)
+	}
+}
+
+// indexDefinition returns the definition of an index for ADD. Functional key
+// parts cannot be defined, the catalog does not load their expression.
+func indexDefinition(i catalog.Index) (string, bool) {
+	parts := make([]string, len(i.Columns))
+	for n, c := range i.Columns {
+		if c.Name == "" {
+			return "", false
+		}
+		parts[n] = sqlutil.QuoteIdentifier(c.Name)
+		if c.SubPart > 0 {
+			parts[n] += fmt.Sprintf("(%d)", c.SubPart)
+		}
+		if c.Descending {
+			parts[n] += " DESC"
+		}
+	}
+	columns := " (" + strings.Join(parts, ", ") + ")"
+
+	if i.Name == catalog.PrimaryKey {
+		return "PRIMARY KEY" + columns, true
+	}
+
+	var definition string
+	switch {
+	case i.Type == "FULLTEXT" || i.Type == "SPATIAL":
+		definition = i.Type + " INDEX "
+	case i.Unique:
+		definition = "UNIQUE INDEX "
+	default:
+		definition = "INDEX "
+	}
+	definition += sqlutil.QuoteIdentifier(i.Name) + columns
+	if i.Type == "HASH" {
+		definition += " USING HASH"
+	}
+	if i.Comment != "" {
+		definition += " COMMENT " + sqlutil.QuoteString(i.Comment)
+	}
+	return definition, true
+}
+
+// foreignKeyDefinition returns the definition of a foreign key for ADD. Tables
+// of the same schema are referenced in the target schema.
+func foreignKeyDefinition(schema string, k catalog.ForeignKey) string {
+	referencedSchema := k.ReferencedSchema
+	if referencedSchema == "" {
+		referencedSchema = schema
+	}
+	return fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s) ON DELETE %s ON UPDATE %s",
+		sqlutil.QuoteIdentifier(k.Name), quoteList(k.Columns),
+		sqlutil.QuoteQualified(referencedSchema, k.ReferencedTable), quoteList(k.ReferencedColumns),
+		k.OnDelete, k.OnUpdate)
+}
+
+func quoteList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = sqlutil.QuoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
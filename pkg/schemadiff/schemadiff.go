@@ -0,0 +1,242 @@
+// Package schemadiff compares the tables of two schemas and generates the
+// statements making the target schema match the source.
+package schemadiff
+
+import (
+	"slices"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+)
+
+// Diff lists the differences of a target schema from a source schema
+type Diff struct {
+	// AddedTables are in the source but not in the target
+	AddedTables []string `json:"added_tables"`
+	// RemovedTables are in the target but not in the source
+	RemovedTables []string    `json:"removed_tables"`
+	ChangedTables []TableDiff `json:"changed_tables"`
+}
+
+// TableDiff lists the differences of a table present in both schemas
+type TableDiff struct {
+	Name               string                       `json:"name"`
+	AddedColumns       []AddedColumn                `json:"added_columns,omitempty"`
+	RemovedColumns     []string                     `json:"removed_columns,omitempty"`
+	ChangedColumns     []Change[catalog.Column]     `json:"changed_columns,omitempty"`
+	MovedColumns       []MovedColumn                `json:"moved_columns,omitempty"`
+	AddedIndexes       []catalog.Index              `json:"added_indexes,omitempty"`
+	RemovedIndexes     []string                     `json:"removed_indexes,omitempty"`
+	ChangedIndexes     []Change[catalog.Index]      `json:"changed_indexes,omitempty"`
+	AddedForeignKeys   []catalog.ForeignKey         `json:"added_foreign_keys,omitempty"`
+	RemovedForeignKeys []string                     `json:"removed_foreign_keys,omitempty"`
+	ChangedForeignKeys []Change[catalog.ForeignKey] `json:"changed_foreign_keys,omitempty"`
+	ChangedOptions     []Change[string]             `json:"changed_options,omitempty"`
+}
+
+// AddedColumn is a column of the source table missing from the target
+type AddedColumn struct {
+	catalog.Column
+	// After is the preceding column in the source table, empty for the first column
+	After string `json:"after,omitempty"`
+}
+
+// MovedColumn is a column of both tables that must move for the target columns
+// to follow the order of the source
+type MovedColumn struct {
+	catalog.Column
+	// After is the preceding column in the source table, empty for the first column
+	After string `json:"after,omitempty"`
+}
+
+// Change is an object that differs between the source and the target
+type Change[T any] struct {
+	Name   string `json:"name"`
+	Source T      `json:"source"`
+	Target T      `json:"target"`
+}
+
+// Identical reports whether the schemas have no differences
+func (d Diff) Identical() bool {
+	return len(d.AddedTables) == 0 && len(d.RemovedTables) == 0 && len(d.ChangedTables) == 0
+}
+
+// empty reports whether the table has no differences
+func (t TableDiff) empty() bool {
+	return len(t.AddedColumns) == 0 && len(t.RemovedColumns) == 0 && len(t.ChangedColumns) == 0 && len(t.MovedColumns) == 0 &&
+		len(t.AddedIndexes) == 0 && len(t.RemovedIndexes) == 0 && len(t.ChangedIndexes) == 0 &&
+		len(t.AddedForeignKeys) == 0 && len(t.RemovedForeignKeys) == 0 && len(t.ChangedForeignKeys) == 0 &&
+		len(t.ChangedOptions) == 0
+}
+
+// Compare returns the differences of the target tables from the source tables.
+// Row counts and timestamps are ignored, and so are the schema names: foreign
+// keys of the source referencing the source or the target schema reference
+// the target schema once migrated, like those of the target referencing it.
+func Compare(sourceSchema string, source []catalog.Table, targetSchema string, target []catalog.Table) Diff {
+	d := Diff{AddedTables: []string{}, RemovedTables: []string{}, ChangedTables: []TableDiff{}}
+
+	targets := map[string]catalog.Table{}
+	for _, t := range target {
+		targets[t.Name] = t
+	}
+	sources := map[string]bool{}
+	for _, s := range source {
+		sources[s.Name] = true
+		t, ok := targets[s.Name]
+		if !ok {
+			d.AddedTables = append(d.AddedTables, s.Name)
+			continue
+		}
+		s.ForeignKeys = localForeignKeys(s.ForeignKeys, sourceSchema, targetSchema)
+		t.ForeignKeys = localForeignKeys(t.ForeignKeys, targetSchema)
+		if td := compareTable(s, t); !td.empty() {
+			d.ChangedTables = append(d.ChangedTables, td)
+		}
+	}
+	for _, t := range target {
+		if !sources[t.Name] {
+			d.RemovedTables = append(d.RemovedTables, t.Name)
+		}
+	}
+	return d
+}
+
+// compareTable compares the columns, indexes, foreign keys and options of a table
+func compareTable(source, target catalog.Table) TableDiff {
+	td := TableDiff{Name: source.Name}
+
+	targetColumns := map[string]catalog.Column{}
+	for _, c := range target.Columns {
+		targetColumns[c.Name] = c
+	}
+	sourceColumns := map[string]bool{}
+	for i, c := range source.Columns {
+		sourceColumns[c.Name] = true
+		t, ok := targetColumns[c.Name]
+		switch {
+		case !ok:
+			added := AddedColumn{Column: c}
+			if i > 0 {
+				added.After = source.Columns[i-1].Name
+			}
+			td.AddedColumns = append(td.AddedColumns, added)
+		case !sameColumn(c, t):
+			td.ChangedColumns = append(td.ChangedColumns, Change[catalog.Column]{Name: c.Name, Source: c, Target: t})
+		}
+	}
+	for _, c := range target.Columns {
+		if !sourceColumns[c.Name] {
+			td.RemovedColumns = append(td.RemovedColumns, c.Name)
+		}
+	}
+	td.MovedColumns = movedColumns(source, target, td.AddedColumns, td.RemovedColumns)
+
+	td.AddedIndexes, td.RemovedIndexes, td.ChangedIndexes = compareNamed(source.Indexes, target.Indexes,
+		func(i catalog.Index) string { return i.Name }, sameIndex)
+	td.AddedForeignKeys, td.RemovedForeignKeys, td.ChangedForeignKeys = compareNamed(source.ForeignKeys, target.ForeignKeys,
+		func(k catalog.ForeignKey) string { return k.Name }, sameForeignKey)
+
+	for _, o := range []Change[string]{
+		{Name: "engine", Source: source.Engine, Target: target.Engine},
+		{Name: "collation", Source: source.Collation, Target: target.Collation},
+		{Name: "row_format", Source: source.RowFormat, Target: target.RowFormat},
+		{Name: "create_options", Source: source.CreateOptions, Target: target.CreateOptions},
+		{Name: "comment", Source: source.Comment, Target: target.Comment},
+	} {
+		if o.Source != o.Target {
+			td.ChangedOptions = append(td.ChangedOptions, o)
+		}
+	}
+	return td
+}
+
+// localForeignKeys returns the foreign keys with the references to the given
+// schemas made references to the schema of their table, which are empty
+func localForeignKeys(keys []catalog.ForeignKey, schemas ...string) []catalog.ForeignKey {
+	local := make([]catalog.ForeignKey, len(keys))
+	for i, k := range keys {
+		if slices.Contains(schemas, k.ReferencedSchema) {
+			k.ReferencedSchema = ""
+		}
+		local[i] = k
+	}
+	return local
+}
+
+// movedColumns returns the columns to move, in source order, so that the target
+// columns follow the order of the source once the removed columns are dropped
+// and the added columns are added after their predecessor
+func movedColumns(source, target catalog.Table, added []AddedColumn, removed []string) []MovedColumn {
+	var order []string
+	for _, c := range target.Columns {
+		if !slices.Contains(removed, c.Name) {
+			order = append(order, c.Name)
+		}
+	}
+	for _, c := range added {
+		at := 0
+		if c.After != "" {
+			at = slices.Index(order, c.After) + 1
+		}
+		order = slices.Insert(order, at, c.Name)
+	}
+
+	var moved []MovedColumn
+	for i, c := range source.Columns {
+		if order[i] == c.Name {
+			continue
+		}
+		m := MovedColumn{Column: c}
+		if i > 0 {
+			m.After = source.Columns[i-1].Name
+		}
+		moved = append(moved, m)
+		order = slices.Delete(order, slices.Index(order, c.Name), slices.Index(order, c.Name)+1)
+		order = slices.Insert(order, i, c.Name)
+	}
+	return moved
+}
+
+// compareNamed matches the objects of both tables by name
+func compareNamed[T any](source, target []T, name func(T) string, same func(a, b T) bool) (added []T, removed []string, changed []Change[T]) {
+	targets := map[string]T{}
+	for _, t := range target {
+		targets[name(t)] = t
+	}
+	sources := map[string]bool{}
+	for _, s := range source {
+		sources[name(s)] = true
+		t, ok := targets[name(s)]
+		switch {
+		case !ok:
+			added = append(added, s)
+		case !same(s, t):
+			changed = append(changed, Change[T]{Name: name(s), Source: s, Target: t})
+		}
+	}
+	for _, t := range target {
+		if !sources[name(t)] {
+			removed = append(removed, name(t))
+		}
+	}
+	return added, removed, changed
+}
+
+// sameColumn compares the definitions of two columns, ignoring their position
+// and key flag, which is compared through the indexes
+func sameColumn(a, b catalog.Column) bool {
+	if (a.Default == nil) != (b.Default == nil) || (a.Default != nil && *a.Default != *b.Default) {
+		return false
+	}
+	return a.Type == b.Type && a.Nullable == b.Nullable && a.Extra == b.Extra && a.Comment == b.Comment
+}
+
+func sameIndex(a, b catalog.Index) bool {
+	return a.Unique == b.Unique && a.Type == b.Type && a.Comment == b.Comment && slices.Equal(a.Columns, b.Columns)
+}
+
+func sameForeignKey(a, b catalog.ForeignKey) bool {
+	return a.ReferencedSchema == b.ReferencedSchema && a.ReferencedTable == b.ReferencedTable &&
+		a.OnUpdate == b.OnUpdate && a.OnDelete == b.OnDelete &&
+		slices.Equal(a.Columns, b.Columns) && slices.Equal(a.ReferencedColumns, b.ReferencedColumns)
+}
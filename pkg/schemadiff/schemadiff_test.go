@@ -0,0 +1,205 @@
+package schemadiff
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr(s string) *string { return &s }
+
+var primaryKey = catalog.Index{Name: catalog.PrimaryKey, Unique: true, Type: "BTREE", Columns: []catalog.IndexColumn{{Name: "id"}}}
+
+// source is the schema the target must match
+var source = []catalog.Table{
+	{
+		Name: "customers", Engine: "InnoDB", Collation: "utf8mb4_0900_ai_ci",
+		Columns: []catalog.Column{{Name: "id", Type: "int", Key: "PRI", Extra: "auto_increment"}},
+		Indexes: []catalog.Index{primaryKey},
+	},
+	{
+		Name: "orders", Engine: "InnoDB", Collation: "utf8mb4_0900_ai_ci", Comment: "Customer orders",
+		Columns: []catalog.Column{
+			{Name: "id", Type: "int", Key: "PRI", Extra: "auto_increment"},
+			{Name: "customer_id", Type: "int"},
+			{Name: "status", Type: "varchar(20)", Default: ptr("new"), Comment: "Order's status"},
+			{Name: "created_at", Type: "datetime", Default: ptr("CURRENT_TIMESTAMP"), Extra: "DEFAULT_GENERATED"},
+		},
+		Indexes: []catalog.Index{
+			primaryKey,
+			{Name: "customer_id", Type: "BTREE", Columns: []catalog.IndexColumn{{Name: "customer_id"}, {Name: "created_at", Descending: true}}},
+			{Name: "status", Type: "BTREE", Columns: []catalog.IndexColumn{{Name: "status", SubPart: 4}}},
+		},
+		ForeignKeys: []catalog.ForeignKey{
+			{Name: "orders_customer", Columns: []string{"customer_id"}, ReferencedTable: "customers", ReferencedColumns: []string{"id"}, OnUpdate: "RESTRICT", OnDelete: "CASCADE"},
+		},
+	},
+}
+
+// target lacks customers, has a legacy table and an outdated orders table
+var target = []catalog.Table{
+	{
+		Name: "legacy", Engine: "MyISAM",
+		Columns: []catalog.Column{{Name: "id", Type: "int"}},
+	},
+	{
+		Name: "orders", Engine: "InnoDB", Collation: "utf8mb4_0900_ai_ci",
+		Columns: []catalog.Column{
+			{Name: "id", Type: "int", Key: "PRI", Extra: "auto_increment"},
+			{Name: "customer_id", Type: "int"},
+			{Name: "status", Type: "varchar(10)", Nullable: true},
+			{Name: "note", Type: "text", Nullable: true},
+		},
+		Indexes: []catalog.Index{
+			primaryKey,
+			{Name: "customer_id", Type: "BTREE", Columns: []catalog.IndexColumn{{Name: "customer_id"}}},
+			{Name: "note", Type: "FULLTEXT", Columns: []catalog.IndexColumn{{Name: "note"}}},
+		},
+		ForeignKeys: []catalog.ForeignKey{
+			{Name: "orders_customer", Columns: []string{"customer_id"}, ReferencedTable: "customers", ReferencedColumns: []string{"id"}, OnUpdate: "RESTRICT", OnDelete: "RESTRICT"},
+		},
+	},
+}
+
+func TestCompare(t *testing.T) {
+	d := Compare("shop", source, "staging", target)
+	assert.False(t, d.Identical())
+	assert.Equal(t, []string{"customers"}, d.AddedTables)
+	assert.Equal(t, []string{"legacy"}, d.RemovedTables)
+	require.Len(t, d.ChangedTables, 1)
+
+	orders := d.ChangedTables[0]
+	assert.Equal(t, "orders", orders.Name)
+	assert.Equal(t, []AddedColumn{{Column: source[1].Columns[3], After: "status"}}, orders.AddedColumns)
+	assert.Equal(t, []string{"note"}, orders.RemovedColumns)
+	require.Len(t, orders.ChangedColumns, 1)
+	assert.Equal(t, "status", orders.ChangedColumns[0].Name)
+	assert.Equal(t, "varchar(10)", orders.ChangedColumns[0].Target.Type)
+
+	assert.Equal(t, []catalog.Index{source[1].Indexes[2]}, orders.AddedIndexes)
+	assert.Equal(t, []string{"note"}, orders.RemovedIndexes)
+	require.Len(t, orders.ChangedIndexes, 1)
+	assert.Equal(t, "customer_id", orders.ChangedIndexes[0].Name)
+
+	assert.Empty(t, orders.AddedForeignKeys)
+	assert.Empty(t, orders.RemovedForeignKeys)
+	require.Len(t, orders.ChangedForeignKeys, 1)
+	assert.Equal(t, "CASCADE", orders.ChangedForeignKeys[0].Source.OnDelete)
+
+	assert.Equal(t, []Change[string]{{Name: "comment", Source: "Customer orders", Target: ""}}, orders.ChangedOptions)
+
+	// Position numbers and statistics are ignored
+	moved := source[0]
+	moved.Columns = []catalog.Column{{Name: "id", Position: 7, Type: "int", Key: "PRI", Extra: "auto_increment"}}
+	rows := int64(42)
+	moved.Rows = &rows
+	assert.True(t, Compare("shop", []catalog.Table{source[0]}, "staging", []catalog.Table{moved}).Identical())
+}
+
+func TestCompareMovedColumns(t *testing.T) {
+	column := func(name string) catalog.Column { return catalog.Column{Name: name, Type: "int"} }
+	source := []catalog.Table{{Name: "t", Columns: []catalog.Column{column("a"), column("b"), column("c"), column("d")}}}
+	target := []catalog.Table{{Name: "t", Columns: []catalog.Column{column("c"), column("a"), column("b"), column("x")}}}
+
+	d := Compare("shop", source, "shop", target)
+	require.Len(t, d.ChangedTables, 1)
+	assert.Equal(t, []MovedColumn{{Column: column("a")}, {Column: column("b"), After: "a"}}, d.ChangedTables[0].MovedColumns)
+
+	s, err := d.Script("shop", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"SET FOREIGN_KEY_CHECKS = 0",
+		"ALTER TABLE `shop`.`t` DROP COLUMN `x`, ADD COLUMN `d` int NOT NULL AFTER `c`, " +
+			"MODIFY COLUMN `a` int NOT NULL FIRST, MODIFY COLUMN `b` int NOT NULL AFTER `a`",
+		"SET FOREIGN_KEY_CHECKS = 1",
+	}, s.Statements)
+
+	// A changed column that moves is changed and moved at once
+	target[0].Columns[1].Type = "bigint"
+	s, err = Compare("shop", source, "shop", target).Script("shop", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ALTER TABLE `shop`.`t` DROP COLUMN `x`, ADD COLUMN `d` int NOT NULL AFTER `c`, "+
+		"MODIFY COLUMN `a` int NOT NULL FIRST, MODIFY COLUMN `b` int NOT NULL AFTER `a`", s.Statements[1])
+}
+
+func TestCompareForeignKeySchemas(t *testing.T) {
+	table := func(referencedSchema string) []catalog.Table {
+		return []catalog.Table{{Name: "orders", ForeignKeys: []catalog.ForeignKey{
+			{Name: "orders_customer", Columns: []string{"customer_id"}, ReferencedSchema: referencedSchema, ReferencedTable: "customers", ReferencedColumns: []string{"id"}, OnUpdate: "RESTRICT", OnDelete: "CASCADE"},
+		}}}
+	}
+
+	// References to the source or the target schema are references of the target schema
+	assert.True(t, Compare("shop_v2", table("shop_v2"), "shop", table("")).Identical())
+	assert.True(t, Compare("shop_v2", table("shop"), "shop", table("shop")).Identical())
+	assert.False(t, Compare("shop_v2", table("crm"), "shop", table("")).Identical())
+
+	d := Compare("shop_v2", table("shop_v2"), "shop", []catalog.Table{{Name: "orders"}})
+	s, err := d.Script("shop", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ALTER TABLE `shop`.`orders` ADD CONSTRAINT `orders_customer` FOREIGN KEY (`customer_id`) REFERENCES `shop`.`customers` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT", s.Statements[1])
+}
+
+func TestScript(t *testing.T) {
+	d := Compare("shop", source, "staging", target)
+	s, err := d.Script("staging", func(name string) (string, error) {
+		assert.Equal(t, "customers", name)
+		return "CREATE TABLE `customers` (\n  `id` int NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB", nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, s.Warnings)
+	assert.Equal(t, []string{
+		"SET FOREIGN_KEY_CHECKS = 0",
+		"ALTER TABLE `staging`.`orders` DROP FOREIGN KEY `orders_customer`",
+		"DROP TABLE `staging`.`legacy`",
+		"ALTER TABLE `staging`.`orders` DROP INDEX `note`, DROP INDEX `customer_id`, DROP COLUMN `note`, " +
+			"MODIFY COLUMN `status` varchar(20) NOT NULL DEFAULT 'new' COMMENT 'Order\\'s status', " +
+			"ADD COLUMN `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER `status`, " +
+			"ADD INDEX `status` (`status`(4)), ADD INDEX `customer_id` (`customer_id`, `created_at` DESC), " +
+			"COMMENT='Customer orders'",
+		"CREATE TABLE `staging`.`customers` (\n  `id` int NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB",
+		"ALTER TABLE `staging`.`orders` ADD CONSTRAINT `orders_customer` FOREIGN KEY (`customer_id`) REFERENCES `staging`.`customers` (`id`) ON DELETE CASCADE ON UPDATE RESTRICT",
+		"SET FOREIGN_KEY_CHECKS = 1",
+	}, s.Statements)
+
+	// Identical schemas need no statements
+	s, err = Compare("shop", source, "staging", source).Script("staging", nil)
+	require.NoError(t, err)
+	assert.Empty(t, s.Statements)
+
+	// Definitions that cannot be loaded fail the script
+	_, err = d.Script("staging", func(name string) (string, error) { return "", fmt.Errorf("access denied") })
+	assert.EqualError(t, err, "access denied")
+}
+
+func TestScriptWarnings(t *testing.T) {
+	d := Diff{ChangedTables: []TableDiff{{
+		Name: "orders",
+		AddedColumns: []AddedColumn{
+			{Column: catalog.Column{Name: "total", Type: "decimal(10,2)", Extra: "STORED GENERATED"}},
+			{Column: catalog.Column{Name: "flags", Type: "bit(2)", Default: ptr("b'0'")}},
+			{Column: catalog.Column{Name: "ref", Type: "binary(16)", Default: ptr("uuid_to_bin(uuid())"), Extra: "DEFAULT_GENERATED"}},
+		},
+		AddedIndexes: []catalog.Index{
+			{Name: "lower_status", Type: "BTREE", Columns: []catalog.IndexColumn{{}}},
+			{Name: catalog.PrimaryKey, Unique: true, Type: "BTREE", Columns: []catalog.IndexColumn{{Name: "id"}}},
+		},
+		ChangedOptions: []Change[string]{{Name: "create_options", Source: "stats_persistent=0"}},
+	}}}
+	s, err := d.Script("shop", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"SET FOREIGN_KEY_CHECKS = 0",
+		"ALTER TABLE `shop`.`orders` ADD COLUMN `flags` bit(2) NOT NULL DEFAULT b'0' FIRST, " +
+			"ADD COLUMN `ref` binary(16) NOT NULL DEFAULT (uuid_to_bin(uuid())) FIRST, ADD PRIMARY KEY (`id`)",
+		"SET FOREIGN_KEY_CHECKS = 1",
+	}, s.Statements)
+	assert.Equal(t, []string{
+		"generated column orders.total must be added by hand",
+		"functional index orders.lower_status must be added by hand",
+		`create_options of orders must be changed by hand: "stats_persistent=0"`,
+	}, s.Warnings)
+}
@@ -0,0 +1,300 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/auth"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// DefaultID is the ID of the session used by requests without a client session
+const DefaultID = "default"
+
+// Session is the state of one MCP client session
+type Session struct {
+	ID        string
+	Datastore datastore.DatastoreInterface
+
+	mu      sync.Mutex
+	profile string
+	// user is the authenticated user the session belongs to, set by the first
+	// request of the session
+	user  string
+	owned bool
+	// client receives the notifications of the session, nil until a request of
+	// an MCP client session was seen
+	client server.ClientSession
+}
+
+// SetProfile records the connection profile the session connected with, empty
+// for connections with explicit parameters
+func (s *Session) SetProfile(profile string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.profile = profile
+}
+
+// Profile returns the connection profile the session connected with, empty for
+// connections with explicit parameters
+func (s *Session) Profile() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.profile
+}
+
+// ConnectionKey identifies the connection of the session for limits: the name of
+// its connection profile, or the identity of its datastore
+func (s *Session) ConnectionKey() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.profile != "" {
+		return s.profile
+	}
+	return s.Datastore.Identity()
+}
+
+// authorize binds the session to the user of its first request and rejects
+// the requests of other users, who could otherwise use its connection by
+// learning its ID
+func (s *Session) authorize(user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.owned {
+		s.user, s.owned = user, true
+		return nil
+	}
+	if s.user != user {
+		return fmt.Errorf("permission denied: session %s belongs to another user", s.ID)
+	}
+	return nil
+}
+
+// setClient records the MCP client session notifications are sent to
+func (s *Session) setClient(client server.ClientSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = client
+}
+
+// notifyHealth sends a change of the connection health to the client as an MCP log message
+func (s *Session) notifyHealth(h datastore.Health) {
+	s.mu.Lock()
+	client := s.client
+	s.mu.Unlock()
+
+	if client == nil {
+		return
+	}
+
+	level, message := healthMessage(h)
+	notification := mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: "notifications/message",
+			Params: mcp.NotificationParams{
+				AdditionalFields: map[string]any{
+					"level":  level,
+					"logger": "mysql",
+					"data":   map[string]any{"message": message, "health": h},
+				},
+			},
+		},
+	}
+
+	// Never block the health monitor on a slow client
+	select {
+	case client.NotificationChannel() <- notification:
+	default:
+	}
+}
+
+// healthMessage describes a health change with its log level
+func healthMessage(h datastore.Health) (mcp.LoggingLevel, string) {
+	switch h.State {
+	case datastore.StateConnected:
+		return mcp.LoggingLevelInfo, "MySQL connection is healthy"
+	case datastore.StateDegraded:
+		return mcp.LoggingLevelWarning, "MySQL health check failed: " + h.LastError
+	case datastore.StateReconnecting:
+		return mcp.LoggingLevelWarning, fmt.Sprintf("Reconnecting to MySQL (attempt %d): %s", h.Attempts, h.LastError)
+	case datastore.StateFailed:
+		return mcp.LoggingLevelError, "Gave up reconnecting to MySQL, use the connect tool: " + h.LastError
+	}
+	return mcp.LoggingLevelInfo, "MySQL connection is " + string(h.State)
+}
+
+// Manager owns the sessions of the server by MCP session ID
+type Manager struct {
+	mu           sync.Mutex
+	sessions     map[string]*Session
+	newDatastore func() datastore.DatastoreInterface
+	closeHooks   []func(*Session)
+}
+
+// NewManager creates a manager creating the datastore of each new session with newDatastore
+func NewManager(newDatastore func() datastore.DatastoreInterface) *Manager {
+	return &Manager{
+		sessions:     map[string]*Session{},
+		newDatastore: newDatastore,
+	}
+}
+
+// Get returns the session with the given ID, creating it on first use
+func (m *Manager) Get(id string) *Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		s = &Session{ID: id, Datastore: m.newDatastore()}
+		if n, ok := s.Datastore.(datastore.HealthNotifier); ok {
+			n.NotifyHealth(s.notifyHealth)
+		}
+		m.sessions[id] = s
+	}
+	return s
+}
+
+// FromContext returns the session of the MCP client session of the request
+func (m *Manager) FromContext(ctx context.Context) *Session {
+	if cs := server.ClientSessionFromContext(ctx); cs != nil {
+		s := m.Get(cs.SessionID())
+		s.setClient(cs)
+		return s
+	}
+	return m.Get(DefaultID)
+}
+
+// RequireOwner wraps a tool handler so that a session only serves the user who started it
+func (m *Manager) RequireOwner(handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if err := m.FromContext(ctx).authorize(auth.UserName(ctx)); err != nil {
+			return nil, err
+		}
+		return handler(ctx, request)
+	}
+}
+
+// OnClose registers a hook called whenever a session is closed
+func (m *Manager) OnClose(hook func(*Session)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closeHooks = append(m.closeHooks, hook)
+}
+
+// Close ends a session, runs the close hooks and closes its datastore
+func (m *Manager) Close(id string) error {
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	delete(m.sessions, id)
+	hooks := m.closeHooks
+	m.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	for _, hook := range hooks {
+		hook(s)
+	}
+	return s.Datastore.Close()
+}
+
+// CloseAll ends every session, for example on shutdown
+func (m *Manager) CloseAll() error {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.sessions))
+	for id := range m.sessions {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, id := range ids {
+		errs = append(errs, m.Close(id))
+	}
+	return errors.Join(errs...)
+}
+
+// Len returns the number of open sessions
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.sessions)
+}
+
+var sessionIDPattern = regexp.MustCompile(`sessionId=([0-9A-Za-z-]+)`)
+
+// TrackSSE wraps the handler of an SSE server so that a session is closed as soon
+// as the SSE stream of its client ends. The session ID is read from the endpoint
+// event the SSE server sends when the stream opens, and the session belongs to
+// the user who opened the stream.
+func (m *Manager) TrackSSE(next http.Handler, ssePath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != ssePath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &sessionRecorder{ResponseWriter: w, opened: func(id string) {
+			m.Get(id).authorize(auth.UserName(r.Context()))
+		}}
+		next.ServeHTTP(rec, r)
+
+		if rec.sessionID != "" {
+			m.Close(rec.sessionID)
+		}
+	})
+}
+
+// sessionRecorder captures the session ID from the first event of an SSE stream
+type sessionRecorder struct {
+	http.ResponseWriter
+	sessionID string
+	buf       bytes.Buffer
+	// opened is called with the session ID once it is known
+	opened func(id string)
+}
+
+func (r *sessionRecorder) Write(p []byte) (int, error) {
+	if r.sessionID == "" && r.buf.Len() < 4096 {
+		r.buf.Write(p)
+		scanner := bufio.NewScanner(bytes.NewReader(r.buf.Bytes()))
+		for scanner.Scan() {
+			if m := sessionIDPattern.FindStringSubmatch(scanner.Text()); m != nil {
+				r.sessionID = m[1]
+				r.buf.Reset()
+				r.opened(r.sessionID)
+				break
+			}
+		}
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *sessionRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Global session manager
+var Default = NewManager(func() datastore.DatastoreInterface {
+	return &datastore.MySQLDatastore{}
+})
@@ -0,0 +1,199 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/auth"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubDatastore records whether it was closed
+type stubDatastore struct {
+	closed atomic.Bool
+}
+
+func (d *stubDatastore) Connect(ctx context.Context, params datastore.ConnectParams) error {
+	return nil
+}
+func (d *stubDatastore) CheckConnection() error { return nil }
+func (d *stubDatastore) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+func (d *stubDatastore) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+func (d *stubDatastore) Conn(ctx context.Context) (*sql.Conn, error)   { return nil, nil }
+func (d *stubDatastore) IsConnected() bool                             { return !d.closed.Load() }
+func (d *stubDatastore) Close() error                                  { d.closed.Store(true); return nil }
+func (d *stubDatastore) Identity() string                              { return "" }
+func (d *stubDatastore) TLSCipher(ctx context.Context) (string, error) { return "", nil }
+func (d *stubDatastore) Info(ctx context.Context) (datastore.ConnectionInfo, error) {
+	return datastore.ConnectionInfo{}, nil
+}
+func (d *stubDatastore) Health() datastore.Health { return datastore.Health{} }
+func (d *stubDatastore) UseDatabase(ctx context.Context, database string) error {
+	return nil
+}
+
+func newStubManager() *Manager {
+	return NewManager(func() datastore.DatastoreInterface {
+		return &stubDatastore{}
+	})
+}
+
+type clientSession string
+
+func (s clientSession) SessionID() string { return string(s) }
+func (s clientSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return make(chan mcp.JSONRPCNotification, 1)
+}
+
+func TestFromContext(t *testing.T) {
+	m := newStubManager()
+	srv := server.NewMCPServer("test", "1.0.0")
+
+	a := m.FromContext(srv.WithContext(context.Background(), clientSession("a")))
+	b := m.FromContext(srv.WithContext(context.Background(), clientSession("b")))
+
+	assert.Equal(t, "a", a.ID)
+	assert.NotSame(t, a.Datastore, b.Datastore)
+	assert.Same(t, a, m.Get("a"))
+	assert.Equal(t, DefaultID, m.FromContext(context.Background()).ID)
+}
+
+func TestCloseRunsHooksAndClosesDatastore(t *testing.T) {
+	m := newStubManager()
+
+	var closed []string
+	m.OnClose(func(s *Session) {
+		closed = append(closed, s.ID)
+	})
+
+	a := m.Get("a")
+	m.Get("b")
+
+	require.NoError(t, m.Close("a"))
+	assert.Equal(t, []string{"a"}, closed)
+	assert.True(t, a.Datastore.(*stubDatastore).closed.Load())
+	assert.Equal(t, 1, m.Len())
+
+	// Closing an unknown session is a no-op
+	require.NoError(t, m.Close("a"))
+	assert.Len(t, closed, 1)
+
+	require.NoError(t, m.CloseAll())
+	assert.Equal(t, 0, m.Len())
+}
+
+func TestTrackSSEClosesSessionWhenStreamEnds(t *testing.T) {
+	m := newStubManager()
+	sseServer := server.NewSSEServer(server.NewMCPServer("test", "1.0.0"))
+	// The stream is opened by alice
+	tracked := m.TrackSSE(sseServer, "/sse")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracked.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), &auth.Identity{User: "alice"})))
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/sse", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// Read the endpoint event to learn the session ID
+	reader := bufio.NewReader(resp.Body)
+	var id string
+	for id == "" {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if _, after, ok := strings.Cut(line, "sessionId="); ok {
+			id = strings.TrimSpace(after)
+		}
+	}
+
+	s := m.Get(id)
+	assert.NoError(t, s.authorize("alice"))
+	assert.EqualError(t, s.authorize("bob"), "permission denied: session "+id+" belongs to another user")
+	cancel()
+
+	assert.Eventually(t, func() bool {
+		return s.Datastore.(*stubDatastore).closed.Load()
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRequireOwner(t *testing.T) {
+	m := newStubManager()
+	srv := server.NewMCPServer("test", "1.0.0")
+	handler := m.RequireOwner(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	call := func(sessionID, user string) error {
+		ctx := srv.WithContext(context.Background(), clientSession(sessionID))
+		if user != "" {
+			ctx = auth.WithIdentity(ctx, &auth.Identity{User: user})
+		}
+		_, err := handler(ctx, mcp.CallToolRequest{})
+		return err
+	}
+
+	// The session belongs to the user of its first request
+	require.NoError(t, call("a", "alice"))
+	require.NoError(t, call("a", "alice"))
+	assert.EqualError(t, call("a", "bob"), "permission denied: session a belongs to another user")
+	assert.EqualError(t, call("a", ""), "permission denied: session a belongs to another user")
+	require.NoError(t, call("b", "bob"))
+}
+
+// notifyingDatastore lets tests trigger health changes
+type notifyingDatastore struct {
+	stubDatastore
+	listener func(datastore.Health)
+}
+
+func (d *notifyingDatastore) NotifyHealth(listener func(datastore.Health)) { d.listener = listener }
+
+// channelSession is a client session keeping its notifications
+type channelSession chan mcp.JSONRPCNotification
+
+func (s channelSession) SessionID() string                                   { return "c" }
+func (s channelSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return s }
+
+func TestHealthNotifications(t *testing.T) {
+	ds := &notifyingDatastore{}
+	m := NewManager(func() datastore.DatastoreInterface { return ds })
+
+	// Changes before the client is known are dropped
+	m.Get("c")
+	require.NotNil(t, ds.listener)
+	ds.listener(datastore.Health{State: datastore.StateDegraded})
+
+	client := make(channelSession, 1)
+	m.FromContext(server.NewMCPServer("test", "1.0.0").WithContext(context.Background(), client))
+	ds.listener(datastore.Health{State: datastore.StateReconnecting, Attempts: 2, LastError: "connection refused"})
+
+	require.Len(t, client, 1)
+	notification := <-client
+	assert.Equal(t, "notifications/message", notification.Method)
+	assert.Equal(t, mcp.LoggingLevelWarning, notification.Params.AdditionalFields["level"])
+	data := notification.Params.AdditionalFields["data"].(map[string]any)
+	assert.Equal(t, "Reconnecting to MySQL (attempt 2): connection refused", data["message"])
+
+	// A full channel does not block
+	client <- notification
+	ds.listener(datastore.Health{State: datastore.StateFailed})
+	assert.Len(t, client, 1)
+}
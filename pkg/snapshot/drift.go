@@ -0,0 +1,96 @@
+package snapshot
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/schemadiff"
+)
+
+// Drift lists the changes of a live schema since a snapshot
+type Drift struct {
+	Schema    string `json:"schema"`
+	TakenAt   string `json:"snapshot_taken_at"`
+	Identical bool   `json:"identical"`
+	// Tables compares the live tables as the source with the snapshot as the
+	// target: added tables were created since the snapshot
+	Tables   schemadiff.Diff `json:"tables"`
+	Views    ObjectDiff      `json:"views"`
+	Routines ObjectDiff      `json:"routines"`
+	Triggers ObjectDiff      `json:"triggers"`
+	Events   ObjectDiff      `json:"events"`
+}
+
+// ObjectDiff lists the names of the objects created, dropped and redefined since a snapshot
+type ObjectDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+func (d ObjectDiff) identical() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Compare returns the drift of a live snapshot from a saved one
+func Compare(saved, live *Snapshot) Drift {
+	d := Drift{
+		Schema:   live.Schema,
+		TakenAt:  saved.TakenAt.Format(time.RFC3339),
+		Tables:   schemadiff.Compare(live.Schema, live.Tables, saved.Schema, saved.Tables),
+		Views:    compareObjects(saved.Views, live.Views, func(v catalog.View) string { return v.Name }),
+		Routines: compareObjects(saved.Routines, live.Routines, func(r catalog.Routine) string { return r.Type + " " + r.Name }),
+		Triggers: compareObjects(saved.Triggers, live.Triggers, func(t catalog.Trigger) string { return t.Name }),
+		Events:   compareObjects(saved.Events, live.Events, func(e catalog.Event) string { return e.Name }),
+	}
+	d.Identical = d.Tables.Identical() && d.Views.identical() && d.Routines.identical() && d.Triggers.identical() && d.Events.identical()
+	return d
+}
+
+// compareObjects matches objects by name and compares all their attributes but
+// their schema, so that a snapshot can be compared with a schema of another name
+func compareObjects[T any](saved, live []T, name func(T) string) ObjectDiff {
+	d := ObjectDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+
+	before := map[string]T{}
+	for _, o := range saved {
+		before[name(o)] = o
+	}
+	after := map[string]bool{}
+	for _, o := range live {
+		after[name(o)] = true
+		old, ok := before[name(o)]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, name(o))
+		case !reflect.DeepEqual(sameSchema(old), sameSchema(o)):
+			d.Changed = append(d.Changed, name(o))
+		}
+	}
+	for _, o := range saved {
+		if !after[name(o)] {
+			d.Removed = append(d.Removed, name(o))
+		}
+	}
+	return d
+}
+
+// sameSchema clears the schema of an object before comparing it
+func sameSchema(o interface{}) interface{} {
+	switch o := o.(type) {
+	case catalog.View:
+		o.Schema = ""
+		return o
+	case catalog.Routine:
+		o.Schema = ""
+		return o
+	case catalog.Trigger:
+		o.Schema = ""
+		return o
+	case catalog.Event:
+		o.Schema = ""
+		return o
+	}
+	return o
+}
@@ -0,0 +1,246 @@
+// Package snapshot saves the catalog of a schema to versionable JSON or YAML
+// files, detects the drift of a live schema from a snapshot and keeps loaded
+// snapshots to answer schema questions while disconnected.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/datastore"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatVersion is the version of the snapshot format written by this package
+const FormatVersion = 1
+
+// Snapshot is the catalog of a schema at a point in time. Statistics and
+// timestamps of the objects are left out, so that snapshots of an unchanged
+// schema only differ by TakenAt.
+type Snapshot struct {
+	Version int    `json:"version"`
+	Schema  string `json:"schema"`
+	// Profile is the connection profile the snapshot was taken with, empty for
+	// connections with explicit parameters
+	Profile  string            `json:"profile,omitempty"`
+	TakenAt  time.Time         `json:"taken_at"`
+	Tables   []catalog.Table   `json:"tables"`
+	Views    []catalog.View    `json:"views"`
+	Routines []catalog.Routine `json:"routines"`
+	Triggers []catalog.Trigger `json:"triggers"`
+	Events   []catalog.Event   `json:"events"`
+}
+
+// Take reads the snapshot of a schema of a connection of a profile
+func Take(ctx context.Context, ds datastore.DatastoreInterface, profile, schema string) (*Snapshot, error) {
+	s := catalog.InformationSchema{DS: ds}
+	f := catalog.ObjectFilter{Schema: schema, WithBodies: true}
+
+	tables, err := s.Schema(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	views, err := s.Views(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	routines, err := s.Routines(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	triggers, err := s.Triggers(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.Events(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tables {
+		tables[i].Rows = nil
+		tables[i].CreateTime = ""
+		tables[i].UpdateTime = ""
+	}
+	for i := range routines {
+		routines[i].Created = ""
+		routines[i].LastAltered = ""
+	}
+	for i := range triggers {
+		triggers[i].Created = ""
+	}
+	for i := range events {
+		events[i].LastExecuted = ""
+	}
+
+	return &Snapshot{
+		Version:  FormatVersion,
+		Schema:   schema,
+		Profile:  profile,
+		TakenAt:  time.Now().UTC().Truncate(time.Second),
+		Tables:   tables,
+		Views:    orEmpty(views),
+		Routines: orEmpty(routines),
+		Triggers: orEmpty(triggers),
+		Events:   orEmpty(events),
+	}, nil
+}
+
+// orEmpty replaces a nil list, so that lists are never null in files
+func orEmpty[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
+
+// Table returns a table of the snapshot
+func (s *Snapshot) Table(name string) (*catalog.Table, bool) {
+	for i := range s.Tables {
+		if s.Tables[i].Name == name {
+			return &s.Tables[i], true
+		}
+	}
+	return nil, false
+}
+
+// Format is the file format of a snapshot
+type Format string
+
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+)
+
+// Formats are the snapshot file formats, in the order of the tool enum
+var Formats = []string{string(JSON), string(YAML)}
+
+// FormatOf returns the format of a snapshot file by its extension
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON, nil
+	case ".yaml", ".yml":
+		return YAML, nil
+	}
+	return "", fmt.Errorf("unknown snapshot format of %s, expected a .json, .yaml or .yml file", path)
+}
+
+// Marshal encodes the snapshot. Both formats use the JSON field names and order.
+func (s *Snapshot) Marshal(format Format) ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	switch format {
+	case JSON:
+		return append(data, '\n'), nil
+	case YAML:
+		// JSON is YAML: re-encode the document in block style
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, fmt.Errorf("failed to marshal snapshot: %w", err)
+		}
+		blockStyle(&node)
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return nil, fmt.Errorf("failed to marshal snapshot: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("invalid format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// blockStyle drops the flow style and quotes of a node, the encoder quotes the
+// strings that need it
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// Parse decodes a snapshot
+func Parse(data []byte, format Format) (*Snapshot, error) {
+	if format == YAML {
+		var document interface{}
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("invalid snapshot: %w", err)
+		}
+		var err error
+		if data, err = json.Marshal(document); err != nil {
+			return nil, fmt.Errorf("invalid snapshot: %w", err)
+		}
+	}
+
+	s := &Snapshot{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if s.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, expected %d", s.Version, FormatVersion)
+	}
+	if s.Schema == "" {
+		return nil, fmt.Errorf("invalid snapshot: schema is missing")
+	}
+	return s, nil
+}
+
+// ListViews lists the views of the snapshot like InformationSchema.Views
+func (s *Snapshot) ListViews(f catalog.ObjectFilter) []catalog.View {
+	views := make([]catalog.View, len(s.Views))
+	for i, v := range s.Views {
+		if !f.WithBodies {
+			v.Body = ""
+		}
+		views[i] = v
+	}
+	return views
+}
+
+// ListRoutines lists the routines of the snapshot like InformationSchema.Routines
+func (s *Snapshot) ListRoutines(f catalog.ObjectFilter) []catalog.Routine {
+	routines := make([]catalog.Routine, len(s.Routines))
+	for i, r := range s.Routines {
+		if !f.WithBodies {
+			r.Body = ""
+		}
+		routines[i] = r
+	}
+	return routines
+}
+
+// ListTriggers lists the triggers of the snapshot like InformationSchema.Triggers
+func (s *Snapshot) ListTriggers(f catalog.ObjectFilter) []catalog.Trigger {
+	triggers := []catalog.Trigger{}
+	for _, t := range s.Triggers {
+		if f.Table != "" && t.Table != f.Table {
+			continue
+		}
+		if !f.WithBodies {
+			t.Body = ""
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers
+}
+
+// ListEvents lists the events of the snapshot like InformationSchema.Events
+func (s *Snapshot) ListEvents(f catalog.ObjectFilter) []catalog.Event {
+	events := make([]catalog.Event, len(s.Events))
+	for i, e := range s.Events {
+		if !f.WithBodies {
+			e.Body = ""
+		}
+		events[i] = e
+	}
+	return events
+}
@@ -0,0 +1,154 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bonyuta0204/mcp-mysql-client/pkg/catalog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr(s string) *string { return &s }
+
+// shop is a snapshot with values that YAML would read as other types unquoted
+var shop = &Snapshot{
+	Version: FormatVersion,
+	Schema:  "shop",
+	TakenAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	Tables: []catalog.Table{{
+		Schema: "shop", Name: "orders", Type: "BASE TABLE", Engine: "InnoDB", Comment: "yes",
+		Columns: []catalog.Column{
+			{Name: "id", Position: 1, Type: "int", Key: "PRI"},
+			{Name: "status", Position: 2, Type: "varchar(20)", Default: ptr("123")},
+		},
+		Indexes: []catalog.Index{{Name: catalog.PrimaryKey, Unique: true, Type: "BTREE", Columns: []catalog.IndexColumn{{Name: "id"}}}},
+	}},
+	Views:    []catalog.View{{Schema: "shop", Name: "open_orders", Body: "select `id`\nfrom `orders`\nwhere `status` = 'new'"}},
+	Routines: []catalog.Routine{{Schema: "shop", Name: "refresh", Type: "PROCEDURE", Parameters: []catalog.Parameter{{Position: 1, Name: "since", Mode: "IN", Type: "datetime"}}}},
+	Triggers: []catalog.Trigger{},
+	Events:   []catalog.Event{},
+}
+
+func TestMarshalParse(t *testing.T) {
+	for _, format := range []Format{JSON, YAML} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := shop.Marshal(format)
+			require.NoError(t, err)
+			parsed, err := Parse(data, format)
+			require.NoError(t, err)
+			assert.Equal(t, shop, parsed)
+		})
+	}
+
+	// YAML uses the JSON field names and order, in block style
+	data, err := shop.Marshal(YAML)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "version: 1\nschema: shop\ntaken_at: \"2024-05-01T10:00:00Z\"\ntables:\n  - schema: shop\n")
+	assert.Contains(t, string(data), "default: \"123\"")
+	assert.Contains(t, string(data), "body: |-\n      select `id`\n      from `orders`\n")
+
+	_, err = shop.Marshal("xml")
+	assert.EqualError(t, err, `invalid format "xml", expected one of json, yaml`)
+	_, err = Parse([]byte(`{"version": 2, "schema": "shop"}`), JSON)
+	assert.EqualError(t, err, "unsupported snapshot version 2, expected 1")
+	_, err = Parse([]byte("version: 1\n"), YAML)
+	assert.EqualError(t, err, "invalid snapshot: schema is missing")
+}
+
+func TestFormatOf(t *testing.T) {
+	for path, expected := range map[string]Format{"shop.json": JSON, "shop.YAML": YAML, "dir/shop.yml": YAML} {
+		format, err := FormatOf(path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, format, path)
+	}
+	_, err := FormatOf("shop.sql")
+	assert.Error(t, err)
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	st := NewStore(dir)
+
+	path, err := st.Save(shop, "", YAML)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "shop.yaml"), path)
+	// The temporary file is renamed into place
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	info, err := entries[0].Info()
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+	s, ok := st.Get("", "shop")
+	require.True(t, ok)
+	assert.Same(t, shop, s)
+
+	// Files of other directories are refused
+	for _, file := range []string{"../shop.json", "/tmp/shop.json", ".."} {
+		_, err = st.Save(shop, file, JSON)
+		assert.EqualError(t, err, `invalid snapshot file name "`+file+`"`)
+	}
+	_, err = NewStore("").Save(shop, "shop.json", JSON)
+	assert.EqualError(t, err, "no snapshot directory is configured, start the server with -snapshot-dir")
+
+	// An older snapshot of the same schema does not replace the latest
+	older := *shop
+	older.TakenAt = shop.TakenAt.Add(-time.Hour)
+	data, err := older.Marshal(JSON)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shop-old.json"), data, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a snapshot"), 0o644))
+	// A broken snapshot does not prevent loading the others
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o644))
+
+	loaded := NewStore(dir)
+	require.NoError(t, loaded.LoadDir())
+	require.Len(t, loaded.All(), 1)
+	assert.Equal(t, shop.TakenAt, loaded.All()[0].TakenAt)
+
+	s, err = loaded.Load("shop-old.json")
+	require.NoError(t, err)
+	assert.Equal(t, older.TakenAt, s.TakenAt)
+	s, _ = loaded.Get("", "shop")
+	assert.Equal(t, shop.TakenAt, s.TakenAt)
+
+	// The same schema of another profile is kept apart
+	staging := *shop
+	staging.Profile = "staging"
+	staging.TakenAt = shop.TakenAt.Add(-time.Hour)
+	path, err = st.Save(&staging, "", JSON)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "staging.shop.json"), path)
+	s, _ = st.Get("", "shop")
+	assert.Same(t, shop, s)
+	s, _ = st.Get("staging", "shop")
+	assert.Same(t, &staging, s)
+	assert.Len(t, st.All(), 2)
+}
+
+func TestCompare(t *testing.T) {
+	assert.True(t, Compare(shop, shop).Identical)
+
+	// The live schema has another name, a new column, a changed view and no routine
+	live := *shop
+	live.Schema = "shop_staging"
+	live.Tables = []catalog.Table{shop.Tables[0]}
+	live.Tables[0].Schema = "shop_staging"
+	live.Tables[0].Columns = append(append([]catalog.Column{}, shop.Tables[0].Columns...), catalog.Column{Name: "note", Position: 3, Type: "text", Nullable: true})
+	live.Views = []catalog.View{{Schema: "shop_staging", Name: "open_orders", Body: "select `id` from `orders`"}}
+	live.Routines = []catalog.Routine{}
+	live.Triggers = []catalog.Trigger{{Schema: "shop_staging", Name: "orders_audit", Table: "orders"}}
+
+	d := Compare(shop, &live)
+	assert.False(t, d.Identical)
+	assert.Equal(t, "shop_staging", d.Schema)
+	assert.Equal(t, "2024-05-01T10:00:00Z", d.TakenAt)
+	require.Len(t, d.Tables.ChangedTables, 1)
+	assert.Equal(t, "note", d.Tables.ChangedTables[0].AddedColumns[0].Name)
+	assert.Equal(t, ObjectDiff{Added: []string{}, Removed: []string{}, Changed: []string{"open_orders"}}, d.Views)
+	assert.Equal(t, ObjectDiff{Added: []string{}, Removed: []string{"PROCEDURE refresh"}, Changed: []string{}}, d.Routines)
+	assert.Equal(t, ObjectDiff{Added: []string{"orders_audit"}, Removed: []string{}, Changed: []string{}}, d.Triggers)
+}
@@ -0,0 +1,192 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Store keeps the latest snapshot of each schema of each connection profile and
+// saves snapshots to its directory
+type Store struct {
+	mu       sync.Mutex
+	dir      string
+	snapshot map[key]*Snapshot
+}
+
+// key identifies the snapshots of a schema, the schemas of different servers
+// having the same name
+type key struct {
+	profile string
+	schema  string
+}
+
+// NewStore creates a store saving snapshots to dir, snapshots are only kept in
+// memory if dir is empty
+func NewStore(dir string) *Store {
+	return &Store{dir: dir, snapshot: map[key]*Snapshot{}}
+}
+
+// Default is the store of the server, replaced at startup when a snapshot directory is set
+var Default = NewStore("")
+
+// Dir returns the directory snapshots are saved to, empty if snapshots are only kept in memory
+func (st *Store) Dir() string {
+	return st.dir
+}
+
+// Add keeps a snapshot, replacing an older snapshot of the same schema and profile
+func (st *Store) Add(s *Snapshot) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	k := key{s.Profile, s.Schema}
+	if old, ok := st.snapshot[k]; !ok || !old.TakenAt.After(s.TakenAt) {
+		st.snapshot[k] = s
+	}
+}
+
+// Get returns the latest snapshot of a schema of a connection profile
+func (st *Store) Get(profile, schema string) (*Snapshot, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	s, ok := st.snapshot[key{profile, schema}]
+	return s, ok
+}
+
+// All returns the latest snapshot of every schema, by profile and schema name
+func (st *Store) All() []*Snapshot {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	all := make([]*Snapshot, 0, len(st.snapshot))
+	for _, s := range st.snapshot {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Profile != all[j].Profile {
+			return all[i].Profile < all[j].Profile
+		}
+		return all[i].Schema < all[j].Schema
+	})
+	return all
+}
+
+// path returns the path of a snapshot file of the directory. Files are named
+// without directories so that tools cannot write elsewhere.
+func (st *Store) path(file string) (string, error) {
+	if st.dir == "" {
+		return "", fmt.Errorf("no snapshot directory is configured, start the server with -snapshot-dir")
+	}
+	if file == "" || file != filepath.Base(file) || file == ".." {
+		return "", fmt.Errorf("invalid snapshot file name %q", file)
+	}
+	return filepath.Join(st.dir, file), nil
+}
+
+// Save writes a snapshot to a file of the directory, by default named after
+// its profile and schema, and keeps it. It returns the path of the file.
+func (st *Store) Save(s *Snapshot, file string, format Format) (string, error) {
+	if file == "" {
+		file = s.Schema + "." + string(format)
+		if s.Profile != "" {
+			file = s.Profile + "." + file
+		}
+	}
+	path, err := st.path(file)
+	if err != nil {
+		return "", err
+	}
+	data, err := s.Marshal(format)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFile(path, data); err != nil {
+		return "", fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	st.Add(s)
+	return path, nil
+}
+
+// writeFile writes a snapshot file through a temporary file renamed into place,
+// so that a failed write never leaves a truncated snapshot behind
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads a snapshot file of the directory and keeps it
+func (st *Store) Load(file string) (*Snapshot, error) {
+	path, err := st.path(file)
+	if err != nil {
+		return nil, err
+	}
+	s, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	st.Add(s)
+	return s, nil
+}
+
+// LoadDir reads every snapshot file of the directory, keeping the latest of each
+// schema and profile. Files that cannot be read are skipped with a warning.
+func (st *Store) LoadDir() error {
+	if st.dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(st.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if _, err := FormatOf(e.Name()); err != nil {
+			continue
+		}
+		s, err := readFile(filepath.Join(st.dir, e.Name()))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipped snapshot file: %v\n", err)
+			continue
+		}
+		st.Add(s)
+	}
+	return nil
+}
+
+// readFile reads a snapshot file in the format of its extension
+func readFile(path string) (*Snapshot, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	s, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,431 @@
+package sqlutil
+
+import (
+	"strings"
+)
+
+// StatementClass groups SQL statements by their effect on the database
+type StatementClass string
+
+const (
+	ClassRead  StatementClass = "read"
+	ClassWrite StatementClass = "write"
+	ClassDDL   StatementClass = "ddl"
+	ClassOther StatementClass = "other"
+	// ClassAdmin manages accounts and the server
+	ClassAdmin StatementClass = "admin"
+)
+
+var classByKeyword = map[string]StatementClass{
+	"SELECT":    ClassRead,
+	"SHOW":      ClassRead,
+	"DESCRIBE":  ClassRead,
+	"DESC":      ClassRead,
+	"EXPLAIN":   ClassRead,
+	"TABLE":     ClassRead,
+	"VALUES":    ClassRead,
+	"INSERT":    ClassWrite,
+	"UPDATE":    ClassWrite,
+	"DELETE":    ClassWrite,
+	"REPLACE":   ClassWrite,
+	"LOAD":      ClassWrite,
+	"CREATE":    ClassDDL,
+	"ALTER":     ClassDDL,
+	"DROP":      ClassDDL,
+	"TRUNCATE":  ClassDDL,
+	"RENAME":    ClassDDL,
+	"GRANT":     ClassAdmin,
+	"REVOKE":    ClassAdmin,
+	"KILL":      ClassAdmin,
+	"SHUTDOWN":  ClassAdmin,
+	"RESTART":   ClassAdmin,
+	"INSTALL":   ClassAdmin,
+	"UNINSTALL": ClassAdmin,
+	"FLUSH":     ClassAdmin,
+	"RESET":     ClassAdmin,
+	"PURGE":     ClassAdmin,
+	"CLONE":     ClassAdmin,
+	"CHANGE":    ClassAdmin,
+}
+
+// adminObjects are the objects of CREATE, ALTER, DROP and RENAME statements
+// managing accounts rather than the schema
+var adminObjects = map[string]bool{
+	"USER": true,
+	"ROLE": true,
+}
+
+// adminSetTargets are the words of SET statements changing the configuration
+// of the server rather than the session
+var adminSetTargets = map[string]bool{
+	"GLOBAL":         true,
+	"PERSIST":        true,
+	"PERSIST_ONLY":   true,
+	"@@GLOBAL":       true,
+	"@@PERSIST":      true,
+	"@@PERSIST_ONLY": true,
+}
+
+// nondeterministicFunctions return a different value on every call
+var nondeterministicFunctions = map[string]bool{
+	"NOW":               true,
+	"SYSDATE":           true,
+	"CURDATE":           true,
+	"CURTIME":           true,
+	"CURRENT_DATE":      true,
+	"CURRENT_TIME":      true,
+	"CURRENT_TIMESTAMP": true,
+	"LOCALTIME":         true,
+	"LOCALTIMESTAMP":    true,
+	"UNIX_TIMESTAMP":    true,
+	"UTC_DATE":          true,
+	"UTC_TIME":          true,
+	"UTC_TIMESTAMP":     true,
+	"RAND":              true,
+	"UUID":              true,
+	"UUID_SHORT":        true,
+	"CONNECTION_ID":     true,
+	"LAST_INSERT_ID":    true,
+	"FOUND_ROWS":        true,
+	"ROW_COUNT":         true,
+	"SLEEP":             true,
+	"GET_LOCK":          true,
+	"RELEASE_LOCK":      true,
+	"IS_FREE_LOCK":      true,
+	"IS_USED_LOCK":      true,
+	"BENCHMARK":         true,
+	"NEXTVAL":           true,
+}
+
+// deterministicShowTargets are the SHOW statements describing the catalog rather than server state
+var deterministicShowTargets = map[string]bool{
+	"DATABASES": true,
+	"SCHEMAS":   true,
+	"TABLES":    true,
+	"FULL":      true,
+	"COLUMNS":   true,
+	"FIELDS":    true,
+	"INDEX":     true,
+	"INDEXES":   true,
+	"KEYS":      true,
+	"CREATE":    true,
+}
+
+// classRank orders the classes from the least to the most privileged
+var classRank = map[StatementClass]int{
+	ClassRead:  0,
+	ClassOther: 1,
+	ClassWrite: 2,
+	ClassDDL:   3,
+	ClassAdmin: 4,
+}
+
+// Classify returns the class of a statement based on its leading keyword. The
+// code of executable comments such as /*!50000 DELETE ... */ counts, and as
+// versioned comments only run on some servers, a statement that reads
+// differently without them gets the more privileged of both classes.
+func Classify(query string) StatementClass {
+	class := classify(keywords(query, true), topLevelKeywords(query, true))
+	if !strings.Contains(query, "/*!") {
+		return class
+	}
+	if without := classify(keywords(query, false), topLevelKeywords(query, false)); classRank[without] > classRank[class] {
+		return without
+	}
+	return class
+}
+
+func classify(words, topLevel []string) StatementClass {
+	if len(words) == 0 {
+		return ClassOther
+	}
+
+	class := ClassOther
+	switch {
+	case words[0] == "WITH":
+		// Common table expressions precede the statement they belong to, which
+		// is the first statement keyword outside of parentheses
+		class = ClassRead
+		for _, w := range topLevel[1:] {
+			if c, ok := classByKeyword[w]; ok {
+				class = c
+				break
+			}
+		}
+	case words[0] == "SET":
+		// SET PASSWORD and SET DEFAULT ROLE change accounts
+		if len(words) > 1 && (words[1] == "PASSWORD" || words[1] == "DEFAULT" && len(words) > 2 && words[2] == "ROLE") {
+			return ClassAdmin
+		}
+		for _, w := range words[1:] {
+			if adminSetTargets[w] {
+				return ClassAdmin
+			}
+		}
+	default:
+		if c, ok := classByKeyword[words[0]]; ok {
+			class = c
+		}
+	}
+
+	switch class {
+	case ClassDDL:
+		if len(words) > 1 && adminObjects[words[1]] {
+			return ClassAdmin
+		}
+	case ClassRead:
+		// SELECT ... INTO OUTFILE and DUMPFILE write files on the server
+		for i, w := range words[:len(words)-1] {
+			if w == "INTO" && (words[i+1] == "OUTFILE" || words[i+1] == "DUMPFILE") {
+				return ClassWrite
+			}
+		}
+	}
+	return class
+}
+
+// IsDeterministicRead reports whether a statement only reads data and returns
+// the same result as long as the data does not change
+func IsDeterministicRead(query string) bool {
+	if Classify(query) != ClassRead {
+		return false
+	}
+
+	words := Keywords(query)
+	if words[0] == "SHOW" && (len(words) < 2 || !deterministicShowTargets[words[1]]) {
+		return false
+	}
+
+	for i, w := range words {
+		if nondeterministicFunctions[w] {
+			return false
+		}
+		if strings.HasPrefix(w, "@") {
+			// User and system variables are session state
+			return false
+		}
+		switch w {
+		case "INTO":
+			// SELECT ... INTO @var or OUTFILE has side effects
+			return false
+		case "UPDATE", "SHARE":
+			// Locking reads (FOR UPDATE, FOR SHARE, LOCK IN SHARE MODE)
+			if i > 0 && (words[i-1] == "FOR" || words[i-1] == "IN") {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Keywords returns the upper-cased words of a statement outside of string
+// literals, quoted identifiers and comments, including the code of executable
+// comments and optimizer hints
+func Keywords(query string) []string {
+	return keywords(query, true)
+}
+
+// ContainsSymbol reports whether a statement contains a symbol such as ; outside
+// of string literals, quoted identifiers and comments, including the code of
+// executable comments and optimizer hints
+func ContainsSymbol(query, symbol string) bool {
+	found := false
+	scanCode(query, true, func(kind tokenKind, text string) {
+		if kind == tokenSymbol && text == symbol {
+			found = true
+		}
+	})
+	return found
+}
+
+// ReplaceCode returns the statement with each stretch of code outside of string
+// literals, quoted identifiers and comments replaced by fn, called in order
+func ReplaceCode(query string, fn func(code string) string) string {
+	var b, code strings.Builder
+	flush := func() {
+		if code.Len() > 0 {
+			b.WriteString(fn(code.String()))
+			code.Reset()
+		}
+	}
+	scan(query, func(kind tokenKind, text string) {
+		if kind == tokenQuoted || kind == tokenComment {
+			flush()
+			b.WriteString(text)
+			return
+		}
+		code.WriteString(text)
+	})
+	flush()
+	return b.String()
+}
+
+// keywords returns the words of a statement, with or without the code of executable comments
+func keywords(query string, executable bool) []string {
+	var words []string
+	scanCode(query, executable, func(kind tokenKind, text string) {
+		if kind == tokenWord {
+			words = append(words, strings.ToUpper(text))
+		}
+	})
+	return words
+}
+
+// topLevelKeywords returns the words of keywords that are not nested in parentheses
+func topLevelKeywords(query string, executable bool) []string {
+	var words []string
+	depth := 0
+	scanCode(query, executable, func(kind tokenKind, text string) {
+		switch {
+		case kind == tokenSymbol && text == "(":
+			depth++
+		case kind == tokenSymbol && text == ")":
+			depth--
+		case kind == tokenWord && depth == 0:
+			words = append(words, strings.ToUpper(text))
+		}
+	})
+	return words
+}
+
+// executableCode returns the code of a comment run by MySQL: /*! ... */ with an
+// optional minimum server version, or /*+ ... */ optimizer hints
+func executableCode(comment string) (string, bool) {
+	var code string
+	switch {
+	case strings.HasPrefix(comment, "/*!"):
+		code = strings.TrimLeft(comment[3:], "0123456789")
+	case strings.HasPrefix(comment, "/*+"):
+		code = comment[3:]
+	default:
+		return "", false
+	}
+	return strings.TrimSuffix(code, "*/"), true
+}
+
+// scanCode is scan reporting the tokens of the code of executable comments
+// instead of the comments when executable is set
+func scanCode(query string, executable bool, fn func(kind tokenKind, text string)) {
+	scan(query, func(kind tokenKind, text string) {
+		if code, ok := executableCode(text); executable && kind == tokenComment && ok {
+			scanCode(code, executable, fn)
+			return
+		}
+		fn(kind, text)
+	})
+}
+
+// Normalize removes comments and collapses whitespace outside of literals so
+// that equivalent statements compare equal. Executable comments are kept.
+func Normalize(query string) string {
+	var b strings.Builder
+	pendingSpace := false
+	scan(query, func(kind tokenKind, text string) {
+		if _, ok := executableCode(text); kind == tokenComment && !ok {
+			pendingSpace = true
+			return
+		}
+		switch kind {
+		case tokenSpace:
+			pendingSpace = true
+		default:
+			if pendingSpace && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			pendingSpace = false
+			b.WriteString(text)
+		}
+	})
+	return strings.TrimRight(b.String(), "; ")
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenQuoted
+	tokenComment
+	tokenSpace
+	tokenSymbol
+)
+
+// scan splits a statement into tokens and calls fn for each of them
+func scan(query string, fn func(kind tokenKind, text string)) {
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quoteEnd(query, i)
+			fn(tokenQuoted, query[i:end])
+			i = end
+		case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "--") && (i+2 == len(query) || isSpace(query[i+2]))):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			fn(tokenComment, query[i:i+end])
+			i += end
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			fn(tokenComment, query[i:i+end])
+			i += end
+		case isSpace(c):
+			end := i + 1
+			for end < len(query) && isSpace(query[end]) {
+				end++
+			}
+			fn(tokenSpace, query[i:end])
+			i = end
+		case isWordChar(c):
+			end := i + 1
+			for end < len(query) && isWordChar(query[end]) {
+				end++
+			}
+			fn(tokenWord, query[i:end])
+			i = end
+		default:
+			fn(tokenSymbol, query[i:i+1])
+			i++
+		}
+	}
+}
+
+// quoteEnd returns the index after the closing quote of the literal starting at start
+func quoteEnd(query string, start int) int {
+	end, _ := findQuoteEnd(query, start)
+	return end
+}
+
+// findQuoteEnd is quoteEnd reporting whether the literal is terminated
+func findQuoteEnd(query string, start int) (int, bool) {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		if query[i] == '\\' && quote != '`' {
+			i++
+			continue
+		}
+		if query[i] == quote {
+			// A doubled quote is an escaped quote
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, true
+		}
+	}
+	return len(query), false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
@@ -0,0 +1,104 @@
+package sqlutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected StatementClass
+	}{
+		{query: "SELECT * FROM users", expected: ClassRead},
+		{query: "  /* hint */ select 1", expected: ClassRead},
+		{query: "-- comment\nSHOW TABLES", expected: ClassRead},
+		{query: "WITH t AS (SELECT 1) SELECT * FROM t", expected: ClassRead},
+		{query: "WITH t AS (SELECT 1) DELETE FROM users", expected: ClassWrite},
+		{query: "insert into users values (1)", expected: ClassWrite},
+		{query: "CREATE TABLE t (id INT)", expected: ClassDDL},
+		{query: "TRUNCATE users", expected: ClassDDL},
+		{query: "SET @a = 1", expected: ClassOther},
+		{query: "SET sql_mode = DEFAULT", expected: ClassOther},
+		{query: "SELECT * FROM users INTO OUTFILE '/tmp/users'", expected: ClassWrite},
+		{query: "SELECT payload INTO DUMPFILE '/tmp/payload' FROM blobs", expected: ClassWrite},
+		{query: "SELECT id INTO @id FROM users", expected: ClassRead},
+		{query: "GRANT ALL ON *.* TO 'app'@'%'", expected: ClassAdmin},
+		{query: "CREATE USER 'app'@'%'", expected: ClassAdmin},
+		{query: "DROP ROLE reader", expected: ClassAdmin},
+		{query: "SET PASSWORD FOR 'app'@'%' = 'secret'", expected: ClassAdmin},
+		{query: "SET GLOBAL max_connections = 1", expected: ClassAdmin},
+		{query: "SET @@global.read_only = 1", expected: ClassAdmin},
+		{query: "KILL 42", expected: ClassAdmin},
+		{query: "SHUTDOWN", expected: ClassAdmin},
+		{query: "INSTALL PLUGIN audit SONAME 'audit.so'", expected: ClassAdmin},
+		{query: "/*!50000 DELETE FROM users */", expected: ClassWrite},
+		{query: "/*!UPDATE users SET name = 'a' */", expected: ClassWrite},
+		{query: "/*!40101 DROP TABLE users */;", expected: ClassDDL},
+		{query: "SELECT /*!40001 SQL_NO_CACHE */ * FROM users", expected: ClassRead},
+		{query: "CREATE TABLE t (id INT) /*!50100 PARTITION BY HASH (id) */", expected: ClassDDL},
+		// Read on servers running the versioned comment, a delete on the others
+		{query: "/*!99999 SELECT 1 FROM (*/ DELETE FROM users /*!99999 ) */", expected: ClassWrite},
+		{query: "", expected: ClassOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Classify(tt.query))
+		})
+	}
+}
+
+func TestIsDeterministicRead(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{query: "SELECT * FROM users", expected: true},
+		{query: "SELECT 'NOW()' AS label", expected: true},
+		{query: "SHOW TABLES", expected: true},
+		{query: "SHOW FULL COLUMNS FROM users", expected: true},
+		{query: "SELECT NOW()", expected: false},
+		{query: "select rand() from users", expected: false},
+		{query: "SELECT * FROM users FOR UPDATE", expected: false},
+		{query: "SELECT * FROM users LOCK IN SHARE MODE", expected: false},
+		{query: "SELECT id INTO @id FROM users", expected: false},
+		{query: "SHOW PROCESSLIST", expected: false},
+		{query: "SELECT @x", expected: false},
+		{query: "SELECT /*!NOW() AS */ 1", expected: false},
+		{query: "SELECT * FROM users WHERE id = @id", expected: false},
+		{query: "SELECT @@time_zone", expected: false},
+		{query: "SELECT * FROM users WHERE email = 'a@b.c'", expected: true},
+		{query: "UPDATE users SET name = 'a'", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsDeterministicRead(tt.query))
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "SELECT * FROM users WHERE name = 'a  b'", Normalize("SELECT *\n  FROM users -- all\n WHERE name = 'a  b';"))
+	assert.Equal(t, Normalize("select 1"), Normalize("/* x */ select   1 ;"))
+	assert.Equal(t, "SELECT * FROM users /*!50000 WHERE id = 1 */", Normalize("SELECT *  FROM users /*!50000 WHERE id = 1 */"))
+}
+
+func TestReplaceCode(t *testing.T) {
+	var code []string
+	replaced := ReplaceCode("SELECT 'a' FROM `t` -- c\nWHERE x = 1 /* d */", func(s string) string {
+		code = append(code, s)
+		return strings.ToLower(s)
+	})
+	assert.Equal(t, []string{"SELECT ", " FROM ", " ", "\nWHERE x = 1 "}, code)
+	assert.Equal(t, "select 'a' from `t` -- c\nwhere x = 1 /* d */", replaced)
+}
+
+func TestContainsSymbol(t *testing.T) {
+	assert.True(t, ContainsSymbol("id > 1; DROP TABLE users", ";"))
+	assert.True(t, ContainsSymbol("id > 1 /*!50000 ; */", ";"))
+	assert.False(t, ContainsSymbol("name = 'a;b' -- ;", ";"))
+}
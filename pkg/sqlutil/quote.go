@@ -0,0 +1,24 @@
+package sqlutil
+
+import "strings"
+
+// QuoteIdentifier quotes a schema, table or column name with backticks
+func QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// QuoteQualified quotes a name qualified by its schema, if any
+func QuoteQualified(schema, name string) string {
+	if schema == "" {
+		return QuoteIdentifier(name)
+	}
+	return QuoteIdentifier(schema) + "." + QuoteIdentifier(name)
+}
+
+// stringEscaper escapes the characters of a string literal that MySQL reads specially
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`)
+
+// QuoteString quotes a string literal with single quotes
+func QuoteString(value string) string {
+	return "'" + stringEscaper.Replace(value) + "'"
+}
@@ -0,0 +1,20 @@
+package sqlutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	assert.Equal(t, "`users`", QuoteIdentifier("users"))
+	assert.Equal(t, "`odd``name`", QuoteIdentifier("odd`name"))
+	assert.Equal(t, "`shop`.`orders`", QuoteQualified("shop", "orders"))
+	assert.Equal(t, "`orders`", QuoteQualified("", "orders"))
+}
+
+func TestQuoteString(t *testing.T) {
+	assert.Equal(t, "'paid'", QuoteString("paid"))
+	assert.Equal(t, `'it\'s a \\ path\n'`, QuoteString("it's a \\ path\n"))
+	assert.Equal(t, `'\0\Z'`, QuoteString("\x00\x1a"))
+}
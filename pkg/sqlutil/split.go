@@ -0,0 +1,98 @@
+package sqlutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// delimiterCommand is the mysql client command changing the statement delimiter
+const delimiterCommand = "DELIMITER"
+
+// Split splits a script into statements like the mysql client does. Delimiters
+// inside string literals, quoted identifiers and comments are ignored, and a
+// DELIMITER line changes the delimiter of the following statements. The
+// statements are returned without their delimiter; empty ones are dropped.
+func Split(script string) ([]string, error) {
+	var statements []string
+	delimiter := ";"
+	start := 0
+	// hasContent is set once the current statement has more than spaces and comments
+	hasContent := false
+
+	flush := func(end int) {
+		if hasContent {
+			statements = append(statements, strings.TrimSpace(script[start:end]))
+		}
+		hasContent = false
+	}
+
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case !hasContent && isDelimiterCommand(script[i:]):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			fields := strings.Fields(script[i : i+end])
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("line %d: DELIMITER requires a delimiter", lineOf(script, i))
+			}
+			delimiter = fields[1]
+			i += end
+			start = i
+
+		case strings.HasPrefix(script[i:], delimiter):
+			flush(i)
+			i += len(delimiter)
+			start = i
+
+		case c == '\'' || c == '"' || c == '`':
+			end, ok := findQuoteEnd(script, i)
+			if !ok {
+				return nil, fmt.Errorf("line %d: unterminated quoted string", lineOf(script, i))
+			}
+			hasContent = true
+			i = end
+
+		case c == '#' || (c == '-' && strings.HasPrefix(script[i:], "--") && (i+2 == len(script) || isSpace(script[i+2]))):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			i += end
+
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", lineOf(script, i))
+			}
+			// Executable comments and optimizer hints are part of the statement
+			if strings.HasPrefix(script[i:], "/*!") || strings.HasPrefix(script[i:], "/*+") {
+				hasContent = true
+			}
+			i += end + 4
+
+		case isSpace(c):
+			i++
+
+		default:
+			hasContent = true
+			i++
+		}
+	}
+	flush(len(script))
+
+	return statements, nil
+}
+
+// isDelimiterCommand reports whether s starts with a DELIMITER command
+func isDelimiterCommand(s string) bool {
+	n := len(delimiterCommand)
+	return len(s) >= n && strings.EqualFold(s[:n], delimiterCommand) && (len(s) == n || isSpace(s[n]))
+}
+
+// lineOf returns the line number of the offset
+func lineOf(script string, offset int) int {
+	return strings.Count(script[:offset], "\n") + 1
+}
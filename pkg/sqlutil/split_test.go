@@ -0,0 +1,86 @@
+package sqlutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		expected []string
+	}{
+		{
+			name:     "single statement without delimiter",
+			script:   "SELECT 1",
+			expected: []string{"SELECT 1"},
+		},
+		{
+			name:     "several statements",
+			script:   "SET @a = 1;\nCREATE TEMPORARY TABLE t (id INT);\n\nSELECT @a;  ",
+			expected: []string{"SET @a = 1", "CREATE TEMPORARY TABLE t (id INT)", "SELECT @a"},
+		},
+		{
+			name:     "delimiters in literals",
+			script:   `SELECT 'a;b', "c;d", ` + "`e;f`" + `; SELECT 'it''s;', 'x\';'`,
+			expected: []string{`SELECT 'a;b', "c;d", ` + "`e;f`", `SELECT 'it''s;', 'x\';'`},
+		},
+		{
+			name:     "delimiters in comments",
+			script:   "-- first; statement\nSELECT 1; # trailing; comment\n/* block; comment */ SELECT 2;\n-- only a comment;",
+			expected: []string{"-- first; statement\nSELECT 1", "# trailing; comment\n/* block; comment */ SELECT 2"},
+		},
+		{
+			name:     "executable comments",
+			script:   "/*!40101 SET NAMES utf8mb4 */;\nSELECT 1",
+			expected: []string{"/*!40101 SET NAMES utf8mb4 */", "SELECT 1"},
+		},
+		{
+			name: "delimiter changes",
+			script: "DROP PROCEDURE IF EXISTS p;\n" +
+				"DELIMITER $$\n" +
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND$$\n" +
+				"delimiter ;\n" +
+				"CALL p();",
+			expected: []string{
+				"DROP PROCEDURE IF EXISTS p",
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND",
+				"CALL p()",
+			},
+		},
+		{
+			name:     "empty statements",
+			script:   ";; \n ;",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := Split(tt.script)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, statements)
+		})
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		err    string
+	}{
+		{script: "SELECT 1;\nSELECT 'unterminated", err: "line 2: unterminated quoted string"},
+		{script: "SELECT 1 /* unterminated", err: "line 1: unterminated comment"},
+		{script: "SELECT 1;\nDELIMITER\nSELECT 2", err: "line 2: DELIMITER requires a delimiter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			_, err := Split(tt.script)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
@@ -2,14 +2,77 @@ package utils
 
 import (
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"unicode/utf8"
 )
 
+// FormatQueryResultAsJson formats the result of a SQL query as a JSON array of objects
 func FormatQueryResultAsJson(rows *sql.Rows) (string, error) {
+	result, _, err := FormatQueryResultAsJsonWithCount(rows)
+	return result, err
+}
+
+// FormatQueryResultAsJsonWithCount formats the result like FormatQueryResultAsJson
+// and also returns the number of rows read
+func FormatQueryResultAsJsonWithCount(rows *sql.Rows) (string, int, error) {
+	return FormatQueryResultAsJsonWithOptions(rows, FormatOptions{})
+}
+
+// FormatOptions shorten the values of a result
+type FormatOptions struct {
+	// MaxValueLength truncates longer values to this number of characters, zero
+	// keeps values whole
+	MaxValueLength int
+	// SummarizeBinary replaces binary values by their length and a hex prefix
+	SummarizeBinary bool
+}
+
+// binaryPrefixLength is the number of bytes of binary summaries shown in hex
+const binaryPrefixLength = 16
+
+// binaryTypes are the column types holding bytes rather than text
+var binaryTypes = map[string]bool{
+	"BINARY": true, "VARBINARY": true, "TINYBLOB": true, "BLOB": true, "MEDIUMBLOB": true, "LONGBLOB": true, "GEOMETRY": true, "BIT": true,
+}
+
+// format shortens a value according to the options. Values that are not valid
+// UTF-8 are binary whatever the type of their column.
+func (o FormatOptions) format(value string, binary bool) string {
+	if o.SummarizeBinary && (binary || !utf8.ValidString(value)) {
+		prefix := value[:min(len(value), binaryPrefixLength)]
+		ellipsis := ""
+		if len(value) > binaryPrefixLength {
+			ellipsis = "..."
+		}
+		return fmt.Sprintf("<binary %d bytes: %s%s>", len(value), hex.EncodeToString([]byte(prefix)), ellipsis)
+	}
+
+	if o.MaxValueLength > 0 && utf8.RuneCountInString(value) > o.MaxValueLength {
+		runes := []rune(value)
+		return fmt.Sprintf("%s... (%d characters)", string(runes[:o.MaxValueLength]), len(runes))
+	}
+	return value
+}
+
+// FormatQueryResultAsJsonWithOptions formats the result like FormatQueryResultAsJsonWithCount,
+// shortening long and binary values
+func FormatQueryResultAsJsonWithOptions(rows *sql.Rows, opts FormatOptions) (string, int, error) {
 	columns, err := rows.Columns()
 	if err != nil {
-		return "", fmt.Errorf("failed to get column names: %w", err)
+		return "", 0, fmt.Errorf("failed to get column names: %w", err)
+	}
+
+	binary := make([]bool, len(columns))
+	if opts.SummarizeBinary {
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to get column types: %w", err)
+		}
+		for i, t := range types {
+			binary[i] = binaryTypes[t.DatabaseTypeName()]
+		}
 	}
 
 	var results = []map[string]string{}
@@ -24,7 +87,7 @@ func FormatQueryResultAsJson(rows *sql.Rows) (string, error) {
 		// Scan the row into values
 		err := rows.Scan(valuesPtrs...)
 		if err != nil {
-			return "", fmt.Errorf("failed to scan row: %w", err)
+			return "", 0, fmt.Errorf("failed to scan row: %w", err)
 		}
 
 		// Convert values to strings and add to result
@@ -32,7 +95,7 @@ func FormatQueryResultAsJson(rows *sql.Rows) (string, error) {
 		for i, col := range columns {
 			v := values[i]
 			if v.Valid {
-				result[col] = v.String
+				result[col] = opts.format(v.String, binary[i])
 			} else {
 				result[col] = "NULL"
 			}
@@ -42,15 +105,15 @@ func FormatQueryResultAsJson(rows *sql.Rows) (string, error) {
 
 	// Check for errors from iterating over rows
 	if err := rows.Err(); err != nil {
-		return "", fmt.Errorf("error iterating over rows: %w", err)
+		return "", 0, fmt.Errorf("error iterating over rows: %w", err)
 	}
 
 	json, err := json.MarshalIndent(results, "", "  ")
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal results to JSON: %w", err)
+		return "", 0, fmt.Errorf("failed to marshal results to JSON: %w", err)
 	}
 
-	return string(json), nil
+	return string(json), len(results), nil
 }
 
 // FormatQueryResult formats the result of a SQL query as a markdown table